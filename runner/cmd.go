@@ -68,9 +68,13 @@ func App() {
 						Aliases: []string{"http"},
 						Usage:   "Set a http port",
 					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Print the resolved container spec of the job as JSON and exit without running it",
+					},
 				},
 				Action: func(c *cli.Context) error {
-					start(c.Int("log-level"), c.Int("http-port"), c.String("config-dir"))
+					start(c.Int("log-level"), c.Int("http-port"), c.String("config-dir"), c.Bool("dry-run"))
 					return nil
 				},
 			},
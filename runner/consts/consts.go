@@ -10,6 +10,12 @@ const USER_ARTIFACTS_DIR = "artifacts"
 const FUSE_DIR = "fuse"
 const RUNS_DIR = "runs"
 
+// GIT_MIRRORS_DIR keeps bare mirrors of the job repos, shared by the jobs on the host
+const GIT_MIRRORS_DIR = "git-mirrors"
+
+// ENV_FILES_DIR keeps the rendered job env files in memory, the runs dir is used if the host has no /dev/shm
+const ENV_FILES_DIR = "/dev/shm/dstack-env"
+
 const FILE_LOCK_FULL_DOWNLOAD = ".lock.full"
 
 // ServerUrl A default build-time variable. The value is overridden via ldflags.
@@ -23,18 +29,177 @@ const (
 	NVIDIA_SMI_CMD           = "nvidia-smi --query-gpu=name,memory.total --format=csv,noheader"
 	NVIDIA_RUNTIME           = "nvidia"
 	NVIDIA_DRIVER_INIT_ERROR = "stderr: nvidia-container-cli: initialization error: nvml error: driver not loaded: unknown"
+	NVIDIA_SMI_STATS_CMD     = "nvidia-smi --query-gpu=index,utilization.gpu,memory.used,memory.total --format=csv,noheader,nounits"
+)
+
+// CHECKSUMS_SUFFIX is appended to the artifact or build diff key to store SHA-256 digests in the sha256sum format
+const CHECKSUMS_SUFFIX = ".sha256"
+
+// CACHE_MANIFEST_FILE keeps sizes and last-used timestamps of the workflow caches
+const CACHE_MANIFEST_FILE = ".manifest.yaml"
+
+// OUTPUTS_FILE is where the job writes its key=value outputs, relative to the workflow dir
+const OUTPUTS_FILE = DSTACK_DIR_PATH + "/outputs"
+
+// MAX_OUTPUTS_SIZE limits the outputs file, the outputs are kept in the job state
+const MAX_OUTPUTS_SIZE = 64 * 1024
+
+// DEFAULT_MASTER_PORT is the torch.distributed default
+const DEFAULT_MASTER_PORT = 29500
+
+const DELAY_HEARTBEAT = 30 * time.Second
+
+// LEASE_TTL_HEARTBEATS is the number of missed heartbeats after which the runner lease expires
+const LEASE_TTL_HEARTBEATS = 3
+
+// RESULT_LOG_LINES is the number of the last job log lines kept in the failure summary
+const RESULT_LOG_LINES = 50
+
+const DELAY_GPU_STATS = 30 * time.Second
+const MAX_GPU_STATS_SAMPLES = 60
+
+// DELAY_USAGE_STATS is how often the resource usage of the job container is written to the job log
+const DELAY_USAGE_STATS = 60 * time.Second
+
+// DELAY_COST is how often the cost estimate of a running job is written to the job state
+const DELAY_COST = 5 * time.Minute
+
+// The local log files are rotated at LOG_MAX_SIZE_MIB, the logs directory is capped at LOG_MAX_TOTAL_MIB
+const (
+	LOG_MAX_SIZE_MIB  = 64
+	LOG_MAX_TOTAL_MIB = 1024
 )
 
+// The container ports of the dev environment servers
+const (
+	DEV_ENV_SSH_PORT         = 10022
+	DEV_ENV_CODE_SERVER_PORT = 10080
+)
+
+// DELAY_IDLE_CHECK is how often the connections to a dev environment are checked
+const DELAY_IDLE_CHECK = time.Minute
+
+// DELAY_PROBE and PROBE_TIMEOUT are the defaults of the app readiness probes
+const DELAY_PROBE = 2 * time.Second
+const PROBE_TIMEOUT = 5 * time.Second
+
 // JOB ports
 const (
 	EXPOSE_PORT_START = 3000
 	EXPOSE_PORT_END   = 4000
 )
 
-const MAX_ATTEMPTS = 10
-const DELAY_TRY = 6 * time.Second
+const MAX_PORT_BINDING_ATTEMPTS = 3
+
+// RETRY_* are the default backoff of the backend calls, see Config.Retry. RETRY_MAX_ELAPSED also covers the wait
+// for the job file of a fresh runner.
+const (
+	RETRY_INITIAL_DELAY = time.Second
+	RETRY_MAX_DELAY     = 15 * time.Second
+	RETRY_MAX_ELAPSED   = 2 * time.Minute
+	RETRY_JITTER        = 0.5
+)
+
+const MAX_CONTAINER_RETRY_BACKOFF = 10 * time.Minute
+
+// DEFAULT_EXIT_CODE_ATTEMPTS limits the restarts on the retry exit codes of the jobs without a container retry policy
+const DEFAULT_EXIT_CODE_ATTEMPTS = 3
+
+// UPDATE_STATE_MAX_ELAPSED limits the retries of a job state write, the job updates wait for it under the lock
+const UPDATE_STATE_MAX_ELAPSED = 15 * time.Second
+
+// DEFAULT_MAX_OFFLINE is how long the job state updates are queued while the backend is unreachable before the job fails
+const DEFAULT_MAX_OFFLINE = 30 * time.Minute
+
+const DEFAULT_HOOK_TIMEOUT = 10 * time.Minute
+
+// WEBHOOK_TIMEOUT limits a webhook delivery attempt, WEBHOOK_FLUSH_TIMEOUT the delivery of the pending events at the job end
+const (
+	WEBHOOK_TIMEOUT       = 10 * time.Second
+	WEBHOOK_FLUSH_TIMEOUT = 30 * time.Second
+	WEBHOOK_ATTEMPTS      = 3
+)
 
 const DELAY_READ_STATUS = 5 * time.Second
+const DELAY_GITHUB_APP_TOKEN_REFRESH = time.Minute
+const DELAY_FUSE_HEALTH_CHECK = 30 * time.Second
+const FUSE_MOUNT_TIMEOUT = 10 * time.Second
 
 const REPO_HTTPS_URL = "https://%s/%s/%s.git"
 const REPO_GIT_URL = "git@%s:%s/%s.git"
+
+// CAPABILITIES_DIR keeps the capability records the runners publish on start
+const CAPABILITIES_DIR = "capabilities"
+
+// SCALING_DIR keeps the traffic signals of the service jobs the hub scales the replicas by
+const SCALING_DIR = "scaling"
+
+const DELAY_SCALING_SIGNALS = 15 * time.Second
+
+// VOLUMES_DIR keeps the mount points of the persistent volumes in the runner config dir
+const VOLUMES_DIR = "volumes"
+
+// VOLUME_ATTACH_TIMEOUT limits the wait for a volume to be attached or detached and for its device to appear
+const VOLUME_ATTACH_TIMEOUT = 5 * time.Minute
+
+// DELAY_CHECK_INTERRUPTION is how often the instance of a job with a checkpoint is checked for the interruption
+const DELAY_CHECK_INTERRUPTION = 5 * time.Second
+
+// DAEMONS_DIR keeps the registrations of the persistent runners
+const DAEMONS_DIR = "daemons"
+
+// QUEUE_PREFIX is the key prefix of the pending jobs claimed by the persistent runners
+const QUEUE_PREFIX = "queue/job-"
+
+const DELAY_QUEUE_POLL = 10 * time.Second
+
+// DIND_IMAGE is the sidecar daemon of the jobs with the nested Docker, DIND_HOST is its address in the job container
+const (
+	DIND_IMAGE = "docker:dind"
+	DIND_HOST  = "tcp://localhost:2375"
+)
+
+// DELAY_QUEUE_CLAIM is how long a claim must survive before the job is run, the other runners may overwrite it meanwhile
+const DELAY_QUEUE_CLAIM = 3 * time.Second
+
+// MIN_FREE_DISK_MIB is the disk space a job needs on the workdir and the Docker root to start
+const MIN_FREE_DISK_MIB = 2048
+
+// GC_MAX_AGE is the age of the stopped containers and the builds pruned between the jobs of a persistent runner
+const GC_MAX_AGE = 24 * time.Hour
+
+// SIGNATURE_SUFFIX is appended to the build diff key to store its cosign signature
+const SIGNATURE_SUFFIX = ".sig"
+
+// SBOM_SUFFIX and PROVENANCE_SUFFIX are appended to the build diff key to store its SBOM and its in-toto provenance
+const (
+	SBOM_SUFFIX       = ".sbom.json"
+	PROVENANCE_SUFFIX = ".provenance.json"
+)
+
+// HF_TOKEN_SECRET is the secret with the Hugging Face token if the job names no other
+const HF_TOKEN_SECRET = "HF_TOKEN"
+
+// HF_PUBLISH_TIMEOUT limits the publishing of the artifacts to the Hugging Face Hub
+const HF_PUBLISH_TIMEOUT = 2 * time.Hour
+
+// WANDB_KEY_SECRET and MLFLOW_TOKEN_SECRET are the secrets of the trackers if the job names no others
+const (
+	WANDB_KEY_SECRET    = "WANDB_API_KEY"
+	MLFLOW_TOKEN_SECRET = "MLFLOW_TRACKING_TOKEN"
+)
+
+// DVC_IMAGE runs dvc pull if the job names no other image with DVC
+const DVC_IMAGE = "iterativeai/cml:latest"
+
+// DVC_PULL_TIMEOUT limits the pull of the DVC-tracked data before the job
+const DVC_PULL_TIMEOUT = 2 * time.Hour
+
+// RUNNER_BINARIES_DIR is the key prefix of the runner binaries by version, the runners download the version pinned by the job
+const RUNNER_BINARIES_DIR = "runners/bin"
+
+// RUNNER_DOWNLOAD_TIMEOUT limits the download of the pinned runner binary
+const RUNNER_DOWNLOAD_TIMEOUT = 10 * time.Minute
+
+// ENV_RUNNER_UPDATED is the version the runner was updated to, the re-executed runner doesn't update again
+const ENV_RUNNER_UPDATED = "DSTACK_RUNNER_UPDATED"
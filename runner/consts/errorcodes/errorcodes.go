@@ -4,4 +4,10 @@ const (
 	ContainerExitedWithError = "container_exited_with_error"
 	BuildNotFound            = "build_not_found"
 	PortsBindingFailed       = "ports_binding_failed"
+	ChecksumMismatch         = "checksum_mismatch"
+	NoDiskSpace              = "no_disk_space"
+	ImageSignatureInvalid    = "image_signature_invalid"
+	ContainerOOM             = "container_oom"
+	WorkingDirInvalid        = "working_dir_invalid"
+	PlatformEmulated         = "platform_emulated"
 )
@@ -6,7 +6,10 @@ const (
 	Failed      = "failed"
 	Stopped     = "stopped"
 	Downloading = "downloading"
+	Pulling     = "pulling"
 	Building    = "building"
 	Uploading   = "uploading"
 	Stopping    = "stopping"
+	// Preempted is the end of a job stopped for a job of a higher priority
+	Preempted = "preempted"
 )
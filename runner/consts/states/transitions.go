@@ -0,0 +1,36 @@
+package states
+
+// progress orders the statuses of a running job, a job never goes back
+var progress = map[string]int{
+	Downloading: 1,
+	Pulling:     2,
+	Building:    3,
+	Running:     4,
+	Uploading:   5,
+	Stopping:    6,
+}
+
+// IsFinal checks the job has ended
+func IsFinal(status string) bool {
+	return status == Done || status == Failed || status == Stopped || status == Preempted
+}
+
+// CanTransit checks the job may go from one status to the other. The final statuses are never left,
+// the hub may request a stop at any moment, and a stopping job only uploads the artifacts before it ends.
+// The statuses set by the hub before the runner starts, e.g. submitted, may go anywhere.
+func CanTransit(from, to string) bool {
+	if from == to {
+		return true
+	}
+	if IsFinal(from) {
+		return false
+	}
+	if IsFinal(to) || to == Stopping {
+		return true
+	}
+	if from == Stopping {
+		return to == Uploading
+	}
+	rank, known := progress[from]
+	return !known || progress[to] > rank
+}
@@ -0,0 +1,23 @@
+package states
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransit(t *testing.T) {
+	assert.Equal(t, true, CanTransit("submitted", Downloading))
+	assert.Equal(t, true, CanTransit(Downloading, Running))
+	assert.Equal(t, true, CanTransit(Running, Running))
+	assert.Equal(t, true, CanTransit(Running, Failed))
+	assert.Equal(t, true, CanTransit(Building, Stopping))
+	assert.Equal(t, true, CanTransit(Stopping, Uploading))
+	assert.Equal(t, true, CanTransit(Stopping, Stopped))
+	assert.Equal(t, false, CanTransit(Running, Building))
+	assert.Equal(t, false, CanTransit(Stopping, Running))
+	assert.Equal(t, false, CanTransit(Failed, Stopped))
+	assert.Equal(t, false, CanTransit(Done, Failed))
+	assert.Equal(t, true, CanTransit(Running, Preempted))
+	assert.Equal(t, false, CanTransit(Preempted, Running))
+}
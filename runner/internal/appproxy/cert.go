@@ -0,0 +1,72 @@
+package appproxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+const (
+	selfSignedCertFile = "app_proxy_cert.pem"
+	selfSignedKeyFile  = "app_proxy_key.pem"
+	selfSignedValidity = 365 * 24 * time.Hour
+)
+
+// selfSigned returns the certificate generated in the config dir on the first start, the browsers keep trusting it
+// once accepted. It is generated anew when it expires.
+func selfSigned(configDir, domain string) (string, string, error) {
+	certFile := filepath.Join(configDir, selfSignedCertFile)
+	keyFile := filepath.Join(configDir, selfSignedKeyFile)
+	if contents, err := os.ReadFile(certFile); err == nil {
+		if block, _ := pem.Decode(contents); block != nil {
+			if cert, err := x509.ParseCertificate(block.Bytes); err == nil && time.Now().Before(cert.NotAfter) {
+				return certFile, keyFile, nil
+			}
+		}
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	hosts := []string{"localhost"}
+	if domain != "" {
+		hosts = append(hosts, domain, "*."+domain)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{Organization: []string{"dstack"}},
+		DNSNames:     hosts,
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(selfSignedValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	if err = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	if err = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	return certFile, keyFile, nil
+}
@@ -0,0 +1,273 @@
+package appproxy
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/internal/scaling"
+	"golang.org/x/crypto/acme"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+const (
+	// tokenCookie keeps the token of the browsers, they open the URL with ?token= once
+	tokenCookie = "dstack_apps_token"
+	tokenQuery  = "token"
+	acmeDir     = "acme"
+	// idleConnTimeout closes the kept-alive connections to the apps nobody calls anymore
+	idleConnTimeout = 90 * time.Second
+)
+
+// Config of the HTTPS reverse proxy in front of the job apps. The certificate is issued by ACME for Domain,
+// loaded from CertFile and KeyFile, or self-signed. The app ports are then bound on localhost only.
+type Config struct {
+	Host string `yaml:"host,omitempty"`
+	Port int    `yaml:"port"`
+	// Domain routes <app>.<Domain> to the app, the other requests are routed by the path prefix /<app>/
+	Domain   string `yaml:"domain,omitempty"`
+	CertFile string `yaml:"cert_file,omitempty"`
+	KeyFile  string `yaml:"key_file,omitempty"`
+	ACME     *ACME  `yaml:"acme,omitempty"`
+	// Token authorizes the clients, a token is generated for every job if empty
+	Token string `yaml:"token,omitempty"`
+}
+
+// ACME issues the certificates with the TLS-ALPN challenge, the proxy has to listen on 443.
+// CacheDir is the acme dir of the runner config dir by default, DirectoryURL is Let's Encrypt by default.
+type ACME struct {
+	Email        string `yaml:"email,omitempty"`
+	CacheDir     string `yaml:"cache_dir,omitempty"`
+	DirectoryURL string `yaml:"directory_url,omitempty"`
+}
+
+// Runner is the part of the executor the requests are proxied to, the apps and the token are read from the job
+type Runner interface {
+	JobSnapshot(ctx context.Context) models.Job
+	DialContainer(ctx context.Context, port int) (net.Conn, error)
+}
+
+type Server struct {
+	config Config
+	runner Runner
+	server *http.Server
+	// transport keeps the connections to the apps alive between the requests
+	transport *http.Transport
+	// meter counts the requests for the autoscaling signals
+	meter *scaling.Meter
+}
+
+func New(config Config, configDir string, runner Runner) (*Server, error) {
+	if config.ACME != nil && config.Domain == "" {
+		return nil, gerrors.New("ACME requires the app proxy domain")
+	}
+	tlsConfig, err := loadTLSConfig(config, configDir)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	s := &Server{config: config, runner: runner, transport: newTransport(runner)}
+	s.server = &http.Server{
+		Addr:      net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		Handler:   s,
+		TLSConfig: tlsConfig,
+	}
+	return s, nil
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	log.Info(ctx, "App proxy is listening", "host", s.config.Host, "port", s.config.Port, "domain", s.config.Domain)
+	s.server.BaseContext = func(net.Listener) context.Context { return ctx }
+	if err := s.server.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+func (s *Server) SetMeter(meter *scaling.Meter) {
+	s.meter = meter
+}
+
+func (s *Server) Shutdown() {
+	_ = s.server.Shutdown(context.Background())
+	s.transport.CloseIdleConnections()
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	job := s.runner.JobSnapshot(r.Context())
+	token := s.config.Token
+	if token == "" && job.AppProxy != nil {
+		token = job.AppProxy.Token
+	}
+	if token == "" || !s.authorize(w, r, token) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if r.URL.Query().Has(tokenQuery) {
+		// the token is kept out of the address bar and of the app requests
+		query := r.URL.Query()
+		query.Del(tokenQuery)
+		redirect := *r.URL
+		redirect.RawQuery = query.Encode()
+		http.Redirect(w, r, redirect.RequestURI(), http.StatusFound)
+		return
+	}
+	app, prefix, ok := route(r, job.Apps, s.config.Domain)
+	if !ok {
+		http.Error(w, "unknown app", http.StatusNotFound)
+		return
+	}
+	defer s.meter.Start()()
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = net.JoinHostPort("localhost", strconv.Itoa(app.Port))
+			if prefix != "" {
+				req.URL.Path = "/" + strings.TrimPrefix(strings.TrimPrefix(req.URL.Path, prefix), "/")
+				req.URL.RawPath = ""
+				req.Header.Set("X-Forwarded-Prefix", prefix)
+			}
+			req.Header.Set("X-Forwarded-Proto", "https")
+			dropToken(req)
+		},
+		Transport: s.transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Warning(r.Context(), "App proxy request failed", "app", app.Name, "err", err)
+			http.Error(w, "app is unavailable", http.StatusBadGateway)
+		},
+	}
+	proxy.ServeHTTP(w, r)
+}
+
+// newTransport dials the app port of the request address in the job container
+func newTransport(runner Runner) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			_, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, gerrors.Wrap(err)
+			}
+			appPort, err := strconv.Atoi(port)
+			if err != nil {
+				return nil, gerrors.Wrap(err)
+			}
+			return runner.DialContainer(ctx, appPort)
+		},
+		IdleConnTimeout: idleConnTimeout,
+	}
+}
+
+// authorize accepts the bearer token, the cookie or the query token, the latter is stored in the cookie
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request, token string) bool {
+	if bearer := r.Header.Get("Authorization"); strings.HasPrefix(bearer, "Bearer ") && equal(strings.TrimPrefix(bearer, "Bearer "), token) {
+		return true
+	}
+	if cookie, err := r.Cookie(tokenCookie); err == nil && equal(cookie.Value, token) {
+		return true
+	}
+	if query := r.URL.Query().Get(tokenQuery); query != "" && equal(query, token) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     tokenCookie,
+			Value:    token,
+			Path:     "/",
+			Secure:   true,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return true
+	}
+	return false
+}
+
+func equal(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// route picks the app by the subdomain, by the first path segment, or the only app of the job
+func route(r *http.Request, apps []models.App, domain string) (models.App, string, bool) {
+	host := r.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	if domain != "" && strings.HasSuffix(host, "."+domain) {
+		app, found := findApp(apps, strings.TrimSuffix(host, "."+domain))
+		return app, "", found
+	}
+	segment := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)[0]
+	if app, found := findApp(apps, segment); found && segment != "" {
+		return app, "/" + segment, true
+	}
+	if len(apps) == 1 {
+		return apps[0], "", true
+	}
+	return models.App{}, "", false
+}
+
+func findApp(apps []models.App, name string) (models.App, bool) {
+	for _, app := range apps {
+		if app.Name == name {
+			return app, true
+		}
+	}
+	return models.App{}, false
+}
+
+// dropToken removes the proxy credentials from the request to the app
+func dropToken(r *http.Request) {
+	if strings.HasPrefix(r.Header.Get("Authorization"), "Bearer ") {
+		r.Header.Del("Authorization")
+	}
+	cookies := r.Cookies()
+	r.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		if cookie.Name != tokenCookie {
+			r.AddCookie(cookie)
+		}
+	}
+}
+
+func loadTLSConfig(config Config, configDir string) (*tls.Config, error) {
+	if config.ACME != nil {
+		cacheDir := config.ACME.CacheDir
+		if cacheDir == "" {
+			cacheDir = filepath.Join(configDir, acmeDir)
+		}
+		manager := &autocert.Manager{
+			Prompt: autocert.AcceptTOS,
+			Email:  config.ACME.Email,
+			Cache:  autocert.DirCache(cacheDir),
+			HostPolicy: func(_ context.Context, host string) error {
+				if host == config.Domain || strings.HasSuffix(host, "."+config.Domain) {
+					return nil
+				}
+				return gerrors.Newf("host %s is not in the domain %s", host, config.Domain)
+			},
+		}
+		if config.ACME.DirectoryURL != "" {
+			manager.Client = &acme.Client{DirectoryURL: config.ACME.DirectoryURL}
+		}
+		return manager.TLSConfig(), nil
+	}
+	certFile, keyFile := config.CertFile, config.KeyFile
+	if certFile == "" || keyFile == "" {
+		var err error
+		if certFile, keyFile, err = selfSigned(configDir, config.Domain); err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
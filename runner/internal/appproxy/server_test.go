@@ -0,0 +1,117 @@
+package appproxy
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRunner struct {
+	job  models.Job
+	addr string
+}
+
+func (r *fakeRunner) JobSnapshot(context.Context) models.Job {
+	return r.job
+}
+
+func (r *fakeRunner) DialContainer(ctx context.Context, _ int) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", r.addr)
+}
+
+func TestServeHTTP(t *testing.T) {
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, r.URL.Path+" "+r.Header.Get("X-Forwarded-Prefix")+" "+r.Header.Get("Cookie"))
+	}))
+	defer app.Close()
+	runner := &fakeRunner{
+		job: models.Job{
+			Apps:     []models.App{{Name: "gradio", Port: 7860}, {Name: "web", Port: 80}},
+			AppProxy: &models.AppProxy{Token: "secret"},
+		},
+		addr: app.Listener.Addr().String(),
+	}
+	s, err := New(Config{Domain: "example.com"}, t.TempDir(), runner)
+	assert.Equal(t, nil, err)
+	defer s.Shutdown()
+
+	req := httptest.NewRequest(http.MethodGet, "https://runner/gradio/queue", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "https://runner/gradio/queue?token=secret", nil)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/gradio/queue", w.Header().Get("Location"))
+	cookies := w.Result().Cookies()
+	assert.Equal(t, 1, len(cookies))
+
+	req = httptest.NewRequest(http.MethodGet, "https://runner/gradio/queue", nil)
+	req.AddCookie(cookies[0])
+	req.AddCookie(&http.Cookie{Name: "session", Value: "1"})
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/queue /gradio session=1", w.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "https://web.example.com/index.html", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "/index.html  ", w.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, "https://runner/other", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestServeHTTPReusesConnections(t *testing.T) {
+	var conns atomic.Int32
+	app := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "ok")
+	}))
+	app.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	app.Start()
+	defer app.Close()
+	runner := &fakeRunner{
+		job:  models.Job{Apps: []models.App{{Name: "web", Port: 80}}, AppProxy: &models.AppProxy{Token: "secret"}},
+		addr: app.Listener.Addr().String(),
+	}
+	s, err := New(Config{}, t.TempDir(), runner)
+	assert.Equal(t, nil, err)
+	defer s.Shutdown()
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodGet, "https://runner/web/", nil)
+		req.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+	assert.Equal(t, int32(1), conns.Load())
+}
+
+func TestSelfSigned(t *testing.T) {
+	dir := t.TempDir()
+	first, err := loadTLSConfig(Config{Domain: "example.com"}, dir)
+	assert.Equal(t, nil, err)
+	second, err := loadTLSConfig(Config{Domain: "example.com"}, dir)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, first.Certificates[0].Certificate, second.Certificates[0].Certificate)
+}
@@ -9,6 +9,7 @@ import (
 	"io"
 	"io/fs"
 	"mime"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -21,6 +22,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/smithy-go"
 	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/bandwidth"
 	"github.com/dstackai/dstack/runner/internal/gerrors"
 	"github.com/dstackai/dstack/runner/internal/log"
 	"go.uber.org/atomic"
@@ -84,16 +86,46 @@ type Copier struct {
 }
 
 func New(region string) *Copier {
-	c := new(Copier)
+	return NewWithOptions(region, Options{})
+}
+
+// Options tune the S3 transfers of a runner, the limiters are shared by all its copiers
+type Options struct {
+	// Accelerate uses the Transfer Acceleration endpoint, the bucket must have it enabled
+	Accelerate bool
+	Upload     *bandwidth.Limiter
+	Download   *bandwidth.Limiter
+}
+
+// LoadOptions route the requests through the bandwidth limiters
+func (o Options) LoadOptions() []func(*config.LoadOptions) error {
+	if o.Upload == nil && o.Download == nil {
+		return nil
+	}
+	transport := bandwidth.NewTransport(http.DefaultTransport.(*http.Transport).Clone(), o.Upload, o.Download)
+	return []func(*config.LoadOptions) error{config.WithHTTPClient(&http.Client{Transport: transport})}
+}
+
+func (o Options) ClientOptions(opts *s3.Options) {
+	opts.UseAccelerate = o.Accelerate
+}
+
+func NewWithOptions(region string, opts Options) *Copier {
 	ctx := context.TODO()
 	cfg, err := config.LoadDefaultConfig(
 		ctx,
-		config.WithRegion(region),
+		append([]func(*config.LoadOptions) error{config.WithRegion(region)}, opts.LoadOptions()...)...,
 	)
 	if err != nil {
 		return nil
 	}
-	c.cli = s3.NewFromConfig(cfg)
+	return NewWithClient(s3.NewFromConfig(cfg, opts.ClientOptions))
+}
+
+// NewWithClient copies with the client of an S3-compatible storage
+func NewWithClient(cli *s3.Client) *Copier {
+	c := new(Copier)
+	c.cli = cli
 	c.downloader = manager.NewDownloader(c.cli)
 	c.uploader = manager.NewUploader(c.cli)
 
@@ -31,20 +31,21 @@ func (s *Local) AfterRun(ctx context.Context) error {
 	return nil
 }
 
+// DockerBindings mounts the host dir of the artifact at its path in the container, the container paths are slash-separated
 func (s *Local) DockerBindings(workDir string) ([]mount.Mount, error) {
-	cleanPath := filepath.Clean(s.pathLocal)
+	cleanPath := path.Clean(s.pathLocal)
 	if path.IsAbs(cleanPath) && path.Dir(cleanPath) == cleanPath {
 		return nil, errors.New("directory needs to be a non-root path")
 	}
 	dir := s.pathLocal
-	if !filepath.IsAbs(s.pathLocal) {
+	if !path.IsAbs(s.pathLocal) {
 		dir = path.Join(workDir, s.pathLocal)
 	}
 
 	return []mount.Mount{
 		{
 			Type:   mount.TypeBind,
-			Source: path.Join(s.path, s.pathRemote),
+			Source: filepath.Join(s.path, filepath.FromSlash(s.pathRemote)),
 			Target: dir,
 		},
 	}, nil
@@ -57,7 +58,7 @@ func NewLocal(pathRoot, workDir, pathLocal, pathRemote string) (*Local, error) {
 		pathLocal:  pathLocal,
 		pathRemote: pathRemote,
 	}
-	dir := path.Join(s.path, s.pathRemote)
+	dir := filepath.Join(s.path, filepath.FromSlash(s.pathRemote))
 
 	if err := os.MkdirAll(dir, 0o755); err != nil {
 		return nil, gerrors.Wrap(err)
@@ -0,0 +1,245 @@
+package rclone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+var _ artifacts.Artifacter = (*Mount)(nil)
+
+// Remote is an rclone connection string, e.g. :s3,env_auth=true:bucket/path
+type Remote string
+
+func S3(bucket, region, remotePath string) Remote {
+	return Remote(fmt.Sprintf(":s3,provider=AWS,env_auth=true,region=%s:%s", region, path.Join(bucket, remotePath)))
+}
+
+func GCS(bucket, remotePath string) Remote {
+	return Remote(fmt.Sprintf(":gcs,env_auth=true,bucket_policy_only=true:%s", path.Join(bucket, remotePath)))
+}
+
+func Azure(account, container, remotePath string) Remote {
+	return Remote(fmt.Sprintf(":azureblob,account=%s,env_auth=true:%s", account, path.Join(container, remotePath)))
+}
+
+// Mount exposes the remote as a local directory. The mount is checked periodically and remounted on failure.
+type Mount struct {
+	remote    Remote
+	workDir   string
+	pathLocal string
+	readOnly  bool
+
+	mu      sync.Mutex
+	cmd     *exec.Cmd
+	exited  chan struct{}
+	started bool
+	stopCh  chan struct{}
+	doneCh  chan struct{}
+}
+
+func Available() bool {
+	_, err := exec.LookPath("rclone")
+	return err == nil
+}
+
+func New(ctx context.Context, remote Remote, workDir, localPath string, readOnly bool) (*Mount, error) {
+	log.Trace(ctx, "Build rclone FUSE engine", "remote", remote)
+	if !Available() {
+		log.Error(ctx, "rclone binary is required to enable FUSE artifact handling")
+		return nil, gerrors.New("rclone is not found")
+	}
+	if err := os.MkdirAll(path.Join(workDir, localPath), 0o755); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return &Mount{
+		remote:    remote,
+		workDir:   workDir,
+		pathLocal: localPath,
+		readOnly:  readOnly,
+		stopCh:    make(chan struct{}),
+		doneCh:    make(chan struct{}),
+	}, nil
+}
+
+func (m *Mount) dir() string {
+	return path.Join(m.workDir, m.pathLocal)
+}
+
+func (m *Mount) BeforeRun(ctx context.Context) error {
+	if err := m.mount(ctx); err != nil {
+		return gerrors.Wrap(err)
+	}
+	m.started = true
+	go m.watch(ctx)
+	return nil
+}
+
+func (m *Mount) AfterRun(ctx context.Context) error {
+	if !m.started {
+		return nil
+	}
+	close(m.stopCh)
+	<-m.doneCh
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.unmount(ctx)
+}
+
+func (m *Mount) DockerBindings(workDir string) ([]mount.Mount, error) {
+	cleanPath := filepath.Clean(m.pathLocal)
+	if path.IsAbs(cleanPath) && path.Dir(cleanPath) == cleanPath {
+		return nil, errors.New("directory needs to be a non-root path")
+	}
+	dir := m.pathLocal
+	if !filepath.IsAbs(m.pathLocal) {
+		dir = path.Join(workDir, m.pathLocal)
+	}
+	return []mount.Mount{
+		{
+			Type:     mount.TypeBind,
+			Source:   m.dir(),
+			Target:   dir,
+			ReadOnly: m.readOnly,
+			// a remount replaces the FUSE under the bind, the container sees it only with propagation
+			BindOptions: &mount.BindOptions{Propagation: mount.PropagationRSlave},
+		},
+	}, nil
+}
+
+func (m *Mount) mount(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	args := []string{"mount", string(m.remote), m.dir(), "--vfs-cache-mode", "writes"}
+	if m.readOnly {
+		args = append(args, "--read-only")
+	}
+	if os.Getuid() != 0 {
+		args = append(args, "--allow-other")
+	}
+	cmd := exec.Command("rclone", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Start(); err != nil {
+		return gerrors.Wrap(err)
+	}
+	exited := make(chan struct{})
+	go func() {
+		_ = cmd.Wait()
+		close(exited)
+	}()
+	m.cmd = cmd
+	m.exited = exited
+	deadline := time.After(consts.FUSE_MOUNT_TIMEOUT)
+	for !isMounted(m.dir()) {
+		select {
+		case <-exited:
+			return gerrors.Newf("rclone exited before mounting %s", m.dir())
+		case <-deadline:
+			_ = m.unmount(ctx)
+			return gerrors.Newf("timeout mounting %s", m.dir())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	log.Trace(ctx, "FUSE mounted", "dir", m.dir())
+	return nil
+}
+
+func (m *Mount) unmount(ctx context.Context) error {
+	var oneOf error
+	if m.cmd != nil && m.cmd.Process != nil {
+		if err := m.cmd.Process.Signal(os.Interrupt); err != nil {
+			log.Error(ctx, "rclone send signal fail", "err", err, "dir", m.dir())
+			oneOf = err
+		}
+		select {
+		case <-m.exited:
+		case <-time.After(consts.FUSE_MOUNT_TIMEOUT):
+			_ = m.cmd.Process.Kill()
+			<-m.exited
+		}
+	}
+	// a crashed rclone leaves the mount point stale
+	if isMounted(m.dir()) {
+		if err := exec.Command("fusermount", "-uz", m.dir()).Run(); err != nil {
+			log.Error(ctx, "fusermount fail", "err", err, "dir", m.dir())
+			oneOf = err
+		}
+	}
+	return oneOf
+}
+
+// watch remounts the directory if rclone exits or the mount stops responding
+func (m *Mount) watch(ctx context.Context) {
+	defer close(m.doneCh)
+	ticker := time.NewTicker(consts.DELAY_FUSE_HEALTH_CHECK)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.stopCh:
+			return
+		case <-ticker.C:
+		}
+		if m.healthy() {
+			continue
+		}
+		log.Error(ctx, "FUSE mount is unhealthy, remounting", "dir", m.dir())
+		m.mu.Lock()
+		_ = m.unmount(ctx)
+		m.mu.Unlock()
+		if err := m.mount(ctx); err != nil {
+			log.Error(ctx, "Failed to remount", "err", err, "dir", m.dir())
+		}
+	}
+}
+
+func (m *Mount) healthy() bool {
+	m.mu.Lock()
+	exited := m.exited
+	m.mu.Unlock()
+	select {
+	case <-exited:
+		return false
+	default:
+	}
+	// a hung FUSE blocks the syscall, it is bounded by the timeout
+	ok := make(chan bool, 1)
+	go func() {
+		_, err := os.ReadDir(m.dir())
+		ok <- err == nil
+	}()
+	select {
+	case result := <-ok:
+		return result
+	case <-time.After(consts.FUSE_MOUNT_TIMEOUT):
+		return false
+	}
+}
+
+func isMounted(dir string) bool {
+	mounts, err := os.ReadFile("/proc/self/mounts")
+	if err != nil {
+		return false
+	}
+	dir = filepath.Clean(dir)
+	for _, line := range strings.Split(string(mounts), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && fields[1] == dir {
+			return true
+		}
+	}
+	return false
+}
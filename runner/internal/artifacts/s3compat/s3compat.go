@@ -0,0 +1,145 @@
+package s3compat
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/artifacts/client"
+	"github.com/dstackai/dstack/runner/internal/artifacts/simple"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+const (
+	ProviderB2 = "b2"
+	ProviderR2 = "r2"
+	// r2Region is the only region R2 signs the requests with
+	r2Region = "auto"
+)
+
+// Config of an S3-compatible storage keeping the artifacts and the build diffs under Dir of Bucket.
+// Provider b2 takes Region for the endpoint, e.g. us-west-004, r2 takes AccountID, the other storages take Endpoint.
+// The keys are read from the AWS environment variables if not set.
+type Config struct {
+	Provider        string `yaml:"provider,omitempty"`
+	Endpoint        string `yaml:"endpoint,omitempty"`
+	Region          string `yaml:"region,omitempty"`
+	AccountID       string `yaml:"account_id,omitempty"`
+	Bucket          string `yaml:"bucket"`
+	Dir             string `yaml:"dir,omitempty"`
+	AccessKeyID     string `yaml:"access_key_id,omitempty"`
+	SecretAccessKey string `yaml:"secret_access_key,omitempty"`
+}
+
+// resolve returns the endpoint and the signing region of the provider
+func (c Config) resolve() (string, string, error) {
+	switch c.Provider {
+	case ProviderB2:
+		if c.Region == "" {
+			return "", "", gerrors.New("b2 requires the region")
+		}
+		return fmt.Sprintf("https://s3.%s.backblazeb2.com", c.Region), c.Region, nil
+	case ProviderR2:
+		if c.AccountID == "" {
+			return "", "", gerrors.New("r2 requires the account ID")
+		}
+		return fmt.Sprintf("https://%s.r2.cloudflarestorage.com", c.AccountID), r2Region, nil
+	case "":
+		if c.Endpoint == "" {
+			return "", "", gerrors.New("the endpoint is required")
+		}
+		region := c.Region
+		if region == "" {
+			region = "us-east-1"
+		}
+		return c.Endpoint, region, nil
+	}
+	return "", "", gerrors.Newf("unknown provider %s", c.Provider)
+}
+
+// Store is an S3-compatible storage. B2 and R2 have no multipart copy, so the objects are never copied on the server.
+// Their ETags of the multipart uploads are not MD5 either, the artifacts are synced by the size and the time.
+type Store struct {
+	config Config
+	cli    *s3.Client
+}
+
+// New connects to the storage, the bandwidth limits of transfer apply and the acceleration is ignored
+func New(ctx context.Context, c Config, transfer client.Options) (*Store, error) {
+	endpoint, region, err := c.resolve()
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	opts := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if c.AccessKeyID != "" {
+		creds := aws.Credentials{AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, Source: "dstack"}
+		opts = append(opts, config.WithCredentialsProvider(aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return creds, nil
+		})))
+	}
+	opts = append(opts, transfer.LoadOptions()...)
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	cli := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		o.EndpointResolver = s3.EndpointResolverFromURL(endpoint)
+		// the bucket subdomains need a wildcard certificate the custom domains may lack
+		o.UsePathStyle = true
+	})
+	return &Store{config: c, cli: cli}, nil
+}
+
+func (s *Store) key(p string) string {
+	return path.Join(s.config.Dir, p)
+}
+
+// Artifact copies the artifact from and to the storage, the FUSE mounts are not supported
+func (s *Store) Artifact(workDir, localPath, remotePath string) (artifacts.Artifacter, error) {
+	return simple.NewWithCopier(s.config.Bucket, client.NewWithClient(s.cli), workDir, localPath, s.key(remotePath), false)
+}
+
+// GetFile downloads the object to dst, a missing object leaves no dst like the backends do
+func (s *Store) GetFile(ctx context.Context, key, dst string) error {
+	out, err := s.cli.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(s.key(key)),
+	})
+	if err != nil {
+		log.Trace(ctx, "No object in the artifact store", "key", key, "err", err)
+		return nil
+	}
+	defer func() { _ = out.Body.Close() }()
+	file, err := os.Create(dst)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	if _, err = io.Copy(file, out.Body); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(file.Close())
+}
+
+// PutFile uploads src, the big files in parts
+func (s *Store) PutFile(ctx context.Context, src, key string) error {
+	file, err := os.Open(src)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	_, err = manager.NewUploader(s.cli).Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(s.key(key)),
+		Body:   file,
+	})
+	return gerrors.Wrap(err)
+}
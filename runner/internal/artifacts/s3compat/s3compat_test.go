@@ -0,0 +1,80 @@
+package s3compat
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/artifacts/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolve(t *testing.T) {
+	endpoint, region, err := Config{Provider: ProviderB2, Region: "us-west-004"}.resolve()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "https://s3.us-west-004.backblazeb2.com", endpoint)
+	assert.Equal(t, "us-west-004", region)
+
+	endpoint, region, err = Config{Provider: ProviderR2, AccountID: "abc"}.resolve()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "https://abc.r2.cloudflarestorage.com", endpoint)
+	assert.Equal(t, "auto", region)
+
+	endpoint, region, err = Config{Endpoint: "https://minio.local:9000"}.resolve()
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "https://minio.local:9000", endpoint)
+	assert.Equal(t, "us-east-1", region)
+
+	_, _, err = Config{Provider: ProviderR2}.resolve()
+	assert.NotEqual(t, nil, err)
+	_, _, err = Config{Provider: "wasabi"}.resolve()
+	assert.NotEqual(t, nil, err)
+}
+
+func TestPutGetFile(t *testing.T) {
+	var mu sync.Mutex
+	objects := map[string][]byte{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.Method {
+		case http.MethodPut:
+			body, _ := io.ReadAll(r.Body)
+			objects[r.URL.Path] = body
+			w.Header().Set("ETag", `"etag"`)
+		case http.MethodGet:
+			body, ok := objects[r.URL.Path]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_, _ = w.Write(body)
+		}
+	}))
+	defer server.Close()
+	ctx := context.Background()
+	store, err := New(ctx, Config{Endpoint: server.URL, Bucket: "bucket", Dir: "dstack", AccessKeyID: "key", SecretAccessKey: "secret"}, client.Options{})
+	assert.Equal(t, nil, err)
+
+	dir := t.TempDir()
+	src := filepath.Join(dir, "layer.tar.zst")
+	assert.Equal(t, nil, os.WriteFile(src, []byte("layer"), 0o644))
+	assert.Equal(t, nil, store.PutFile(ctx, src, "builds/repo/build.tar.zst"))
+	assert.Equal(t, []byte("layer"), objects["/bucket/dstack/builds/repo/build.tar.zst"])
+
+	dst := filepath.Join(dir, "downloaded")
+	assert.Equal(t, nil, store.GetFile(ctx, "builds/repo/build.tar.zst", dst))
+	downloaded, err := os.ReadFile(dst)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "layer", string(downloaded))
+
+	missing := filepath.Join(dir, "missing")
+	assert.Equal(t, nil, store.GetFile(ctx, "builds/repo/missing.tar.zst", missing))
+	_, err = os.Stat(missing)
+	assert.Equal(t, true, os.IsNotExist(err))
+}
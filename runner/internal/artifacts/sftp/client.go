@@ -0,0 +1,441 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// The subset of the SFTP version 3 protocol the artifacts need, the requests are sent one at a time
+const (
+	fxpInit     = 1
+	fxpVersion  = 2
+	fxpOpen     = 3
+	fxpClose    = 4
+	fxpRead     = 5
+	fxpWrite    = 6
+	fxpOpendir  = 11
+	fxpReaddir  = 12
+	fxpMkdir    = 14
+	fxpStat     = 17
+	fxpStatus   = 101
+	fxpHandle   = 102
+	fxpData     = 103
+	fxpName     = 104
+	fxpAttrs    = 105
+	sftpVersion = 3
+
+	fxOK         = 0
+	fxEOF        = 1
+	fxNoSuchFile = 2
+
+	fxfRead  = 0x01
+	fxfWrite = 0x02
+	fxfCreat = 0x08
+	fxfTrunc = 0x10
+
+	attrSize        = 0x01
+	attrUIDGID      = 0x02
+	attrPermissions = 0x04
+	attrACModTime   = 0x08
+	attrExtended    = 0x80000000
+
+	// chunkSize is below the 32 KiB packets every server accepts
+	chunkSize = 32000
+	// maxPacket bounds the replies read from the server
+	maxPacket = 1 << 20
+	modeDir   = 0o040000
+	modeType  = 0o170000
+)
+
+// StatusError is the failure reported by the server
+type StatusError struct {
+	Code    uint32
+	Message string
+}
+
+func (e StatusError) Error() string {
+	return "sftp: " + e.Message
+}
+
+type attrs struct {
+	size uint64
+	mode uint32
+}
+
+func (a attrs) isDir() bool {
+	return a.mode&modeType == modeDir
+}
+
+type entry struct {
+	name string
+	attrs
+}
+
+type client struct {
+	mu     sync.Mutex
+	w      io.Writer
+	r      io.Reader
+	nextID uint32
+}
+
+func newClient(w io.Writer, r io.Reader) (*client, error) {
+	c := &client{w: w, r: r}
+	init := &buffer{}
+	init.uint32(sftpVersion)
+	if err := c.send(fxpInit, init.bytes()); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	typ, _, err := c.receive()
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if typ != fxpVersion {
+		return nil, gerrors.Newf("sftp: unexpected packet %d", typ)
+	}
+	return c, nil
+}
+
+func (c *client) send(typ byte, payload []byte) error {
+	header := make([]byte, 5)
+	binary.BigEndian.PutUint32(header, uint32(len(payload)+1))
+	header[4] = typ
+	if _, err := c.w.Write(append(header, payload...)); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+func (c *client) receive() (byte, *reader, error) {
+	header := make([]byte, 5)
+	if _, err := io.ReadFull(c.r, header); err != nil {
+		return 0, nil, gerrors.Wrap(err)
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length == 0 || length > maxPacket {
+		return 0, nil, gerrors.Newf("sftp: bad packet length %d", length)
+	}
+	payload := make([]byte, length-1)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return 0, nil, gerrors.Wrap(err)
+	}
+	return header[4], &reader{b: payload}, nil
+}
+
+// request sends the request with a new id and returns the reply after its id
+func (c *client) request(typ byte, build func(b *buffer)) (byte, *reader, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	b := &buffer{}
+	b.uint32(c.nextID)
+	build(b)
+	if err := c.send(typ, b.bytes()); err != nil {
+		return 0, nil, err
+	}
+	replyType, r, err := c.receive()
+	if err != nil {
+		return 0, nil, err
+	}
+	if id := r.uint32(); id != c.nextID {
+		return 0, nil, gerrors.Newf("sftp: unexpected reply id %d", id)
+	}
+	return replyType, r, r.err
+}
+
+// status turns a status reply into an error, nil for OK
+func status(typ byte, r *reader, expected byte) error {
+	if typ == fxpStatus {
+		code := r.uint32()
+		message := r.string()
+		if code == fxOK {
+			return nil
+		}
+		return StatusError{Code: code, Message: message}
+	}
+	if typ != expected {
+		return gerrors.Newf("sftp: unexpected packet %d", typ)
+	}
+	return nil
+}
+
+func (c *client) stat(p string) (attrs, error) {
+	typ, r, err := c.request(fxpStat, func(b *buffer) { b.string(p) })
+	if err != nil {
+		return attrs{}, err
+	}
+	if err = status(typ, r, fxpAttrs); err != nil {
+		return attrs{}, err
+	}
+	if typ != fxpAttrs {
+		return attrs{}, gerrors.Newf("sftp: no attributes of %s", p)
+	}
+	return r.attrs(), r.err
+}
+
+func (c *client) handle(typ byte, build func(b *buffer)) (string, error) {
+	replyType, r, err := c.request(typ, build)
+	if err != nil {
+		return "", err
+	}
+	if err = status(replyType, r, fxpHandle); err != nil {
+		return "", err
+	}
+	if replyType != fxpHandle {
+		return "", gerrors.New("sftp: no handle")
+	}
+	return r.string(), r.err
+}
+
+func (c *client) close(handle string) error {
+	typ, r, err := c.request(fxpClose, func(b *buffer) { b.string(handle) })
+	if err != nil {
+		return err
+	}
+	return status(typ, r, fxpStatus)
+}
+
+func (c *client) readDir(p string) ([]entry, error) {
+	handle, err := c.handle(fxpOpendir, func(b *buffer) { b.string(p) })
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = c.close(handle) }()
+	var entries []entry
+	for {
+		typ, r, err := c.request(fxpReaddir, func(b *buffer) { b.string(handle) })
+		if err != nil {
+			return nil, err
+		}
+		if err = status(typ, r, fxpName); err != nil {
+			if statusErr, ok := err.(StatusError); ok && statusErr.Code == fxEOF {
+				return entries, nil
+			}
+			return nil, err
+		}
+		count := r.uint32()
+		for i := uint32(0); i < count && r.err == nil; i++ {
+			name := r.string()
+			_ = r.string() // the long name is for humans
+			a := r.attrs()
+			if name != "." && name != ".." {
+				entries = append(entries, entry{name: name, attrs: a})
+			}
+		}
+		if r.err != nil {
+			return nil, r.err
+		}
+	}
+}
+
+func (c *client) mkdir(p string) error {
+	typ, r, err := c.request(fxpMkdir, func(b *buffer) {
+		b.string(p)
+		b.uint32(0)
+	})
+	if err != nil {
+		return err
+	}
+	return status(typ, r, fxpStatus)
+}
+
+// mkdirAll makes the dir and its parents, the existing ones are kept
+func (c *client) mkdirAll(p string) error {
+	if a, err := c.stat(p); err == nil {
+		if !a.isDir() {
+			return gerrors.Newf("sftp: %s is not a directory", p)
+		}
+		return nil
+	}
+	if parent := path.Dir(p); parent != p {
+		if err := c.mkdirAll(parent); err != nil {
+			return err
+		}
+	}
+	if err := c.mkdir(p); err != nil {
+		// another runner may have made it meanwhile
+		if a, errStat := c.stat(p); errStat == nil && a.isDir() {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *client) download(remote, local string) error {
+	handle, err := c.handle(fxpOpen, func(b *buffer) {
+		b.string(remote)
+		b.uint32(fxfRead)
+		b.uint32(0)
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { _ = c.close(handle) }()
+	if err = os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return gerrors.Wrap(err)
+	}
+	file, err := os.Create(local)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	var offset uint64
+	for {
+		typ, r, err := c.request(fxpRead, func(b *buffer) {
+			b.string(handle)
+			b.uint64(offset)
+			b.uint32(chunkSize)
+		})
+		if err != nil {
+			return err
+		}
+		if err = status(typ, r, fxpData); err != nil {
+			if statusErr, ok := err.(StatusError); ok && statusErr.Code == fxEOF {
+				return gerrors.Wrap(file.Close())
+			}
+			return err
+		}
+		data := r.string()
+		if r.err != nil {
+			return r.err
+		}
+		if _, err = file.WriteString(data); err != nil {
+			return gerrors.Wrap(err)
+		}
+		offset += uint64(len(data))
+	}
+}
+
+func (c *client) upload(local, remote string) error {
+	file, err := os.Open(local)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	handle, err := c.handle(fxpOpen, func(b *buffer) {
+		b.string(remote)
+		b.uint32(fxfWrite | fxfCreat | fxfTrunc)
+		b.uint32(0)
+	})
+	if err != nil {
+		return err
+	}
+	chunk := make([]byte, chunkSize)
+	var offset uint64
+	for {
+		n, errRead := file.Read(chunk)
+		if n > 0 {
+			typ, r, err := c.request(fxpWrite, func(b *buffer) {
+				b.string(handle)
+				b.uint64(offset)
+				b.string(string(chunk[:n]))
+			})
+			if err == nil {
+				err = status(typ, r, fxpStatus)
+			}
+			if err != nil {
+				_ = c.close(handle)
+				return err
+			}
+			offset += uint64(n)
+		}
+		if errRead == io.EOF {
+			return c.close(handle)
+		}
+		if errRead != nil {
+			_ = c.close(handle)
+			return gerrors.Wrap(errRead)
+		}
+	}
+}
+
+type buffer struct {
+	b []byte
+}
+
+func (b *buffer) bytes() []byte {
+	return b.b
+}
+
+func (b *buffer) uint32(v uint32) {
+	b.b = binary.BigEndian.AppendUint32(b.b, v)
+}
+
+func (b *buffer) uint64(v uint64) {
+	b.b = binary.BigEndian.AppendUint64(b.b, v)
+}
+
+func (b *buffer) string(s string) {
+	b.uint32(uint32(len(s)))
+	b.b = append(b.b, s...)
+}
+
+// reader decodes a reply, the first short read sets err and the later reads return zeros
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) take(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.b) < n {
+		r.err = gerrors.New("sftp: short packet")
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) uint32() uint32 {
+	if v := r.take(4); v != nil {
+		return binary.BigEndian.Uint32(v)
+	}
+	return 0
+}
+
+func (r *reader) uint64() uint64 {
+	if v := r.take(8); v != nil {
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+func (r *reader) string() string {
+	return string(r.take(int(r.uint32())))
+}
+
+func (r *reader) attrs() attrs {
+	var a attrs
+	flags := r.uint32()
+	if flags&attrSize != 0 {
+		a.size = r.uint64()
+	}
+	if flags&attrUIDGID != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&attrPermissions != 0 {
+		a.mode = r.uint32()
+	}
+	if flags&attrACModTime != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&attrExtended != 0 {
+		count := r.uint32()
+		for i := uint32(0); i < count && r.err == nil; i++ {
+			r.string()
+			r.string()
+		}
+	}
+	return a
+}
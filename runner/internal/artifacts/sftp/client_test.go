@@ -0,0 +1,177 @@
+package sftp
+
+import (
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeServer serves the requests of the client from a local dir, one request at a time
+type fakeServer struct {
+	root    string
+	handles map[string]*os.File
+	dirs    map[string][]os.DirEntry
+}
+
+func (s *fakeServer) serve(r io.Reader, w io.Writer) {
+	for {
+		header := make([]byte, 5)
+		if _, err := io.ReadFull(r, header); err != nil {
+			return
+		}
+		payload := make([]byte, binary.BigEndian.Uint32(header)-1)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			return
+		}
+		typ, reply := s.handle(header[4], &reader{b: payload})
+		out := make([]byte, 5)
+		binary.BigEndian.PutUint32(out, uint32(len(reply.bytes())+1))
+		out[4] = typ
+		if _, err := w.Write(append(out, reply.bytes()...)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *fakeServer) handle(typ byte, req *reader) (byte, *buffer) {
+	reply := &buffer{}
+	if typ == fxpInit {
+		reply.uint32(sftpVersion)
+		return fxpVersion, reply
+	}
+	id := req.uint32()
+	reply.uint32(id)
+	replyStatus := func(code uint32) (byte, *buffer) {
+		reply.uint32(code)
+		reply.string("status " + strconv.Itoa(int(code)))
+		reply.string("")
+		return fxpStatus, reply
+	}
+	switch typ {
+	case fxpStat:
+		info, err := os.Stat(filepath.Join(s.root, req.string()))
+		if err != nil {
+			return replyStatus(fxNoSuchFile)
+		}
+		writeAttrs(reply, info)
+		return fxpAttrs, reply
+	case fxpMkdir:
+		if os.Mkdir(filepath.Join(s.root, req.string()), 0o755) != nil {
+			return replyStatus(4)
+		}
+		return replyStatus(fxOK)
+	case fxpOpendir:
+		p := req.string()
+		entries, err := os.ReadDir(filepath.Join(s.root, p))
+		if err != nil {
+			return replyStatus(fxNoSuchFile)
+		}
+		s.dirs[p] = entries
+		reply.string(p)
+		return fxpHandle, reply
+	case fxpReaddir:
+		p := req.string()
+		entries := s.dirs[p]
+		if len(entries) == 0 {
+			return replyStatus(fxEOF)
+		}
+		s.dirs[p] = nil
+		reply.uint32(uint32(len(entries)))
+		for _, e := range entries {
+			info, _ := e.Info()
+			reply.string(e.Name())
+			reply.string(e.Name())
+			writeAttrs(reply, info)
+		}
+		return fxpName, reply
+	case fxpOpen:
+		p := req.string()
+		flags := req.uint32()
+		var file *os.File
+		var err error
+		if flags&fxfWrite != 0 {
+			file, err = os.Create(filepath.Join(s.root, p))
+		} else {
+			file, err = os.Open(filepath.Join(s.root, p))
+		}
+		if err != nil {
+			return replyStatus(fxNoSuchFile)
+		}
+		s.handles[p] = file
+		reply.string(p)
+		return fxpHandle, reply
+	case fxpRead:
+		file := s.handles[req.string()]
+		offset := req.uint64()
+		data := make([]byte, req.uint32())
+		n, _ := file.ReadAt(data, int64(offset))
+		if n == 0 {
+			return replyStatus(fxEOF)
+		}
+		reply.string(string(data[:n]))
+		return fxpData, reply
+	case fxpWrite:
+		file := s.handles[req.string()]
+		offset := req.uint64()
+		if _, err := file.WriteAt([]byte(req.string()), int64(offset)); err != nil {
+			return replyStatus(4)
+		}
+		return replyStatus(fxOK)
+	case fxpClose:
+		p := req.string()
+		if file, ok := s.handles[p]; ok {
+			_ = file.Close()
+			delete(s.handles, p)
+		}
+		delete(s.dirs, p)
+		return replyStatus(fxOK)
+	}
+	return replyStatus(4)
+}
+
+func writeAttrs(b *buffer, info os.FileInfo) {
+	mode := uint32(info.Mode().Perm())
+	if info.IsDir() {
+		mode |= modeDir
+	}
+	b.uint32(attrSize | attrPermissions)
+	b.uint64(uint64(info.Size()))
+	b.uint32(mode)
+}
+
+func TestUploadDownloadDir(t *testing.T) {
+	server := &fakeServer{root: t.TempDir(), handles: map[string]*os.File{}, dirs: map[string][]os.DirEntry{}}
+	requests, requestsW := io.Pipe()
+	replies, repliesW := io.Pipe()
+	go server.serve(requests, repliesW)
+	defer func() { _ = requestsW.Close() }()
+	c, err := newClient(requestsW, replies)
+	assert.Equal(t, nil, err)
+
+	src := t.TempDir()
+	large := make([]byte, 3*chunkSize+10)
+	for i := range large {
+		large[i] = byte(i)
+	}
+	assert.Equal(t, nil, os.MkdirAll(filepath.Join(src, "model", "weights"), 0o755))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(src, "model", "weights", "large.bin"), large, 0o644))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(src, "config.json"), []byte("{}"), 0o644))
+	assert.Equal(t, nil, uploadDir(c, src, "/artifacts/repo/job/output"))
+
+	dst := t.TempDir()
+	assert.Equal(t, nil, downloadDir(c, "/artifacts/repo/job/output", dst))
+	downloaded, err := os.ReadFile(filepath.Join(dst, "model", "weights", "large.bin"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, large, downloaded)
+	config, err := os.ReadFile(filepath.Join(dst, "config.json"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "{}", string(config))
+
+	// a missing remote dir is an empty artifact
+	assert.Equal(t, nil, downloadDir(c, "/artifacts/missing", t.TempDir()))
+}
@@ -0,0 +1,192 @@
+package sftp
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"golang.org/x/crypto/ssh"
+)
+
+const dialTimeout = 30 * time.Second
+
+var _ artifacts.Artifacter = (*SFTP)(nil)
+
+// Config points to an SFTP file server keeping the artifacts under Dir, e.g. an on-prem server without an object store
+type Config struct {
+	Host         string `yaml:"host"`
+	Port         int    `yaml:"port,omitempty"`
+	User         string `yaml:"user"`
+	IdentityFile string `yaml:"identity_file"`
+	// HostKey is the server public key in the authorized_keys format
+	HostKey string `yaml:"host_key"`
+	Dir     string `yaml:"dir"`
+}
+
+// SFTP downloads the artifact before the run and uploads it after, the FUSE mounts are not supported
+type SFTP struct {
+	config     Config
+	workDir    string
+	pathLocal  string
+	pathRemote string
+}
+
+func New(config Config, workDir, pathLocal, pathRemote string) (*SFTP, error) {
+	if err := os.MkdirAll(path.Join(workDir, pathLocal), 0o755); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return &SFTP{
+		config:     config,
+		workDir:    workDir,
+		pathLocal:  pathLocal,
+		pathRemote: pathRemote,
+	}, nil
+}
+
+func (s *SFTP) BeforeRun(ctx context.Context) error {
+	log.Trace(ctx, "Download artifact", "artifact", s.pathLocal, "host", s.config.Host)
+	return s.session(ctx, func(c *client) error {
+		return downloadDir(c, s.remoteDir(), path.Join(s.workDir, s.pathLocal))
+	})
+}
+
+func (s *SFTP) AfterRun(ctx context.Context) error {
+	log.Trace(ctx, "Upload artifact", "artifact", s.pathLocal, "host", s.config.Host)
+	return s.session(ctx, func(c *client) error {
+		return uploadDir(c, path.Join(s.workDir, s.pathLocal), s.remoteDir())
+	})
+}
+
+func (s *SFTP) DockerBindings(workDir string) ([]mount.Mount, error) {
+	cleanPath := filepath.Clean(s.pathLocal)
+	if path.IsAbs(cleanPath) && path.Dir(cleanPath) == cleanPath {
+		return nil, errors.New("directory needs to be a non-root path")
+	}
+	dir := s.pathLocal
+	if !filepath.IsAbs(s.pathLocal) {
+		dir = path.Join(workDir, s.pathLocal)
+	}
+	return []mount.Mount{
+		{
+			Type:   mount.TypeBind,
+			Source: path.Join(s.workDir, s.pathLocal),
+			Target: dir,
+		},
+	}, nil
+}
+
+func (s *SFTP) remoteDir() string {
+	return path.Join(s.config.Dir, s.pathRemote)
+}
+
+// session connects to the server for one transfer
+func (s *SFTP) session(ctx context.Context, transfer func(c *client) error) error {
+	key, err := os.ReadFile(s.config.IdentityFile)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s.config.HostKey))
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	port := s.config.Port
+	if port == 0 {
+		port = 22
+	}
+	addr := net.JoinHostPort(s.config.Host, strconv.Itoa(port))
+	log.Trace(ctx, "Connecting to the SFTP server", "addr", addr)
+	conn, err := ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            s.config.User,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.FixedHostKey(hostKey),
+		Timeout:         dialTimeout,
+	})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = conn.Close() }()
+	session, err := conn.NewSession()
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = session.Close() }()
+	w, err := session.StdinPipe()
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	r, err := session.StdoutPipe()
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if err = session.RequestSubsystem("sftp"); err != nil {
+		return gerrors.Wrap(err)
+	}
+	c, err := newClient(w, r)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(transfer(c))
+}
+
+// downloadDir copies the remote dir into the local one, a missing remote dir is an empty artifact
+func downloadDir(c *client, remote, local string) error {
+	entries, err := c.readDir(remote)
+	if err != nil {
+		if statusErr, ok := err.(StatusError); ok && statusErr.Code == fxNoSuchFile {
+			return nil
+		}
+		return gerrors.Wrap(err)
+	}
+	if err = os.MkdirAll(local, 0o755); err != nil {
+		return gerrors.Wrap(err)
+	}
+	for _, e := range entries {
+		if e.isDir() {
+			err = downloadDir(c, path.Join(remote, e.name), filepath.Join(local, e.name))
+		} else {
+			err = c.download(path.Join(remote, e.name), filepath.Join(local, e.name))
+		}
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// uploadDir copies the local dir into the remote one, the symlinks are skipped
+func uploadDir(c *client, local, remote string) error {
+	if err := c.mkdirAll(remote); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(local, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		target := path.Join(remote, filepath.ToSlash(rel))
+		switch {
+		case d.IsDir():
+			return c.mkdirAll(target)
+		case d.Type().IsRegular():
+			return c.upload(p, target)
+		}
+		return nil
+	})
+}
@@ -63,10 +63,15 @@ func (s *Simple) DockerBindings(workDir string) ([]mount.Mount, error) {
 }
 
 func NewSimple(bucket, region, workDir, pathLocal, pathRemote string, doSync bool) (*Simple, error) {
+	return NewWithCopier(bucket, client.New(region), workDir, pathLocal, pathRemote, doSync)
+}
+
+// NewWithCopier is NewSimple for the S3-compatible storages
+func NewWithCopier(bucket string, transfer *client.Copier, workDir, pathLocal, pathRemote string, doSync bool) (*Simple, error) {
 	s := &Simple{
 		bucket:     bucket,
 		workDir:    workDir,
-		transfer:   client.New(region),
+		transfer:   transfer,
 		pathLocal:  pathLocal,
 		pathRemote: pathRemote,
 		doSync:     doSync,
@@ -0,0 +1,210 @@
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?><d:propfind xmlns:d="DAV:"><d:prop><d:resourcetype/><d:getcontentlength/></d:prop></d:propfind>`
+
+// ErrNotFound is returned for the missing remote paths
+var ErrNotFound = errors.New("webdav: not found")
+
+type entry struct {
+	name string
+	dir  bool
+	size int64
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+				ContentLength string `xml:"getcontentlength"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+type client struct {
+	base     *url.URL
+	user     string
+	password string
+	http     *http.Client
+}
+
+func newClient(config Config) (*client, error) {
+	base, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, gerrors.Newf("webdav: unsupported URL %s", config.URL)
+	}
+	return &client{base: base, user: config.User, password: config.Password, http: http.DefaultClient}, nil
+}
+
+func (c *client) url(p string) string {
+	u := *c.base
+	u.Path = path.Join("/", c.base.Path, p)
+	return u.String()
+}
+
+func (c *client) do(ctx context.Context, method, p string, body io.Reader, header http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.url(p), body)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return resp, nil
+}
+
+// list returns the entries of the remote dir without the dir itself
+func (c *client) list(ctx context.Context, p string) ([]entry, error) {
+	resp, err := c.do(ctx, "PROPFIND", p, strings.NewReader(propfindBody), http.Header{
+		"Depth":        []string{"1"},
+		"Content-Type": []string{"application/xml"},
+	})
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, gerrors.Newf("webdav: PROPFIND %s: %s", p, resp.Status)
+	}
+	var result multistatus
+	if err = xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	self := strings.TrimSuffix(path.Join("/", c.base.Path, p), "/")
+	var entries []entry
+	for _, response := range result.Responses {
+		href, err := url.Parse(response.Href)
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		hrefPath := strings.TrimSuffix(href.Path, "/")
+		if hrefPath == self || hrefPath == "" {
+			continue
+		}
+		e := entry{name: path.Base(hrefPath)}
+		for _, propstat := range response.Propstat {
+			if propstat.Prop.ResourceType.Collection != nil {
+				e.dir = true
+			}
+			if size, err := strconv.ParseInt(propstat.Prop.ContentLength, 10, 64); err == nil {
+				e.size = size
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func (c *client) download(ctx context.Context, remote, local string) error {
+	resp, err := c.do(ctx, http.MethodGet, remote, nil, nil)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return gerrors.Newf("webdav: GET %s: %s", remote, resp.Status)
+	}
+	if err = os.MkdirAll(filepath.Dir(local), 0o755); err != nil {
+		return gerrors.Wrap(err)
+	}
+	file, err := os.Create(local)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	if _, err = io.Copy(file, resp.Body); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(file.Close())
+}
+
+func (c *client) upload(ctx context.Context, local, remote string) error {
+	file, err := os.Open(local)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.url(remote), file)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	// a known length keeps the servers from buffering the chunked uploads
+	req.ContentLength = info.Size()
+	if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return gerrors.Newf("webdav: PUT %s: %s", remote, resp.Status)
+	}
+	return nil
+}
+
+// mkcolAll makes the collection and its parents, the existing ones are kept
+func (c *client) mkcolAll(ctx context.Context, p string) error {
+	current := ""
+	for _, part := range strings.Split(strings.Trim(path.Clean("/"+p), "/"), "/") {
+		if part == "" {
+			continue
+		}
+		current = path.Join(current, part)
+		if err := c.mkcol(ctx, current); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+func (c *client) mkcol(ctx context.Context, p string) error {
+	resp, err := c.do(ctx, "MKCOL", p, nil, nil)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	_ = resp.Body.Close()
+	// 405 is the answer for the existing collections
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+		return gerrors.Newf("webdav: MKCOL %s: %s", p, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package webdav
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+var _ artifacts.Artifacter = (*WebDAV)(nil)
+
+// Config points to a WebDAV server keeping the artifacts under Dir of URL, e.g. the files endpoint of Nextcloud
+// https://cloud.example.com/remote.php/dav/files/<user>. With Nextcloud and ownCloud Password is an app password.
+type Config struct {
+	URL      string `yaml:"url"`
+	User     string `yaml:"user,omitempty"`
+	Password string `yaml:"password,omitempty"`
+	Dir      string `yaml:"dir,omitempty"`
+}
+
+// WebDAV downloads the artifact before the run and uploads it after, the FUSE mounts are not supported
+type WebDAV struct {
+	client     *client
+	dir        string
+	workDir    string
+	pathLocal  string
+	pathRemote string
+}
+
+func New(config Config, workDir, pathLocal, pathRemote string) (*WebDAV, error) {
+	c, err := newClient(config)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if err = os.MkdirAll(path.Join(workDir, pathLocal), 0o755); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return &WebDAV{
+		client:     c,
+		dir:        config.Dir,
+		workDir:    workDir,
+		pathLocal:  pathLocal,
+		pathRemote: pathRemote,
+	}, nil
+}
+
+func (w *WebDAV) BeforeRun(ctx context.Context) error {
+	log.Trace(ctx, "Download artifact", "artifact", w.pathLocal, "url", w.client.base.Host)
+	return downloadDir(ctx, w.client, w.remoteDir(), path.Join(w.workDir, w.pathLocal))
+}
+
+func (w *WebDAV) AfterRun(ctx context.Context) error {
+	log.Trace(ctx, "Upload artifact", "artifact", w.pathLocal, "url", w.client.base.Host)
+	return uploadDir(ctx, w.client, path.Join(w.workDir, w.pathLocal), w.remoteDir())
+}
+
+func (w *WebDAV) DockerBindings(workDir string) ([]mount.Mount, error) {
+	cleanPath := filepath.Clean(w.pathLocal)
+	if path.IsAbs(cleanPath) && path.Dir(cleanPath) == cleanPath {
+		return nil, errors.New("directory needs to be a non-root path")
+	}
+	dir := w.pathLocal
+	if !filepath.IsAbs(w.pathLocal) {
+		dir = path.Join(workDir, w.pathLocal)
+	}
+	return []mount.Mount{
+		{
+			Type:   mount.TypeBind,
+			Source: path.Join(w.workDir, w.pathLocal),
+			Target: dir,
+		},
+	}, nil
+}
+
+func (w *WebDAV) remoteDir() string {
+	return path.Join(w.dir, w.pathRemote)
+}
+
+// downloadDir copies the remote collection into the local dir, a missing collection is an empty artifact
+func downloadDir(ctx context.Context, c *client, remote, local string) error {
+	entries, err := c.list(ctx, remote)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if err = os.MkdirAll(local, 0o755); err != nil {
+		return gerrors.Wrap(err)
+	}
+	for _, e := range entries {
+		if e.dir {
+			err = downloadDir(ctx, c, path.Join(remote, e.name), filepath.Join(local, e.name))
+		} else {
+			err = c.download(ctx, path.Join(remote, e.name), filepath.Join(local, e.name))
+		}
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// uploadDir copies the local dir into the remote collection, the symlinks are skipped
+func uploadDir(ctx context.Context, c *client, local, remote string) error {
+	if err := c.mkcolAll(ctx, remote); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(local, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		target := path.Join(remote, filepath.ToSlash(rel))
+		switch {
+		case d.IsDir():
+			// the walk makes the parents first
+			return c.mkcol(ctx, target)
+		case d.Type().IsRegular():
+			return c.upload(ctx, p, target)
+		}
+		return nil
+	})
+}
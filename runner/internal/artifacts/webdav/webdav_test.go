@@ -0,0 +1,100 @@
+package webdav
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const davPrefix = "/remote.php/dav/files/user"
+
+// fakeDAV serves the WebDAV methods the client uses from a local dir
+func fakeDAV(root string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "user" || password != "app-password" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		p := filepath.Join(root, strings.TrimPrefix(r.URL.Path, davPrefix))
+		switch r.Method {
+		case "MKCOL":
+			if err := os.Mkdir(p, 0o755); err != nil {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodPut:
+			file, err := os.Create(p)
+			if err != nil {
+				w.WriteHeader(http.StatusConflict)
+				return
+			}
+			_, _ = io.Copy(file, r.Body)
+			_ = file.Close()
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			http.ServeFile(w, r, p)
+		case "PROPFIND":
+			entries, err := os.ReadDir(p)
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.WriteHeader(http.StatusMultiStatus)
+			_, _ = fmt.Fprintf(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+			writeResponse(w, r.URL.Path+"/", true, 0)
+			for _, e := range entries {
+				info, _ := e.Info()
+				writeResponse(w, path.Join(r.URL.Path, e.Name()), e.IsDir(), info.Size())
+			}
+			_, _ = fmt.Fprintf(w, `</d:multistatus>`)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+}
+
+func writeResponse(w io.Writer, href string, dir bool, size int64) {
+	resourceType := ""
+	if dir {
+		resourceType = "<d:collection/>"
+	}
+	_, _ = fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:resourcetype>%s</d:resourcetype><d:getcontentlength>%d</d:getcontentlength></d:prop></d:propstat></d:response>`,
+		(&url.URL{Path: href}).EscapedPath(), resourceType, size)
+}
+
+func TestUploadDownloadDir(t *testing.T) {
+	server := fakeDAV(t.TempDir())
+	defer server.Close()
+	c, err := newClient(Config{URL: server.URL + davPrefix, User: "user", Password: "app-password"})
+	assert.Equal(t, nil, err)
+	ctx := context.Background()
+
+	src := t.TempDir()
+	assert.Equal(t, nil, os.MkdirAll(filepath.Join(src, "model", "my weights"), 0o755))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(src, "model", "my weights", "model.bin"), []byte("weights"), 0o644))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(src, "config.json"), []byte("{}"), 0o644))
+	assert.Equal(t, nil, uploadDir(ctx, c, src, "dstack/artifacts/repo/job/output"))
+
+	dst := t.TempDir()
+	assert.Equal(t, nil, downloadDir(ctx, c, "dstack/artifacts/repo/job/output", dst))
+	weights, err := os.ReadFile(filepath.Join(dst, "model", "my weights", "model.bin"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "weights", string(weights))
+	config, err := os.ReadFile(filepath.Join(dst, "config.json"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "{}", string(config))
+
+	// a missing remote dir is an empty artifact
+	assert.Equal(t, nil, downloadDir(ctx, c, "dstack/artifacts/missing", t.TempDir()))
+}
@@ -9,10 +9,12 @@ import (
 	"path"
 	"strings"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/dstackai/dstack/runner/consts"
 	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/artifacts/rclone"
 	"github.com/dstackai/dstack/runner/internal/backend"
 	"github.com/dstackai/dstack/runner/internal/common"
 	"github.com/dstackai/dstack/runner/internal/gerrors"
@@ -37,10 +39,12 @@ type AzureBackend struct {
 	credential    *azidentity.DefaultAzureCredential
 	runnerID      string
 	state         *models.State
+	// jobETag is the ETag of the job file the runner has last read or written
+	jobETag *azcore.ETag
 }
 
 func init() {
-	backend.RegisterBackend("azure", func(ctx context.Context, pathConfig string) (backend.Backend, error) {
+	backend.Register("azure", func(ctx context.Context, pathConfig string) (backend.Backend, error) {
 		configFile := AzureConfig{}
 		log.Trace(ctx, "Read config file", "path", pathConfig)
 		fileContent, err := os.ReadFile(pathConfig)
@@ -116,10 +120,11 @@ func (azbackend *AzureBackend) Job(ctx context.Context) *models.Job {
 
 func (azbackend *AzureBackend) RefetchJob(ctx context.Context) (*models.Job, error) {
 	log.Trace(ctx, "Refetching job from state", "ID", azbackend.state.Job.JobID)
-	contents, err := azbackend.storage.GetFile(ctx, azbackend.state.Job.JobFilepath())
+	contents, etag, err := azbackend.storage.GetFileETag(ctx, azbackend.state.Job.JobFilepath())
 	if err != nil {
 		return nil, gerrors.Wrap(err)
 	}
+	azbackend.jobETag = etag
 	err = yaml.Unmarshal(contents, &azbackend.state.Job)
 	if err != nil {
 		return nil, gerrors.Wrap(err)
@@ -145,10 +150,11 @@ func (azbackend *AzureBackend) UpdateState(ctx context.Context) error {
 	}
 	jobFilepath := azbackend.state.Job.JobFilepath()
 	log.Trace(ctx, "Write to file job", "Path", jobFilepath)
-	err = azbackend.storage.PutFile(ctx, jobFilepath, contents)
+	etag, err := azbackend.storage.PutFileIfMatch(ctx, jobFilepath, contents, azbackend.jobETag)
 	if err != nil {
 		return gerrors.Wrap(err)
 	}
+	azbackend.jobETag = etag
 	log.Trace(ctx, "Fetching list jobs", "Repo username", azbackend.state.Job.RepoUserName, "Repo name", azbackend.state.Job.RepoName, "Job ID", azbackend.state.Job.JobID)
 	files, err := azbackend.storage.ListFile(ctx, azbackend.state.Job.JobHeadFilepathPrefix())
 	if err != nil {
@@ -187,6 +193,14 @@ func (azbackend *AzureBackend) IsInterrupted(ctx context.Context) (bool, error)
 	return false, nil
 }
 
+func (azbackend *AzureBackend) AttachVolume(ctx context.Context, name string) (string, error) {
+	return azbackend.compute.AttachVolume(ctx, azbackend.state.RequestID, name)
+}
+
+func (azbackend *AzureBackend) DetachVolume(ctx context.Context, name string) error {
+	return azbackend.compute.DetachVolume(ctx, azbackend.state.RequestID, name)
+}
+
 func (azbackend *AzureBackend) Shutdown(ctx context.Context) error {
 	log.Trace(ctx, "Starting shutdown")
 	err := azbackend.compute.TerminateInstance(ctx, azbackend.state.RequestID)
@@ -197,6 +211,22 @@ func (azbackend *AzureBackend) Shutdown(ctx context.Context) error {
 }
 
 func (azbackend *AzureBackend) GetArtifact(ctx context.Context, runName, localPath, remotePath string, mount bool) artifacts.Artifacter {
+	return azbackend.getArtifact(ctx, runName, localPath, remotePath, mount, false)
+}
+
+func (azbackend *AzureBackend) GetDataset(ctx context.Context, runName, localPath, remotePath string, mount bool) artifacts.Artifacter {
+	return azbackend.getArtifact(ctx, runName, localPath, remotePath, mount, true)
+}
+
+func (azbackend *AzureBackend) getArtifact(ctx context.Context, runName, localPath, remotePath string, mount, readOnly bool) artifacts.Artifacter {
+	if mount {
+		rootPath := path.Join(azbackend.GetTMPDir(ctx), consts.FUSE_DIR, runName)
+		art, err := rclone.New(ctx, rclone.Azure(azbackend.config.StorageAccount, azbackend.storage.container, remotePath), rootPath, localPath, readOnly)
+		if err == nil {
+			return art
+		}
+		log.Error(ctx, "Error FUSE artifact's engine, the artifact is copied instead", "err", err)
+	}
 	workDir := path.Join(azbackend.GetTMPDir(ctx), consts.USER_ARTIFACTS_DIR, runName)
 	return NewAzureArtifacter(azbackend.storage, workDir, localPath, remotePath)
 }
@@ -311,6 +341,27 @@ func (azbackend *AzureBackend) PutBuildDiff(ctx context.Context, src, key string
 	return nil
 }
 
+func (azbackend *AzureBackend) GetFile(ctx context.Context, key string) ([]byte, error) {
+	return azbackend.storage.GetFile(ctx, key)
+}
+
+func (azbackend *AzureBackend) PutFile(ctx context.Context, key string, contents []byte) error {
+	return azbackend.storage.PutFile(ctx, key, contents)
+}
+
+func (azbackend *AzureBackend) DeletePrefix(ctx context.Context, prefix string) error {
+	keys, err := azbackend.storage.ListFile(ctx, prefix)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	for _, key := range keys {
+		if err = azbackend.storage.DeleteFile(ctx, key); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	return nil
+}
+
 func (azbackend *AzureBackend) GetTMPDir(ctx context.Context) string {
 	return path.Join(common.HomeDir(), consts.TMP_DIR_PATH)
 }
@@ -2,6 +2,7 @@ package azure
 
 import (
 	"context"
+	"fmt"
 	"strings"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
@@ -14,6 +15,7 @@ type AzureCompute struct {
 	computeClient    armcompute.VirtualMachinesClient
 	interfacesClient armnetwork.InterfacesClient
 	ipAddressClient  armnetwork.PublicIPAddressesClient
+	subscriptionId   string
 	resourceGroup    string
 }
 
@@ -34,6 +36,7 @@ func NewAzureCompute(credential *azidentity.DefaultAzureCredential, subscription
 		computeClient:    *computeClient,
 		interfacesClient: *interfacesClient,
 		ipAddressClient:  *ipAddressClient,
+		subscriptionId:   subscriptionId,
 		resourceGroup:    resourceGroup,
 	}, nil
 }
@@ -65,6 +68,72 @@ func (azcompute AzureCompute) TerminateInstance(ctx context.Context, requestID s
 	return nil
 }
 
+// AttachVolume attaches the managed disk of the resource group to the VM at the lowest free LUN
+func (azcompute AzureCompute) AttachVolume(ctx context.Context, requestID, name string) (string, error) {
+	resp, err := azcompute.computeClient.Get(ctx, azcompute.resourceGroup, requestID, nil)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	vm := resp.VirtualMachine
+	storage := vm.Properties.StorageProfile
+	used := make(map[int32]bool)
+	for _, disk := range storage.DataDisks {
+		if disk.Name != nil && strings.EqualFold(*disk.Name, name) && disk.Lun != nil {
+			return lunDevice(*disk.Lun), nil
+		}
+		if disk.Lun != nil {
+			used[*disk.Lun] = true
+		}
+	}
+	lun := int32(0)
+	for used[lun] {
+		lun++
+	}
+	diskID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/disks/%s", azcompute.subscriptionId, azcompute.resourceGroup, name)
+	createOption := armcompute.DiskCreateOptionTypesAttach
+	storage.DataDisks = append(storage.DataDisks, &armcompute.DataDisk{
+		Lun:          &lun,
+		Name:         &name,
+		CreateOption: &createOption,
+		ManagedDisk:  &armcompute.ManagedDiskParameters{ID: &diskID},
+	})
+	if err = azcompute.updateVM(ctx, requestID, vm); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return lunDevice(lun), nil
+}
+
+func (azcompute AzureCompute) DetachVolume(ctx context.Context, requestID, name string) error {
+	resp, err := azcompute.computeClient.Get(ctx, azcompute.resourceGroup, requestID, nil)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	vm := resp.VirtualMachine
+	storage := vm.Properties.StorageProfile
+	disks := storage.DataDisks[:0]
+	for _, disk := range storage.DataDisks {
+		if disk.Name == nil || !strings.EqualFold(*disk.Name, name) {
+			disks = append(disks, disk)
+		}
+	}
+	storage.DataDisks = disks
+	return gerrors.Wrap(azcompute.updateVM(ctx, requestID, vm))
+}
+
+func (azcompute AzureCompute) updateVM(ctx context.Context, requestID string, vm armcompute.VirtualMachine) error {
+	poller, err := azcompute.computeClient.BeginCreateOrUpdate(ctx, azcompute.resourceGroup, requestID, vm, nil)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	_, err = poller.PollUntilDone(ctx, nil)
+	return gerrors.Wrap(err)
+}
+
+// lunDevice is the link the Azure Linux agent makes to the data disk of the LUN
+func lunDevice(lun int32) string {
+	return fmt.Sprintf("/dev/disk/azure/scsi1/lun%d", lun)
+}
+
 func getNetworkInterfaceName(networkInterfaceID string) string {
 	parts := strings.Split(networkInterfaceID, "/")
 	return parts[len(parts)-1]
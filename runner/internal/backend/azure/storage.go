@@ -13,7 +13,10 @@ import (
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/bloberror"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/dstackai/dstack/runner/internal/backend"
 	"github.com/dstackai/dstack/runner/internal/gerrors"
 )
 
@@ -63,6 +66,41 @@ func (azstorage AzureStorage) PutFile(ctx context.Context, key string, contents
 	return nil
 }
 
+// GetFileETag is GetFile with the ETag of the blob
+func (azstorage AzureStorage) GetFileETag(ctx context.Context, key string) ([]byte, *azcore.ETag, error) {
+	contents := bytes.Buffer{}
+	get, err := azstorage.containerClient.NewBlobClient(key).DownloadStream(ctx, nil)
+	if err != nil {
+		return nil, nil, gerrors.Wrap(err)
+	}
+	retryReader := get.NewRetryReader(ctx, &azblob.RetryReaderOptions{})
+	defer retryReader.Close()
+	if _, err = contents.ReadFrom(retryReader); err != nil {
+		return nil, nil, gerrors.Wrap(err)
+	}
+	return contents.Bytes(), get.ETag, nil
+}
+
+// PutFileIfMatch writes the blob if its ETag is still etag, unconditionally if nil, and returns the new ETag
+func (azstorage AzureStorage) PutFileIfMatch(ctx context.Context, key string, contents []byte, etag *azcore.ETag) (*azcore.ETag, error) {
+	var options *azblob.UploadBufferOptions
+	if etag != nil {
+		options = &azblob.UploadBufferOptions{
+			AccessConditions: &blob.AccessConditions{
+				ModifiedAccessConditions: &blob.ModifiedAccessConditions{IfMatch: etag},
+			},
+		}
+	}
+	resp, err := azstorage.storageClient.UploadBuffer(ctx, azstorage.container, key, contents, options)
+	if err != nil {
+		if bloberror.HasCode(err, bloberror.ConditionNotMet) {
+			return nil, gerrors.Wrap(backend.ErrStateConflict)
+		}
+		return nil, gerrors.Wrap(err)
+	}
+	return resp.ETag, nil
+}
+
 func (azstorage AzureStorage) ListFile(ctx context.Context, prefix string) ([]string, error) {
 	pager := azstorage.containerClient.NewListBlobsFlatPager(&azblob.ListBlobsFlatOptions{Prefix: &prefix})
 	var result []string
@@ -78,6 +116,14 @@ func (azstorage AzureStorage) ListFile(ctx context.Context, prefix string) ([]st
 	return result, nil
 }
 
+func (azstorage AzureStorage) DeleteFile(ctx context.Context, key string) error {
+	_, err := azstorage.containerClient.NewBlobClient(key).Delete(ctx, nil)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
 func (azstorage AzureStorage) RenameFile(ctx context.Context, oldKey, newKey string) error {
 	if oldKey == newKey {
 		return nil
@@ -4,20 +4,19 @@ import (
 	"context"
 	"errors"
 	"io"
-	"io/ioutil"
-	"os"
-	"path/filepath"
-	"sync"
 
 	"github.com/docker/docker/api/types/mount"
 	"github.com/dstackai/dstack/runner/internal/artifacts"
-	"github.com/dstackai/dstack/runner/internal/gerrors"
-	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/artifacts/client"
 	"github.com/dstackai/dstack/runner/internal/models"
-	"gopkg.in/yaml.v2"
 )
 
 var ErrLoadStateFile = errors.New("not load state file")
+var ErrNotFoundTask = errors.New("not found task")
+
+// ErrStateConflict is returned by UpdateState if the job file was changed since the runner read or wrote it, e.g. by the hub.
+// The first write after Init is unconditional.
+var ErrStateConflict = errors.New("job state was changed concurrently")
 
 type Backend interface {
 	Init(ctx context.Context, ID string) error
@@ -31,6 +30,8 @@ type Backend interface {
 	Shutdown(ctx context.Context) error
 	GetArtifact(ctx context.Context, runName, localPath, remotePath string, fs bool) artifacts.Artifacter
 	GetCache(ctx context.Context, runName, localPath, remotePath string) artifacts.Artifacter
+	// GetDataset is GetArtifact for input data, FUSE mounts are read-only
+	GetDataset(ctx context.Context, runName, localPath, remotePath string, fs bool) artifacts.Artifacter
 	CreateLogger(ctx context.Context, logGroup, logName string) io.Writer
 	ListSubDir(ctx context.Context, dir string) ([]string, error)
 	Bucket(ctx context.Context) string
@@ -41,54 +42,26 @@ type Backend interface {
 	GetRepoArchive(ctx context.Context, path, dst string) error
 	GetBuildDiff(ctx context.Context, key, dst string) error
 	PutBuildDiff(ctx context.Context, src, key string) error
+	GetFile(ctx context.Context, key string) ([]byte, error)
+	PutFile(ctx context.Context, key string, contents []byte) error
+	DeletePrefix(ctx context.Context, prefix string) error
 	GetTMPDir(ctx context.Context) string
 	GetDockerBindings(ctx context.Context) []mount.Mount
 }
 
-type File struct {
-	Backend string `yaml:"backend"`
+// Locator is implemented by the cloud backends, Region is where the instance runs, e.g. the AWS region or the GCP zone
+type Locator interface {
+	Region() string
 }
 
-var DefaultBackend Backend
-var backends map[string]LoadFn
-var mu = sync.Mutex{}
-var ErrNotFoundTask = errors.New("not found task")
-
-type LoadFn func(ctx context.Context, path string) (Backend, error)
-
-func RegisterBackend(name string, fn LoadFn) {
-	mu.Lock()
-	defer mu.Unlock()
-	if backends == nil {
-		backends = make(map[string]LoadFn)
-	}
-	backends[name] = fn
+// Volumes is implemented by the cloud backends that attach the persistent disks to the instance: the EBS volumes,
+// the persistent disks and the managed disks. AttachVolume returns the device the disk appears at.
+type Volumes interface {
+	AttachVolume(ctx context.Context, name string) (string, error)
+	DetachVolume(ctx context.Context, name string) error
 }
 
-func New(ctx context.Context, path string) (Backend, error) {
-	log.Trace(ctx, "Create backend")
-	mu.Lock()
-	defer mu.Unlock()
-	file := File{}
-	log.Trace(ctx, "Read config for backend", "path", path)
-	if _, err := os.Stat(filepath.Join(path)); err != nil {
-		return DefaultBackend, nil
-	}
-	theConfig, err := ioutil.ReadFile(path)
-	if err != nil {
-		return nil, gerrors.Wrap(err)
-	}
-	log.Trace(ctx, "Unmarshal config")
-	err = yaml.Unmarshal(theConfig, &file)
-	if err != nil {
-		return nil, gerrors.Wrap(err)
-	}
-	log.Trace(ctx, "Engine backend", "engine", file.Backend)
-	if _, ok := backends[file.Backend]; !ok {
-		return nil, gerrors.Newf("backend not found: %s", file.Backend)
-	}
-	if backends[file.Backend] == nil {
-		return nil, gerrors.Newf("backend loading error : %s", file.Backend)
-	}
-	return backends[file.Backend](ctx, path)
+// Transfers is implemented by the backends that tune the artifact transfers with the runner settings
+type Transfers interface {
+	SetTransfer(ctx context.Context, opts client.Options) error
 }
@@ -1 +1,45 @@
 package backend
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPollStop(t *testing.T) {
+	calls := 0
+	stopCh := PollStop(context.Background(), func(ctx context.Context) (bool, error) {
+		calls++
+		return calls == 3, nil
+	}, time.Millisecond)
+	select {
+	case <-stopCh:
+	case <-time.After(time.Second):
+		t.Fatal("stop request is not delivered")
+	}
+	assert.Equal(t, 3, calls)
+}
+
+// unregister removes the backend registered by the test, the registry is global
+func unregister(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(factories, name)
+}
+
+func TestRegistry(t *testing.T) {
+	t.Cleanup(func() { unregister("test") })
+	Register("test", func(ctx context.Context, path string) (Backend, error) {
+		return nil, nil
+	})
+	assert.Contains(t, Registered(), "test")
+	assert.Panics(t, func() {
+		Register("test", func(ctx context.Context, path string) (Backend, error) { return nil, nil })
+	})
+	_, err := New(context.Background(), "test", "")
+	assert.Equal(t, nil, err)
+	_, err = New(context.Background(), "missing", "")
+	assert.NotEqual(t, nil, err)
+}
@@ -15,6 +15,7 @@ import (
 
 	"github.com/dstackai/dstack/runner/consts"
 	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/artifacts/rclone"
 	"github.com/dstackai/dstack/runner/internal/backend"
 	"github.com/dstackai/dstack/runner/internal/common"
 	"github.com/dstackai/dstack/runner/internal/gerrors"
@@ -33,6 +34,8 @@ type GCPBackend struct {
 	logging       *GCPLogging
 	runnerID      string
 	state         *models.State
+	// jobGeneration is the generation of the job file the runner has last read or written
+	jobGeneration int64
 }
 
 type GCPConfigFile struct {
@@ -42,7 +45,7 @@ type GCPConfigFile struct {
 }
 
 func init() {
-	backend.RegisterBackend("gcp", func(ctx context.Context, pathConfig string) (backend.Backend, error) {
+	backend.Register("gcp", func(ctx context.Context, pathConfig string) (backend.Backend, error) {
 		configFile := GCPConfigFile{}
 		log.Trace(ctx, "Read config file", "path", pathConfig)
 		fileContent, err := ioutil.ReadFile(pathConfig)
@@ -108,10 +111,11 @@ func (gbackend *GCPBackend) Job(ctx context.Context) *models.Job {
 
 func (gbackend *GCPBackend) RefetchJob(ctx context.Context) (*models.Job, error) {
 	log.Trace(ctx, "Refetching job from state", "ID", gbackend.state.Job.JobID)
-	contents, err := gbackend.storage.GetFile(ctx, gbackend.state.Job.JobFilepath())
+	contents, generation, err := gbackend.storage.GetFileGeneration(ctx, gbackend.state.Job.JobFilepath())
 	if err != nil {
 		return nil, gerrors.Wrap(err)
 	}
+	gbackend.jobGeneration = generation
 	err = yaml.Unmarshal(contents, &gbackend.state.Job)
 	if err != nil {
 		return nil, gerrors.Wrap(err)
@@ -127,10 +131,11 @@ func (gbackend *GCPBackend) UpdateState(ctx context.Context) error {
 	}
 	jobFilepath := gbackend.state.Job.JobFilepath()
 	log.Trace(ctx, "Write to file job", "Path", jobFilepath)
-	err = gbackend.storage.PutFile(ctx, jobFilepath, contents)
+	generation, err := gbackend.storage.PutFileIfGeneration(ctx, jobFilepath, contents, gbackend.jobGeneration)
 	if err != nil {
 		return gerrors.Wrap(err)
 	}
+	gbackend.jobGeneration = generation
 	log.Trace(ctx, "Fetching list jobs", "Repo username", gbackend.state.Job.RepoUserName, "Repo name", gbackend.state.Job.RepoName, "Job ID", gbackend.state.Job.JobID)
 	files, err := gbackend.storage.ListFile(ctx, gbackend.state.Job.JobHeadFilepathPrefix())
 	if err != nil {
@@ -189,6 +194,22 @@ func (gbackend *GCPBackend) Shutdown(ctx context.Context) error {
 }
 
 func (gbackend *GCPBackend) GetArtifact(ctx context.Context, runName, localPath, remotePath string, mount bool) artifacts.Artifacter {
+	return gbackend.getArtifact(ctx, runName, localPath, remotePath, mount, false)
+}
+
+func (gbackend *GCPBackend) GetDataset(ctx context.Context, runName, localPath, remotePath string, mount bool) artifacts.Artifacter {
+	return gbackend.getArtifact(ctx, runName, localPath, remotePath, mount, true)
+}
+
+func (gbackend *GCPBackend) getArtifact(ctx context.Context, runName, localPath, remotePath string, mount, readOnly bool) artifacts.Artifacter {
+	if mount {
+		rootPath := path.Join(gbackend.GetTMPDir(ctx), consts.FUSE_DIR, runName)
+		art, err := rclone.New(ctx, rclone.GCS(gbackend.bucket, remotePath), rootPath, localPath, readOnly)
+		if err == nil {
+			return art
+		}
+		log.Error(ctx, "Error FUSE artifact's engine, the artifact is copied instead", "err", err)
+	}
 	workDir := path.Join(gbackend.GetTMPDir(ctx), consts.USER_ARTIFACTS_DIR, runName)
 	return NewGCPArtifacter(gbackend.storage, workDir, localPath, remotePath, false)
 }
@@ -236,6 +257,18 @@ func (gbackend *GCPBackend) GetJobByPath(ctx context.Context, path string) (*mod
 	return job, nil
 }
 
+func (gbackend *GCPBackend) AttachVolume(ctx context.Context, name string) (string, error) {
+	return gbackend.compute.AttachVolume(ctx, gbackend.state.RequestID, name)
+}
+
+func (gbackend *GCPBackend) DetachVolume(ctx context.Context, name string) error {
+	return gbackend.compute.DetachVolume(ctx, gbackend.state.RequestID, name)
+}
+
+func (gbackend *GCPBackend) Region() string {
+	return gbackend.zone
+}
+
 func (gbackend *GCPBackend) Bucket(ctx context.Context) string {
 	log.Trace(ctx, "Getting bucket")
 	return gbackend.bucket
@@ -309,6 +342,27 @@ func (gbackend *GCPBackend) PutBuildDiff(ctx context.Context, src, key string) e
 	return nil
 }
 
+func (gbackend *GCPBackend) GetFile(ctx context.Context, key string) ([]byte, error) {
+	return gbackend.storage.GetFile(ctx, key)
+}
+
+func (gbackend *GCPBackend) PutFile(ctx context.Context, key string, contents []byte) error {
+	return gbackend.storage.PutFile(ctx, key, contents)
+}
+
+func (gbackend *GCPBackend) DeletePrefix(ctx context.Context, prefix string) error {
+	keys, err := gbackend.storage.ListFile(ctx, prefix)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	for _, key := range keys {
+		if err = gbackend.storage.DeleteFile(ctx, key); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	return nil
+}
+
 func (gbackend *GCPBackend) GetTMPDir(ctx context.Context) string {
 	return path.Join(common.HomeDir(), consts.TMP_DIR_PATH)
 }
@@ -2,6 +2,7 @@ package gcp
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -66,3 +67,53 @@ func (gcompute *GCPCompute) IsInterruptedSpot(ctx context.Context, instanceID st
 	}
 	return string(body) == "TRUE", nil
 }
+
+// AttachVolume attaches the persistent disk of the zone to the instance, the disk name is its device name
+func (gcompute *GCPCompute) AttachVolume(ctx context.Context, instanceID, name string) (string, error) {
+	log.Trace(ctx, "Attach disk", "ID", instanceID, "disk", name)
+	source := fmt.Sprintf("projects/%s/zones/%s/disks/%s", gcompute.project, gcompute.zone, name)
+	device := fmt.Sprintf("/dev/disk/by-id/google-%s", name)
+	instance, err := gcompute.instancesClient.Get(ctx, &computepb.GetInstanceRequest{
+		Instance: instanceID,
+		Project:  gcompute.project,
+		Zone:     gcompute.zone,
+	})
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	for _, disk := range instance.GetDisks() {
+		if strings.HasSuffix(disk.GetSource(), source) {
+			return device, nil
+		}
+	}
+	op, err := gcompute.instancesClient.AttachDisk(ctx, &computepb.AttachDiskInstanceRequest{
+		AttachedDiskResource: &computepb.AttachedDisk{
+			Source:     &source,
+			DeviceName: &name,
+		},
+		Instance: instanceID,
+		Project:  gcompute.project,
+		Zone:     gcompute.zone,
+	})
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	if err = op.Wait(ctx); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return device, nil
+}
+
+func (gcompute *GCPCompute) DetachVolume(ctx context.Context, instanceID, name string) error {
+	log.Trace(ctx, "Detach disk", "ID", instanceID, "disk", name)
+	op, err := gcompute.instancesClient.DetachDisk(ctx, &computepb.DetachDiskInstanceRequest{
+		DeviceName: name,
+		Instance:   instanceID,
+		Project:    gcompute.project,
+		Zone:       gcompute.zone,
+	})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(op.Wait(ctx))
+}
@@ -6,12 +6,14 @@ import (
 	"errors"
 	"io"
 	"io/fs"
+	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/dstackai/dstack/runner/internal/backend"
 	"github.com/dstackai/dstack/runner/internal/backend/base"
 	"github.com/dstackai/dstack/runner/internal/common"
 	"go.uber.org/atomic"
@@ -19,6 +21,7 @@ import (
 	"cloud.google.com/go/storage"
 	"github.com/dstackai/dstack/runner/internal/gerrors"
 	"github.com/dstackai/dstack/runner/internal/log"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
 )
 
@@ -80,6 +83,41 @@ func (gstorage *GCPStorage) PutFile(ctx context.Context, key string, contents []
 	return writer.Close()
 }
 
+// GetFileGeneration is GetFile with the generation of the object
+func (gstorage *GCPStorage) GetFileGeneration(ctx context.Context, key string) ([]byte, int64, error) {
+	reader, err := gstorage.bucket.Object(key).NewReader(ctx)
+	if err != nil {
+		return nil, 0, gerrors.Wrap(err)
+	}
+	defer reader.Close()
+	buffer := new(bytes.Buffer)
+	if _, err = io.Copy(buffer, reader); err != nil {
+		return nil, 0, gerrors.Wrap(err)
+	}
+	return buffer.Bytes(), reader.Attrs.Generation, nil
+}
+
+// PutFileIfGeneration writes the object if it is still of the generation, any if zero, and returns the new generation
+func (gstorage *GCPStorage) PutFileIfGeneration(ctx context.Context, key string, contents []byte, generation int64) (int64, error) {
+	obj := gstorage.bucket.Object(key)
+	if generation != 0 {
+		obj = obj.If(storage.Conditions{GenerationMatch: generation})
+	}
+	writer := obj.NewWriter(ctx)
+	if _, err := io.Copy(writer, bytes.NewReader(contents)); err != nil {
+		_ = writer.Close()
+		return 0, gerrors.Wrap(err)
+	}
+	if err := writer.Close(); err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusPreconditionFailed {
+			return 0, gerrors.Wrap(backend.ErrStateConflict)
+		}
+		return 0, gerrors.Wrap(err)
+	}
+	return writer.Attrs().Generation, nil
+}
+
 func (gstorage *GCPStorage) ListFile(ctx context.Context, prefix string) ([]string, error) {
 	query := &storage.Query{Prefix: prefix}
 	names := make([]string, 0)
@@ -13,6 +13,7 @@ import (
 
 	"github.com/docker/docker/api/types/mount"
 	"github.com/dstackai/dstack/runner/internal/repo"
+	"github.com/fsnotify/fsnotify"
 
 	"github.com/dstackai/dstack/runner/consts"
 	"github.com/dstackai/dstack/runner/consts/states"
@@ -30,6 +31,8 @@ type LocalConfigFile struct {
 	Namespace string `yaml:"namespace"`
 }
 
+var _ backend.StopWatcher = (*Local)(nil)
+
 type Local struct {
 	namespace string
 	path      string
@@ -37,12 +40,14 @@ type Local struct {
 	state     *models.State
 	storage   *LocalStorage
 	cliSecret *ClientSecret
+	// jobSum is the checksum of the job file the runner has last read or written
+	jobSum string
 }
 
 const LOCAL_BACKEND_DIR = "local_backend"
 
 func init() {
-	backend.RegisterBackend("local", func(ctx context.Context, pathConfig string) (backend.Backend, error) {
+	backend.Register("local", func(ctx context.Context, pathConfig string) (backend.Backend, error) {
 		config := LocalConfigFile{}
 		fileContent, err := ioutil.ReadFile(pathConfig)
 		if err != nil {
@@ -95,6 +100,7 @@ func (l *Local) RefetchJob(ctx context.Context) (*models.Job, error) {
 	if err != nil {
 		return nil, gerrors.Wrap(err)
 	}
+	l.jobSum = fileSum(contents)
 	err = yaml.Unmarshal(contents, &l.state.Job)
 	if err != nil {
 		return nil, gerrors.Wrap(err)
@@ -129,10 +135,11 @@ func (l *Local) UpdateState(ctx context.Context) error {
 	}
 	jobPath := l.state.Job.JobFilepath()
 	log.Trace(ctx, "Write to file job", "Path", jobPath)
-	err = l.storage.PutFile(jobPath, contents)
+	sum, err := l.storage.PutFileIfUnchanged(jobPath, contents, l.jobSum)
 	if err != nil {
 		return gerrors.Wrap(err)
 	}
+	l.jobSum = sum
 	log.Trace(ctx, "Fetching list jobs", "Repo username", l.state.Job.RepoUserName, "Repo name", l.state.Job.RepoName, "Job ID", l.state.Job.JobID)
 	files, err := l.storage.ListFile(l.state.Job.JobHeadFilepathPrefix())
 	if err != nil {
@@ -175,6 +182,52 @@ func (l *Local) CheckStop(ctx context.Context) (bool, error) {
 	return false, nil
 }
 
+// WatchStop checks the runner metadata file whenever it is written. The directory is watched,
+// since the file may be replaced rather than written in place.
+func (l *Local) WatchStop(ctx context.Context) (<-chan struct{}, error) {
+	pathStateFile := filepath.Join(l.path, fmt.Sprintf("runners/m;%s.yaml", l.runnerID))
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if err = watcher.Add(filepath.Dir(pathStateFile)); err != nil {
+		_ = watcher.Close()
+		return nil, gerrors.Wrap(err)
+	}
+	stopCh := make(chan struct{})
+	go func() {
+		defer func() { _ = watcher.Close() }()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != pathStateFile || event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+					continue
+				}
+				stopped, err := l.CheckStop(ctx)
+				if err != nil {
+					log.Error(ctx, "Failed to check stop request", "err", err)
+					continue
+				}
+				if stopped {
+					close(stopCh)
+					return
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Error(ctx, "Failed to watch stop requests", "err", err)
+			}
+		}
+	}()
+	return stopCh, nil
+}
+
 func (l *Local) IsInterrupted(ctx context.Context) (bool, error) {
 	return false, nil
 }
@@ -185,7 +238,7 @@ func (l *Local) Shutdown(ctx context.Context) error {
 }
 
 func (l *Local) GetArtifact(ctx context.Context, runName, localPath, remotePath string, _ bool) artifacts.Artifacter {
-	rootPath := path.Join(l.GetTMPDir(ctx), consts.USER_ARTIFACTS_DIR, runName)
+	rootPath := filepath.Join(l.GetTMPDir(ctx), consts.USER_ARTIFACTS_DIR, runName)
 	log.Trace(ctx, "Create simple artifact's engine. Local", "Root path", rootPath)
 	art, err := local.NewLocal(l.path, rootPath, localPath, remotePath)
 	if err != nil {
@@ -199,6 +252,10 @@ func (l *Local) GetCache(ctx context.Context, runName, localPath, remotePath str
 	return l.GetArtifact(ctx, runName, localPath, remotePath, false)
 }
 
+func (l *Local) GetDataset(ctx context.Context, runName, localPath, remotePath string, _ bool) artifacts.Artifacter {
+	return l.GetArtifact(ctx, runName, localPath, remotePath, false)
+}
+
 func (l *Local) CreateLogger(ctx context.Context, logGroup, logName string) io.Writer {
 	log.Trace(ctx, "Build logger", "LogGroup", logGroup, "LogName", logName)
 	logger, err := NewLogger(l.state.Job.JobID, l.path, logGroup, logName)
@@ -284,8 +341,26 @@ func (l *Local) PutBuildDiff(ctx context.Context, src, key string) error {
 	return errors.New("not implemented")
 }
 
+func (l *Local) GetFile(ctx context.Context, key string) ([]byte, error) {
+	return l.storage.GetFile(key)
+}
+
+func (l *Local) PutFile(ctx context.Context, key string, contents []byte) error {
+	if err := os.MkdirAll(filepath.Join(l.path, filepath.Dir(key)), 0o755); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return l.storage.PutFile(key, contents)
+}
+
+func (l *Local) DeletePrefix(ctx context.Context, prefix string) error {
+	if err := os.RemoveAll(filepath.Join(l.path, prefix)); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
 func (l *Local) GetTMPDir(ctx context.Context) string {
-	return path.Join(l.path, "tmp")
+	return filepath.Join(l.path, "tmp")
 }
 
 func (l *Local) GetDockerBindings(ctx context.Context) []mount.Mount {
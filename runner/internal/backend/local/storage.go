@@ -1,10 +1,14 @@
 package local
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
+	"github.com/dstackai/dstack/runner/internal/backend"
 	"github.com/dstackai/dstack/runner/internal/gerrors"
 )
 
@@ -41,6 +45,28 @@ func (lstorage *LocalStorage) PutFile(path string, contents []byte) error {
 	return nil
 }
 
+// PutFileIfUnchanged writes the file if its checksum is still sum, unconditionally if empty, and returns the new checksum
+func (lstorage *LocalStorage) PutFileIfUnchanged(path string, contents []byte, sum string) (string, error) {
+	if sum != "" {
+		current, err := lstorage.GetFile(path)
+		if err != nil {
+			return "", gerrors.Wrap(err)
+		}
+		if fileSum(current) != sum {
+			return "", gerrors.Wrap(backend.ErrStateConflict)
+		}
+	}
+	if err := lstorage.PutFile(path, contents); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return fileSum(contents), nil
+}
+
+func fileSum(contents []byte) string {
+	sum := sha256.Sum256(contents)
+	return hex.EncodeToString(sum[:])
+}
+
 func (lstorage *LocalStorage) RenameFile(oldKey, newKey string) error {
 	if oldKey == newKey {
 		return nil
@@ -72,17 +98,18 @@ func (lstorage *LocalStorage) RenameFile(oldKey, newKey string) error {
 	return nil
 }
 
+// ListFile lists the keys starting with prefix in its dir, the keys are slash-separated on every OS
 func (lstorage *LocalStorage) ListFile(prefix string) ([]string, error) {
-	dirpath := filepath.Dir(prefix)
-	filePrefix := filepath.Base(prefix)
-	entries, err := os.ReadDir(filepath.Join(lstorage.basepath, dirpath))
+	dirpath := path.Dir(prefix)
+	filePrefix := path.Base(prefix)
+	entries, err := os.ReadDir(filepath.Join(lstorage.basepath, filepath.FromSlash(dirpath)))
 	if err != nil {
 		return nil, gerrors.Wrap(err)
 	}
 	fileNames := make([]string, 0)
 	for _, entry := range entries {
 		if strings.HasPrefix(entry.Name(), filePrefix) {
-			fileNames = append(fileNames, filepath.Join(dirpath, entry.Name()))
+			fileNames = append(fileNames, path.Join(dirpath, entry.Name()))
 		}
 	}
 	return fileNames, nil
@@ -0,0 +1,87 @@
+package backend
+
+import (
+	"context"
+	"io/ioutil"
+	"plugin"
+	"sort"
+	"sync"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"gopkg.in/yaml.v2"
+)
+
+// File is the backend config, Backend is the registered name of the backend
+type File struct {
+	Backend string `yaml:"backend"`
+}
+
+// Factory creates the backend from its config file
+type Factory func(ctx context.Context, path string) (Backend, error)
+
+var (
+	registryMu sync.Mutex
+	factories  = make(map[string]Factory)
+)
+
+// Register makes the backend available by name. The built-in backends register in their init, the custom ones
+// do the same in a package linked into the runner or in a Go plugin. Register panics if the name is taken.
+func Register(name string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("backend: nil factory of " + name)
+	}
+	if _, ok := factories[name]; ok {
+		panic("backend: registered twice: " + name)
+	}
+	factories[name] = factory
+}
+
+// Registered lists the names of the registered backends
+func Registered() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadPlugins opens the Go plugins, they register their backends in init
+func LoadPlugins(ctx context.Context, paths []string) error {
+	for _, path := range paths {
+		log.Trace(ctx, "Load backend plugin", "path", path)
+		if _, err := plugin.Open(path); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// New creates the backend by name, the name of the backend config file at path is used if it's empty
+func New(ctx context.Context, name, path string) (Backend, error) {
+	if name == "" {
+		log.Trace(ctx, "Read config for backend", "path", path)
+		theConfig, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		file := File{}
+		if err = yaml.Unmarshal(theConfig, &file); err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		name = file.Backend
+	}
+	log.Trace(ctx, "Create backend", "backend", name)
+	registryMu.Lock()
+	factory, ok := factories[name]
+	registryMu.Unlock()
+	if !ok {
+		return nil, gerrors.Newf("backend not found: %s, registered: %v", name, Registered())
+	}
+	return factory(ctx, path)
+}
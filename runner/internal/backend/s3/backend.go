@@ -12,12 +12,15 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/dstackai/dstack/runner/internal/repo"
 
 	"github.com/dstackai/dstack/runner/consts"
 	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/artifacts/client"
+	"github.com/dstackai/dstack/runner/internal/artifacts/rclone"
 	"github.com/dstackai/dstack/runner/internal/artifacts/s3fs"
 	"github.com/dstackai/dstack/runner/internal/artifacts/simple"
 	"github.com/dstackai/dstack/runner/internal/backend"
@@ -38,6 +41,11 @@ type S3 struct {
 	cliEC2    *ClientEC2
 	cliSecret *ClientSecret
 	logger    *Logger
+	// jobETag is the ETag of the job file the runner has last read or written
+	jobETag string
+	// transfer tunes the artifacts and the build diffs, cliTransfer moves the build diffs with it
+	transfer    client.Options
+	cliTransfer *s3.Client
 }
 
 type File struct {
@@ -46,7 +54,7 @@ type File struct {
 }
 
 func init() {
-	backend.RegisterBackend("aws", func(ctx context.Context, pathConfig string) (backend.Backend, error) {
+	backend.Register("aws", func(ctx context.Context, pathConfig string) (backend.Backend, error) {
 		file := File{}
 		log.Trace(ctx, "Read config file", "path", pathConfig)
 		theConfig, err := ioutil.ReadFile(pathConfig)
@@ -120,10 +128,11 @@ func (s *S3) Job(ctx context.Context) *models.Job {
 
 func (s *S3) RefetchJob(ctx context.Context) (*models.Job, error) {
 	log.Trace(ctx, "Refetching job from state", "ID", s.state.Job.JobID)
-	contents, err := s.cliS3.GetFile(ctx, s.bucket, s.state.Job.JobFilepath())
+	contents, etag, err := s.cliS3.GetFileETag(ctx, s.bucket, s.state.Job.JobFilepath())
 	if err != nil {
 		return nil, gerrors.Wrap(err)
 	}
+	s.jobETag = etag
 	err = yaml.Unmarshal(contents, &s.state.Job)
 	if err != nil {
 		return nil, gerrors.Wrap(err)
@@ -147,10 +156,11 @@ func (s *S3) UpdateState(ctx context.Context) error {
 	}
 	jobFilepath := s.state.Job.JobFilepath()
 	log.Trace(ctx, "Write to file job", "Path", jobFilepath)
-	err = s.cliS3.PutFile(ctx, s.bucket, jobFilepath, theFile)
+	etag, err := s.cliS3.PutFileIfMatch(ctx, s.bucket, jobFilepath, theFile, s.jobETag)
 	if err != nil {
 		return gerrors.Wrap(err)
 	}
+	s.jobETag = etag
 	log.Trace(ctx, "Fetching list jobs", "Repo username", s.state.Job.RepoUserName, "Repo name", s.state.Job.RepoName, "Job ID", s.state.Job.JobID)
 	files, err := s.cliS3.ListFile(ctx, s.bucket, s.state.Job.JobHeadFilepathPrefix())
 	if err != nil {
@@ -216,11 +226,26 @@ func (s *S3) Shutdown(ctx context.Context) error {
 }
 
 func (s *S3) GetArtifact(ctx context.Context, runName, localPath, remotePath string, mount bool) artifacts.Artifacter {
+	return s.getArtifact(ctx, runName, localPath, remotePath, mount, false)
+}
+
+func (s *S3) GetDataset(ctx context.Context, runName, localPath, remotePath string, mount bool) artifacts.Artifacter {
+	return s.getArtifact(ctx, runName, localPath, remotePath, mount, true)
+}
+
+func (s *S3) getArtifact(ctx context.Context, runName, localPath, remotePath string, mount, readOnly bool) artifacts.Artifacter {
 	if s == nil {
 		return nil
 	}
 	if mount {
 		rootPath := path.Join(s.GetTMPDir(ctx), consts.FUSE_DIR, runName)
+		if rclone.Available() {
+			art, err := rclone.New(ctx, rclone.S3(s.bucket, s.region, remotePath), rootPath, localPath, readOnly)
+			if err == nil {
+				return art
+			}
+			log.Error(ctx, "Error rclone FUSE artifact's engine, falling back to s3fs", "err", err)
+		}
 		iamRole := fmt.Sprintf("dstack_role_%s", strings.ReplaceAll(s.bucket, "-", "_"))
 		log.Trace(ctx, "Create FUSE artifact's engine", "Region", s.region, "Root path", rootPath, "IAM Role", iamRole)
 		art, err := s3fs.New(ctx, s.bucket, s.region, iamRole, rootPath, localPath, remotePath)
@@ -232,7 +257,7 @@ func (s *S3) GetArtifact(ctx context.Context, runName, localPath, remotePath str
 	}
 	rootPath := path.Join(s.GetTMPDir(ctx), consts.USER_ARTIFACTS_DIR, runName)
 	log.Trace(ctx, "Create simple artifact's engine", "Region", s.region, "Root path", rootPath)
-	art, err := simple.NewSimple(s.bucket, s.region, rootPath, localPath, remotePath, false)
+	art, err := simple.NewWithCopier(s.bucket, client.NewWithOptions(s.region, s.transfer), rootPath, localPath, remotePath, false)
 	if err != nil {
 		log.Error(ctx, "Error create simple engine", "err", err)
 		return nil
@@ -242,7 +267,7 @@ func (s *S3) GetArtifact(ctx context.Context, runName, localPath, remotePath str
 
 func (s *S3) GetCache(ctx context.Context, runName, localPath, remotePath string) artifacts.Artifacter {
 	rootPath := path.Join(s.GetTMPDir(ctx), consts.USER_ARTIFACTS_DIR, runName)
-	art, err := simple.NewSimple(s.bucket, s.region, rootPath, localPath, remotePath, true)
+	art, err := simple.NewWithCopier(s.bucket, client.NewWithOptions(s.region, s.transfer), rootPath, localPath, remotePath, true)
 	if err != nil {
 		log.Error(ctx, "Error create simple engine", "err", err)
 		return nil
@@ -336,6 +361,18 @@ func (s *S3) GetJobByPath(ctx context.Context, path string) (*models.Job, error)
 	return job, nil
 }
 
+func (s *S3) AttachVolume(ctx context.Context, name string) (string, error) {
+	return s.cliEC2.AttachVolume(ctx, name)
+}
+
+func (s *S3) DetachVolume(ctx context.Context, name string) error {
+	return s.cliEC2.DetachVolume(ctx, name)
+}
+
+func (s *S3) Region() string {
+	return s.region
+}
+
 func (s *S3) Bucket(ctx context.Context) string {
 	log.Trace(ctx, "Getting bucket")
 	if s == nil {
@@ -418,8 +455,27 @@ func (s *S3) GetRepoArchive(ctx context.Context, path, dir string) error {
 	return nil
 }
 
+// SetTransfer applies the acceleration and the bandwidth limits of the runner to the artifacts and the build diffs.
+// The state files are small and keep the regular endpoint, so a saturated link doesn't delay the heartbeats.
+func (s *S3) SetTransfer(ctx context.Context, opts client.Options) error {
+	cfg, err := config.LoadDefaultConfig(ctx, append([]func(*config.LoadOptions) error{config.WithRegion(s.region)}, opts.LoadOptions()...)...)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	s.transfer = opts
+	s.cliTransfer = s3.NewFromConfig(cfg, opts.ClientOptions)
+	return nil
+}
+
+func (s *S3) transferClient() *s3.Client {
+	if s.cliTransfer != nil {
+		return s.cliTransfer
+	}
+	return s.cliS3.cli
+}
+
 func (s *S3) GetBuildDiff(ctx context.Context, key, dst string) error {
-	out, err := s.cliS3.cli.GetObject(ctx, &s3.GetObjectInput{
+	out, err := s.transferClient().GetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 	})
@@ -445,7 +501,7 @@ func (s *S3) PutBuildDiff(ctx context.Context, src, key string) error {
 		return gerrors.Wrap(err)
 	}
 	defer func() { _ = file.Close() }()
-	_, err = s.cliS3.cli.PutObject(ctx, &s3.PutObjectInput{
+	_, err = s.transferClient().PutObject(ctx, &s3.PutObjectInput{
 		Bucket: aws.String(s.bucket),
 		Key:    aws.String(key),
 		Body:   file,
@@ -456,6 +512,27 @@ func (s *S3) PutBuildDiff(ctx context.Context, src, key string) error {
 	return nil
 }
 
+func (s *S3) GetFile(ctx context.Context, key string) ([]byte, error) {
+	return s.cliS3.GetFile(ctx, s.bucket, key)
+}
+
+func (s *S3) PutFile(ctx context.Context, key string, contents []byte) error {
+	return s.cliS3.PutFile(ctx, s.bucket, key, contents)
+}
+
+func (s *S3) DeletePrefix(ctx context.Context, prefix string) error {
+	keys, err := s.cliS3.ListFile(ctx, s.bucket, prefix)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	for _, key := range keys {
+		if err = s.cliS3.DeleteFile(ctx, s.bucket, key); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	return nil
+}
+
 func (s *S3) GetTMPDir(ctx context.Context) string {
 	return path.Join(common.HomeDir(), consts.TMP_DIR_PATH)
 }
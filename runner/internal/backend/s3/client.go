@@ -6,11 +6,14 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/dstackai/dstack/runner/internal/backend"
 	"github.com/dstackai/dstack/runner/internal/gerrors"
 	"github.com/dstackai/dstack/runner/internal/log"
 )
@@ -71,6 +74,52 @@ func (c *ClientS3) PutFile(ctx context.Context, bucket, key string, file []byte)
 	return nil
 }
 
+// GetFileETag is GetFile with the ETag of the object
+func (c *ClientS3) GetFileETag(ctx context.Context, bucket, key string) ([]byte, string, error) {
+	out, err := c.cli.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, "", gerrors.Wrap(err)
+	}
+	defer func() { _ = out.Body.Close() }()
+	buffer := new(bytes.Buffer)
+	if _, err = io.Copy(buffer, out.Body); err != nil {
+		return nil, "", gerrors.Wrap(err)
+	}
+	return buffer.Bytes(), aws.ToString(out.ETag), nil
+}
+
+// PutFileIfMatch writes the object if its ETag is still etag, unconditionally if empty, and returns the new ETag.
+// S3 has no conditional puts, the ETag is checked right before the write.
+func (c *ClientS3) PutFileIfMatch(ctx context.Context, bucket, key string, file []byte, etag string) (string, error) {
+	if etag != "" {
+		_, err := c.cli.HeadObject(ctx, &s3.HeadObjectInput{
+			Bucket:  aws.String(bucket),
+			Key:     aws.String(key),
+			IfMatch: aws.String(etag),
+		})
+		var respErr *smithyhttp.ResponseError
+		if errors.As(err, &respErr) && respErr.HTTPStatusCode() == http.StatusPreconditionFailed {
+			return "", gerrors.Wrap(backend.ErrStateConflict)
+		}
+		if err != nil {
+			return "", gerrors.Wrap(err)
+		}
+	}
+	out, err := c.cli.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(file),
+		ContentLength: int64(len(file)),
+	})
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return aws.ToString(out.ETag), nil
+}
+
 func (c *ClientS3) RenameFile(ctx context.Context, bucket, oldKey, newKey string) error {
 	if oldKey == newKey {
 		return nil
@@ -7,18 +7,43 @@ import (
 	"fmt"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
 	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/smithy-go"
 	"github.com/dstackai/dstack/runner/internal/gerrors"
 	"github.com/dstackai/dstack/runner/internal/log"
 )
 
 var defaultFlushInterval = 250 * time.Millisecond
 
+// The PutLogEvents limits, every event counts its message and 26 bytes
+const (
+	maxBatchEvents = 10000
+	maxBatchBytes  = 1048576
+	eventOverhead  = 26
+)
+
+const (
+	// logBufferSize is the number of the messages waiting for a batch, the writes beyond it are dropped
+	logBufferSize = 10000
+	// maxMessageChunk splits the long writes, an escaped chunk stays below the 256 KiB limit of an event
+	maxMessageChunk = 32 * 1024
+	// publishAttempts of a batch when the service is throttling or the sequence token is stale
+	publishAttempts  = 5
+	delayThrottled   = 500 * time.Millisecond
+	maxDelayThrottle = 8 * time.Second
+	// maxPendingEvents of the failed batches are kept for the next flushes while the service is unreachable, the oldest are dropped beyond it
+	maxPendingEvents = 100000
+	// maxDelayOffline is the longest pause of the flushes while the service is unreachable
+	maxDelayOffline = time.Minute
+)
+
+// Logger sends the written logs in batches, the writes never block: the messages are dropped if the buffer is full
 type Logger struct {
 	cwl           *cloudwatchlogs.Client
 	flushInterval time.Duration
@@ -26,9 +51,30 @@ type Logger struct {
 	logGroup      string
 	logStream     string
 	logEvents     []types.InputLogEvent
-	mu            sync.Mutex
-	logCh         chan LogMesage
-	jobID         string
+	batchBytes    int
+	// pending are the batches not published yet, oldest first
+	pending       [][]types.InputLogEvent
+	pendingEvents int
+	// retryAt delays the next flush while the service is unreachable, zero while it is online
+	retryAt    time.Time
+	retryDelay time.Duration
+	mu         sync.Mutex
+	logCh      chan LogMesage
+	jobID      string
+	stats      loggerStats
+}
+
+// loggerStats count the events, Dropped are lost before a batch and Failed within a rejected or overflown batch
+type loggerStats struct {
+	sent    uint64
+	dropped uint64
+	failed  uint64
+}
+
+type LoggerStats struct {
+	Sent    uint64
+	Dropped uint64
+	Failed  uint64
 }
 type Config struct {
 	JobID         string
@@ -67,7 +113,7 @@ func NewCloudwatch(cfg *Config) (*Logger, error) {
 		flushInterval: cfg.FlushInterval,
 		logEvents:     make([]types.InputLogEvent, 0),
 		mu:            sync.Mutex{},
-		logCh:         make(chan LogMesage, 100),
+		logCh:         make(chan LogMesage, logBufferSize),
 		jobID:         cfg.JobID,
 	}
 	if l.flushInterval <= 0 {
@@ -92,51 +138,136 @@ func (l *Logger) checkStreamExists(ctx context.Context) error {
 	return nil
 }
 
-func (l *Logger) publishButch(ctx context.Context) error {
-	if len(l.logEvents) == 0 {
+// publishButch sends the batch with retries, the stale sequence tokens are replaced with the expected ones
+func (l *Logger) publishButch(ctx context.Context, events []types.InputLogEvent) error {
+	if len(events) == 0 {
 		return nil
 	}
+	delay := delayThrottled
 	var err error
-	input := cloudwatchlogs.PutLogEventsInput{
-		LogEvents:     l.logEvents,
-		LogGroupName:  aws.String(l.logGroup),
-		LogStreamName: aws.String(l.logStream),
-		SequenceToken: l.seqToken,
-	}
-	resp, err := l.cwl.PutLogEvents(ctx, &input)
-	if err != nil {
+	for attempt := 1; attempt <= publishAttempts; attempt++ {
+		var resp *cloudwatchlogs.PutLogEventsOutput
+		resp, err = l.cwl.PutLogEvents(ctx, &cloudwatchlogs.PutLogEventsInput{
+			LogEvents:     events,
+			LogGroupName:  aws.String(l.logGroup),
+			LogStreamName: aws.String(l.logStream),
+			SequenceToken: l.seqToken,
+		})
+		if err == nil {
+			if resp.NextSequenceToken != nil {
+				l.seqToken = resp.NextSequenceToken
+			}
+			atomic.AddUint64(&l.stats.sent, uint64(len(events)))
+			return nil
+		}
 		var seqTokenError *types.InvalidSequenceTokenException
 		if errors.As(err, &seqTokenError) {
 			log.Info(ctx, "Invalid token. Refreshing")
 			l.seqToken = seqTokenError.ExpectedSequenceToken
-			return l.publishButch(ctx)
+			continue
 		}
 		var alreadyAccErr *types.DataAlreadyAcceptedException
 		if errors.As(err, &alreadyAccErr) {
 			log.Info(ctx, "Data already accepted. Refreshing")
 			l.seqToken = alreadyAccErr.ExpectedSequenceToken
-			return l.publishButch(ctx)
+			return nil
 		}
-		return gerrors.Wrap(err)
+		if !isThrottled(err) {
+			break
+		}
+		log.Trace(ctx, "Cloudwatch is throttling, retrying", "attempt", attempt, "delay", delay)
+		select {
+		case <-ctx.Done():
+			return gerrors.Wrap(err)
+		case <-time.After(delay):
+		}
+		if delay *= 2; delay > maxDelayThrottle {
+			delay = maxDelayThrottle
+		}
+	}
+	return gerrors.Wrap(err)
+}
+
+func isThrottled(err error) bool {
+	var unavailable *types.ServiceUnavailableException
+	if errors.As(err, &unavailable) {
+		return true
+	}
+	var apiErr smithy.APIError
+	return errors.As(err, &apiErr) && apiErr.ErrorCode() == "ThrottlingException"
+}
+
+// flush queues the batch and publishes the queue in order. If the service is unreachable, the batches are kept
+// for the next flushes with a backoff, the oldest are dropped if the queue is full.
+func (l *Logger) flush(ctx context.Context) {
+	l.mu.Lock()
+	if len(l.logEvents) > 0 {
+		l.pending = append(l.pending, l.logEvents)
+		l.pendingEvents += len(l.logEvents)
+		l.logEvents = make([]types.InputLogEvent, 0)
+		l.batchBytes = 0
 	}
-	if resp.NextSequenceToken != nil {
-		l.seqToken = resp.NextSequenceToken
+	l.mu.Unlock()
+	for l.pendingEvents > maxPendingEvents {
+		atomic.AddUint64(&l.stats.failed, uint64(len(l.pending[0])))
+		l.pendingEvents -= len(l.pending[0])
+		l.pending = l.pending[1:]
+	}
+	if !l.retryAt.IsZero() && time.Now().Before(l.retryAt) {
+		return
+	}
+	for len(l.pending) > 0 {
+		err := l.publishButch(ctx, l.pending[0])
+		var apiErr smithy.APIError
+		if err != nil && errors.As(err, &apiErr) && !isThrottled(err) {
+			// the service rejected the batch, it won't accept it later
+			fmt.Println(err.Error())
+			atomic.AddUint64(&l.stats.failed, uint64(len(l.pending[0])))
+		} else if err != nil {
+			if l.retryAt.IsZero() {
+				log.Warning(ctx, "Cloudwatch is unreachable, the logs are queued", "err", err)
+				l.retryDelay = delayThrottled
+			} else if l.retryDelay *= 2; l.retryDelay > maxDelayOffline {
+				l.retryDelay = maxDelayOffline
+			}
+			l.retryAt = time.Now().Add(l.retryDelay)
+			return
+		}
+		l.pendingEvents -= len(l.pending[0])
+		l.pending = l.pending[1:]
+	}
+	if !l.retryAt.IsZero() {
+		log.Info(ctx, "Cloudwatch is reachable again, the queued logs are sent")
+		l.retryAt = time.Time{}
+	}
+}
+
+func (l *Logger) Stats() LoggerStats {
+	return LoggerStats{
+		Sent:    atomic.LoadUint64(&l.stats.sent),
+		Dropped: atomic.LoadUint64(&l.stats.dropped),
+		Failed:  atomic.LoadUint64(&l.stats.failed),
 	}
-	return nil
 }
 
 var newTicker = func(freq time.Duration) *time.Ticker {
 	return time.NewTicker(freq)
 }
 
+// Write enqueues the message without waiting for the batches, the long messages are split into several events
 func (l *Logger) Write(p []byte) (int, error) {
-	var err error
-	l.logCh <- LogMesage{
-		JobID:  l.jobID,
-		Log:    string(p),
-		Source: "stdout",
+	for offset := 0; offset < len(p); offset += maxMessageChunk {
+		end := offset + maxMessageChunk
+		if end > len(p) {
+			end = len(p)
+		}
+		select {
+		case l.logCh <- LogMesage{JobID: l.jobID, Log: string(p[offset:end]), Source: "stdout"}:
+		default:
+			atomic.AddUint64(&l.stats.dropped, 1)
+		}
 	}
-	return len(p), gerrors.Wrap(err)
+	return len(p), nil
 }
 
 func (l *Logger) Build(ctx context.Context, logGroup, logStream string) io.Writer {
@@ -147,7 +278,7 @@ func (l *Logger) Build(ctx context.Context, logGroup, logStream string) io.Write
 		logStream:     logStream,
 		logEvents:     make([]types.InputLogEvent, 0),
 		mu:            sync.Mutex{},
-		logCh:         make(chan LogMesage, 100),
+		logCh:         make(chan LogMesage, logBufferSize),
 		jobID:         l.jobID,
 	}
 	if err := newLogger.checkStreamExists(ctx); err != nil {
@@ -165,42 +296,41 @@ func (l *Logger) WriteLogs(ctx context.Context) {
 		}
 	}()
 	ticker := newTicker(l.flushInterval)
+	defer ticker.Stop()
+	var reportedDrops uint64
 	for {
 		select {
 		case <-ctx.Done():
-			err := l.publishButch(context.Background())
-			if err != nil {
-				fmt.Println(err.Error())
-			}
-			l.mu.Lock()
-			l.logEvents = l.logEvents[:0]
-			l.mu.Unlock()
+			// the last attempt is not delayed, the logs still queued are lost
+			l.retryAt = time.Time{}
+			l.flush(context.Background())
+			atomic.AddUint64(&l.stats.failed, uint64(l.pendingEvents))
+			stats := l.Stats()
+			log.Info(context.Background(), "Cloudwatch logger stopped", "sent", stats.Sent, "dropped", stats.Dropped, "failed", stats.Failed)
 			return
 		case <-ticker.C:
-			err := l.publishButch(ctx)
-			if err != nil {
-				fmt.Println(err.Error())
+			l.flush(ctx)
+			if dropped := atomic.LoadUint64(&l.stats.dropped); dropped > reportedDrops {
+				log.Warning(ctx, "Cloudwatch log buffer is full, messages are dropped", "dropped", dropped-reportedDrops)
+				reportedDrops = dropped
 			}
-			l.mu.Lock()
-			l.logEvents = l.logEvents[:0]
-			l.mu.Unlock()
 		case event, ok := <-l.logCh:
 			if !ok {
-				err := l.publishButch(ctx)
-				if err != nil {
-					fmt.Println(err.Error())
-				}
-				l.mu.Lock()
-				l.logEvents = l.logEvents[:0]
-				l.mu.Unlock()
+				l.flush(ctx)
 				fmt.Println("[ERROR] log channel closed")
 				return
 			}
+			message := event.String()
+			size := len(message) + eventOverhead
+			if len(l.logEvents) >= maxBatchEvents || l.batchBytes+size > maxBatchBytes {
+				l.flush(ctx)
+			}
 			l.mu.Lock()
 			l.logEvents = append(l.logEvents, types.InputLogEvent{
-				Message:   aws.String(event.String()),
+				Message:   aws.String(message),
 				Timestamp: aws.Int64(time.Now().UnixNano() / int64(time.Millisecond)),
 			})
+			l.batchBytes += size
 			l.mu.Unlock()
 		}
 	}
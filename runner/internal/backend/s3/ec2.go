@@ -2,11 +2,15 @@ package local
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/dstackai/dstack/runner/consts"
 	"github.com/dstackai/dstack/runner/internal/gerrors"
 	"github.com/dstackai/dstack/runner/internal/log"
 )
@@ -93,6 +97,85 @@ func (ec *ClientEC2) IsInterruptedSpot(ctx context.Context, requestID string) (b
 	return false, nil
 }
 
+// AttachVolume attaches the EBS volume to the instance at a free device name, an attached volume is kept
+func (ec *ClientEC2) AttachVolume(ctx context.Context, volumeID string) (string, error) {
+	log.Trace(ctx, "Attach volume", "ID", volumeID)
+	instanceID, err := ec.getInstanceID(ctx)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	volumes, err := ec.cli.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{VolumeIds: []string{volumeID}})
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	if len(volumes.Volumes) == 0 {
+		return "", gerrors.Newf("volume %s is not found", volumeID)
+	}
+	for _, attachment := range volumes.Volumes[0].Attachments {
+		if attachment.InstanceId != nil && *attachment.InstanceId == instanceID && attachment.Device != nil {
+			return volumeDevice(volumeID, *attachment.Device), nil
+		}
+	}
+	device, err := ec.freeDevice(ctx, instanceID)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	_, err = ec.cli.AttachVolume(ctx, &ec2.AttachVolumeInput{
+		Device:     &device,
+		InstanceId: &instanceID,
+		VolumeId:   &volumeID,
+	})
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	waiter := ec2.NewVolumeInUseWaiter(ec.cli)
+	if err = waiter.Wait(ctx, &ec2.DescribeVolumesInput{VolumeIds: []string{volumeID}}, consts.VOLUME_ATTACH_TIMEOUT); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return volumeDevice(volumeID, device), nil
+}
+
+func (ec *ClientEC2) DetachVolume(ctx context.Context, volumeID string) error {
+	log.Trace(ctx, "Detach volume", "ID", volumeID)
+	if _, err := ec.cli.DetachVolume(ctx, &ec2.DetachVolumeInput{VolumeId: &volumeID}); err != nil {
+		return gerrors.Wrap(err)
+	}
+	waiter := ec2.NewVolumeAvailableWaiter(ec.cli)
+	return gerrors.Wrap(waiter.Wait(ctx, &ec2.DescribeVolumesInput{VolumeIds: []string{volumeID}}, consts.VOLUME_ATTACH_TIMEOUT))
+}
+
+// freeDevice picks a device name of the range recommended for the EBS volumes
+func (ec *ClientEC2) freeDevice(ctx context.Context, instanceID string) (string, error) {
+	res, err := ec.cli.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}})
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	used := make(map[string]bool)
+	for _, reservation := range res.Reservations {
+		for _, instance := range reservation.Instances {
+			for _, mapping := range instance.BlockDeviceMappings {
+				if mapping.DeviceName != nil {
+					used[*mapping.DeviceName] = true
+				}
+			}
+		}
+	}
+	for c := 'f'; c <= 'p'; c++ {
+		if device := fmt.Sprintf("/dev/sd%c", c); !used[device] {
+			return device, nil
+		}
+	}
+	return "", gerrors.New("no device name is free")
+}
+
+// volumeDevice is the NVMe device of the volume on the Nitro instances, the renamed xvd device on the others
+func volumeDevice(volumeID, device string) string {
+	if _, err := os.Stat("/dev/nvme0"); err == nil {
+		return "/dev/disk/by-id/nvme-Amazon_Elastic_Block_Store_" + strings.ReplaceAll(volumeID, "-", "")
+	}
+	return strings.Replace(device, "/dev/sd", "/dev/xvd", 1)
+}
+
 func (ec *ClientEC2) getInstanceID(ctx context.Context) (string, error) {
 	meta, err := ec.metaCli.GetMetadata(ctx, &imds.GetMetadataInput{Path: "instance-id"})
 	if err != nil {
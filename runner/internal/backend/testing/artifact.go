@@ -0,0 +1,76 @@
+package testing
+
+import (
+	"context"
+	"os"
+	"path"
+	"sync"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+var _ artifacts.Artifacter = (*Artifact)(nil)
+
+// Artifact counts the downloads and the uploads, the files stay in the runner temp dir
+type Artifact struct {
+	LocalPath  string
+	RemotePath string
+	Mount      bool
+
+	mu      sync.Mutex
+	dir     string
+	befores int
+	afters  int
+}
+
+func (b *Backend) newArtifact(runName, localPath, remotePath string, mount bool) *Artifact {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	art := &Artifact{
+		LocalPath:  localPath,
+		RemotePath: remotePath,
+		Mount:      mount,
+		dir:        path.Join(b.tmpDir, consts.USER_ARTIFACTS_DIR, runName, localPath),
+	}
+	b.artifacts = append(b.artifacts, art)
+	return art
+}
+
+func (a *Artifact) BeforeRun(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.befores++
+	return gerrors.Wrap(os.MkdirAll(a.dir, 0o755))
+}
+
+func (a *Artifact) AfterRun(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.afters++
+	return nil
+}
+
+func (a *Artifact) DockerBindings(workDir string) ([]mount.Mount, error) {
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	target := a.LocalPath
+	if !path.IsAbs(target) {
+		target = path.Join(workDir, target)
+	}
+	return []mount.Mount{{
+		Type:   mount.TypeBind,
+		Source: a.dir,
+		Target: target,
+	}}, nil
+}
+
+// Transfers are the numbers of the BeforeRun and the AfterRun calls
+func (a *Artifact) Transfers() (int, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.befores, a.afters
+}
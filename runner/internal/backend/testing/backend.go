@@ -0,0 +1,427 @@
+// Package testing is an in-memory backend for the executor tests, no cloud or local storage is touched
+package testing
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/backend"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/internal/repo"
+	"gopkg.in/yaml.v2"
+)
+
+var _ backend.Backend = (*Backend)(nil)
+
+// Backend keeps the job, the files and the secrets in memory. The written job states are recorded,
+// the failures, the concurrent changes, the stop requests and the interruptions are injected by the test.
+type Backend struct {
+	mu sync.Mutex
+
+	runnerID string
+	tmpDir   string
+	job      *models.Job
+	// stored is the job as last written, the concurrent changes are applied to it
+	stored      []byte
+	conflict    bool
+	updateErrs  []error
+	statuses    []string
+	updates     int
+	puts        int
+	files       map[string][]byte
+	secrets     map[string]string
+	artifacts   []*Artifact
+	logs        map[string]*bytes.Buffer
+	stopped     bool
+	interrupted bool
+	shutdown    bool
+}
+
+// New returns the backend of job, tmpDir is the runner temp dir the runs are prepared in
+func New(job *models.Job, tmpDir string) *Backend {
+	return &Backend{
+		tmpDir:  tmpDir,
+		job:     job,
+		files:   make(map[string][]byte),
+		secrets: make(map[string]string),
+		logs:    make(map[string]*bytes.Buffer),
+	}
+}
+
+// FailUpdates makes the next state writes return errs in order
+func (b *Backend) FailUpdates(errs ...error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updateErrs = append(b.updateErrs, errs...)
+}
+
+// ChangeJob applies change to the stored job as the hub would, the next state write conflicts
+func (b *Backend) ChangeJob(change func(job *models.Job)) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stored := new(models.Job)
+	if err := yaml.Unmarshal(b.stored, stored); err != nil {
+		return gerrors.Wrap(err)
+	}
+	change(stored)
+	contents, err := yaml.Marshal(stored)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	b.stored = contents
+	b.conflict = true
+	return nil
+}
+
+// RequestStop makes CheckStop report the stop request
+func (b *Backend) RequestStop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.stopped = true
+}
+
+// Interrupt makes IsInterrupted report the spot interruption
+func (b *Backend) Interrupt() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.interrupted = true
+}
+
+// SetSecret adds the secret returned by Secrets
+func (b *Backend) SetSecret(name, value string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.secrets[name] = value
+}
+
+// SetFile stores the file returned by GetFile and the other readers of the storage
+func (b *Backend) SetFile(key string, contents []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.files[key] = contents
+}
+
+// Statuses are the job statuses in the order they were written, the repeated ones are collapsed
+func (b *Backend) Statuses() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.statuses...)
+}
+
+// Updates is the number of the state writes, the failed ones included
+func (b *Backend) Updates() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.updates
+}
+
+// Puts is the number of the files the executor has put into the storage
+func (b *Backend) Puts() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.puts
+}
+
+// Stored is the job as last written
+func (b *Backend) Stored() (*models.Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	job := new(models.Job)
+	if err := yaml.Unmarshal(b.stored, job); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return job, nil
+}
+
+// Artifacts are the artifacts, caches and datasets the executor has got
+func (b *Backend) Artifacts() []*Artifact {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*Artifact(nil), b.artifacts...)
+}
+
+// Logs is what was written to the logger of logName
+func (b *Backend) Logs(logName string) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if buf, ok := b.logs[logName]; ok {
+		return buf.String()
+	}
+	return ""
+}
+
+// IsShutdown reports Shutdown was called
+func (b *Backend) IsShutdown() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.shutdown
+}
+
+func (b *Backend) Init(ctx context.Context, ID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.job == nil {
+		return backend.ErrNotFoundTask
+	}
+	b.runnerID = ID
+	if b.job.Environment == nil {
+		b.job.Environment = make(map[string]string)
+	}
+	contents, err := yaml.Marshal(b.job)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	b.stored = contents
+	return nil
+}
+
+func (b *Backend) Job(ctx context.Context) *models.Job {
+	return b.job
+}
+
+// RefetchJob reads the stored job into the current one like the storage backends do
+func (b *Backend) RefetchJob(ctx context.Context) (*models.Job, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err := yaml.Unmarshal(b.stored, b.job); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	b.conflict = false
+	return b.job, nil
+}
+
+func (b *Backend) MasterJob(ctx context.Context) *models.Job {
+	if b.job.MasterJobID == "" {
+		return nil
+	}
+	job, err := b.GetJobByPath(ctx, path.Join("jobs", b.job.RepoUserName, b.job.RepoName, b.job.MasterJobID+".yaml"))
+	if err != nil {
+		return nil
+	}
+	return job
+}
+
+func (b *Backend) Requirements(ctx context.Context) models.Requirements {
+	return b.job.Requirements
+}
+
+func (b *Backend) UpdateState(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.updates++
+	if len(b.updateErrs) > 0 {
+		err := b.updateErrs[0]
+		b.updateErrs = b.updateErrs[1:]
+		return err
+	}
+	if b.conflict {
+		return backend.ErrStateConflict
+	}
+	contents, err := yaml.Marshal(b.job)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	b.stored = contents
+	if n := len(b.statuses); n == 0 || b.statuses[n-1] != b.job.Status {
+		b.statuses = append(b.statuses, b.job.Status)
+	}
+	return nil
+}
+
+func (b *Backend) CheckStop(ctx context.Context) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.stopped, nil
+}
+
+func (b *Backend) IsInterrupted(ctx context.Context) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.interrupted, nil
+}
+
+func (b *Backend) Shutdown(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.shutdown = true
+	return nil
+}
+
+func (b *Backend) GetArtifact(ctx context.Context, runName, localPath, remotePath string, fs bool) artifacts.Artifacter {
+	return b.newArtifact(runName, localPath, remotePath, fs)
+}
+
+func (b *Backend) GetCache(ctx context.Context, runName, localPath, remotePath string) artifacts.Artifacter {
+	return b.newArtifact(runName, localPath, remotePath, false)
+}
+
+func (b *Backend) GetDataset(ctx context.Context, runName, localPath, remotePath string, fs bool) artifacts.Artifacter {
+	return b.newArtifact(runName, localPath, remotePath, fs)
+}
+
+func (b *Backend) CreateLogger(ctx context.Context, logGroup, logName string) io.Writer {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	buf, ok := b.logs[logName]
+	if !ok {
+		buf = new(bytes.Buffer)
+		b.logs[logName] = buf
+	}
+	return &logger{b: b, buf: buf}
+}
+
+func (b *Backend) ListSubDir(ctx context.Context, dir string) ([]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	seen := make(map[string]bool)
+	var subDirs []string
+	for key := range b.files {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		rest := strings.TrimPrefix(key, prefix)
+		i := strings.Index(rest, "/")
+		if i < 0 || seen[rest[:i]] {
+			continue
+		}
+		seen[rest[:i]] = true
+		subDirs = append(subDirs, prefix+rest[:i+1])
+	}
+	sort.Strings(subDirs)
+	return subDirs, nil
+}
+
+func (b *Backend) Bucket(ctx context.Context) string {
+	return "fake"
+}
+
+func (b *Backend) Secrets(ctx context.Context) (map[string]string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	secrets := make(map[string]string, len(b.secrets))
+	for k, v := range b.secrets {
+		secrets[k] = v
+	}
+	return secrets, nil
+}
+
+func (b *Backend) GitCredentials(ctx context.Context) *models.GitCredentials {
+	return nil
+}
+
+func (b *Backend) GetJobByPath(ctx context.Context, path string) (*models.Job, error) {
+	contents, err := b.GetFile(ctx, path)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	job := new(models.Job)
+	if err = yaml.Unmarshal(contents, job); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return job, nil
+}
+
+func (b *Backend) GetRepoDiff(ctx context.Context, path string) (string, error) {
+	contents, err := b.GetFile(ctx, path)
+	return string(contents), err
+}
+
+// GetRepoArchive extracts the archive stored at path to dir
+func (b *Backend) GetRepoArchive(ctx context.Context, path, dir string) error {
+	contents, err := b.GetFile(ctx, path)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	archive, err := os.CreateTemp(b.tmpDir, "archive-*")
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = os.Remove(archive.Name()) }()
+	_, err = archive.Write(contents)
+	if errClose := archive.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(repo.ExtractArchive(ctx, archive.Name(), dir))
+}
+
+func (b *Backend) GetBuildDiff(ctx context.Context, key, dst string) error {
+	contents, err := b.GetFile(ctx, key)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if err = os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(os.WriteFile(dst, contents, 0o644))
+}
+
+func (b *Backend) PutBuildDiff(ctx context.Context, src, key string) error {
+	contents, err := os.ReadFile(src)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return b.PutFile(ctx, key, contents)
+}
+
+func (b *Backend) GetFile(ctx context.Context, key string) ([]byte, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	contents, ok := b.files[key]
+	if !ok {
+		return nil, gerrors.Newf("no file %s", key)
+	}
+	return contents, nil
+}
+
+func (b *Backend) PutFile(ctx context.Context, key string, contents []byte) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.puts++
+	b.files[key] = contents
+	return nil
+}
+
+func (b *Backend) DeletePrefix(ctx context.Context, prefix string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for key := range b.files {
+		if strings.HasPrefix(key, prefix) {
+			delete(b.files, key)
+		}
+	}
+	return nil
+}
+
+func (b *Backend) GetTMPDir(ctx context.Context) string {
+	return b.tmpDir
+}
+
+func (b *Backend) GetDockerBindings(ctx context.Context) []mount.Mount {
+	return nil
+}
+
+// logger appends to the buffer of the backend under its lock
+type logger struct {
+	b   *Backend
+	buf *bytes.Buffer
+}
+
+func (l *logger) Write(p []byte) (int, error) {
+	l.b.mu.Lock()
+	defer l.b.mu.Unlock()
+	return l.buf.Write(p)
+}
@@ -0,0 +1,53 @@
+package backend
+
+import (
+	"context"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// StopWatcher is implemented by backends able to notify about stop requests without polling
+type StopWatcher interface {
+	WatchStop(ctx context.Context) (<-chan struct{}, error)
+}
+
+// WatchStop returns a channel closed once the job is requested to stop.
+// Backends without push notifications are polled with CheckStop every interval. The cloud backends
+// have no notification channel of their own, the hub pushes stop requests over the control API instead.
+func WatchStop(ctx context.Context, b Backend, interval time.Duration) (<-chan struct{}, error) {
+	if watcher, ok := b.(StopWatcher); ok {
+		stopCh, err := watcher.WatchStop(ctx)
+		if err == nil {
+			return stopCh, nil
+		}
+		log.Error(ctx, "Failed to watch stop requests, falling back to polling", "err", err)
+	}
+	return PollStop(ctx, b.CheckStop, interval), nil
+}
+
+// PollStop calls check every interval until it reports a stop request or ctx is done
+func PollStop(ctx context.Context, check func(ctx context.Context) (bool, error), interval time.Duration) <-chan struct{} {
+	stopCh := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			stopped, err := check(ctx)
+			if err != nil {
+				log.Error(ctx, "Failed to check stop request", "err", err)
+				continue
+			}
+			if stopped {
+				close(stopCh)
+				return
+			}
+		}
+	}()
+	return stopCh
+}
@@ -0,0 +1,120 @@
+package bandwidth
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// chunkSize is the most bytes a read waits for at once, so the concurrent transfers share the rate evenly
+const chunkSize = 32 * 1024
+
+// Limiter is a token bucket of bytes shared by all the transfers of a runner, the burst is a second of the rate
+type Limiter struct {
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter limits to megabits per second, nil is unlimited
+func NewLimiter(mbps int) *Limiter {
+	if mbps <= 0 {
+		return nil
+	}
+	rate := float64(mbps) * 1000 * 1000 / 8
+	return &Limiter{rate: rate, tokens: rate, last: time.Now()}
+}
+
+// Wait blocks until n bytes may be transferred
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	// the debt is paid by the later callers too, so the rate holds under the concurrent transfers
+	l.tokens -= float64(n)
+	var delay time.Duration
+	if l.tokens < 0 {
+		delay = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type reader struct {
+	ctx     context.Context
+	r       io.ReadCloser
+	limiter *Limiter
+}
+
+// Reader limits the reads of r, it is r itself if the limiter is nil
+func (l *Limiter) Reader(ctx context.Context, r io.ReadCloser) io.ReadCloser {
+	if l == nil || r == nil {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, limiter: l}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > chunkSize {
+		p = p[:chunkSize]
+	}
+	n, err := r.r.Read(p)
+	if n > 0 {
+		if errWait := r.limiter.Wait(r.ctx, n); errWait != nil {
+			return n, errWait
+		}
+	}
+	return n, err
+}
+
+func (r *reader) Close() error {
+	return r.r.Close()
+}
+
+type transport struct {
+	base     http.RoundTripper
+	upload   *Limiter
+	download *Limiter
+}
+
+// NewTransport limits the request bodies by upload and the response bodies by download
+func NewTransport(base http.RoundTripper, upload, download *Limiter) http.RoundTripper {
+	if upload == nil && download == nil {
+		return base
+	}
+	return &transport{base: base, upload: upload, download: download}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil && t.upload != nil {
+		req = req.Clone(req.Context())
+		req.Body = t.upload.Reader(req.Context(), req.Body)
+	}
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = t.download.Reader(req.Context(), resp.Body)
+	return resp, nil
+}
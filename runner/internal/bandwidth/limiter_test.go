@@ -0,0 +1,30 @@
+package bandwidth
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiterReader(t *testing.T) {
+	// 8 Mbps is 1 MB/s with a burst of 1 MB, the rest of 1.5 MB takes half a second
+	limiter := NewLimiter(8)
+	data := make([]byte, 1500*1000)
+	start := time.Now()
+	n, err := io.Copy(io.Discard, limiter.Reader(context.Background(), io.NopCloser(bytes.NewReader(data))))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(len(data)), n)
+	assert.Equal(t, true, time.Since(start) >= 400*time.Millisecond)
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	var limiter *Limiter = NewLimiter(0)
+	assert.Equal(t, true, limiter == nil)
+	r := io.NopCloser(bytes.NewReader(nil))
+	assert.Equal(t, r, limiter.Reader(context.Background(), r))
+	assert.Equal(t, nil, limiter.Wait(context.Background(), 1<<30))
+}
@@ -0,0 +1,206 @@
+package compress
+
+import (
+	"archive/tar"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/klauspost/compress/zstd"
+)
+
+// TarDir writes the contents of the directory to a zstd compressed tar
+func TarDir(src, dst string) error {
+	out, err := os.Create(dst)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = out.Close() }()
+	encoder, err := zstd.NewWriter(out)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	tw := tar.NewWriter(encoder)
+	err = filepath.Walk(src, func(p string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = filepath.ToSlash(rel)
+		if err = tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = file.Close() }()
+		_, err = io.Copy(tw, file)
+		return err
+	})
+	if err != nil {
+		_ = encoder.Close()
+		return gerrors.Wrap(err)
+	}
+	if err = tw.Close(); err != nil {
+		_ = encoder.Close()
+		return gerrors.Wrap(err)
+	}
+	if err = encoder.Close(); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+// UntarDir extracts the tar written by TarDir into the directory
+func UntarDir(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = in.Close() }()
+	return Untar(in, dst)
+}
+
+// Untar extracts a tar, zstd compressed or not, into the directory. The entries are kept inside of it.
+func Untar(in io.Reader, dst string) error {
+	reader, err := NewReader(in)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = reader.Close() }()
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		target, err := Target(dst, header.Name)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err = os.MkdirAll(target, os.FileMode(header.Mode)|0o700); err != nil {
+				return gerrors.Wrap(err)
+			}
+		case tar.TypeSymlink:
+			link := filepath.FromSlash(header.Linkname)
+			if filepath.IsAbs(link) || !within(dst, filepath.Join(filepath.Dir(target), link)) {
+				return gerrors.Newf("archive symlink points outside of the directory: %s -> %s", header.Name, header.Linkname)
+			}
+			_ = os.Remove(target)
+			if err = os.Symlink(header.Linkname, target); err != nil {
+				return gerrors.Wrap(err)
+			}
+		case tar.TypeLink:
+			// the hard links name a file extracted before, relative to the directory
+			source, err := Target(dst, header.Linkname)
+			if err != nil {
+				return gerrors.Wrap(err)
+			}
+			if info, err := os.Lstat(source); err != nil || !info.Mode().IsRegular() {
+				return gerrors.Newf("archive hard link points to no extracted file: %s -> %s", header.Name, header.Linkname)
+			}
+			if err = os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return gerrors.Wrap(err)
+			}
+			_ = os.Remove(target)
+			if err = os.Link(source, target); err != nil {
+				return gerrors.Wrap(err)
+			}
+		case tar.TypeReg:
+			if err = os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return gerrors.Wrap(err)
+			}
+			// a symlink left at the target would be followed
+			_ = os.Remove(target)
+			file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode))
+			if err != nil {
+				return gerrors.Wrap(err)
+			}
+			_, err = io.Copy(file, tr)
+			_ = file.Close()
+			if err != nil {
+				return gerrors.Wrap(err)
+			}
+		}
+	}
+}
+
+// Target joins the slash-separated name to the directory. It fails if the path is outside of the directory
+// or under a symlink, as an entry written through a symlink extracted before could land anywhere.
+func Target(dir, name string) (string, error) {
+	if hasDotDot(name) {
+		return "", gerrors.Newf("archive entry is outside of the directory: %s", name)
+	}
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if !within(dir, target) {
+		return "", gerrors.Newf("archive entry is outside of the directory: %s", name)
+	}
+	if err := checkNoSymlinks(dir, filepath.Dir(target)); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return target, nil
+}
+
+func hasDotDot(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+// within reports whether the path is the directory or inside it
+func within(dir, p string) bool {
+	dir = filepath.Clean(dir)
+	p = filepath.Clean(p)
+	return p == dir || strings.HasPrefix(p, dir+string(os.PathSeparator))
+}
+
+// checkNoSymlinks fails if any existing directory between dir and p is a symlink
+func checkNoSymlinks(dir, p string) error {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(p))
+	if err != nil || rel == "." {
+		return err
+	}
+	current := filepath.Clean(dir)
+	for _, part := range strings.Split(rel, string(os.PathSeparator)) {
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return gerrors.Newf("archive entry is under a symlink: %s", current)
+		}
+	}
+	return nil
+}
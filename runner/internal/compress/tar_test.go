@@ -0,0 +1,101 @@
+package compress
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTarDir(t *testing.T) {
+	src := t.TempDir()
+	assert.Equal(t, nil, os.MkdirAll(filepath.Join(src, "lib", "site-packages"), 0o755))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(src, "lib", "site-packages", "torch.py"), []byte("import torch\n"), 0o644))
+	assert.Equal(t, nil, os.Symlink("lib", filepath.Join(src, "lib64")))
+
+	archive := filepath.Join(t.TempDir(), "cache.tar.zst")
+	assert.Equal(t, nil, TarDir(src, archive))
+	header := make([]byte, 4)
+	file, err := os.Open(archive)
+	assert.Equal(t, nil, err)
+	_, err = file.Read(header)
+	assert.Equal(t, nil, err)
+	_ = file.Close()
+	assert.Equal(t, true, IsZstd(header))
+
+	dst := t.TempDir()
+	assert.Equal(t, nil, UntarDir(archive, dst))
+	contents, err := os.ReadFile(filepath.Join(dst, "lib", "site-packages", "torch.py"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "import torch\n", string(contents))
+	link, err := os.Readlink(filepath.Join(dst, "lib64"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "lib", link)
+}
+
+func TestDecompressFileUncompressed(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "layer.tar")
+	assert.Equal(t, nil, os.WriteFile(src, []byte("raw layer"), 0o644))
+	dst := filepath.Join(dir, "out.tar")
+	assert.Equal(t, nil, DecompressFile(src, dst))
+	contents, err := os.ReadFile(dst)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "raw layer", string(contents))
+}
+
+func TestUntarDirRejectsEscapes(t *testing.T) {
+	write := func(headers ...*tar.Header) string {
+		archive := filepath.Join(t.TempDir(), "cache.tar")
+		file, err := os.Create(archive)
+		assert.Equal(t, nil, err)
+		tw := tar.NewWriter(file)
+		for _, header := range headers {
+			assert.Equal(t, nil, tw.WriteHeader(header))
+		}
+		assert.Equal(t, nil, tw.Close())
+		assert.Equal(t, nil, file.Close())
+		return archive
+	}
+	dst := t.TempDir()
+	assert.NotEqual(t, nil, UntarDir(write(&tar.Header{Name: "../evil", Typeflag: tar.TypeReg, Mode: 0o644}), dst))
+	assert.NotEqual(t, nil, UntarDir(write(&tar.Header{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: "/etc"}), dst))
+	assert.NotEqual(t, nil, UntarDir(write(&tar.Header{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "../.."}), dst))
+	assert.NotEqual(t, nil, UntarDir(write(
+		&tar.Header{Name: "self", Typeflag: tar.TypeSymlink, Linkname: "."},
+		&tar.Header{Name: "self/file", Typeflag: tar.TypeReg, Mode: 0o644},
+	), dst))
+	assert.NotEqual(t, nil, UntarDir(write(&tar.Header{Name: "passwd", Typeflag: tar.TypeLink, Linkname: "../../etc/passwd"}), dst))
+	assert.NotEqual(t, nil, UntarDir(write(&tar.Header{Name: "missing", Typeflag: tar.TypeLink, Linkname: "nothing"}), dst))
+	assert.Equal(t, nil, UntarDir(write(
+		&tar.Header{Name: "lib", Typeflag: tar.TypeDir, Mode: 0o755},
+		&tar.Header{Name: "lib/python", Typeflag: tar.TypeSymlink, Linkname: "../bin/python"},
+	), dst))
+}
+
+func TestUntarHardLink(t *testing.T) {
+	archive := filepath.Join(t.TempDir(), "cache.tar")
+	file, err := os.Create(archive)
+	assert.Equal(t, nil, err)
+	tw := tar.NewWriter(file)
+	contents := []byte("import numpy\n")
+	assert.Equal(t, nil, tw.WriteHeader(&tar.Header{Name: "pkgs/numpy.py", Typeflag: tar.TypeReg, Mode: 0o644, Size: int64(len(contents))}))
+	_, err = tw.Write(contents)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, tw.WriteHeader(&tar.Header{Name: "envs/base/numpy.py", Typeflag: tar.TypeLink, Linkname: "pkgs/numpy.py"}))
+	assert.Equal(t, nil, tw.Close())
+	assert.Equal(t, nil, file.Close())
+
+	dst := t.TempDir()
+	assert.Equal(t, nil, UntarDir(archive, dst))
+	linked, err := os.ReadFile(filepath.Join(dst, "envs", "base", "numpy.py"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, contents, linked)
+	source, err := os.Stat(filepath.Join(dst, "pkgs", "numpy.py"))
+	assert.Equal(t, nil, err)
+	target, err := os.Stat(filepath.Join(dst, "envs", "base", "numpy.py"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, os.SameFile(source, target))
+}
@@ -0,0 +1,85 @@
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/klauspost/compress/zstd"
+)
+
+const Zstd = "zstd"
+
+// zstdMagic starts every zstd frame. Data without it was uploaded uncompressed, e.g. by older runners.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+func IsZstd(header []byte) bool {
+	return bytes.HasPrefix(header, zstdMagic)
+}
+
+// NewReader decompresses zstd data and passes any other data through
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(len(zstdMagic))
+	if err != nil && err != io.EOF {
+		return nil, gerrors.Wrap(err)
+	}
+	if !IsZstd(header) {
+		return io.NopCloser(br), nil
+	}
+	decoder, err := zstd.NewReader(br)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return decoder.IOReadCloser(), nil
+}
+
+func CompressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = in.Close() }()
+	out, err := os.Create(dst)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = out.Close() }()
+	encoder, err := zstd.NewWriter(out)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if _, err = io.Copy(encoder, in); err != nil {
+		_ = encoder.Close()
+		return gerrors.Wrap(err)
+	}
+	if err = encoder.Close(); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+// DecompressFile writes the decompressed src to dst. Uncompressed src is copied as is.
+func DecompressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = in.Close() }()
+	reader, err := NewReader(in)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = reader.Close() }()
+	out, err := os.Create(dst)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = out.Close() }()
+	if _, err = io.Copy(out, reader); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
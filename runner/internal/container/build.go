@@ -12,6 +12,8 @@ import (
 	"github.com/dstackai/dstack/runner/internal/gerrors"
 	"github.com/dstackai/dstack/runner/internal/log"
 	"io"
+	"sort"
+	"strings"
 )
 
 type BuildSpec struct {
@@ -26,6 +28,9 @@ type BuildSpec struct {
 	BaseImageName      string
 	RegistryAuthBase64 string
 	RepoPath           string
+	// Dockerfile is relative to RepoPath, when set it replaces Commands
+	Dockerfile string
+	Platform   string
 }
 
 func BuildImage(ctx context.Context, client docker.APIClient, spec *BuildSpec, imageName string, stoppedCh chan struct{}, logs io.Writer) error {
@@ -99,7 +104,7 @@ func BuildImage(ctx context.Context, client docker.APIClient, spec *BuildSpec, i
 		return gerrors.Wrap(err)
 	}
 	if info.State.ExitCode != 0 {
-		return gerrors.Wrap(ContainerExitedError{info.State.ExitCode})
+		return gerrors.Wrap(exitedError(info))
 	}
 	log.Trace(ctx, "Committing build image", "image", imageName)
 	_, err = client.ContainerCommit(ctx, createResp.ID, types.ContainerCommitOptions{Reference: imageName})
@@ -119,5 +124,32 @@ func (s *BuildSpec) Hash() string {
 	buffer.WriteString("\n")
 	buffer.WriteString(s.ConfigurationType)
 	buffer.WriteString("\n")
+	if s.Platform != "" && s.Platform != DefaultPlatform {
+		buffer.WriteString(s.Platform)
+		buffer.WriteString("\n")
+	}
 	return fmt.Sprintf("%x", sha256.Sum256(buffer.Bytes()))
 }
+
+// ContentHash identifies the build by its content only, so identical environments match across repos
+func (s *BuildSpec) ContentHash() (string, error) {
+	env := append([]string{}, s.Env...)
+	sort.Strings(env)
+	var buffer bytes.Buffer
+	buffer.WriteString(s.Hash())
+	buffer.WriteString("\n")
+	for _, items := range [][]string{s.Commands, s.Entrypoint, env} {
+		buffer.WriteString(strings.Join(items, "\x00"))
+		buffer.WriteString("\n")
+	}
+	// a Dockerfile build depends on the Dockerfile and the build context, not on the commands
+	if s.Dockerfile != "" {
+		digest, err := DockerfileDigest(s)
+		if err != nil {
+			return "", gerrors.Wrap(err)
+		}
+		buffer.WriteString(digest)
+		buffer.WriteString("\n")
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(buffer.Bytes())), nil
+}
@@ -0,0 +1,210 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	docker "github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+type ServiceSpec struct {
+	Name               string
+	Image              string
+	RegistryAuthBase64 string
+	Commands           []string
+	Entrypoint         []string
+	Env                []string
+	// Volumes are shared named volumes in the `name:/path[:ro]` form
+	Volumes []string
+	Mounts  []mount.Mount
+	// ExposedPorts and BindingPorts publish the service ports on the host, e.g. the app ports of the primary service
+	ExposedPorts nat.PortSet
+	BindingPorts nat.PortMap
+}
+
+// ComposeSpec describes containers linked by an internal network, every service is reachable by its name.
+// The exit code of the Primary service decides the job status.
+type ComposeSpec struct {
+	Project  string
+	Services []ServiceSpec
+	Primary  string
+}
+
+type Compose struct {
+	client   docker.APIClient
+	network  string
+	volumes  []string
+	services []*DockerRuntime
+	primary  *DockerRuntime
+	downOnce sync.Once
+}
+
+// Compose creates the network, the volumes and starts the services in the declaration order.
+// logs returns the writer for the given service.
+func (r *Engine) Compose(ctx context.Context, spec *ComposeSpec, logs func(service string) io.Writer) (*Compose, error) {
+	c := &Compose{client: r.client}
+	networkName := fmt.Sprintf("%s_default", spec.Project)
+	log.Trace(ctx, "Creating compose network", "name", networkName)
+	if _, err := r.client.NetworkCreate(ctx, networkName, types.NetworkCreate{
+		CheckDuplicate: true,
+		Driver:         "bridge",
+	}); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	c.network = networkName
+	created := make(map[string]bool)
+	for _, service := range spec.Services {
+		mounts := append([]mount.Mount{}, service.Mounts...)
+		for _, item := range service.Volumes {
+			name, target, readOnly, err := ParseVolume(item)
+			if err != nil {
+				c.Down(ctx)
+				return nil, gerrors.Wrap(err)
+			}
+			volumeName := fmt.Sprintf("%s_%s", spec.Project, name)
+			if !created[volumeName] {
+				if _, err = r.client.VolumeCreate(ctx, volume.VolumeCreateBody{Name: volumeName}); err != nil {
+					c.Down(ctx)
+					return nil, gerrors.Wrap(err)
+				}
+				c.volumes = append(c.volumes, volumeName)
+				created[volumeName] = true
+			}
+			mounts = append(mounts, mount.Mount{
+				Type:     mount.TypeVolume,
+				Source:   volumeName,
+				Target:   target,
+				ReadOnly: readOnly,
+			})
+		}
+		runtime, err := r.startService(ctx, networkName, &service, mounts, logs(service.Name))
+		if err != nil {
+			c.Down(ctx)
+			return nil, gerrors.Newf("service %s: %v", service.Name, err)
+		}
+		c.services = append(c.services, runtime)
+		if service.Name == spec.Primary {
+			c.primary = runtime
+		}
+	}
+	if c.primary == nil {
+		c.Down(ctx)
+		return nil, gerrors.Newf("primary service %s is not found", spec.Primary)
+	}
+	return c, nil
+}
+
+func (r *Engine) startService(ctx context.Context, networkName string, spec *ServiceSpec, mounts []mount.Mount, logs io.Writer) (*DockerRuntime, error) {
+	if err := r.pullImageIfAbsent(ctx, spec.Image, spec.RegistryAuthBase64, nil); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	log.Trace(ctx, "Creating service container", "name", spec.Name, "image", spec.Image)
+	config := &container.Config{
+		Image:        spec.Image,
+		Hostname:     spec.Name,
+		Cmd:          spec.Commands,
+		Entrypoint:   spec.Entrypoint,
+		Env:          spec.Env,
+		ExposedPorts: spec.ExposedPorts,
+		Tty:          true,
+		AttachStdout: true,
+	}
+	hostConfig := &container.HostConfig{
+		NetworkMode:  container.NetworkMode(networkName),
+		PortBindings: spec.BindingPorts,
+		Runtime:      r.runtime,
+		Mounts:       mounts,
+	}
+	networkingConfig := &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			networkName: {Aliases: []string{spec.Name}},
+		},
+	}
+	resp, err := r.client.ContainerCreate(ctx, config, hostConfig, networkingConfig, nil, "")
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	runtime := &DockerRuntime{
+		client:      r.client,
+		containerID: resp.ID,
+		logs:        logs,
+		errLogs:     logs,
+		tty:         true,
+	}
+	if err = runtime.Run(ctx); err != nil {
+		if errRemove := runtime.Remove(ctx); errRemove != nil {
+			log.Error(ctx, "Failed to remove service container", "id", runtime.containerID, "err", errRemove)
+		}
+		return nil, gerrors.Wrap(err)
+	}
+	return runtime, nil
+}
+
+// Wait blocks until the primary service exits, then tears down the rest
+func (c *Compose) Wait(ctx context.Context) error {
+	err := c.primary.Wait(ctx)
+	c.Down(ctx)
+	return gerrors.Wrap(err)
+}
+
+func (c *Compose) Stop(ctx context.Context) error {
+	err := c.primary.Stop(ctx)
+	c.Down(ctx)
+	return gerrors.Wrap(err)
+}
+
+// Down removes the containers, the volumes and the network, errors are only logged.
+// Wait and Stop may race on a stop request, only the first call tears down.
+func (c *Compose) Down(ctx context.Context) {
+	c.downOnce.Do(func() { c.down(ctx) })
+}
+
+func (c *Compose) down(ctx context.Context) {
+	for _, service := range c.services {
+		if err := c.client.ContainerRemove(ctx, service.containerID, types.ContainerRemoveOptions{Force: true}); err != nil && !docker.IsErrNotFound(err) {
+			log.Error(ctx, "Failed to remove service container", "id", service.containerID, "err", err)
+		}
+	}
+	c.services = nil
+	for _, name := range c.volumes {
+		if err := c.client.VolumeRemove(ctx, name, true); err != nil {
+			log.Error(ctx, "Failed to remove compose volume", "name", name, "err", err)
+		}
+	}
+	c.volumes = nil
+	if c.network != "" {
+		if err := c.client.NetworkRemove(ctx, c.network); err != nil {
+			log.Error(ctx, "Failed to remove compose network", "name", c.network, "err", err)
+		}
+		c.network = ""
+	}
+}
+
+// ParseVolume parses `name:/path` and `name:/path:ro`
+func ParseVolume(s string) (name string, target string, readOnly bool, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || !strings.HasPrefix(parts[1], "/") {
+		return "", "", false, gerrors.Newf("invalid volume: %s", s)
+	}
+	if len(parts) == 3 {
+		switch parts[2] {
+		case "ro":
+			readOnly = true
+		case "rw":
+		default:
+			return "", "", false, gerrors.Newf("invalid volume mode: %s", s)
+		}
+	}
+	return parts[0], parts[1], readOnly, nil
+}
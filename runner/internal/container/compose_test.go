@@ -0,0 +1,24 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseVolume(t *testing.T) {
+	name, target, readOnly, err := ParseVolume("data:/data")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "data", name)
+	assert.Equal(t, "/data", target)
+	assert.Equal(t, false, readOnly)
+
+	_, _, readOnly, err = ParseVolume("data:/data:ro")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, readOnly)
+
+	for _, s := range []string{"data", ":/data", "data:relative", "data:/data:x", "a:/b:ro:c"} {
+		_, _, _, err = ParseVolume(s)
+		assert.NotEqual(t, nil, err)
+	}
+}
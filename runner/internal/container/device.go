@@ -0,0 +1,53 @@
+package container
+
+import (
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// Device is a host device passed to the container without the privileged mode.
+// Permissions are the cgroup ones, a subset of rwm.
+type Device struct {
+	Host        string
+	Container   string
+	Permissions string
+}
+
+// ParseDevice parses the docker format host[:container][:permissions]
+func ParseDevice(s string) (Device, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 || !strings.HasPrefix(parts[0], "/dev/") {
+		return Device{}, gerrors.Newf("device is not in the /dev/host[:container][:permissions] format: %s", s)
+	}
+	device := Device{Host: parts[0], Container: parts[0], Permissions: "rwm"}
+	rest := parts[1:]
+	if len(rest) > 0 && strings.HasPrefix(rest[0], "/") {
+		device.Container = rest[0]
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		if rest[0] == "" || strings.Trim(rest[0], "rwm") != "" {
+			return Device{}, gerrors.Newf("device permissions are not a subset of rwm: %s", s)
+		}
+		device.Permissions = rest[0]
+		rest = rest[1:]
+	}
+	if len(rest) > 0 {
+		return Device{}, gerrors.Newf("device is not in the /dev/host[:container][:permissions] format: %s", s)
+	}
+	return device, nil
+}
+
+func deviceMappings(devices []Device) []container.DeviceMapping {
+	mappings := make([]container.DeviceMapping, 0, len(devices))
+	for _, device := range devices {
+		mappings = append(mappings, container.DeviceMapping{
+			PathOnHost:        device.Host,
+			PathInContainer:   device.Container,
+			CgroupPermissions: device.Permissions,
+		})
+	}
+	return mappings
+}
@@ -0,0 +1,26 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDevice(t *testing.T) {
+	device, err := ParseDevice("/dev/fuse")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Device{Host: "/dev/fuse", Container: "/dev/fuse", Permissions: "rwm"}, device)
+
+	device, err = ParseDevice("/dev/video0:/dev/camera:r")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Device{Host: "/dev/video0", Container: "/dev/camera", Permissions: "r"}, device)
+
+	device, err = ParseDevice("/dev/infiniband/uverbs0:rw")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Device{Host: "/dev/infiniband/uverbs0", Container: "/dev/infiniband/uverbs0", Permissions: "rw"}, device)
+
+	for _, s := range []string{"fuse", "/dev/fuse:x", "/dev/fuse:/dev/fuse:rw:m", "/dev/fuse:rw:/dev/fuse"} {
+		_, err = ParseDevice(s)
+		assert.NotEqual(t, nil, err, s)
+	}
+}
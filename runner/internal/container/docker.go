@@ -44,7 +44,37 @@ type Spec struct {
 	ShmSize            int64
 	LocalPortsRange    string
 	Runtime            string
-	AllowHostMode      bool
+	// AllowHostMode uses the host network if Network is not set and the OS supports it
+	AllowHostMode bool
+	// Network is bridge, host, none or the name of an existing network, NetworkAliases are the DNS names on the latter
+	Network        string
+	NetworkAliases []string
+	// ReadOnlyRootfs leaves the container writable only in the mounts, Tmpfs maps the in-memory mounts to their options
+	ReadOnlyRootfs bool
+	Tmpfs          map[string]string
+	Devices        []Device
+	// CapAdd, CapDrop and SecurityOpt are passed to docker as is
+	CapAdd      []string
+	CapDrop     []string
+	SecurityOpt []string
+	// User runs the container as uid[:gid] or a user name of the image, root by default
+	User string
+	// DNS, DNSSearch and ExtraHosts (host:ip) are set in the resolv.conf and the /etc/hosts of the container
+	DNS        []string
+	DNSSearch  []string
+	ExtraHosts []string
+	// HostNetwork requires the host network, e.g. for inter-node traffic of multi-node jobs
+	HostNetwork bool
+	// KeepFailed leaves the container in place if it exits with a non-zero code
+	KeepFailed bool
+	// Sidecars are started before the container and share its network namespace
+	Sidecars []SidecarSpec
+	// GPUDevices, CPUSet and MemoryMiB confine the container to a slot of a runner pool
+	GPUDevices []int
+	CPUSet     string
+	MemoryMiB  int64
+	// RestoreCheckpointDir starts the container from the CRIU checkpoint CHECKPOINT_ID in the dir (experimental)
+	RestoreCheckpointDir string
 }
 
 var _ = Container((*Docker)(nil))
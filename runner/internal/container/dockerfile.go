@@ -0,0 +1,170 @@
+package container
+
+import (
+	"archive/tar"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	docker "github.com/docker/docker/client"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+type buildMessage struct {
+	Stream string `json:"stream"`
+	Error  string `json:"error"`
+}
+
+// DockerfileDigest hashes the Dockerfile path, the build args and every file of the build context
+func DockerfileDigest(spec *BuildSpec) (string, error) {
+	hash := sha256.New()
+	_, _ = fmt.Fprintf(hash, "%s\n", spec.Dockerfile)
+	if spec.Platform != "" && spec.Platform != DefaultPlatform {
+		_, _ = fmt.Fprintf(hash, "%s\n", spec.Platform)
+	}
+	env := append([]string{}, spec.Env...)
+	sort.Strings(env)
+	_, _ = fmt.Fprintf(hash, "%s\n", strings.Join(env, "\x00"))
+	err := walkBuildContext(spec.RepoPath, func(path, rel string, info fs.FileInfo) error {
+		_, _ = fmt.Fprintf(hash, "%s %o\n", rel, info.Mode())
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		defer func() { _ = file.Close() }()
+		if _, err = io.Copy(hash, file); err != nil {
+			return gerrors.Wrap(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+func BuildDockerfile(ctx context.Context, client docker.APIClient, spec *BuildSpec, imageName string, stoppedCh chan struct{}, logs io.Writer) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-stoppedCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	reader, writer := io.Pipe()
+	go func() {
+		_ = writer.CloseWithError(writeBuildContext(writer, spec.RepoPath))
+	}()
+	defer func() { _ = reader.Close() }()
+
+	buildArgs := make(map[string]*string, len(spec.Env))
+	for _, item := range spec.Env {
+		key, value, _ := strings.Cut(item, "=")
+		arg := value
+		buildArgs[key] = &arg
+	}
+	log.Trace(ctx, "Building image from Dockerfile", "dockerfile", spec.Dockerfile, "image", imageName)
+	resp, err := client.ImageBuild(ctx, reader, types.ImageBuildOptions{
+		Tags:        []string{imageName},
+		Dockerfile:  filepath.ToSlash(spec.Dockerfile),
+		BuildArgs:   buildArgs,
+		Remove:      true,
+		ForceRemove: true,
+		PullParent:  true,
+		Platform:    spec.Platform,
+	})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var msg buildMessage
+		if err = decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return gerrors.Wrap(err)
+		}
+		if msg.Error != "" {
+			return gerrors.Newf("dockerfile build failed: %s", msg.Error)
+		}
+		if msg.Stream != "" {
+			if _, err = io.WriteString(logs, msg.Stream); err != nil {
+				return gerrors.Wrap(err)
+			}
+		}
+	}
+}
+
+func writeBuildContext(w io.Writer, root string) error {
+	writer := tar.NewWriter(w)
+	err := walkBuildContext(root, func(path, rel string, info fs.FileInfo) error {
+		link := ""
+		if info.Mode()&fs.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return gerrors.Wrap(err)
+			}
+			link = target
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		header.Name = rel
+		if err = writer.WriteHeader(header); err != nil {
+			return gerrors.Wrap(err)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		defer func() { _ = file.Close() }()
+		if _, err = io.Copy(writer, file); err != nil {
+			return gerrors.Wrap(err)
+		}
+		return nil
+	})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(writer.Close())
+}
+
+// walkBuildContext visits the build context in lexical order, skipping the .git directory
+func walkBuildContext(root string, fn func(path, rel string, info fs.FileInfo) error) error {
+	return filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		if rel == "." {
+			return nil
+		}
+		if info.IsDir() && rel == ".git" {
+			return filepath.SkipDir
+		}
+		return fn(path, filepath.ToSlash(rel), info)
+	})
+}
@@ -0,0 +1,42 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDockerfileDigest(t *testing.T) {
+	root := t.TempDir()
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(root, "Dockerfile"), []byte("FROM ubuntu\n"), 0o644))
+	assert.Equal(t, nil, os.MkdirAll(filepath.Join(root, ".git"), 0o755))
+	spec := &BuildSpec{RepoPath: root, Dockerfile: "Dockerfile", Env: []string{"B=2", "A=1"}}
+	digest, err := DockerfileDigest(spec)
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(root, ".git", "HEAD"), []byte("ref"), 0o644))
+	spec.Env = []string{"A=1", "B=2"}
+	same, err := DockerfileDigest(spec)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, digest, same)
+
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(root, "Dockerfile"), []byte("FROM debian\n"), 0o644))
+	changed, err := DockerfileDigest(spec)
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, digest, changed)
+}
+
+func TestContentHashDockerfile(t *testing.T) {
+	root := t.TempDir()
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(root, "Dockerfile"), []byte("FROM ubuntu\n"), 0o644))
+	spec := &BuildSpec{RepoPath: root, Dockerfile: "Dockerfile"}
+	hash, err := spec.ContentHash()
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(root, "requirements.txt"), []byte("torch\n"), 0o644))
+	changed, err := spec.ContentHash()
+	assert.Equal(t, nil, err)
+	assert.NotEqual(t, hash, changed)
+}
@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"os/exec"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
@@ -22,8 +25,22 @@ import (
 type Engine struct {
 	client      docker.APIClient
 	runtime     string
+	platform    string
 	nCpu        int
 	memTotalMiB uint64
+	rootDir     string
+	proxy       bool
+	version     string
+	// osType is the OS of the containers, Docker Desktop runs the linux ones in a VM
+	osType string
+	// arch is the native architecture of the daemon, the images of the others run emulated
+	arch string
+	// insecure are the registries the daemon reaches over plain HTTP
+	insecure   map[string]bool
+	registries Registries
+
+	// explicitPlatform is set when the job requests a platform, otherwise images are pulled as docker resolves them
+	explicitPlatform bool
 }
 
 type Option interface {
@@ -38,9 +55,25 @@ func (f funcEngineOpt) apply(engine *Engine) {
 
 type ContainerExitedError struct {
 	ExitCode int
+	// OOMKilled is set if the kernel killed the container for exceeding its memory limit,
+	// MemoryLimitMiB is the limit of the container, zero if it has none
+	OOMKilled      bool
+	MemoryLimitMiB int64
+}
+
+// exitedError describes the exit of the inspected container
+func exitedError(info types.ContainerJSON) ContainerExitedError {
+	exited := ContainerExitedError{ExitCode: info.State.ExitCode, OOMKilled: info.State.OOMKilled}
+	if info.HostConfig != nil {
+		exited.MemoryLimitMiB = info.HostConfig.Memory / 1024 / 1024
+	}
+	return exited
 }
 
 func (e ContainerExitedError) Error() string {
+	if e.OOMKilled {
+		return fmt.Sprintf("container was killed out of memory, exit code: %d", e.ExitCode)
+	}
 	return fmt.Sprintf("container exited with non-zero exit code: %d", e.ExitCode)
 }
 
@@ -58,6 +91,12 @@ func NewEngine(opts ...Option) *Engine {
 		log.Error(ctx, "Failed to create client", "err", err)
 		return nil
 	}
+	return NewEngineWithClient(client, opts...)
+}
+
+// NewEngineWithClient is the engine of the daemon client, e.g. the FakeClient of the tests
+func NewEngineWithClient(client docker.APIClient, opts ...Option) *Engine {
+	ctx := context.Background()
 	info, err := client.Info(ctx)
 	if err != nil {
 		log.Error(ctx, "Failed fetch info about client", "err", err)
@@ -72,8 +111,25 @@ func NewEngine(opts ...Option) *Engine {
 	engine := &Engine{
 		client:      client,
 		runtime:     defaultRuntime,
+		platform:    HostPlatform(),
 		nCpu:        info.NCPU,
 		memTotalMiB: BytesToMiB(info.MemTotal),
+		rootDir:     info.DockerRootDir,
+		proxy:       info.HTTPSProxy != "" || info.HTTPProxy != "",
+		version:     info.ServerVersion,
+		osType:      info.OSType,
+		arch:        NormalizeArch(info.Architecture),
+	}
+	if info.OSType == "windows" {
+		log.Warning(ctx, "The Docker daemon runs Windows containers, switch Docker Desktop to Linux containers")
+	}
+	if info.RegistryConfig != nil {
+		engine.insecure = make(map[string]bool)
+		for name, index := range info.RegistryConfig.IndexConfigs {
+			if !index.Secure {
+				engine.insecure[name] = true
+			}
+		}
 	}
 	for _, opt := range opts {
 		opt.apply(engine)
@@ -88,6 +144,56 @@ func (r *Engine) DockerClient() docker.APIClient {
 func (r *Engine) DockerRuntime() string {
 	return r.runtime
 }
+func (r *Engine) Platform() string {
+	return r.platform
+}
+
+// SetPlatform requests the image variants for the platform instead of the platform of the instance
+func (r *Engine) SetPlatform(platform string) {
+	r.platform = platform
+	r.explicitPlatform = true
+}
+
+// ImagePlatform is the platform of the local image, emulated is set if the daemon runs it under emulation,
+// e.g. the amd64 images on Apple Silicon
+func (r *Engine) ImagePlatform(ctx context.Context, image string) (string, bool, error) {
+	info, _, err := r.client.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return "", false, gerrors.Wrap(err)
+	}
+	arch := NormalizeArch(info.Architecture)
+	emulated := arch != "" && r.arch != "" && arch != r.arch
+	return info.Os + "/" + arch, emulated, nil
+}
+
+// HasProxy reports the daemon pulls the images through a proxy
+func (r *Engine) HasProxy() bool {
+	return r.proxy
+}
+
+// Version of the Docker daemon
+func (r *Engine) Version() string {
+	return r.version
+}
+
+// DockerRootDir is where the daemon keeps the images and the containers
+func (r *Engine) DockerRootDir() string {
+	return r.rootDir
+}
+
+// SocketPath is the unix socket of the daemon to mount into the containers, empty if it is reached otherwise.
+// Docker Desktop reached over the Windows named pipe serves the socket of its linux VM at the usual path.
+func (r *Engine) SocketPath() string {
+	host := r.client.DaemonHost()
+	if strings.HasPrefix(host, "npipe://") && r.osType == "linux" {
+		return dockerDesktopSocket
+	}
+	if !strings.HasPrefix(host, "unix://") {
+		return ""
+	}
+	return strings.TrimPrefix(host, "unix://")
+}
+
 func (r *Engine) CPU() int {
 	return r.nCpu
 }
@@ -99,16 +205,55 @@ type DockerRuntime struct {
 	client      docker.APIClient
 	containerID string
 	logs        io.Writer
+	errLogs     io.Writer
+	tty         bool
+	keepFailed  bool
+	runtime     string
+
+	// netHolder owns the network namespace shared with the sidecars, if any
+	netHolder    string
+	sidecarSpecs []SidecarSpec
+	mu           sync.Mutex
+	sidecars     []*DockerRuntime
+	// restoreDir has the checkpoint the container is started from, if any
+	restoreDir string
 }
 
+// CHECKPOINT_ID names the CRIU checkpoints of the job containers in their checkpoint dirs
+const CHECKPOINT_ID = "dstack"
+
+// dockerDesktopSocket is the daemon socket Docker Desktop mounts into the containers from its VM
+const dockerDesktopSocket = "/var/run/docker.sock"
+
+// the console size of the containers with TTY, wide enough for the progress bars
+const (
+	ttyRows = 40
+	ttyCols = 160
+)
+
+// Create runs the container with TTY, stderr is merged into stdout
 func (r *Engine) Create(ctx context.Context, spec *Spec, logs io.Writer) (*DockerRuntime, error) {
+	return r.create(ctx, spec, logs, logs, true)
+}
+
+// CreateWithStreams runs the container without TTY, so stdout and stderr can be demultiplexed
+func (r *Engine) CreateWithStreams(ctx context.Context, spec *Spec, stdout, stderr io.Writer) (*DockerRuntime, error) {
+	return r.create(ctx, spec, stdout, stderr, false)
+}
+
+func (r *Engine) create(ctx context.Context, spec *Spec, stdout, stderr io.Writer, tty bool) (*DockerRuntime, error) {
 	log.Trace(ctx, "Start pull image")
-	err := r.pullImageIfAbsent(ctx, spec.Image, spec.RegistryAuthBase64)
+	err := r.pullImageIfAbsent(ctx, spec.Image, spec.RegistryAuthBase64, nil)
 	if err != nil {
 		log.Error(ctx, fmt.Sprintf("failed to download docker image: %s", err))
 		return nil, gerrors.Newf("failed to download docker image: %s", err)
 	}
 	log.Trace(ctx, "End pull image")
+	for _, sidecar := range spec.Sidecars {
+		if err = r.pullImageIfAbsent(ctx, sidecar.Image, sidecar.RegistryAuthBase64, nil); err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+	}
 
 	log.Trace(ctx, "Creating docker container", "image:", spec.Image)
 	log.Trace(ctx, "Container params ", "mounts", spec.Mounts)
@@ -119,17 +264,18 @@ func (r *Engine) Create(ctx context.Context, spec *Spec, logs io.Writer) (*Docke
 		Image:        spec.Image,
 		Cmd:          spec.Commands,
 		Entrypoint:   spec.Entrypoint,
-		Tty:          true,
+		Tty:          tty,
 		WorkingDir:   spec.WorkDir,
 		Env:          spec.Env,
 		ExposedPorts: spec.ExposedPorts,
 		Labels:       spec.Labels,
+		User:         spec.User,
 		AttachStdout: true,
 		AttachStdin:  true,
 	}
-	var networkMode container.NetworkMode = "default"
-	if spec.AllowHostMode && supportNetworkModeHost() {
-		networkMode = "host"
+	networkMode, networking, err := r.networkConfig(ctx, spec)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
 	}
 	hostConfig := &container.HostConfig{
 		NetworkMode:     networkMode,
@@ -139,21 +285,92 @@ func (r *Engine) Create(ctx context.Context, spec *Spec, logs io.Writer) (*Docke
 		Sysctls:         map[string]string{},
 		Runtime:         r.runtime,
 		Mounts:          spec.Mounts,
+		ReadonlyRootfs:  spec.ReadOnlyRootfs,
+		CapAdd:          spec.CapAdd,
+		CapDrop:         spec.CapDrop,
+		SecurityOpt:     spec.SecurityOpt,
+		Tmpfs:           spec.Tmpfs,
+		DNS:             spec.DNS,
+		DNSSearch:       spec.DNSSearch,
+		ExtraHosts:      spec.ExtraHosts,
+		Resources: container.Resources{
+			CpusetCpus: spec.CPUSet,
+			Memory:     spec.MemoryMiB * 1024 * 1024,
+			Devices:    deviceMappings(spec.Devices),
+		},
+	}
+	if tty {
+		// the programs size their output to the terminal, e.g. the progress bars
+		hostConfig.ConsoleSize = [2]uint{ttyRows, ttyCols}
+	}
+	if networkMode == NetworkHost && (len(spec.DNS) > 0 || len(spec.DNSSearch) > 0) {
+		// docker rejects the DNS options in the host network, the host resolv.conf is used
+		log.Warning(ctx, "DNS servers are ignored in the host network")
+		hostConfig.DNS = nil
+		hostConfig.DNSSearch = nil
+	}
+	if networkMode == NetworkNone {
+		// an isolated container has no ports to publish
+		config.ExposedPorts = nil
+		hostConfig.PortBindings = nil
+		hostConfig.PublishAllPorts = false
+	}
+	if len(spec.GPUDevices) > 0 {
+		devices := make([]string, len(spec.GPUDevices))
+		for i, device := range spec.GPUDevices {
+			devices[i] = strconv.Itoa(device)
+		}
+		config.Env = append(append([]string{}, spec.Env...), "NVIDIA_VISIBLE_DEVICES="+strings.Join(devices, ","))
 	}
-	resp, err := r.client.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	netHolder := ""
+	if len(spec.Sidecars) > 0 && networkMode != NetworkHost {
+		// the sidecars run before the container, so the namespace and the ports are owned by a holder container
+		if netHolder, err = r.createNetworkHolder(ctx, spec, config, hostConfig, networking); err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		config.ExposedPorts = nil
+		hostConfig.NetworkMode = container.NetworkMode("container:" + netHolder)
+		hostConfig.PortBindings = nil
+		hostConfig.PublishAllPorts = false
+		// the resolv.conf and the hosts file come with the namespace of the holder
+		hostConfig.DNS = nil
+		hostConfig.DNSSearch = nil
+		hostConfig.ExtraHosts = nil
+		networking = nil
+	}
+	resp, err := r.client.ContainerCreate(ctx, config, hostConfig, networking, nil, "")
 	if err != nil {
 		log.Error(ctx, fmt.Sprintf("failed to create docker container: %s", err))
+		if netHolder != "" {
+			_ = r.client.ContainerRemove(ctx, netHolder, types.ContainerRemoveOptions{Force: true})
+		}
 		return nil, gerrors.Wrap(err)
 	}
 	return &DockerRuntime{
-		client:      r.client,
-		containerID: resp.ID,
-		logs:        logs,
+		client:       r.client,
+		containerID:  resp.ID,
+		logs:         stdout,
+		errLogs:      stderr,
+		tty:          tty,
+		keepFailed:   spec.KeepFailed,
+		runtime:      r.runtime,
+		netHolder:    netHolder,
+		sidecarSpecs: spec.Sidecars,
+		restoreDir:   spec.RestoreCheckpointDir,
 	}, nil
 }
 func (r *DockerRuntime) Run(ctx context.Context) error {
+	if err := r.startSidecars(ctx); err != nil {
+		return gerrors.Wrap(err)
+	}
 	log.Trace(ctx, "Starting docker container")
-	if err := r.client.ContainerStart(ctx, r.containerID, types.ContainerStartOptions{}); err != nil {
+	startOpts := types.ContainerStartOptions{}
+	if r.restoreDir != "" {
+		log.Info(ctx, "Restoring the container from the checkpoint", "dir", r.restoreDir)
+		startOpts.CheckpointID = CHECKPOINT_ID
+		startOpts.CheckpointDir = r.restoreDir
+	}
+	if err := r.client.ContainerStart(ctx, r.containerID, startOpts); err != nil {
 		log.Error(ctx, fmt.Sprintf("failed to start docker container: %s", err))
 		return gerrors.Newf("failed to start container: %s", err)
 	}
@@ -199,8 +416,11 @@ func (r *DockerRuntime) LogsWS(ctx context.Context) error {
 		return gerrors.Wrap(err)
 	}
 	go func() {
-		_, err = io.Copy(r.logs, logs.Reader)
-		//_, err = stdcopy.StdCopy(r.logs, r.logs, logs.Reader)
+		if r.tty {
+			_, err = io.Copy(r.logs, logs.Reader)
+		} else {
+			_, err = stdcopy.StdCopy(r.logs, r.errLogs, logs.Reader)
+		}
 		if err != nil {
 			log.Error(ctx, "failed to stream container logs", "err", gerrors.Wrap(err))
 		}
@@ -216,24 +436,45 @@ func (r *DockerRuntime) Wait(ctx context.Context) error {
 	case err := <-werr:
 		return gerrors.Wrap(err)
 	}
+	r.stopSidecars(ctx)
 	info, err := r.client.ContainerInspect(ctx, r.containerID)
 	if err != nil {
 		return gerrors.Wrap(err)
 	}
+	if info.State.ExitCode != 0 && r.keepFailed {
+		log.Info(ctx, "Keeping the failed container", "container", r.containerID)
+		return gerrors.Wrap(exitedError(info))
+	}
+	removeOpts := types.ContainerRemoveOptions{
+		Force: true,
+	}
+	if err = r.client.ContainerRemove(ctx, r.containerID, removeOpts); err != nil {
+		if info.State.ExitCode != 0 {
+			log.Error(ctx, "Failed to remove the failed container", "container", r.containerID, "err", err)
+			return gerrors.Wrap(exitedError(info))
+		}
+		return gerrors.Wrap(err)
+	}
 	if info.State.ExitCode != 0 {
-		return gerrors.Wrap(ContainerExitedError{info.State.ExitCode})
+		return gerrors.Wrap(exitedError(info))
 	}
+	return nil
+}
+
+// Remove deletes the container with its sidecars, e.g. if it failed to start and there is nothing to kill
+func (r *DockerRuntime) Remove(ctx context.Context) error {
+	r.stopSidecars(ctx)
 	removeOpts := types.ContainerRemoveOptions{
 		Force: true,
 	}
-	err = r.client.ContainerRemove(ctx, r.containerID, removeOpts)
-	if err != nil {
+	if err := r.client.ContainerRemove(ctx, r.containerID, removeOpts); err != nil {
 		return gerrors.Wrap(err)
 	}
 	return nil
 }
 
 func (r *DockerRuntime) ForceStop(ctx context.Context) error {
+	r.stopSidecars(ctx)
 	err := r.client.ContainerKill(ctx, r.containerID, "9")
 	if err != nil {
 		return gerrors.Wrap(err)
@@ -248,7 +489,31 @@ func (r *DockerRuntime) ForceStop(ctx context.Context) error {
 	return nil
 }
 
+// Pause freezes the processes of the container, they keep their memory until Unpause
+func (r *DockerRuntime) Pause(ctx context.Context) error {
+	return gerrors.Wrap(r.client.ContainerPause(ctx, r.containerID))
+}
+
+func (r *DockerRuntime) Unpause(ctx context.Context) error {
+	return gerrors.Wrap(r.client.ContainerUnpause(ctx, r.containerID))
+}
+
+// Checkpoint dumps the processes of the container to dir with CRIU and stops it, the docker daemon has to be experimental
+func (r *DockerRuntime) Checkpoint(ctx context.Context, dir string) error {
+	err := r.client.CheckpointCreate(ctx, r.containerID, types.CheckpointCreateOptions{
+		CheckpointID:  CHECKPOINT_ID,
+		CheckpointDir: dir,
+		Exit:          true,
+	})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	r.stopSidecars(ctx)
+	return nil
+}
+
 func (r *DockerRuntime) Stop(ctx context.Context) error {
+	r.stopSidecars(ctx)
 	err := r.client.ContainerKill(ctx, r.containerID, "SIGTERM")
 	if err != nil {
 		return gerrors.Wrap(err)
@@ -263,7 +528,12 @@ func (r *DockerRuntime) Stop(ctx context.Context) error {
 	return nil
 }
 
-func (r *Engine) pullImageIfAbsent(ctx context.Context, image string, registryAuthBase64 string) error {
+// PullImage pulls the image if it is absent, reporting layer progress to the given writer
+func (r *Engine) PullImage(ctx context.Context, image string, registryAuthBase64 string, progress io.Writer) error {
+	return gerrors.Wrap(r.pullImageIfAbsent(ctx, image, registryAuthBase64, progress))
+}
+
+func (r *Engine) pullImageIfAbsent(ctx context.Context, image string, registryAuthBase64 string, progress io.Writer) error {
 	if image == "" {
 		return gerrors.New("given image value is empty")
 	}
@@ -276,25 +546,65 @@ func (r *Engine) pullImageIfAbsent(ctx context.Context, image string, registryAu
 	}
 
 	if len(summaries) != 0 {
-		return nil
+		if !r.explicitPlatform {
+			return nil
+		}
+		// a multi-arch tag may be cached locally with another platform variant
+		info, _, err := r.client.ImageInspectWithRaw(ctx, image)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		if "linux/"+NormalizeArch(info.Architecture) == r.platform {
+			return nil
+		}
+		log.Trace(ctx, "Image platform mismatch", "image", image, "architecture", info.Architecture, "platform", r.platform)
+	}
+	platform := ""
+	if r.explicitPlatform {
+		platform = r.platform
+	}
+	err = r.pullImage(ctx, image, registryAuthBase64, platform, progress)
+	if err != nil && platform != "" && isNoMatchingVariantError(err) {
+		// single-platform images are used as is, the same as without a requested platform
+		log.Info(ctx, "No image variant for the platform, using the default one", "image", image, "platform", platform)
+		if len(summaries) != 0 {
+			return nil
+		}
+		err = r.pullImage(ctx, image, registryAuthBase64, "", progress)
 	}
+	return gerrors.Wrap(err)
+}
+
+func (r *Engine) pullImageFrom(ctx context.Context, image, registryAuthBase64, platform string, progress io.Writer) error {
 	reader, err := r.client.ImagePull(ctx, image, types.ImagePullOptions{
 		RegistryAuth: registryAuthBase64,
+		Platform:     platform,
 	})
 	if err != nil {
 		return gerrors.Wrap(err)
 	}
 	defer func() { _ = reader.Close() }()
-	buf, err := ioutil.ReadAll(reader)
-	if err != nil {
+	if progress == nil {
+		progress = ioutil.Discard
+	}
+	log.Trace(ctx, "Pulling image", "image", image, "platform", platform)
+	if err = newPullProgress(progress).consume(reader); err != nil {
 		return gerrors.Wrap(err)
 	}
-	log.Trace(ctx, "Image pull stdout", "stdout", string(buf))
 	return nil
 }
 
+func isNoMatchingVariantError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "no matching manifest") || strings.Contains(msg, "does not match the specified platform")
+}
+
 func (r *Engine) GetBuildDigest(ctx context.Context, spec *BuildSpec) (string, error) {
-	err := r.pullImageIfAbsent(ctx, spec.BaseImageName, spec.RegistryAuthBase64)
+	if spec.Dockerfile != "" {
+		spec.Platform = r.platform
+		return DockerfileDigest(spec)
+	}
+	err := r.pullImageIfAbsent(ctx, spec.BaseImageName, spec.RegistryAuthBase64, nil)
 	if err != nil {
 		return "", gerrors.Wrap(err)
 	}
@@ -303,10 +613,14 @@ func (r *Engine) GetBuildDigest(ctx context.Context, spec *BuildSpec) (string, e
 		return "", gerrors.Wrap(err)
 	}
 	spec.BaseImageID = info.ID
+	spec.Platform = r.platform
 	return spec.Hash(), nil
 }
 
 func (r *Engine) Build(ctx context.Context, spec *BuildSpec, imageName string, stoppedCh chan struct{}, logs io.Writer) error {
+	if spec.Dockerfile != "" {
+		return gerrors.Wrap(BuildDockerfile(ctx, r.client, spec, imageName, stoppedCh, logs))
+	}
 	if err := BuildImage(ctx, r.client, spec, imageName, stoppedCh, logs); err != nil {
 		return gerrors.Wrap(err)
 	}
@@ -340,6 +654,41 @@ func (r *Engine) ImportImageDiff(ctx context.Context, diffPath string) error {
 	return nil
 }
 
+// SaveImage stores the whole image, it is used for multi-layer images built from a Dockerfile
+func (r *Engine) SaveImage(ctx context.Context, imageName, path string) error {
+	reader, err := r.client.ImageSave(ctx, []string{imageName})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = reader.Close() }()
+	file, err := os.Create(path)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	if _, err = io.Copy(file, reader); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+func (r *Engine) LoadImage(ctx context.Context, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	resp, err := r.client.ImageLoad(ctx, file, true)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if _, err = io.Copy(ioutil.Discard, resp.Body); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
 func (r *Engine) RestartDaemon(ctx context.Context) error {
 	log.Trace(ctx, "Restarting docker daemon")
 	cmd := exec.Command("systemctl", "restart", "docker")
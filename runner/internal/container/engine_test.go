@@ -1,8 +1,11 @@
 package container
 
 import (
-	"github.com/stretchr/testify/assert"
 	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
 )
 
 func TestShellCommandsEmpty(t *testing.T) {
@@ -30,3 +33,14 @@ func TestShellCommandsBackgroundSpaced(t *testing.T) {
 	args := ShellCommands([]string{"sleep 5 & ", "echo 123"})[0]
 	assert.Equal(t, "{ sleep 5 & } && echo 123", args)
 }
+
+func TestExitedErrorOOM(t *testing.T) {
+	info := types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{
+		State:      &types.ContainerState{ExitCode: 137, OOMKilled: true},
+		HostConfig: &container.HostConfig{Resources: container.Resources{Memory: 2048 * 1024 * 1024}},
+	}}
+	exited := exitedError(info)
+	assert.Equal(t, true, exited.OOMKilled)
+	assert.Equal(t, int64(2048), exited.MemoryLimitMiB)
+	assert.Equal(t, "container was killed out of memory, exit code: 137", exited.Error())
+}
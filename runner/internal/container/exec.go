@@ -0,0 +1,135 @@
+package container
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	docker "github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// execPollInterval is the delay between the inspections of an exited process until its exit code is set
+const execPollInterval = 100 * time.Millisecond
+
+// ExecOptions of a process started in the job container. Rows and Cols size the TTY, if any.
+type ExecOptions struct {
+	User       string
+	Env        []string
+	WorkingDir string
+	TTY        bool
+	Rows, Cols uint
+}
+
+// ExecSession is a process attached over a hijacked connection. Without TTY stdout and stderr are merged.
+type ExecSession struct {
+	client docker.APIClient
+	execID string
+	conn   types.HijackedResponse
+	output io.Reader
+}
+
+func (r *DockerRuntime) Exec(ctx context.Context, cmd []string, opts ExecOptions) (*ExecSession, error) {
+	created, err := r.client.ContainerExecCreate(ctx, r.containerID, types.ExecConfig{
+		User:         opts.User,
+		Tty:          opts.TTY,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+		Env:          opts.Env,
+		WorkingDir:   opts.WorkingDir,
+		Cmd:          cmd,
+	})
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	conn, err := r.client.ContainerExecAttach(ctx, created.ID, types.ExecStartCheck{Tty: opts.TTY})
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	session := &ExecSession{client: r.client, execID: created.ID, conn: conn, output: conn.Reader}
+	if !opts.TTY {
+		reader, writer := io.Pipe()
+		go func() {
+			_, err := stdcopy.StdCopy(writer, writer, conn.Reader)
+			_ = writer.CloseWithError(err)
+		}()
+		session.output = reader
+	}
+	if opts.TTY && opts.Rows > 0 && opts.Cols > 0 {
+		if err = session.Resize(ctx, opts.Rows, opts.Cols); err != nil {
+			log.Warning(ctx, "Failed to resize the exec TTY", "err", err)
+		}
+	}
+	log.Trace(ctx, "Exec started", "exec_id", created.ID, "cmd", cmd)
+	return session, nil
+}
+
+func (s *ExecSession) Read(p []byte) (int, error) {
+	return s.output.Read(p)
+}
+
+func (s *ExecSession) Write(p []byte) (int, error) {
+	return s.conn.Conn.Write(p)
+}
+
+// CloseWrite sends EOF to the process stdin
+func (s *ExecSession) CloseWrite() error {
+	return gerrors.Wrap(s.conn.CloseWrite())
+}
+
+func (s *ExecSession) Close() error {
+	s.conn.Close()
+	return nil
+}
+
+func (s *ExecSession) Resize(ctx context.Context, rows, cols uint) error {
+	return gerrors.Wrap(s.client.ContainerExecResize(ctx, s.execID, types.ResizeOptions{Height: rows, Width: cols}))
+}
+
+// ExitCode waits until the process exits, its output is read to the end by then
+func (s *ExecSession) ExitCode(ctx context.Context) (int, error) {
+	for {
+		inspect, err := s.client.ContainerExecInspect(ctx, s.execID)
+		if err != nil {
+			return 0, gerrors.Wrap(err)
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, gerrors.Wrap(ctx.Err())
+		case <-time.After(execPollInterval):
+		}
+	}
+}
+
+// Address is the IP the container ports are reachable at from the host, the sidecars share it
+func (r *DockerRuntime) Address(ctx context.Context) (string, error) {
+	id := r.containerID
+	if r.netHolder != "" {
+		id = r.netHolder
+	}
+	info, err := r.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	if info.HostConfig != nil && info.HostConfig.NetworkMode.IsHost() {
+		return "127.0.0.1", nil
+	}
+	if info.NetworkSettings != nil {
+		if info.NetworkSettings.IPAddress != "" {
+			return info.NetworkSettings.IPAddress, nil
+		}
+		for _, endpoint := range info.NetworkSettings.Networks {
+			if endpoint != nil && endpoint.IPAddress != "" {
+				return endpoint.IPAddress, nil
+			}
+		}
+	}
+	return "", gerrors.New("container has no IP address")
+}
@@ -0,0 +1,323 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// FakeProgram is what the fake containers of an image do: they print Output and exit with ExitCode,
+// the blocking ones run until they are killed
+type FakeProgram struct {
+	Output    string
+	Stderr    string
+	ExitCode  int
+	OOMKilled bool
+	Block     bool
+}
+
+// FakeClient is an in-memory docker daemon for the engine of the executor tests: the images are pulled instantly
+// and the containers run the programs of their images. The calls the engine doesn't make for the plain jobs,
+// e.g. the builds and the networks, panic.
+type FakeClient struct {
+	client.APIClient
+
+	mu         sync.Mutex
+	programs   map[string]FakeProgram
+	images     map[string]bool
+	containers map[string]*fakeContainer
+	created    []*container.Config
+	nextID     int
+	// arch is the architecture of the daemon, the images are amd64
+	arch string
+}
+
+type fakeContainer struct {
+	config  *container.Config
+	program FakeProgram
+	output  *io.PipeReader
+	writer  *io.PipeWriter
+	exited  chan struct{}
+	started bool
+	killed  bool
+	removed bool
+}
+
+func NewFakeClient() *FakeClient {
+	return &FakeClient{
+		programs:   make(map[string]FakeProgram),
+		images:     make(map[string]bool),
+		containers: make(map[string]*fakeContainer),
+		arch:       "x86_64",
+	}
+}
+
+// SetArchitecture makes the daemon report arch, e.g. aarch64 of Apple Silicon
+func (c *FakeClient) SetArchitecture(arch string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.arch = arch
+}
+
+// SetProgram makes the containers of image run program, the containers of the other images exit at once
+func (c *FakeClient) SetProgram(image string, program FakeProgram) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.programs[image] = program
+}
+
+// Created are the configs of the created containers in order
+func (c *FakeClient) Created() []*container.Config {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*container.Config(nil), c.created...)
+}
+
+// Running counts the containers started and not removed yet
+func (c *FakeClient) Running() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	running := 0
+	for _, fake := range c.containers {
+		if fake.started && !fake.removed {
+			running++
+		}
+	}
+	return running
+}
+
+func (c *FakeClient) container(id string) (*fakeContainer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fake, ok := c.containers[id]
+	if !ok {
+		return nil, fmt.Errorf("no such container: %s", id)
+	}
+	return fake, nil
+}
+
+func (c *FakeClient) Info(ctx context.Context) (types.Info, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return types.Info{NCPU: 4, MemTotal: 8 << 30, ServerVersion: "fake", OSType: "linux", Architecture: c.arch}, nil
+}
+
+func (c *FakeClient) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var summaries []types.ImageSummary
+	for _, image := range options.Filters.Get("reference") {
+		if c.images[image] {
+			summaries = append(summaries, types.ImageSummary{ID: image, RepoTags: []string{image}})
+		}
+	}
+	return summaries, nil
+}
+
+func (c *FakeClient) ImageInspectWithRaw(ctx context.Context, image string) (types.ImageInspect, []byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.images[image] {
+		return types.ImageInspect{}, nil, fmt.Errorf("no such image: %s", image)
+	}
+	return types.ImageInspect{ID: image, RepoTags: []string{image}, Architecture: "amd64", Os: "linux"}, nil, nil
+}
+
+func (c *FakeClient) ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.images[ref] = true
+	return ioutil.NopCloser(strings.NewReader(`{"status":"Downloaded newer image for ` + ref + `"}` + "\n")), nil
+}
+
+func (c *FakeClient) ImageTag(ctx context.Context, source, target string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.images[target] = true
+	return nil
+}
+
+func (c *FakeClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.ContainerCreateCreatedBody, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.images[config.Image] {
+		return container.ContainerCreateCreatedBody{}, fmt.Errorf("no such image: %s", config.Image)
+	}
+	c.nextID++
+	id := fmt.Sprintf("fake-%d", c.nextID)
+	output, writer := io.Pipe()
+	c.containers[id] = &fakeContainer{
+		config:  config,
+		program: c.programs[config.Image],
+		output:  output,
+		writer:  writer,
+		exited:  make(chan struct{}),
+	}
+	c.created = append(c.created, config)
+	return container.ContainerCreateCreatedBody{ID: id}, nil
+}
+
+// ContainerStart runs the program, the output waits for the attached reader
+func (c *FakeClient) ContainerStart(ctx context.Context, id string, options types.ContainerStartOptions) error {
+	fake, err := c.container(id)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	fake.started = true
+	c.mu.Unlock()
+	go func() {
+		var out, errOut io.Writer = fake.writer, fake.writer
+		if !fake.config.Tty {
+			out = stdcopy.NewStdWriter(fake.writer, stdcopy.Stdout)
+			errOut = stdcopy.NewStdWriter(fake.writer, stdcopy.Stderr)
+		}
+		if fake.program.Output != "" {
+			_, _ = out.Write([]byte(fake.program.Output))
+		}
+		if fake.program.Stderr != "" {
+			_, _ = errOut.Write([]byte(fake.program.Stderr))
+		}
+		_ = fake.writer.Close()
+		if fake.program.Block {
+			<-fake.exited
+			return
+		}
+		c.exit(fake)
+	}()
+	return nil
+}
+
+func (c *FakeClient) exit(fake *fakeContainer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-fake.exited:
+	default:
+		close(fake.exited)
+	}
+}
+
+func (c *FakeClient) ContainerAttach(ctx context.Context, id string, options types.ContainerAttachOptions) (types.HijackedResponse, error) {
+	fake, err := c.container(id)
+	if err != nil {
+		return types.HijackedResponse{}, err
+	}
+	conn, _ := net.Pipe()
+	return types.HijackedResponse{Conn: conn, Reader: bufio.NewReader(fake.output)}, nil
+}
+
+func (c *FakeClient) ContainerLogs(ctx context.Context, id string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	fake, err := c.container(id)
+	if err != nil {
+		return nil, err
+	}
+	return fake.output, nil
+}
+
+func (c *FakeClient) ContainerWait(ctx context.Context, id string, condition container.WaitCondition) (<-chan container.ContainerWaitOKBody, <-chan error) {
+	wait := make(chan container.ContainerWaitOKBody, 1)
+	errs := make(chan error, 1)
+	fake, err := c.container(id)
+	if err != nil {
+		errs <- err
+		return wait, errs
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			errs <- ctx.Err()
+		case <-fake.exited:
+			wait <- container.ContainerWaitOKBody{StatusCode: int64(c.exitCode(fake))}
+		}
+	}()
+	return wait, errs
+}
+
+func (c *FakeClient) exitCode(fake *fakeContainer) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if fake.killed {
+		return 137
+	}
+	return fake.program.ExitCode
+}
+
+func (c *FakeClient) ContainerInspect(ctx context.Context, id string) (types.ContainerJSON, error) {
+	fake, err := c.container(id)
+	if err != nil {
+		return types.ContainerJSON{}, err
+	}
+	running := true
+	select {
+	case <-fake.exited:
+		running = false
+	default:
+	}
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID: id,
+			State: &types.ContainerState{
+				Running:   running,
+				ExitCode:  c.exitCode(fake),
+				OOMKilled: fake.program.OOMKilled,
+			},
+			HostConfig: &container.HostConfig{},
+		},
+		Config: fake.config,
+	}, nil
+}
+
+func (c *FakeClient) ContainerInspectWithRaw(ctx context.Context, id string, getSize bool) (types.ContainerJSON, []byte, error) {
+	info, err := c.ContainerInspect(ctx, id)
+	return info, nil, err
+}
+
+func (c *FakeClient) ContainerStats(ctx context.Context, id string, stream bool) (types.ContainerStats, error) {
+	if _, err := c.container(id); err != nil {
+		return types.ContainerStats{}, err
+	}
+	body, err := json.Marshal(types.StatsJSON{})
+	if err != nil {
+		return types.ContainerStats{}, err
+	}
+	return types.ContainerStats{Body: ioutil.NopCloser(bytes.NewReader(body)), OSType: "linux"}, nil
+}
+
+func (c *FakeClient) ContainerKill(ctx context.Context, id string, signal string) error {
+	fake, err := c.container(id)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	fake.killed = true
+	c.mu.Unlock()
+	c.exit(fake)
+	return nil
+}
+
+func (c *FakeClient) ContainerRemove(ctx context.Context, id string, options types.ContainerRemoveOptions) error {
+	fake, err := c.container(id)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	fake.removed = true
+	c.mu.Unlock()
+	c.exit(fake)
+	return nil
+}
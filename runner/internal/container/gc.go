@@ -0,0 +1,78 @@
+package container
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// BUILD_IMAGE_REPO keeps the images of the job builds
+const BUILD_IMAGE_REPO = "dstackai/build"
+
+// GCPolicy limits what the jobs leave behind on a long-lived host
+type GCPolicy struct {
+	// MaxAge prunes the stopped containers, the dangling images and the builds older than it
+	MaxAge time.Duration
+	// MaxBuildsSize removes the oldest builds above it, in bytes. Zero is no limit.
+	MaxBuildsSize int64
+}
+
+// GC prunes the stopped containers, the dangling images and the stale builds. The images in use are kept.
+func (r *Engine) GC(ctx context.Context, policy GCPolicy) error {
+	until := filters.Arg("until", policy.MaxAge.String())
+	containers, err := r.client.ContainersPrune(ctx, filters.NewArgs(until))
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	log.Trace(ctx, "Pruned containers", "count", len(containers.ContainersDeleted), "reclaimed", containers.SpaceReclaimed)
+
+	summaries, err := r.client.ImageList(ctx, types.ImageListOptions{
+		Filters: filters.NewArgs(filters.Arg("reference", BUILD_IMAGE_REPO)),
+	})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	for _, tag := range staleBuilds(summaries, policy, time.Now()) {
+		if _, err = r.client.ImageRemove(ctx, tag, types.ImageRemoveOptions{PruneChildren: true}); err != nil {
+			log.Trace(ctx, "Failed to remove the build", "image", tag, "err", err)
+			continue
+		}
+		log.Trace(ctx, "Removed the build", "image", tag)
+	}
+
+	images, err := r.client.ImagesPrune(ctx, filters.NewArgs(filters.Arg("dangling", "true"), until))
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	log.Trace(ctx, "Pruned dangling images", "count", len(images.ImagesDeleted), "reclaimed", images.SpaceReclaimed)
+	return nil
+}
+
+// staleBuilds returns the tags of the builds older than the max age and of the oldest ones above the max size
+func staleBuilds(summaries []types.ImageSummary, policy GCPolicy, now time.Time) []string {
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Created > summaries[j].Created
+	})
+	var stale []string
+	var size int64
+	for _, summary := range summaries {
+		size += summary.Size
+		expired := now.Sub(time.Unix(summary.Created, 0)) > policy.MaxAge
+		oversize := policy.MaxBuildsSize > 0 && size > policy.MaxBuildsSize
+		if !expired && !oversize {
+			continue
+		}
+		for _, tag := range summary.RepoTags {
+			if strings.HasPrefix(tag, BUILD_IMAGE_REPO+":") {
+				stale = append(stale, tag)
+			}
+		}
+	}
+	return stale
+}
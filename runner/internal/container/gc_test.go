@@ -0,0 +1,22 @@
+package container
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStaleBuilds(t *testing.T) {
+	now := time.Unix(1_000_000, 0)
+	summaries := []types.ImageSummary{
+		{RepoTags: []string{"dstackai/build:old"}, Created: now.Add(-48 * time.Hour).Unix(), Size: 10},
+		{RepoTags: []string{"dstackai/build:new", "ubuntu:latest"}, Created: now.Add(-time.Hour).Unix(), Size: 10},
+		{RepoTags: []string{"dstackai/build:older"}, Created: now.Add(-2 * time.Hour).Unix(), Size: 10},
+	}
+	policy := GCPolicy{MaxAge: 24 * time.Hour}
+	assert.Equal(t, []string{"dstackai/build:old"}, staleBuilds(summaries, policy, now))
+	policy.MaxBuildsSize = 15
+	assert.Equal(t, []string{"dstackai/build:older", "dstackai/build:old"}, staleBuilds(summaries, policy, now))
+}
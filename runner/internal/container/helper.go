@@ -0,0 +1,69 @@
+package container
+
+import (
+	"context"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// HelperSpec is a throwaway container the runner prepares the job files with
+type HelperSpec struct {
+	Image      string
+	Commands   []string
+	Env        []string
+	User       string
+	WorkingDir string
+	Mounts     []mount.Mount
+}
+
+// RunHelper pulls the image if absent, runs the commands to the end and copies their output to logs
+func (r *Engine) RunHelper(ctx context.Context, spec *HelperSpec, logs io.Writer) error {
+	if err := r.pullImageIfAbsent(ctx, spec.Image, "", io.Discard); err != nil {
+		return gerrors.Wrap(err)
+	}
+	log.Trace(ctx, "Running the helper container", "image", spec.Image)
+	resp, err := r.client.ContainerCreate(ctx, &container.Config{
+		Image:      spec.Image,
+		Entrypoint: []string{"/bin/sh", "-c"},
+		Cmd:        ShellCommands(spec.Commands),
+		Env:        spec.Env,
+		User:       spec.User,
+		WorkingDir: spec.WorkingDir,
+	}, &container.HostConfig{
+		Mounts: spec.Mounts,
+	}, nil, nil, "")
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() {
+		_ = r.client.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{Force: true})
+	}()
+	if err = r.client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return gerrors.Wrap(err)
+	}
+	output, err := r.client.ContainerLogs(ctx, resp.ID, types.ContainerLogsOptions{ShowStdout: true, ShowStderr: true, Follow: true})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	_, err = stdcopy.StdCopy(logs, logs, output)
+	_ = output.Close()
+	if err != nil {
+		log.Warning(ctx, "Failed to copy the helper output", "err", err)
+	}
+	wait, werr := r.client.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case result := <-wait:
+		if result.StatusCode != 0 {
+			return gerrors.Newf("helper exited with code %d", result.StatusCode)
+		}
+	case err = <-werr:
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package container
+
+import (
+	"context"
+	"runtime"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+const (
+	NetworkBridge = "bridge"
+	NetworkHost   = "host"
+	NetworkNone   = "none"
+)
+
+// networkConfig resolves the network of the container. Without an explicit network the host one is used if allowed,
+// a named network must exist, the job joins it and doesn't create it.
+func (r *Engine) networkConfig(ctx context.Context, spec *Spec) (container.NetworkMode, *network.NetworkingConfig, error) {
+	if spec.HostNetwork && spec.Network != "" && spec.Network != NetworkHost {
+		return "", nil, gerrors.Newf("the job requires the host network, %s is requested", spec.Network)
+	}
+	switch spec.Network {
+	case "":
+		if (spec.AllowHostMode || spec.HostNetwork) && supportNetworkModeHost() {
+			return NetworkHost, nil, nil
+		}
+		if spec.HostNetwork {
+			log.Info(ctx, "Host network is not supported, publishing ports instead", "os", runtime.GOOS)
+		}
+		return "default", nil, nil
+	case NetworkHost:
+		if !supportNetworkModeHost() {
+			return "", nil, gerrors.Newf("host network is not supported on %s", runtime.GOOS)
+		}
+		return NetworkHost, nil, nil
+	case NetworkBridge, NetworkNone:
+		return container.NetworkMode(spec.Network), nil, nil
+	}
+	if _, err := r.client.NetworkInspect(ctx, spec.Network, types.NetworkInspectOptions{}); err != nil {
+		return "", nil, gerrors.Newf("network %s is not available: %s", spec.Network, err)
+	}
+	return container.NetworkMode(spec.Network), &network.NetworkingConfig{
+		EndpointsConfig: map[string]*network.EndpointSettings{
+			spec.Network: {Aliases: spec.NetworkAliases},
+		},
+	}, nil
+}
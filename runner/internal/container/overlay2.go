@@ -27,8 +27,9 @@ const (
 )
 
 type ImageTag struct {
-	Name   string `json:"name"`
-	Digest string `json:"digest"`
+	Name         string `json:"name"`
+	Digest       string `json:"digest"`
+	Architecture string `json:"architecture,omitempty"`
 }
 
 type Repositories struct {
@@ -66,8 +67,9 @@ func Overlay2ExportImageDiff(ctx context.Context, client docker.APIClient, image
 	log.Trace(ctx, "Export layer", "cacheID", cacheID)
 
 	imageTagBytes, err := json.Marshal(&ImageTag{
-		Name:   imageName,
-		Digest: imageDigest.String(),
+		Name:         imageName,
+		Digest:       imageDigest.String(),
+		Architecture: NormalizeArch(inspect.Architecture),
 	})
 	if err != nil {
 		return gerrors.Wrap(err)
@@ -150,6 +152,10 @@ func Overlay2ImportImageDiff(ctx context.Context, diffPath string) error {
 	if err != nil {
 		return gerrors.Wrap(err)
 	}
+	// diffs exported before multi-arch support have no architecture and are amd64
+	if imageTag.Architecture != "" && "linux/"+imageTag.Architecture != HostPlatform() {
+		return gerrors.Newf("image diff is built for %s, host platform is %s", imageTag.Architecture, HostPlatform())
+	}
 	err = extract.Archive(ctx, diffFile, DockerRoot, func(path string) string {
 		if path == "tag.json" {
 			return ""
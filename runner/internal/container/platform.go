@@ -0,0 +1,24 @@
+package container
+
+import (
+	"runtime"
+)
+
+// DefaultPlatform is kept out of build digests so that amd64 builds made before multi-arch support stay valid
+const DefaultPlatform = "linux/amd64"
+
+// HostPlatform is the platform the runner is built for, which is the platform of the instance
+func HostPlatform() string {
+	return "linux/" + NormalizeArch(runtime.GOARCH)
+}
+
+// NormalizeArch maps kernel and docker architecture names to GOARCH names
+func NormalizeArch(arch string) string {
+	switch arch {
+	case "x86_64", "x86-64":
+		return "amd64"
+	case "aarch64", "arm64/v8":
+		return "arm64"
+	}
+	return arch
+}
@@ -0,0 +1,40 @@
+package container
+
+import (
+	"context"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeArch(t *testing.T) {
+	assert.Equal(t, "amd64", NormalizeArch("x86_64"))
+	assert.Equal(t, "arm64", NormalizeArch("aarch64"))
+	assert.Equal(t, "arm64", NormalizeArch("arm64"))
+}
+
+func TestHashPlatform(t *testing.T) {
+	spec := &BuildSpec{BaseImageID: "sha256:abc", WorkDir: "/workflow"}
+	amd64 := spec.Hash()
+	spec.Platform = DefaultPlatform
+	assert.Equal(t, amd64, spec.Hash())
+	spec.Platform = "linux/arm64"
+	assert.NotEqual(t, amd64, spec.Hash())
+}
+
+func TestImagePlatform(t *testing.T) {
+	ctx := context.Background()
+	client := NewFakeClient()
+	client.SetArchitecture("aarch64")
+	_, err := client.ImagePull(ctx, "ubuntu:22.04", types.ImagePullOptions{})
+	assert.Equal(t, nil, err)
+	platform, emulated, err := NewEngineWithClient(client).ImagePlatform(ctx, "ubuntu:22.04")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "linux/amd64", platform)
+	assert.Equal(t, true, emulated)
+	client.SetArchitecture("x86_64")
+	_, emulated, err = NewEngineWithClient(client).ImagePlatform(ctx, "ubuntu:22.04")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, emulated)
+}
@@ -0,0 +1,123 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+type pullMessage struct {
+	ID             string `json:"id"`
+	Status         string `json:"status"`
+	Error          string `json:"error"`
+	ProgressDetail struct {
+		Current int64 `json:"current"`
+		Total   int64 `json:"total"`
+	} `json:"progressDetail"`
+}
+
+type layerProgress struct {
+	current int64
+	total   int64
+	done    bool
+}
+
+// pullProgress aggregates the docker pull stream into one line per layer update
+type pullProgress struct {
+	out     io.Writer
+	layers  map[string]*layerProgress
+	percent map[string]int
+}
+
+func newPullProgress(out io.Writer) *pullProgress {
+	return &pullProgress{
+		out:     out,
+		layers:  make(map[string]*layerProgress),
+		percent: make(map[string]int),
+	}
+}
+
+func (p *pullProgress) consume(r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var msg pullMessage
+		if err := decoder.Decode(&msg); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return gerrors.Wrap(err)
+		}
+		if msg.Error != "" {
+			return gerrors.Newf("image pull failed: %s", msg.Error)
+		}
+		if err := p.update(msg); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+}
+
+func (p *pullProgress) update(msg pullMessage) error {
+	if msg.ID == "" || !isLayerStatus(msg.Status) {
+		return nil
+	}
+	layer, ok := p.layers[msg.ID]
+	if !ok {
+		layer = &layerProgress{}
+		p.layers[msg.ID] = layer
+	}
+	switch {
+	case msg.Status == "Downloading" && msg.ProgressDetail.Total > 0:
+		layer.current, layer.total = msg.ProgressDetail.Current, msg.ProgressDetail.Total
+	case msg.Status == "Download complete" || msg.Status == "Pull complete" || strings.HasPrefix(msg.Status, "Already exists"):
+		if layer.done {
+			return nil
+		}
+		layer.done = true
+		layer.current = layer.total
+	default:
+		return nil
+	}
+	layerPercent := 100
+	if !layer.done {
+		layerPercent = int(layer.current * 100 / layer.total)
+	}
+	// report every 10% per layer to keep the log readable
+	if last, ok := p.percent[msg.ID]; ok && layerPercent < 100 && layerPercent/10 == last/10 {
+		return nil
+	}
+	p.percent[msg.ID] = layerPercent
+	_, err := fmt.Fprintf(p.out, "%s: %d%% (total %d%%, %d/%d layers)\n", msg.ID, layerPercent, p.total(), p.doneLayers(), len(p.layers))
+	return gerrors.Wrap(err)
+}
+
+func isLayerStatus(status string) bool {
+	switch status {
+	case "Pulling fs layer", "Waiting", "Downloading", "Verifying Checksum", "Download complete", "Extracting", "Pull complete":
+		return true
+	}
+	return strings.HasPrefix(status, "Already exists")
+}
+
+func (p *pullProgress) total() int {
+	var current, total int64
+	for _, layer := range p.layers {
+		current += layer.current
+		total += layer.total
+	}
+	if total == 0 {
+		return 0
+	}
+	return int(current * 100 / total)
+}
+
+func (p *pullProgress) doneLayers() int {
+	count := 0
+	for _, layer := range p.layers {
+		if layer.done {
+			count++
+		}
+	}
+	return count
+}
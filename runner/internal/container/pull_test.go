@@ -0,0 +1,29 @@
+package container
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPullProgress(t *testing.T) {
+	stream := strings.Join([]string{
+		`{"status":"Pulling from library/ubuntu","id":"latest"}`,
+		`{"status":"Pulling fs layer","id":"aaa"}`,
+		`{"status":"Downloading","progressDetail":{"current":10,"total":100},"id":"aaa"}`,
+		`{"status":"Downloading","progressDetail":{"current":15,"total":100},"id":"aaa"}`,
+		`{"status":"Downloading","progressDetail":{"current":50,"total":100},"id":"aaa"}`,
+		`{"status":"Download complete","id":"aaa"}`,
+		`{"status":"Pull complete","id":"aaa"}`,
+	}, "\n")
+	var out bytes.Buffer
+	assert.Equal(t, nil, newPullProgress(&out).consume(strings.NewReader(stream)))
+	assert.Equal(t, "aaa: 10% (total 10%, 0/1 layers)\naaa: 50% (total 50%, 0/1 layers)\naaa: 100% (total 100%, 1/1 layers)\n", out.String())
+}
+
+func TestPullProgressError(t *testing.T) {
+	err := newPullProgress(&bytes.Buffer{}).consume(strings.NewReader(`{"error":"manifest unknown"}`))
+	assert.NotEqual(t, nil, err)
+}
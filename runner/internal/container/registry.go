@@ -0,0 +1,126 @@
+package container
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// DOCKER_HUB is the registry host of the images without one
+const DOCKER_HUB = "docker.io"
+
+// Registries configures the image pulls. The mirrors of a registry are tried before the registry itself.
+type Registries struct {
+	// Mirrors maps a registry host, docker.io for Docker Hub, to the hosts serving its images
+	Mirrors map[string][]string
+	// Insecure are the registries reached over plain HTTP, the daemon must allow them too
+	Insecure []string
+	// Auth maps a registry host to its base64 credentials, the job ones take precedence
+	Auth map[string]string
+	// Mint returns the base64 credentials of the registries with no Auth, e.g. from the cloud identity of the instance.
+	// An empty string pulls anonymously.
+	Mint func(ctx context.Context, host string) (string, error)
+}
+
+// SetRegistries applies the registries to the next pulls
+func (r *Engine) SetRegistries(registries Registries) {
+	r.registries = registries
+}
+
+// CheckInsecureRegistries warns about the registries the daemon won't reach over plain HTTP
+func (r *Engine) CheckInsecureRegistries(ctx context.Context, hosts []string) {
+	for _, host := range hosts {
+		if !r.insecure[host] {
+			log.Warning(ctx, "The Docker daemon doesn't allow the insecure registry, add it to insecure-registries of daemon.json", "registry", host)
+		}
+	}
+}
+
+// pullImage pulls from the mirrors of the image registry first, the mirrored image is tagged as the original one
+func (r *Engine) pullImage(ctx context.Context, image, registryAuthBase64, platform string, progress io.Writer) error {
+	host, path := splitImageRegistry(image)
+	for _, mirror := range r.registries.Mirrors[host] {
+		mirrored := mirror + "/" + path
+		if err := r.pullImageFrom(ctx, mirrored, r.registryAuth(ctx, mirror, ""), platform, progress); err != nil {
+			log.Warning(ctx, "Failed to pull from the mirror", "image", mirrored, "err", err)
+			continue
+		}
+		if err := r.client.ImageTag(ctx, mirrored, image); err != nil {
+			return gerrors.Wrap(err)
+		}
+		return nil
+	}
+	return gerrors.Wrap(r.pullImageFrom(ctx, image, r.registryAuth(ctx, host, registryAuthBase64), platform, progress))
+}
+
+func (r *Engine) registryAuth(ctx context.Context, host, registryAuthBase64 string) string {
+	if registryAuthBase64 != "" {
+		return registryAuthBase64
+	}
+	if auth, ok := r.registries.Auth[host]; ok {
+		return auth
+	}
+	if r.registries.Mint == nil {
+		return ""
+	}
+	auth, err := r.registries.Mint(ctx, host)
+	if err != nil {
+		log.Warning(ctx, "Failed to mint the registry credentials, pulling anonymously", "registry", host, "err", err)
+		return ""
+	}
+	return auth
+}
+
+// splitImageRegistry returns the registry host and the rest of the image reference, the same way docker resolves it
+func splitImageRegistry(image string) (string, string) {
+	first, rest, found := strings.Cut(image, "/")
+	if !found || (!strings.ContainsAny(first, ".:") && first != "localhost") {
+		if !found {
+			return DOCKER_HUB, "library/" + image
+		}
+		return DOCKER_HUB, image
+	}
+	if first == "index.docker.io" || first == "registry-1.docker.io" {
+		first = DOCKER_HUB
+	}
+	if first == DOCKER_HUB && !strings.Contains(rest, "/") {
+		rest = "library/" + rest
+	}
+	return first, rest
+}
+
+// ImageID is the content-addressed ID of the local image
+func (r *Engine) ImageID(ctx context.Context, image string) (string, error) {
+	info, _, err := r.client.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return info.ID, nil
+}
+
+// RepoDigest returns the digest reference of the pulled image, empty if the image comes from no registry
+func (r *Engine) RepoDigest(ctx context.Context, image string) (string, error) {
+	if strings.Contains(image, "@") {
+		return image, nil
+	}
+	info, _, err := r.client.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	repo := image
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		repo = image[:i]
+	}
+	for _, digest := range info.RepoDigests {
+		if strings.HasPrefix(digest, repo+"@") {
+			return digest, nil
+		}
+	}
+	if len(info.RepoDigests) == 1 {
+		return info.RepoDigests[0], nil
+	}
+	return "", nil
+}
@@ -0,0 +1,23 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitImageRegistry(t *testing.T) {
+	for image, expected := range map[string][2]string{
+		"ubuntu:22.04":                        {"docker.io", "library/ubuntu:22.04"},
+		"dstackai/miniforge:py3.9":            {"docker.io", "dstackai/miniforge:py3.9"},
+		"docker.io/ubuntu":                    {"docker.io", "library/ubuntu"},
+		"index.docker.io/dstackai/cuda":       {"docker.io", "dstackai/cuda"},
+		"ghcr.io/org/image:tag":               {"ghcr.io", "org/image:tag"},
+		"localhost/image":                     {"localhost", "image"},
+		"registry.internal:5000/team/image":   {"registry.internal:5000", "team/image"},
+		"nvcr.io/nvidia/pytorch@sha256:abcd0": {"nvcr.io", "nvidia/pytorch@sha256:abcd0"},
+	} {
+		host, path := splitImageRegistry(image)
+		assert.Equal(t, expected, [2]string{host, path}, image)
+	}
+}
@@ -0,0 +1,155 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// sidecarStartTimeout bounds the wait for a sidecar to reach the running state
+const sidecarStartTimeout = 30 * time.Second
+
+type SidecarSpec struct {
+	Name               string
+	Image              string
+	RegistryAuthBase64 string
+	Commands           []string
+	Entrypoint         []string
+	Env                []string
+	Mounts             []mount.Mount
+	Privileged         bool
+	Logs               io.Writer
+}
+
+// createNetworkHolder creates an idle container from the job image, which owns the network namespace and the published ports
+func (r *Engine) createNetworkHolder(ctx context.Context, spec *Spec, config *container.Config, hostConfig *container.HostConfig, networking *network.NetworkingConfig) (string, error) {
+	log.Trace(ctx, "Creating network holder container", "image", spec.Image)
+	resp, err := r.client.ContainerCreate(ctx, &container.Config{
+		Image:        spec.Image,
+		Entrypoint:   []string{"sleep", "infinity"},
+		ExposedPorts: config.ExposedPorts,
+		Labels:       spec.Labels,
+	}, &container.HostConfig{
+		NetworkMode:     hostConfig.NetworkMode,
+		PortBindings:    hostConfig.PortBindings,
+		PublishAllPorts: hostConfig.PublishAllPorts,
+		Sysctls:         hostConfig.Sysctls,
+		DNS:             hostConfig.DNS,
+		DNSSearch:       hostConfig.DNSSearch,
+		ExtraHosts:      hostConfig.ExtraHosts,
+	}, networking, nil, "")
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return resp.ID, nil
+}
+
+// startSidecars runs the sidecars before the main container, in the network namespace of the holder container
+// or in the host network. Sidecars are torn down together with the main container.
+func (r *DockerRuntime) startSidecars(ctx context.Context) error {
+	if len(r.sidecarSpecs) == 0 {
+		return nil
+	}
+	networkMode := container.NetworkMode("host")
+	if r.netHolder != "" {
+		log.Trace(ctx, "Starting network holder container")
+		if err := r.client.ContainerStart(ctx, r.netHolder, types.ContainerStartOptions{}); err != nil {
+			return gerrors.Newf("failed to start container: %s", err)
+		}
+		networkMode = container.NetworkMode(fmt.Sprintf("container:%s", r.netHolder))
+	}
+	for i := range r.sidecarSpecs {
+		if err := r.startSidecar(ctx, networkMode, &r.sidecarSpecs[i]); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+func (r *DockerRuntime) startSidecar(ctx context.Context, networkMode container.NetworkMode, spec *SidecarSpec) error {
+	log.Trace(ctx, "Creating sidecar container", "name", spec.Name, "image", spec.Image)
+	config := &container.Config{
+		Image:        spec.Image,
+		Cmd:          spec.Commands,
+		Entrypoint:   spec.Entrypoint,
+		Env:          spec.Env,
+		Tty:          true,
+		AttachStdout: true,
+	}
+	hostConfig := &container.HostConfig{
+		NetworkMode: networkMode,
+		Runtime:     r.runtime,
+		Mounts:      spec.Mounts,
+		Privileged:  spec.Privileged,
+	}
+	resp, err := r.client.ContainerCreate(ctx, config, hostConfig, nil, nil, "")
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	sidecar := &DockerRuntime{
+		client:      r.client,
+		containerID: resp.ID,
+		logs:        spec.Logs,
+		errLogs:     spec.Logs,
+		tty:         true,
+	}
+	r.mu.Lock()
+	r.sidecars = append(r.sidecars, sidecar)
+	r.mu.Unlock()
+	if err = sidecar.Run(ctx); err != nil {
+		return gerrors.Wrap(err)
+	}
+	if err = sidecar.waitRunning(ctx); err != nil {
+		return gerrors.Newf("sidecar %s: %v", spec.Name, err)
+	}
+	return nil
+}
+
+func (r *DockerRuntime) waitRunning(ctx context.Context) error {
+	deadline := time.Now().Add(sidecarStartTimeout)
+	for {
+		info, err := r.client.ContainerInspect(ctx, r.containerID)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		if info.State.Running {
+			return nil
+		}
+		if info.State.Status == "exited" || info.State.Status == "dead" {
+			return gerrors.Wrap(exitedError(info))
+		}
+		if time.Now().After(deadline) {
+			return gerrors.Newf("not running after %s", sidecarStartTimeout)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// stopSidecars removes the sidecars and the network holder container
+func (r *DockerRuntime) stopSidecars(ctx context.Context) {
+	r.mu.Lock()
+	sidecars, netHolder := r.sidecars, r.netHolder
+	r.sidecars, r.netHolder = nil, ""
+	r.mu.Unlock()
+	for _, sidecar := range sidecars {
+		// the anonymous volumes, e.g. /var/lib/docker of the dind sidecar, go with the container
+		err := r.client.ContainerRemove(ctx, sidecar.containerID, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+		if err != nil {
+			log.Error(ctx, "Failed to remove sidecar container", "id", sidecar.containerID, "err", err)
+		}
+	}
+	if netHolder != "" {
+		err := r.client.ContainerRemove(ctx, netHolder, types.ContainerRemoveOptions{Force: true})
+		if err != nil {
+			log.Error(ctx, "Failed to remove network holder container", "id", netHolder, "err", err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// Stats samples the resource usage of the container, the CPU is measured over a second by the daemon.
+// DiskUsedMiB is the writable layer only, the mounts are not counted.
+func (r *DockerRuntime) Stats(ctx context.Context) (models.ContainerStat, error) {
+	resp, err := r.client.ContainerStats(ctx, r.containerID, false)
+	if err != nil {
+		return models.ContainerStat{}, gerrors.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var stats types.StatsJSON
+	if err = json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return models.ContainerStat{}, gerrors.Wrap(err)
+	}
+	info, _, err := r.client.ContainerInspectWithRaw(ctx, r.containerID, true)
+	if err != nil {
+		return models.ContainerStat{}, gerrors.Wrap(err)
+	}
+	stat := models.ContainerStat{
+		CPUPercent:     cpuPercent(&stats),
+		MemoryUsedMiB:  memoryUsed(&stats.MemoryStats) / 1024 / 1024,
+		MemoryLimitMiB: stats.MemoryStats.Limit / 1024 / 1024,
+		Timestamp:      uint64(time.Now().UnixMilli()),
+	}
+	if info.SizeRw != nil {
+		stat.DiskUsedMiB = uint64(*info.SizeRw) / 1024 / 1024
+	}
+	return stat, nil
+}
+
+// cpuPercent is the share of a single CPU like in docker stats, e.g. 200 for two busy CPUs
+func cpuPercent(stats *types.StatsJSON) float64 {
+	cpuDelta := float64(stats.CPUStats.CPUUsage.TotalUsage) - float64(stats.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(stats.CPUStats.SystemUsage) - float64(stats.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	onlineCPUs := float64(stats.CPUStats.OnlineCPUs)
+	if onlineCPUs == 0 {
+		onlineCPUs = float64(len(stats.CPUStats.CPUUsage.PercpuUsage))
+	}
+	return cpuDelta / systemDelta * onlineCPUs * 100
+}
+
+// memoryUsed excludes the page cache like docker stats, the cgroup v1 and v2 report it differently
+func memoryUsed(stats *types.MemoryStats) uint64 {
+	cache, ok := stats.Stats["total_inactive_file"]
+	if !ok {
+		cache = stats.Stats["inactive_file"]
+	}
+	if cache > stats.Usage {
+		return stats.Usage
+	}
+	return stats.Usage - cache
+}
@@ -0,0 +1,30 @@
+package container
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCPUPercent(t *testing.T) {
+	stats := &types.StatsJSON{}
+	stats.PreCPUStats.CPUUsage.TotalUsage = 1000
+	stats.PreCPUStats.SystemUsage = 10000
+	stats.CPUStats.CPUUsage.TotalUsage = 2000
+	stats.CPUStats.SystemUsage = 14000
+	stats.CPUStats.OnlineCPUs = 4
+	assert.Equal(t, 100.0, cpuPercent(stats))
+
+	stats.CPUStats.OnlineCPUs = 0
+	stats.CPUStats.CPUUsage.PercpuUsage = []uint64{1000, 1000}
+	assert.Equal(t, 50.0, cpuPercent(stats))
+
+	assert.Equal(t, 0.0, cpuPercent(&types.StatsJSON{}))
+}
+
+func TestMemoryUsed(t *testing.T) {
+	assert.Equal(t, uint64(700), memoryUsed(&types.MemoryStats{Usage: 1000, Stats: map[string]uint64{"inactive_file": 300}}))
+	assert.Equal(t, uint64(600), memoryUsed(&types.MemoryStats{Usage: 1000, Stats: map[string]uint64{"total_inactive_file": 400}}))
+	assert.Equal(t, uint64(1000), memoryUsed(&types.MemoryStats{Usage: 1000}))
+}
@@ -0,0 +1,57 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strconv"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// Chown gives the host directories to uid:gid. The files written by a root container can't be chowned by
+// an unprivileged runner, so a throwaway root container of the image does it.
+func (r *Engine) Chown(ctx context.Context, image string, sources []string, uid, gid int) error {
+	if len(sources) == 0 {
+		return nil
+	}
+	cmd := []string{"chown", "-R", fmt.Sprintf("%d:%d", uid, gid)}
+	mounts := make([]mount.Mount, 0, len(sources))
+	for i, source := range sources {
+		target := path.Join("/chown", strconv.Itoa(i))
+		cmd = append(cmd, target)
+		mounts = append(mounts, mount.Mount{Type: mount.TypeBind, Source: source, Target: target})
+	}
+	log.Trace(ctx, "Chowning the job files", "sources", sources, "uid", uid, "gid", gid)
+	resp, err := r.client.ContainerCreate(ctx, &container.Config{
+		Image:      image,
+		Entrypoint: cmd,
+		User:       "0:0",
+	}, &container.HostConfig{
+		Mounts:      mounts,
+		NetworkMode: NetworkNone,
+	}, nil, nil, "")
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() {
+		_ = r.client.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{Force: true})
+	}()
+	if err = r.client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return gerrors.Wrap(err)
+	}
+	wait, werr := r.client.ContainerWait(ctx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case result := <-wait:
+		if result.StatusCode != 0 {
+			return gerrors.Newf("chown exited with code %d", result.StatusCode)
+		}
+	case err = <-werr:
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
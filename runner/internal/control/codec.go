@@ -0,0 +1,20 @@
+package control
+
+import (
+	"encoding/json"
+)
+
+// codec lets the control API run without generated protobuf code, clients call it with the "json" content subtype
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (codec) Name() string {
+	return "json"
+}
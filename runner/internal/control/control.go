@@ -0,0 +1,464 @@
+package control
+
+import (
+	"context"
+	"crypto/subtle"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const ServiceName = "dstack.runner.v1.Control"
+
+// DefaultHost keeps the control API local, listening on other interfaces requires a token
+const DefaultHost = "127.0.0.1"
+
+// logsPollInterval is the delay between log buffer reads while tailing
+const logsPollInterval = 200 * time.Millisecond
+
+// execChunkSize is the largest output message of an exec session
+const execChunkSize = 32 * 1024
+
+// Runner is the part of the executor exposed over the control API.
+// JobSnapshot returns a copy, the job is updated concurrently.
+// StateDegraded reports the job state can't be written to the backend, the stored one is stale.
+// Exec starts a process in the running job container, Sync extracts a tar into its /workflow mount.
+type Runner interface {
+	JobSnapshot(ctx context.Context) models.Job
+	StateDegraded() bool
+	Stop()
+	Exec(ctx context.Context, req *ExecRequest) (ExecSession, error)
+	Sync(ctx context.Context, deleted []string, archive io.Reader) error
+}
+
+// ExecSession is a process attached to the exec stream, see container.ExecSession.
+// ExitCode waits for the process to exit.
+type ExecSession interface {
+	io.ReadWriteCloser
+	CloseWrite() error
+	Resize(ctx context.Context, rows, cols uint) error
+	ExitCode(ctx context.Context) (int, error)
+}
+
+// LogSource is a buffer of log chunks, see stream.Server. The evicted chunks are skipped, first is the index
+// of the first returned one.
+type LogSource interface {
+	Read(offset int) (first int, chunks [][]byte, closed bool)
+}
+
+type StatusRequest struct{}
+
+type StatusResponse struct {
+	JobID             string `json:"job_id"`
+	RunName           string `json:"run_name"`
+	Status            string `json:"status"`
+	ErrorCode         string `json:"error_code,omitempty"`
+	ContainerExitCode string `json:"container_exit_code,omitempty"`
+	Attempt           int    `json:"attempt,omitempty"`
+	Degraded          bool   `json:"degraded,omitempty"`
+}
+
+type UsageRequest struct{}
+
+type UsageResponse struct {
+	GPUs      []models.GPUStat      `json:"gpus"`
+	Container *models.ContainerStat `json:"container,omitempty"`
+}
+
+type TailLogsRequest struct {
+	Offset int `json:"offset"`
+}
+
+type LogChunk struct {
+	Offset int    `json:"offset"`
+	Data   []byte `json:"data"`
+}
+
+// ExecRequest is the first message of the exec stream, the user, env and working dir default to the job container ones
+type ExecRequest struct {
+	Cmd        []string `json:"cmd"`
+	User       string   `json:"user,omitempty"`
+	Env        []string `json:"env,omitempty"`
+	WorkingDir string   `json:"working_dir,omitempty"`
+	TTY        bool     `json:"tty,omitempty"`
+	Rows       uint     `json:"rows,omitempty"`
+	Cols       uint     `json:"cols,omitempty"`
+}
+
+// ExecInput is the stdin of the process, Rows and Cols resize the TTY. EOF closes the stdin.
+type ExecInput struct {
+	Data []byte `json:"data,omitempty"`
+	Rows uint   `json:"rows,omitempty"`
+	Cols uint   `json:"cols,omitempty"`
+	EOF  bool   `json:"eof,omitempty"`
+}
+
+// ExecOutput is the output of the process, the last message has the exit code only
+type ExecOutput struct {
+	Data     []byte `json:"data,omitempty"`
+	ExitCode *int   `json:"exit_code,omitempty"`
+}
+
+// SyncChunk is a part of the tar with the changed files, Delete lists the removed paths in the first chunk only.
+// The paths are slash-separated and relative to /workflow.
+type SyncChunk struct {
+	Delete []string `json:"delete,omitempty"`
+	Data   []byte   `json:"data,omitempty"`
+}
+
+type SyncResponse struct {
+	Bytes int64 `json:"bytes"`
+}
+
+type StopRequest struct{}
+
+type StopResponse struct{}
+
+type Server struct {
+	host   string
+	port   int
+	token  string
+	runner Runner
+	logs   LogSource
+	grpc   *grpc.Server
+}
+
+// New creates the control API server. If the token is set, every call has to pass it as `authorization: Bearer <token>`.
+func New(host string, port int, token string, runner Runner, logs LogSource) *Server {
+	if host == "" {
+		host = DefaultHost
+	}
+	s := &Server{
+		host:   host,
+		port:   port,
+		token:  token,
+		runner: runner,
+		logs:   logs,
+	}
+	s.grpc = grpc.NewServer(
+		grpc.ForceServerCodec(codec{}),
+		grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			if err := s.authorize(ctx); err != nil {
+				return nil, err
+			}
+			return handler(ctx, req)
+		}),
+		grpc.StreamInterceptor(func(srv interface{}, stream grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+			if err := s.authorize(stream.Context()); err != nil {
+				return err
+			}
+			return handler(srv, stream)
+		}),
+	)
+	s.grpc.RegisterService(&serviceDesc, s)
+	return s
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	if s.token == "" && !isLoopback(s.host) {
+		return gerrors.Newf("control API on %s requires a token", s.host)
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(s.host, strconv.Itoa(s.port)))
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	log.Info(ctx, "Control API is listening", "host", s.host, "port", s.port)
+	if err = s.grpc.Serve(listener); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+func (s *Server) Shutdown() {
+	s.grpc.GracefulStop()
+}
+
+func (s *Server) authorize(ctx context.Context) error {
+	if s.token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(value), []byte("Bearer "+s.token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid control API token")
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func (s *Server) Status(ctx context.Context, _ *StatusRequest) (*StatusResponse, error) {
+	job := s.runner.JobSnapshot(ctx)
+	return &StatusResponse{
+		JobID:             job.JobID,
+		RunName:           job.RunName,
+		Status:            job.Status,
+		ErrorCode:         job.ErrorCode,
+		ContainerExitCode: job.ContainerExitCode,
+		Attempt:           job.Attempt,
+		Degraded:          s.runner.StateDegraded(),
+	}, nil
+}
+
+// Usage returns the latest sample of every GPU and of the job container
+func (s *Server) Usage(ctx context.Context, _ *UsageRequest) (*UsageResponse, error) {
+	job := s.runner.JobSnapshot(ctx)
+	latest := make(map[int]models.GPUStat)
+	order := make([]int, 0)
+	for _, stat := range job.GPUStats {
+		if _, ok := latest[stat.Index]; !ok {
+			order = append(order, stat.Index)
+		}
+		latest[stat.Index] = stat
+	}
+	resp := &UsageResponse{GPUs: make([]models.GPUStat, 0, len(order)), Container: job.ContainerStats}
+	for _, index := range order {
+		resp.GPUs = append(resp.GPUs, latest[index])
+	}
+	return resp, nil
+}
+
+func (s *Server) Stop(ctx context.Context, _ *StopRequest) (*StopResponse, error) {
+	log.Info(ctx, "Stop requested over the control API")
+	s.runner.Stop()
+	return &StopResponse{}, nil
+}
+
+// TailLogs streams log chunks from the offset until the log stream is closed
+func (s *Server) TailLogs(req *TailLogsRequest, stream grpc.ServerStream) error {
+	offset := req.Offset
+	for {
+		first, chunks, closed := s.logs.Read(offset)
+		offset = first
+		for _, chunk := range chunks {
+			if err := stream.SendMsg(&LogChunk{Offset: offset, Data: chunk}); err != nil {
+				return gerrors.Wrap(err)
+			}
+			offset++
+		}
+		if closed && len(chunks) == 0 {
+			return nil
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-time.After(logsPollInterval):
+		}
+	}
+}
+
+// Exec proxies a process in the job container: the stream input goes to its stdin and its output comes back
+// until it exits. Without TTY stdout and stderr are merged.
+func (s *Server) Exec(req *ExecRequest, stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	if len(req.Cmd) == 0 {
+		return status.Error(codes.InvalidArgument, "exec command is empty")
+	}
+	session, err := s.runner.Exec(ctx, req)
+	if err != nil {
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	defer func() { _ = session.Close() }()
+	log.Info(ctx, "Exec session started over the control API", "cmd", req.Cmd, "tty", req.TTY)
+	go s.execInput(ctx, session, stream)
+	buf := make([]byte, execChunkSize)
+	for {
+		n, errRead := session.Read(buf)
+		if n > 0 {
+			if err = stream.SendMsg(&ExecOutput{Data: append([]byte{}, buf[:n]...)}); err != nil {
+				return gerrors.Wrap(err)
+			}
+		}
+		if errRead != nil {
+			break
+		}
+	}
+	exitCode, err := session.ExitCode(ctx)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	log.Info(ctx, "Exec session ended", "exit_code", exitCode)
+	return gerrors.Wrap(stream.SendMsg(&ExecOutput{ExitCode: &exitCode}))
+}
+
+// execInput feeds the stream input to the process. If the client is gone, the session is closed to stop the output.
+func (s *Server) execInput(ctx context.Context, session ExecSession, stream grpc.ServerStream) {
+	for {
+		input := new(ExecInput)
+		if err := stream.RecvMsg(input); err != nil {
+			if err == io.EOF {
+				_ = session.CloseWrite()
+			} else {
+				_ = session.Close()
+			}
+			return
+		}
+		if input.Rows > 0 && input.Cols > 0 {
+			if err := session.Resize(ctx, input.Rows, input.Cols); err != nil {
+				log.Warning(ctx, "Failed to resize the exec TTY", "err", err)
+			}
+		}
+		if len(input.Data) > 0 {
+			if _, err := session.Write(input.Data); err != nil {
+				return
+			}
+		}
+		if input.EOF {
+			_ = session.CloseWrite()
+			return
+		}
+	}
+}
+
+// Sync applies the code changes streamed by the CLI to the running job without restarting it
+func (s *Server) Sync(first *SyncChunk, stream grpc.ServerStream) error {
+	reader, writer := io.Pipe()
+	go func() {
+		chunk := first
+		for {
+			if len(chunk.Data) > 0 {
+				if _, err := writer.Write(chunk.Data); err != nil {
+					return
+				}
+			}
+			chunk = new(SyncChunk)
+			if err := stream.RecvMsg(chunk); err != nil {
+				if err == io.EOF {
+					_ = writer.Close()
+				} else {
+					_ = writer.CloseWithError(err)
+				}
+				return
+			}
+		}
+	}()
+	// the tar may end before the stream, the rest of the chunks is dropped
+	defer func() { _ = reader.Close() }()
+	counter := &countingReader{r: reader}
+	if err := s.runner.Sync(stream.Context(), first.Delete, counter); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(stream.SendMsg(&SyncResponse{Bytes: counter.n}))
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*interface{})(nil),
+	// grpc leaves it to the unary handlers to call the interceptor, the token is checked there
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Status",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(StatusRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(*Server).Status(ctx, req)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Status"}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(*Server).Status(ctx, req.(*StatusRequest))
+				}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+		{
+			MethodName: "Usage",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(UsageRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(*Server).Usage(ctx, req)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Usage"}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(*Server).Usage(ctx, req.(*UsageRequest))
+				}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+		{
+			MethodName: "Stop",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := new(StopRequest)
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				if interceptor == nil {
+					return srv.(*Server).Stop(ctx, req)
+				}
+				info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/Stop"}
+				handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+					return srv.(*Server).Stop(ctx, req.(*StopRequest))
+				}
+				return interceptor(ctx, req, info, handler)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "TailLogs",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				req := new(TailLogsRequest)
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(*Server).TailLogs(req, stream)
+			},
+			ServerStreams: true,
+		},
+		{
+			StreamName: "Exec",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				req := new(ExecRequest)
+				if err := stream.RecvMsg(req); err != nil {
+					return err
+				}
+				return srv.(*Server).Exec(req, stream)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName: "Sync",
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				chunk := new(SyncChunk)
+				if err := stream.RecvMsg(chunk); err != nil {
+					return err
+				}
+				return srv.(*Server).Sync(chunk, stream)
+			},
+			ClientStreams: true,
+		},
+	},
+}
@@ -0,0 +1,152 @@
+package control
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type fakeRunner struct {
+	job      *models.Job
+	stopped  bool
+	degraded bool
+	session  *fakeSession
+	deleted  []string
+	synced   []byte
+}
+
+func (r *fakeRunner) JobSnapshot(context.Context) models.Job { return *r.job }
+func (r *fakeRunner) StateDegraded() bool                    { return r.degraded }
+func (r *fakeRunner) Stop()                                  { r.stopped = true }
+func (r *fakeRunner) Exec(context.Context, *ExecRequest) (ExecSession, error) {
+	return r.session, nil
+}
+func (r *fakeRunner) Sync(_ context.Context, deleted []string, archive io.Reader) error {
+	r.deleted = deleted
+	var err error
+	r.synced, err = io.ReadAll(archive)
+	return err
+}
+
+type fakeSession struct {
+	output *bytes.Reader
+	closed bool
+}
+
+func (s *fakeSession) Read(p []byte) (int, error)               { return s.output.Read(p) }
+func (s *fakeSession) Write(p []byte) (int, error)              { return len(p), nil }
+func (s *fakeSession) Close() error                             { s.closed = true; return nil }
+func (s *fakeSession) CloseWrite() error                        { return nil }
+func (s *fakeSession) Resize(context.Context, uint, uint) error { return nil }
+func (s *fakeSession) ExitCode(context.Context) (int, error)    { return 3, nil }
+
+type fakeStream struct {
+	grpc.ServerStream
+	sent []interface{}
+}
+
+func (s *fakeStream) Context() context.Context  { return context.Background() }
+func (s *fakeStream) RecvMsg(interface{}) error { return io.EOF }
+func (s *fakeStream) SendMsg(m interface{}) error {
+	s.sent = append(s.sent, m)
+	return nil
+}
+
+func TestUsageLatestSamples(t *testing.T) {
+	runner := &fakeRunner{job: &models.Job{GPUStats: []models.GPUStat{
+		{Index: 0, Utilization: 10, Timestamp: 1},
+		{Index: 1, Utilization: 20, Timestamp: 1},
+		{Index: 0, Utilization: 90, Timestamp: 2},
+	}}}
+	s := &Server{runner: runner}
+	resp, err := s.Usage(context.Background(), &UsageRequest{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(resp.GPUs))
+	assert.Equal(t, 90, resp.GPUs[0].Utilization)
+	assert.Equal(t, 20, resp.GPUs[1].Utilization)
+}
+
+func TestStop(t *testing.T) {
+	runner := &fakeRunner{job: &models.Job{}}
+	s := &Server{runner: runner}
+	_, err := s.Stop(context.Background(), &StopRequest{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, runner.stopped)
+}
+
+func TestAuthorize(t *testing.T) {
+	s := &Server{token: "secret"}
+	assert.NotEqual(t, nil, s.authorize(context.Background()))
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer wrong"))
+	assert.NotEqual(t, nil, s.authorize(ctx))
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer secret"))
+	assert.Equal(t, nil, s.authorize(ctx))
+}
+
+func TestUnaryCallsRequireToken(t *testing.T) {
+	runner := &fakeRunner{job: &models.Job{}}
+	s := New("0.0.0.0", 0, "secret", runner, nil)
+	listener := bufconn.Listen(1024 * 1024)
+	go func() { _ = s.grpc.Serve(listener) }()
+	defer s.Shutdown()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec{})),
+	)
+	assert.Equal(t, nil, err)
+	defer func() { _ = conn.Close() }()
+
+	err = conn.Invoke(context.Background(), "/"+ServiceName+"/Stop", &StopRequest{}, &StopResponse{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+	assert.Equal(t, false, runner.stopped)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	err = conn.Invoke(ctx, "/"+ServiceName+"/Stop", &StopRequest{}, &StopResponse{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, runner.stopped)
+}
+
+func TestRunRequiresTokenOffLoopback(t *testing.T) {
+	s := New("0.0.0.0", 0, "", &fakeRunner{job: &models.Job{}}, nil)
+	assert.NotEqual(t, nil, s.Run(context.Background()))
+}
+
+func TestExec(t *testing.T) {
+	session := &fakeSession{output: bytes.NewReader([]byte("hello\n"))}
+	s := &Server{runner: &fakeRunner{job: &models.Job{}, session: session}}
+	stream := &fakeStream{}
+	err := s.Exec(&ExecRequest{Cmd: []string{"echo", "hello"}}, stream)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(stream.sent))
+	assert.Equal(t, "hello\n", string(stream.sent[0].(*ExecOutput).Data))
+	assert.Equal(t, 3, *stream.sent[1].(*ExecOutput).ExitCode)
+	assert.Equal(t, true, session.closed)
+}
+
+func TestExecEmptyCommand(t *testing.T) {
+	s := &Server{runner: &fakeRunner{job: &models.Job{}}}
+	assert.NotEqual(t, nil, s.Exec(&ExecRequest{}, &fakeStream{}))
+}
+
+func TestSync(t *testing.T) {
+	runner := &fakeRunner{job: &models.Job{}}
+	s := &Server{runner: runner}
+	stream := &fakeStream{}
+	err := s.Sync(&SyncChunk{Delete: []string{"old.py"}, Data: []byte("tar")}, stream)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"old.py"}, runner.deleted)
+	assert.Equal(t, "tar", string(runner.synced))
+	assert.Equal(t, int64(3), stream.sent[0].(*SyncResponse).Bytes)
+}
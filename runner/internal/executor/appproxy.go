@@ -0,0 +1,28 @@
+package executor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// prepareAppProxy tells the CLI where the apps are served. The token of the runner config is not published,
+// the clients get it from the runner admin, otherwise a token is generated for the job.
+func (ex *Executor) prepareAppProxy(ctx context.Context) error {
+	config := ex.config.AppProxy
+	token := ""
+	if config.Token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return gerrors.Wrap(err)
+		}
+		token = hex.EncodeToString(b)
+		ex.logSecrets.Add(token)
+	}
+	return ex.updateJob(ctx, func(job *models.Job) {
+		job.AppProxy = &models.AppProxy{Port: config.Port, Domain: config.Domain, Token: token}
+	})
+}
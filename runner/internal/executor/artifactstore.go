@@ -0,0 +1,96 @@
+package executor
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/artifacts/s3compat"
+	"github.com/dstackai/dstack/runner/internal/artifacts/sftp"
+	"github.com/dstackai/dstack/runner/internal/artifacts/webdav"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// backendArtifact retries the backend until it creates the artifact, it is nil if the backend gives up
+func (ex *Executor) backendArtifact(ctx context.Context, runName, localPath, remotePath string, mount bool) artifacts.Artifacter {
+	var art artifacts.Artifacter
+	err := ex.backoff.Do(ctx, "get artifact", func() error {
+		art = ex.backend.GetArtifact(ctx, runName, localPath, remotePath, mount)
+		if art == nil {
+			return gerrors.Newf("no artifact %s", localPath)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Error(ctx, "Failed to create the artifact", "path", localPath, "err", err)
+	}
+	return art
+}
+
+// getArtifact returns the artifact of the runner store if there is one, of the backend otherwise
+func (ex *Executor) getArtifact(ctx context.Context, runName, localPath, remotePath string, mount bool) artifacts.Artifacter {
+	store := ex.config.Artifacts
+	if store == nil {
+		return ex.backendArtifact(ctx, runName, localPath, remotePath, mount)
+	}
+	if mount {
+		log.Warning(ctx, "The artifact store mounts no artifacts, the artifact is copied", "path", localPath)
+	}
+	workDir := filepath.Join(ex.backend.GetTMPDir(ctx), consts.USER_ARTIFACTS_DIR, runName)
+	switch {
+	case store.SFTP != nil:
+		art, err := sftp.New(*store.SFTP, workDir, localPath, remotePath)
+		if err != nil {
+			log.Error(ctx, "Failed to create the SFTP artifact", "err", err)
+			return nil
+		}
+		return art
+	case store.WebDAV != nil:
+		art, err := webdav.New(*store.WebDAV, workDir, localPath, remotePath)
+		if err != nil {
+			log.Error(ctx, "Failed to create the WebDAV artifact", "err", err)
+			return nil
+		}
+		return art
+	case store.S3 != nil:
+		s3Store, err := s3compat.New(ctx, *store.S3, ex.transfer)
+		if err != nil {
+			log.Error(ctx, "Failed to connect to the S3-compatible storage", "err", err)
+			return nil
+		}
+		art, err := s3Store.Artifact(workDir, localPath, remotePath)
+		if err != nil {
+			log.Error(ctx, "Failed to create the S3-compatible artifact", "err", err)
+			return nil
+		}
+		return art
+	}
+	log.Error(ctx, "The artifact store has no server")
+	return nil
+}
+
+// getBuildDiff downloads the build diff from the S3-compatible store if there is one, from the backend otherwise
+func (ex *Executor) getBuildDiff(ctx context.Context, key, dst string) error {
+	if ex.config.Artifacts == nil || ex.config.Artifacts.S3 == nil {
+		return gerrors.Wrap(ex.backend.GetBuildDiff(ctx, key, dst))
+	}
+	store, err := s3compat.New(ctx, *ex.config.Artifacts.S3, ex.transfer)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(store.GetFile(ctx, key, dst))
+}
+
+// putBuildDiff uploads the build diff to the S3-compatible store if there is one, to the backend otherwise
+func (ex *Executor) putBuildDiff(ctx context.Context, src, key string) error {
+	if ex.config.Artifacts == nil || ex.config.Artifacts.S3 == nil {
+		return gerrors.Wrap(ex.backend.PutBuildDiff(ctx, src, key))
+	}
+	store, err := s3compat.New(ctx, *ex.config.Artifacts.S3, ex.transfer)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(store.PutFile(ctx, src, key))
+}
@@ -0,0 +1,224 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/joblog"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/version"
+)
+
+// Attestations generates the SBOM and the provenance of the builds uploaded by the runner, they are stored next to the build diff
+type Attestations struct {
+	// Syft is the path of the binary, syft in PATH by default
+	Syft string `yaml:"syft,omitempty"`
+	// SBOMFormat is the syft output format, spdx-json by default
+	SBOMFormat string `yaml:"sbom_format,omitempty"`
+	// NoSBOM keeps the provenance only, e.g. on the instances without syft
+	NoSBOM bool `yaml:"no_sbom,omitempty"`
+}
+
+const (
+	inTotoStatementType = "https://in-toto.io/Statement/v0.1"
+	slsaProvenanceType  = "https://slsa.dev/provenance/v0.2"
+	buildType           = "https://github.com/dstackai/dstack/runner/build@v1"
+)
+
+// Provenance is the in-toto statement with the SLSA provenance of a build
+type Provenance struct {
+	Type          string              `json:"_type"`
+	PredicateType string              `json:"predicateType"`
+	Subject       []ProvenanceSubject `json:"subject"`
+	Predicate     ProvenancePredicate `json:"predicate"`
+}
+
+type ProvenanceSubject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+type ProvenancePredicate struct {
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	BuildType  string `json:"buildType"`
+	Invocation struct {
+		ConfigSource ProvenanceMaterial `json:"configSource"`
+		Parameters   BuildParameters    `json:"parameters"`
+	} `json:"invocation"`
+	Metadata struct {
+		BuildStartedOn  string `json:"buildStartedOn"`
+		BuildFinishedOn string `json:"buildFinishedOn"`
+	} `json:"metadata"`
+	Materials []ProvenanceMaterial `json:"materials"`
+}
+
+type ProvenanceMaterial struct {
+	URI        string            `json:"uri"`
+	Digest     map[string]string `json:"digest,omitempty"`
+	EntryPoint string            `json:"entryPoint,omitempty"`
+}
+
+// BuildParameters are the inputs of the build besides the repo, the secrets are masked
+type BuildParameters struct {
+	BaseImage  string   `json:"base_image,omitempty"`
+	Dockerfile string   `json:"dockerfile,omitempty"`
+	Commands   []string `json:"commands,omitempty"`
+	Env        []string `json:"env,omitempty"`
+}
+
+// buildRecord is what the provenance of a build is made of
+type buildRecord struct {
+	imageName   string
+	imageID     string
+	key         string
+	diffDigest  string
+	baseImage   string
+	repoURL     string
+	repoCommit  string
+	diffSum     string
+	configPath  string
+	spec        *container.BuildSpec
+	started     time.Time
+	finished    time.Time
+	secretsMask *joblog.Secrets
+}
+
+func (a *Attestations) sbom(ctx context.Context, image string) ([]byte, error) {
+	bin := a.Syft
+	if bin == "" {
+		bin = "syft"
+	}
+	format := a.SBOMFormat
+	if format == "" {
+		format = "spdx-json"
+	}
+	cmd := exec.CommandContext(ctx, bin, "docker:"+image, "-o", format, "-q")
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, gerrors.Newf("syft: %s: %s", err, stderr.String())
+	}
+	return output, nil
+}
+
+// attestBuild uploads the SBOM and the provenance of the build diff stored at key, the build is kept if they fail
+func (ex *Executor) attestBuild(ctx context.Context, key, imageName, diffPath string, spec *container.BuildSpec, started time.Time) {
+	attestations := ex.config.Attestations
+	if attestations == nil {
+		return
+	}
+	if !attestations.NoSBOM {
+		sbom, err := attestations.sbom(ctx, imageName)
+		if err == nil {
+			err = ex.backend.PutFile(ctx, key+consts.SBOM_SUFFIX, sbom)
+		}
+		if err != nil {
+			log.Warning(ctx, "Failed to attach the build SBOM", "key", key, "err", err)
+		}
+	}
+	provenance, err := ex.buildProvenance(ctx, key, imageName, diffPath, spec, started)
+	if err == nil {
+		err = ex.backend.PutFile(ctx, key+consts.PROVENANCE_SUFFIX, provenance)
+	}
+	if err != nil {
+		log.Warning(ctx, "Failed to attach the build provenance", "key", key, "err", err)
+		return
+	}
+	log.Trace(ctx, "Attached the build attestations", "key", key)
+}
+
+func (ex *Executor) buildProvenance(ctx context.Context, key, imageName, diffPath string, spec *container.BuildSpec, started time.Time) ([]byte, error) {
+	job := ex.backend.Job(ctx)
+	record := &buildRecord{
+		imageName:   imageName,
+		key:         key,
+		diffSum:     ex.repoDiffSum,
+		configPath:  job.ConfigurationPath,
+		spec:        spec,
+		started:     started,
+		finished:    time.Now(),
+		secretsMask: ex.logSecrets,
+	}
+	var err error
+	if record.imageID, err = ex.engine.ImageID(ctx, imageName); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if record.diffDigest, err = fileDigest(diffPath); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if spec.Dockerfile == "" {
+		if record.baseImage, err = ex.engine.RepoDigest(ctx, spec.BaseImageName); err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+	}
+	if record.repoURL, record.repoCommit, err = ex.repoSource(ctx); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return json.MarshalIndent(newProvenance(record), "", "  ")
+}
+
+func newProvenance(record *buildRecord) *Provenance {
+	p := &Provenance{
+		Type:          inTotoStatementType,
+		PredicateType: slsaProvenanceType,
+		Subject: []ProvenanceSubject{
+			{Name: record.imageName, Digest: digestMap(record.imageID)},
+			{Name: record.key, Digest: map[string]string{"sha256": record.diffDigest}},
+		},
+	}
+	p.Predicate.Builder.ID = fmt.Sprintf("dstack-runner@%s", version.Version)
+	p.Predicate.BuildType = buildType
+	p.Predicate.Invocation.ConfigSource = ProvenanceMaterial{URI: record.repoURL, EntryPoint: record.configPath}
+	if record.repoCommit != "" {
+		p.Predicate.Invocation.ConfigSource.Digest = map[string]string{"sha1": record.repoCommit}
+		p.Predicate.Materials = append(p.Predicate.Materials, ProvenanceMaterial{
+			URI:    "git+" + record.repoURL,
+			Digest: map[string]string{"sha1": record.repoCommit},
+		})
+	}
+	if record.diffSum != "" {
+		p.Predicate.Materials = append(p.Predicate.Materials, ProvenanceMaterial{
+			URI:    "repo-diff",
+			Digest: map[string]string{"sha256": record.diffSum},
+		})
+	}
+	if record.baseImage != "" {
+		name, digest := record.baseImage, ""
+		if i := strings.Index(name, "@"); i >= 0 {
+			name, digest = name[:i], name[i+1:]
+		}
+		p.Predicate.Materials = append(p.Predicate.Materials, ProvenanceMaterial{URI: "docker://" + name, Digest: digestMap(digest)})
+	}
+	params := BuildParameters{BaseImage: record.spec.BaseImageName, Dockerfile: record.spec.Dockerfile}
+	for _, command := range record.spec.Commands {
+		params.Commands = append(params.Commands, record.secretsMask.Redact(command))
+	}
+	for _, env := range record.spec.Env {
+		params.Env = append(params.Env, record.secretsMask.Redact(env))
+	}
+	p.Predicate.Invocation.Parameters = params
+	p.Predicate.Metadata.BuildStartedOn = record.started.UTC().Format(time.RFC3339)
+	p.Predicate.Metadata.BuildFinishedOn = record.finished.UTC().Format(time.RFC3339)
+	return p
+}
+
+// digestMap splits the algorithm of the digest, e.g. sha256:abc
+func digestMap(digest string) map[string]string {
+	if i := strings.Index(digest, ":"); i >= 0 {
+		return map[string]string{digest[:i]: digest[i+1:]}
+	}
+	if digest == "" {
+		return nil
+	}
+	return map[string]string{"sha256": digest}
+}
@@ -0,0 +1,41 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/joblog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewProvenance(t *testing.T) {
+	p := newProvenance(&buildRecord{
+		imageName:  "dstackai/build:abc",
+		imageID:    "sha256:1111",
+		key:        "builds/repo/abc.tar.zst",
+		diffDigest: "2222",
+		baseImage:  "ubuntu@sha256:3333",
+		repoURL:    "https://github.com/dstackai/dstack.git",
+		repoCommit: "4444",
+		spec: &container.BuildSpec{
+			BaseImageName: "ubuntu:22.04",
+			Commands:      []string{"pip install -r requirements.txt", "echo $TOKEN"},
+			Env:           []string{"TOKEN=s3cr3t"},
+		},
+		started:     time.Unix(0, 0),
+		finished:    time.Unix(60, 0),
+		secretsMask: joblog.NewSecrets("s3cr3t"),
+	})
+	assert.Equal(t, inTotoStatementType, p.Type)
+	assert.Equal(t, []ProvenanceSubject{
+		{Name: "dstackai/build:abc", Digest: map[string]string{"sha256": "1111"}},
+		{Name: "builds/repo/abc.tar.zst", Digest: map[string]string{"sha256": "2222"}},
+	}, p.Subject)
+	assert.Equal(t, []ProvenanceMaterial{
+		{URI: "git+https://github.com/dstackai/dstack.git", Digest: map[string]string{"sha1": "4444"}},
+		{URI: "docker://ubuntu", Digest: map[string]string{"sha256": "3333"}},
+	}, p.Predicate.Materials)
+	assert.Equal(t, []string{"TOKEN=***"}, p.Predicate.Invocation.Parameters.Env)
+	assert.Equal(t, "1970-01-01T00:01:00Z", p.Predicate.Metadata.BuildFinishedOn)
+}
@@ -0,0 +1,325 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/compress"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"gopkg.in/yaml.v2"
+)
+
+// cacheArtifact binds the cache directory to the container. The transfers may use other remote paths.
+type cacheArtifact struct {
+	artifacts.Artifacter
+	cache models.Cache
+	// name is the cache directory relative to the cache root, see cacheName
+	name string
+	// restore downloads the cache, possibly saved under a restore key, nil if there is nothing to restore
+	restore artifacts.Artifacter
+	// save uploads the cache under the name
+	save   artifacts.Artifacter
+	format string
+	// hit is set if the cache with the exact key exists, so it is not uploaded again
+	hit bool
+}
+
+func (c cacheArtifact) BeforeRun(ctx context.Context) error {
+	if c.restore == nil {
+		return nil
+	}
+	return c.restore.BeforeRun(ctx)
+}
+
+func (c cacheArtifact) AfterRun(ctx context.Context) error {
+	return c.save.AfterRun(ctx)
+}
+
+// storedSize is the size of the cache in the storage, compressed caches are packed to measure it
+func (c cacheArtifact) storedSize(ctx context.Context) (int64, error) {
+	if z, ok := c.save.(*zstdArtifact); ok {
+		return z.pack(ctx)
+	}
+	return cacheSize(c)
+}
+
+// zstdArtifact transfers the cache directory as a single compressed tar
+type zstdArtifact struct {
+	artifacts.Artifacter
+	archive string
+	dir     string
+	// packed is set once the archive is written, so it is not compressed again on upload
+	packed bool
+}
+
+func (z *zstdArtifact) BeforeRun(ctx context.Context) error {
+	if err := z.Artifacter.BeforeRun(ctx); err != nil {
+		return gerrors.Wrap(err)
+	}
+	if _, err := os.Stat(z.archive); err != nil {
+		return nil
+	}
+	log.Trace(ctx, "Extracting cache", "archive", z.archive)
+	if err := compress.UntarDir(z.archive, z.dir); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(os.Remove(z.archive))
+}
+
+func (z *zstdArtifact) AfterRun(ctx context.Context) error {
+	if !z.packed {
+		if _, err := z.pack(ctx); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	return z.Artifacter.AfterRun(ctx)
+}
+
+// pack compresses the cache directory and returns the archive size
+func (z *zstdArtifact) pack(ctx context.Context) (int64, error) {
+	log.Trace(ctx, "Compressing cache", "dir", z.dir)
+	if err := compress.TarDir(z.dir, z.archive); err != nil {
+		return 0, gerrors.Wrap(err)
+	}
+	info, err := os.Stat(z.archive)
+	if err != nil {
+		return 0, gerrors.Wrap(err)
+	}
+	z.packed = true
+	return info.Size(), nil
+}
+
+const zstdSuffix = ".zst"
+
+type cacheManifest struct {
+	Entries map[string]cacheEntry `yaml:"entries"`
+}
+
+type cacheEntry struct {
+	// Size is the stored size, compressed for compressed caches
+	Size     int64  `yaml:"size"`
+	LastUsed uint64 `yaml:"last_used"`
+	// Format is compress.Zstd for compressed caches stored under the name with the .zst suffix
+	Format string `yaml:"format,omitempty"`
+}
+
+func cacheRoot(job *models.Job) string {
+	return path.Join("cache", job.RepoId, job.HubUserName, job.WorkflowName)
+}
+
+// cacheRemotePath is where the cache saved under the name is stored in the format
+func cacheRemotePath(job *models.Job, name, format string) string {
+	remotePath := path.Join(cacheRoot(job), name)
+	if format == compress.Zstd {
+		remotePath += zstdSuffix
+	}
+	return remotePath
+}
+
+// cacheName is the cache path, suffixed with the key for keyed caches
+func cacheName(cachePath, key string) string {
+	if key == "" {
+		return cachePath
+	}
+	return fmt.Sprintf("%s@%s", cachePath, key)
+}
+
+// cacheTransfer returns the artifact transferring the cache saved under the name
+func (ex *Executor) cacheTransfer(ctx context.Context, cache models.Cache, name, format string) (artifacts.Artifacter, error) {
+	job := ex.backend.Job(ctx)
+	if format != compress.Zstd {
+		return ex.backend.GetCache(ctx, job.RunName, cache.Path, cacheRemotePath(job, name, format)), nil
+	}
+	dir, err := cacheDir(ex.backend.GetCache(ctx, job.RunName, cache.Path, path.Join(cacheRoot(job), name)))
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	staging := ex.backend.GetCache(ctx, job.RunName, cache.Path+zstdSuffix, cacheRemotePath(job, name, format))
+	stagingDir, err := cacheDir(staging)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return &zstdArtifact{Artifacter: staging, archive: filepath.Join(stagingDir, "cache.tar.zst"), dir: dir}, nil
+}
+
+func (ex *Executor) loadCacheManifest(ctx context.Context) cacheManifest {
+	job := ex.backend.Job(ctx)
+	manifest := cacheManifest{}
+	if contents, err := ex.backend.GetFile(ctx, path.Join(cacheRoot(job), consts.CACHE_MANIFEST_FILE)); err == nil {
+		if err = yaml.Unmarshal(contents, &manifest); err != nil {
+			log.Error(ctx, "Cache manifest is corrupted", "err", err)
+		}
+	}
+	if manifest.Entries == nil {
+		manifest.Entries = make(map[string]cacheEntry)
+	}
+	return manifest
+}
+
+// restoreCacheName returns the exact key match or the most recently used cache matching a restore key
+func restoreCacheName(entries map[string]cacheEntry, cache models.Cache, key string) (string, bool) {
+	name := cacheName(cache.Path, key)
+	if _, ok := entries[name]; ok {
+		return name, true
+	}
+	for _, restoreKey := range cache.RestoreKeys {
+		prefix := cacheName(cache.Path, restoreKey)
+		found := ""
+		for entryName, entry := range entries {
+			if strings.HasPrefix(entryName, prefix) && (found == "" || entry.LastUsed > entries[found].LastUsed) {
+				found = entryName
+			}
+		}
+		if found != "" {
+			return found, false
+		}
+	}
+	return "", false
+}
+
+// uploadCache uploads the caches within their limits and evicts the least recently used ones
+func (ex *Executor) uploadCache(ctx context.Context) error {
+	job := ex.backend.Job(ctx)
+	previous := ex.loadCacheManifest(ctx)
+	updated := make(map[string]cacheEntry)
+	now := uint64(time.Now().UnixMilli())
+	for _, artifact := range ex.cacheArtifacts {
+		if artifact.hit {
+			log.Trace(ctx, "Cache key hit, skip uploading", "name", artifact.name)
+			entry := previous.Entries[artifact.name]
+			entry.LastUsed = now
+			updated[artifact.name] = entry
+			continue
+		}
+		size, err := artifact.storedSize(ctx)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		if artifact.cache.MaxSizeMiB > 0 && size > artifact.cache.MaxSizeMiB*1024*1024 {
+			log.Info(ctx, "Cache exceeds its size limit, skip uploading", "path", artifact.cache.Path, "size", size, "max_size_mib", artifact.cache.MaxSizeMiB)
+			continue
+		}
+		if err = artifact.AfterRun(ctx); err != nil {
+			return gerrors.Wrap(err)
+		}
+		ex.timings.transferred(0, size)
+		// caches saved before compression, with or without a manifest entry, are replaced by the compressed ones
+		if previousFormat := previous.Entries[artifact.name].Format; previousFormat != artifact.format {
+			log.Trace(ctx, "Deleting the cache saved in the previous format", "name", artifact.name, "format", previousFormat)
+			if err = ex.backend.DeletePrefix(ctx, cacheRemotePath(job, artifact.name, previousFormat)+"/"); err != nil {
+				return gerrors.Wrap(err)
+			}
+		}
+		updated[artifact.name] = cacheEntry{Size: size, LastUsed: now, Format: artifact.format}
+	}
+	// the manifest is reread right before writing, so the entries saved by concurrent jobs of the workflow are kept
+	manifest := ex.loadCacheManifest(ctx)
+	used := make(map[string]bool)
+	for name, entry := range updated {
+		manifest.Entries[name] = entry
+		used[name] = true
+	}
+	evicted := make(map[string]cacheEntry)
+	for _, name := range evictCaches(manifest.Entries, used, job.CacheSizeLimitMiB*1024*1024) {
+		evicted[name] = manifest.Entries[name]
+		delete(manifest.Entries, name)
+	}
+	contents, err := yaml.Marshal(manifest)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if err = ex.backend.PutFile(ctx, path.Join(cacheRoot(job), consts.CACHE_MANIFEST_FILE), contents); err != nil {
+		return gerrors.Wrap(err)
+	}
+	for name, entry := range evicted {
+		log.Info(ctx, "Evicting cache", "path", name, "size", entry.Size)
+		if err = ex.backend.DeletePrefix(ctx, cacheRemotePath(job, name, entry.Format)+"/"); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// evictCaches returns the least recently used caches to delete so the total size fits the limit.
+// Caches used by the current job are never evicted.
+func evictCaches(entries map[string]cacheEntry, used map[string]bool, limit int64) []string {
+	if limit <= 0 {
+		return nil
+	}
+	var total int64
+	candidates := make([]string, 0)
+	for cachePath, entry := range entries {
+		total += entry.Size
+		if !used[cachePath] {
+			candidates = append(candidates, cachePath)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return entries[candidates[i]].LastUsed < entries[candidates[j]].LastUsed
+	})
+	evicted := make([]string, 0)
+	for _, cachePath := range candidates {
+		if total <= limit {
+			break
+		}
+		total -= entries[cachePath].Size
+		evicted = append(evicted, cachePath)
+	}
+	return evicted
+}
+
+// cacheDir returns the local cache directory bound to the container
+func cacheDir(artifact artifacts.Artifacter) (string, error) {
+	if artifact == nil {
+		return "", gerrors.New("no cache artifact")
+	}
+	bindings, err := artifact.DockerBindings("/")
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	if len(bindings) == 0 {
+		return "", gerrors.New("cache artifact has no bindings")
+	}
+	return bindings[0].Source, nil
+}
+
+// cacheSize sums the files of the cache directory
+func cacheSize(artifact cacheArtifact) (int64, error) {
+	dir, err := cacheDir(artifact.Artifacter)
+	if err != nil {
+		return 0, gerrors.Wrap(err)
+	}
+	return dirSize(dir)
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, gerrors.Wrap(err)
+	}
+	return size, nil
+}
@@ -0,0 +1,53 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEvictCaches(t *testing.T) {
+	entries := map[string]cacheEntry{
+		"pip":   {Size: 30, LastUsed: 3},
+		"conda": {Size: 50, LastUsed: 1},
+		"data":  {Size: 40, LastUsed: 2},
+		"hf":    {Size: 10, LastUsed: 4},
+	}
+	assert.Equal(t, []string{"conda", "data"}, evictCaches(entries, map[string]bool{}, 50))
+	assert.Equal(t, []string{"data", "pip"}, evictCaches(entries, map[string]bool{"conda": true}, 60))
+	assert.Equal(t, []string{}, evictCaches(entries, map[string]bool{}, 200))
+	assert.Equal(t, []string(nil), evictCaches(entries, map[string]bool{}, 0))
+}
+
+func TestRestoreCacheName(t *testing.T) {
+	entries := map[string]cacheEntry{
+		"venv@py-aaa": {Size: 1, LastUsed: 1},
+		"venv@py-bbb": {Size: 1, LastUsed: 2},
+	}
+	cache := models.Cache{Path: "venv", RestoreKeys: []string{"py-"}}
+	name, hit := restoreCacheName(entries, cache, "py-aaa")
+	assert.Equal(t, "venv@py-aaa", name)
+	assert.Equal(t, true, hit)
+	name, hit = restoreCacheName(entries, cache, "py-ccc")
+	assert.Equal(t, "venv@py-bbb", name)
+	assert.Equal(t, false, hit)
+	name, _ = restoreCacheName(entries, models.Cache{Path: "venv"}, "py-ccc")
+	assert.Equal(t, "", name)
+}
+
+func TestEvalCacheKey(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, nil, os.MkdirAll(filepath.Join(dir, "app"), 0o755))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(dir, "app", "requirements.txt"), []byte("torch\n"), 0o644))
+	key, err := evalCacheKey("pip-${{ hashFiles('**/requirements.txt') }}", dir)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4+64, len(key))
+	key, err = evalCacheKey("pip-${{ hashFiles('poetry.lock') }}", dir)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "pip-", key)
+	_, err = evalCacheKey("pip-${{ env.PYTHON }}", dir)
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,128 @@
+package executor
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/common"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+const hashFilesFunc = "hashFiles("
+
+// evalCacheKey replaces ${{ hashFiles('pattern', ...) }} expressions with the digest of the matching repo files
+func evalCacheKey(key, repoDir string) (string, error) {
+	var sb strings.Builder
+	start := 0
+	for {
+		opening := common.IndexWithOffset(key, PatternOpening, start)
+		if opening == -1 {
+			sb.WriteString(key[start:])
+			break
+		}
+		closing := common.IndexWithOffset(key, PatternClosing, opening)
+		if closing == -1 {
+			return "", gerrors.Newf("no pattern closing: %s", key[opening:])
+		}
+		sb.WriteString(key[start:opening])
+		expr := strings.TrimSpace(key[opening+len(PatternOpening) : closing])
+		if !strings.HasPrefix(expr, hashFilesFunc) || !strings.HasSuffix(expr, ")") {
+			return "", gerrors.Newf("unsupported cache key expression: %s", expr)
+		}
+		patterns := make([]string, 0)
+		for _, arg := range strings.Split(expr[len(hashFilesFunc):len(expr)-1], ",") {
+			arg = strings.Trim(strings.TrimSpace(arg), `'"`)
+			if arg != "" {
+				patterns = append(patterns, arg)
+			}
+		}
+		digest, err := hashFiles(repoDir, patterns)
+		if err != nil {
+			return "", gerrors.Wrap(err)
+		}
+		sb.WriteString(digest)
+		start = closing + len(PatternClosing)
+	}
+	return sb.String(), nil
+}
+
+// hashFiles returns the SHA-256 of the files matching any pattern, or an empty string if none match
+func hashFiles(root string, patterns []string) (string, error) {
+	files := make([]string, 0)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		for _, pattern := range patterns {
+			if matchGlob(pattern, filepath.ToSlash(rel)) {
+				files = append(files, rel)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	if len(files) == 0 {
+		return "", nil
+	}
+	sort.Strings(files)
+	h := sha256.New()
+	for _, file := range files {
+		fh := sha256.New()
+		f, err := os.Open(filepath.Join(root, file))
+		if err != nil {
+			return "", gerrors.Wrap(err)
+		}
+		_, err = io.Copy(fh, f)
+		_ = f.Close()
+		if err != nil {
+			return "", gerrors.Wrap(err)
+		}
+		_, _ = h.Write(fh.Sum(nil))
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// matchGlob matches a slash-separated path, ** matches any number of directories
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := filepath.Match(pattern[0], name[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], name[1:])
+}
@@ -0,0 +1,52 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/backend"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/version"
+	"gopkg.in/yaml.v2"
+)
+
+// capabilities describe the instance, the resources are the ones the runner was checked with
+func (ex *Executor) capabilities(ctx context.Context) models.Capabilities {
+	caps := models.Capabilities{
+		RunnerID:  ex.config.Id,
+		Platform:  container.HostPlatform(),
+		Version:   version.Version,
+		UpdatedAt: uint64(time.Now().UnixMilli()),
+	}
+	if ex.config.Resources != nil {
+		caps.Resources = *ex.config.Resources
+	}
+	if ex.engine != nil {
+		caps.DockerVersion = ex.engine.Version()
+		caps.DockerRuntime = ex.engine.DockerRuntime()
+	}
+	if locator, ok := ex.backend.(backend.Locator); ok {
+		caps.Region = locator.Region()
+	}
+	if available, err := freeDiskSpace(existingParent(ex.backend.GetTMPDir(ctx))); err == nil {
+		caps.DiskFreeMiB = available / 1024 / 1024
+	} else {
+		log.Warning(ctx, "Failed to check the disk space", "err", err)
+	}
+	return caps
+}
+
+// advertise publishes the capabilities for the scheduler to match the jobs with the instance
+func (ex *Executor) advertise(ctx context.Context) error {
+	contents, err := yaml.Marshal(ex.capabilities(ctx))
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	key := fmt.Sprintf("%s/%s.yaml", consts.CAPABILITIES_DIR, ex.config.Id)
+	return gerrors.Wrap(ex.backend.PutFile(ctx, key, contents))
+}
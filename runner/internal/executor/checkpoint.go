@@ -0,0 +1,109 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	localbackend "github.com/dstackai/dstack/runner/internal/backend/local"
+	"github.com/dstackai/dstack/runner/internal/compress"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+const checkpointArchive = "checkpoint.tar.zst"
+
+// shouldCheckpoint reports whether the stopped job container is checkpointed instead of killed
+func (ex *Executor) shouldCheckpoint(job *models.Job) bool {
+	return job.Checkpoint != nil && (job.Checkpoint.OnStop || ex.interrupted.Load())
+}
+
+// watchInterruption stops the job once its instance is interrupted, so the container is checkpointed before
+// the instance is gone
+func (ex *Executor) watchInterruption(ctx context.Context, stopCh chan struct{}) {
+	ticker := time.NewTicker(consts.DELAY_CHECK_INTERRUPTION)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		interrupted, err := ex.backend.IsInterrupted(ctx)
+		if err != nil {
+			log.Warning(ctx, "Failed to check if spot was interrupted", "err", err)
+			continue
+		}
+		if interrupted {
+			log.Info(ctx, "Spot was interrupted, checkpointing the job")
+			ex.interrupted.Store(true)
+			ex.Stop()
+			return
+		}
+	}
+}
+
+// checkpoint dumps the container and uploads the checkpoint. Checkpointed is false if the container is still running.
+func (ex *Executor) checkpoint(ctx context.Context, docker *container.DockerRuntime) (bool, error) {
+	if _, isLocalBackend := ex.backend.(*localbackend.Local); isLocalBackend {
+		return false, gerrors.New("the checkpoints are supported by the cloud backends only")
+	}
+	job := ex.backend.Job(ctx)
+	tempDir, err := os.MkdirTemp("", "checkpoint")
+	if err != nil {
+		return false, gerrors.Wrap(err)
+	}
+	defer func() { _ = os.RemoveAll(tempDir) }()
+	log.Info(ctx, "Checkpointing the container")
+	if err = docker.Checkpoint(ctx, tempDir); err != nil {
+		return false, gerrors.Wrap(err)
+	}
+	// Wait may have removed the exited container already
+	_ = docker.Remove(ctx)
+	archive := filepath.Join(tempDir, checkpointArchive)
+	if err = compress.TarDir(filepath.Join(tempDir, container.CHECKPOINT_ID), archive); err != nil {
+		return true, gerrors.Wrap(err)
+	}
+	key := job.CheckpointFilepath(job.JobID)
+	log.Trace(ctx, "Putting the checkpoint", "key", key)
+	if err = ex.putBuildDiff(ctx, archive, key); err != nil {
+		return true, gerrors.Wrap(err)
+	}
+	return true, gerrors.Wrap(ex.updateJob(ctx, func(job *models.Job) {
+		job.Checkpoint.Key = key
+	}))
+}
+
+// restoreCheckpoint downloads the checkpoint the job is restored from and starts the container from it
+func (ex *Executor) restoreCheckpoint(ctx context.Context, spec *container.Spec) (func(), error) {
+	if _, isLocalBackend := ex.backend.(*localbackend.Local); isLocalBackend {
+		return nil, gerrors.New("the checkpoints are supported by the cloud backends only")
+	}
+	job := ex.backend.Job(ctx)
+	key := job.CheckpointFilepath(job.Checkpoint.RestoreFrom)
+	tempDir, err := os.MkdirTemp("", "restore")
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	cleanup := func() { _ = os.RemoveAll(tempDir) }
+	archive := filepath.Join(tempDir, checkpointArchive)
+	if err = ex.getBuildDiff(ctx, key, archive); err != nil {
+		cleanup()
+		return nil, gerrors.Wrap(err)
+	}
+	if _, err = os.Stat(archive); err != nil {
+		cleanup()
+		return nil, gerrors.Newf("no checkpoint is found: %s", key)
+	}
+	if err = compress.UntarDir(archive, filepath.Join(tempDir, container.CHECKPOINT_ID)); err != nil {
+		cleanup()
+		return nil, gerrors.Wrap(err)
+	}
+	_ = os.Remove(archive)
+	spec.RestoreCheckpointDir = tempDir
+	return cleanup, nil
+}
@@ -0,0 +1,23 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldCheckpoint(t *testing.T) {
+	ex := &Executor{}
+	assert.Equal(t, false, ex.shouldCheckpoint(&models.Job{}))
+	assert.Equal(t, false, ex.shouldCheckpoint(&models.Job{Checkpoint: &models.Checkpoint{}}))
+	assert.Equal(t, true, ex.shouldCheckpoint(&models.Job{Checkpoint: &models.Checkpoint{OnStop: true}}))
+	ex.interrupted.Store(true)
+	assert.Equal(t, true, ex.shouldCheckpoint(&models.Job{Checkpoint: &models.Checkpoint{}}))
+	assert.Equal(t, false, ex.shouldCheckpoint(&models.Job{}))
+}
+
+func TestCheckpointFilepath(t *testing.T) {
+	job := &models.Job{RunName: "run", JobID: "job-1"}
+	assert.Equal(t, "checkpoints/run/job-0.tar.zst", job.CheckpointFilepath("job-0"))
+}
@@ -0,0 +1,173 @@
+package executor
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/backend"
+	localbackend "github.com/dstackai/dstack/runner/internal/backend/local"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+type ChecksumMismatchError struct {
+	Path string
+}
+
+func (e ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch: %s", e.Path)
+}
+
+// checksumArtifact records the digests of the uploaded files and verifies them after download
+type checksumArtifact struct {
+	artifacts.Artifacter
+	backend    backend.Backend
+	remotePath string
+}
+
+func (ex *Executor) withChecksums(art artifacts.Artifacter, remotePath string, mount bool) artifacts.Artifacter {
+	if _, isLocalBackend := ex.backend.(*localbackend.Local); art == nil || mount || isLocalBackend {
+		return art
+	}
+	return &checksumArtifact{Artifacter: art, backend: ex.backend, remotePath: remotePath}
+}
+
+func (c *checksumArtifact) BeforeRun(ctx context.Context) error {
+	if err := c.Artifacter.BeforeRun(ctx); err != nil {
+		return gerrors.Wrap(err)
+	}
+	contents, err := c.backend.GetFile(ctx, c.remotePath+consts.CHECKSUMS_SUFFIX)
+	if err != nil {
+		log.Trace(ctx, "No checksums, skip verifying", "artifact", c.remotePath)
+		return nil
+	}
+	dir, err := cacheDir(c.Artifacter)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	for name, digest := range parseChecksums(contents) {
+		actual, err := fileDigest(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil || actual != digest {
+			log.Error(ctx, "Checksum mismatch", "artifact", c.remotePath, "file", name, "err", err)
+			return gerrors.Wrap(ChecksumMismatchError{Path: filepath.Join(c.remotePath, name)})
+		}
+	}
+	return nil
+}
+
+func (c *checksumArtifact) AfterRun(ctx context.Context) error {
+	dir, err := cacheDir(c.Artifacter)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	digests, err := dirDigests(dir)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if err = c.Artifacter.AfterRun(ctx); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(c.backend.PutFile(ctx, c.remotePath+consts.CHECKSUMS_SUFFIX, formatChecksums(digests)))
+}
+
+// verifyBuildDiff compares the downloaded diff with the digest recorded on upload, if any
+func (ex *Executor) verifyBuildDiff(ctx context.Context, key, diffPath string) error {
+	contents, err := ex.backend.GetFile(ctx, key+consts.CHECKSUMS_SUFFIX)
+	if err != nil {
+		log.Trace(ctx, "No build diff checksum, skip verifying", "key", key)
+		return nil
+	}
+	actual, err := fileDigest(diffPath)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if parseChecksums(contents)[filepath.Base(key)] != actual {
+		return gerrors.Wrap(ChecksumMismatchError{Path: key})
+	}
+	return nil
+}
+
+func (ex *Executor) putBuildDiffChecksum(ctx context.Context, key, diffPath string) error {
+	digest, err := fileDigest(diffPath)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(ex.backend.PutFile(ctx, key+consts.CHECKSUMS_SUFFIX, formatChecksums(map[string]string{filepath.Base(key): digest})))
+}
+
+func fileDigest(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	h := sha256.New()
+	if _, err = io.Copy(h, file); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// dirDigests returns the digests of the regular files by their slash-separated relative paths
+func dirDigests(dir string) (map[string]string, error) {
+	digests := make(map[string]string)
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		digest, err := fileDigest(p)
+		if err != nil {
+			return err
+		}
+		digests[filepath.ToSlash(rel)] = digest
+		return nil
+	})
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return digests, nil
+}
+
+func formatChecksums(digests map[string]string) []byte {
+	names := make([]string, 0, len(digests))
+	for name := range digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var buf bytes.Buffer
+	for _, name := range names {
+		buf.WriteString(fmt.Sprintf("%s  %s\n", digests[name], name))
+	}
+	return buf.Bytes()
+}
+
+func parseChecksums(contents []byte) map[string]string {
+	digests := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for scanner.Scan() {
+		digest, name, ok := strings.Cut(scanner.Text(), "  ")
+		if ok {
+			digests[name] = digest
+		}
+	}
+	return digests
+}
@@ -0,0 +1,21 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecksums(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, nil, os.MkdirAll(filepath.Join(dir, "model"), 0o755))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(dir, "model", "weights.bin"), []byte("weights"), 0o644))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(dir, "metrics.json"), []byte("{}"), 0o644))
+	digests, err := dirDigests(dir)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "9a129038d9a00aed0cf6a7ea059ca50a813449061ab87848cf1a13eafdf33b2c", digests["model/weights.bin"])
+	assert.Equal(t, 2, len(digests))
+	assert.Equal(t, digests, parseChecksums(formatChecksums(digests)))
+}
@@ -2,44 +2,320 @@ package executor
 
 import (
 	"context"
+	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/appproxy"
+	"github.com/dstackai/dstack/runner/internal/artifacts/client"
+	"github.com/dstackai/dstack/runner/internal/artifacts/s3compat"
+	"github.com/dstackai/dstack/runner/internal/artifacts/sftp"
+	"github.com/dstackai/dstack/runner/internal/artifacts/webdav"
+	"github.com/dstackai/dstack/runner/internal/bandwidth"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gateway"
 	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/joblog"
 	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/logsink"
 	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/internal/retry"
+	"github.com/dstackai/dstack/runner/internal/secrets/vault"
+	"github.com/dstackai/dstack/runner/internal/sshserver"
+	"github.com/dstackai/dstack/runner/internal/tunnel"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
 type Config struct {
 	Id         string           `yaml:"id"`
 	Resources  *models.Resource `yaml:"resources"`
 	Hostname   *string          `yaml:"hostname"`
 	ExposePort *string          `yaml:"expose_ports,omitempty"`
+	LogFormat  string           `yaml:"log_format,omitempty"`
+	Vault      *vault.Config    `yaml:"vault,omitempty"`
+	Hooks      *Hooks           `yaml:"hooks,omitempty"`
+	Webhook    *Webhook         `yaml:"webhook,omitempty"`
+	Tunnel     *tunnel.Config   `yaml:"tunnel,omitempty"`
+	// SSH lands the sessions authorized by the job keys in the job container
+	SSH *sshserver.Config `yaml:"ssh,omitempty"`
+	// ControlPort enables the gRPC control API. It listens on ControlHost, localhost by default,
+	// other interfaces require ControlToken.
+	ControlPort  int    `yaml:"control_port,omitempty"`
+	ControlHost  string `yaml:"control_host,omitempty"`
+	ControlToken string `yaml:"control_token,omitempty"`
+	// HealthPort serves /healthz and /ready on HealthHost, every interface by default
+	HealthPort int    `yaml:"health_port,omitempty"`
+	HealthHost string `yaml:"health_host,omitempty"`
+	// HeartbeatInterval is in seconds
+	HeartbeatInterval int `yaml:"heartbeat_interval,omitempty"`
+	// DNS servers, DNSSearch domains and ExtraHosts (host:ip) of the job containers, e.g. for the private endpoints of a VPC
+	DNS        []string         `yaml:"dns,omitempty"`
+	DNSSearch  []string         `yaml:"dns_search,omitempty"`
+	ExtraHosts []string         `yaml:"extra_hosts,omitempty"`
+	Proxy      *Proxy           `yaml:"proxy,omitempty"`
+	Registries *Registries      `yaml:"registries,omitempty"`
+	Signatures *SignaturePolicy `yaml:"signatures,omitempty"`
+	// AllowedCapabilities limits the capabilities the jobs may add, any if empty
+	AllowedCapabilities []string `yaml:"allowed_capabilities,omitempty"`
+	// MinFreeDiskMiB is the disk space required on the workdir and the Docker root before a job starts
+	MinFreeDiskMiB int `yaml:"min_free_disk_mib,omitempty"`
+	// Slots switch the runner to the pool mode: every slot runs its own jobs concurrently with the others
+	Slots []Slot `yaml:"slots,omitempty"`
+	// Daemon keeps the runner alive after the job, it runs the jobs of the queue one by one
+	Daemon *Daemon `yaml:"daemon,omitempty"`
+	// Notifications of the job ends, a job may have its own
+	Notifications *models.Notifications `yaml:"notifications,omitempty"`
+	// Price of the instance for the cost estimates, the backend may set the job price instead
+	Price *Price `yaml:"price,omitempty"`
+	// LogRotation of the runner and job log files under the logs dir of the config dir
+	LogRotation *joblog.Rotation `yaml:"log_rotation,omitempty"`
+	// LogSinks forward the job logs to Loki or Fluentd, besides or instead of the backend
+	LogSinks *logsink.Config `yaml:"log_sinks,omitempty"`
+	// LogANSI strips the escape sequences from the persisted logs, normalize also collapses the progress bars.
+	// The streamed logs keep them. With the JSON format the sequences are escaped and kept.
+	LogANSI string `yaml:"log_ansi,omitempty"`
+	// LogLevel overrides the level of the command line, e.g. debug. It is reloaded on SIGHUP.
+	LogLevel string `yaml:"log_level,omitempty"`
+	// AppProxy serves the job apps over HTTPS with token auth, the app ports are then bound on localhost only
+	AppProxy *appproxy.Config `yaml:"app_proxy,omitempty"`
+	// Gateway serves the model service jobs with the OpenAI API
+	Gateway *gateway.Config `yaml:"gateway,omitempty"`
+	// Artifacts keeps the job artifacts on a store of the runner instead of the backend storage
+	Artifacts *ArtifactStore `yaml:"artifacts,omitempty"`
+	// Transfer tunes the artifact and build diff transfers to the S3 storages
+	Transfer *Transfer `yaml:"transfer,omitempty"`
+	// Retry tunes the backoff of the backend calls
+	Retry *Retry `yaml:"retry,omitempty"`
+	// MaxOffline is how long in seconds the job state updates are queued while the backend is unreachable, -1 disables the queue
+	MaxOffline int `yaml:"max_offline,omitempty"`
+	// Backend selects the registered backend over the one of the backend config, BackendPlugins are the Go plugins registering more
+	Backend        string   `yaml:"backend,omitempty"`
+	BackendPlugins []string `yaml:"backend_plugins,omitempty"`
+	// Attestations generates the SBOM and the provenance of the uploaded builds
+	Attestations *Attestations `yaml:"attestations,omitempty"`
+	// Platform is requested for the jobs requesting none, e.g. linux/amd64 on Apple Silicon to run the images of the cloud.
+	// NoEmulation fails the jobs whose images would run emulated instead of warning.
+	Platform    string `yaml:"platform,omitempty"`
+	NoEmulation bool   `yaml:"no_emulation,omitempty"`
+	// SelfUpdate tunes the download of the runner version pinned by the job
+	SelfUpdate *SelfUpdate `yaml:"self_update,omitempty"`
+}
+
+func (c *Config) maxOffline() time.Duration {
+	if c.MaxOffline < 0 {
+		return 0
+	}
+	if c.MaxOffline > 0 {
+		return time.Duration(c.MaxOffline) * time.Second
+	}
+	return consts.DEFAULT_MAX_OFFLINE
+}
+
+// Retry is the backoff of the backend calls in seconds, Jitter is the random share of the delay from 0 to 1
+type Retry struct {
+	InitialDelay float64  `yaml:"initial_delay,omitempty"`
+	MaxDelay     float64  `yaml:"max_delay,omitempty"`
+	MaxElapsed   float64  `yaml:"max_elapsed,omitempty"`
+	Jitter       *float64 `yaml:"jitter,omitempty"`
+}
+
+func (r *Retry) policy() retry.Policy {
+	policy := retry.Policy{
+		InitialDelay: consts.RETRY_INITIAL_DELAY,
+		MaxDelay:     consts.RETRY_MAX_DELAY,
+		MaxElapsed:   consts.RETRY_MAX_ELAPSED,
+		Jitter:       consts.RETRY_JITTER,
+	}
+	if r == nil {
+		return policy
+	}
+	if r.InitialDelay > 0 {
+		policy.InitialDelay = time.Duration(r.InitialDelay * float64(time.Second))
+	}
+	if r.MaxDelay > 0 {
+		policy.MaxDelay = time.Duration(r.MaxDelay * float64(time.Second))
+	}
+	if r.MaxElapsed > 0 {
+		policy.MaxElapsed = time.Duration(r.MaxElapsed * float64(time.Second))
+	}
+	if r.Jitter != nil {
+		policy.Jitter = *r.Jitter
+	}
+	return policy
+}
+
+// Transfer caps the bandwidth of the runner in megabits per second, 0 is unlimited. Accelerate uses the S3
+// Transfer Acceleration endpoint of the AWS backend, the bucket must have it enabled.
+type Transfer struct {
+	Accelerate      bool `yaml:"accelerate,omitempty"`
+	MaxUploadMbps   int  `yaml:"max_upload_mbps,omitempty"`
+	MaxDownloadMbps int  `yaml:"max_download_mbps,omitempty"`
+}
+
+func (t *Transfer) options() client.Options {
+	if t == nil {
+		return client.Options{}
+	}
+	return client.Options{
+		Accelerate: t.Accelerate,
+		Upload:     bandwidth.NewLimiter(t.MaxUploadMbps),
+		Download:   bandwidth.NewLimiter(t.MaxDownloadMbps),
+	}
+}
+
+// ArtifactStore is a file server or an S3-compatible storage of the runner, the artifacts are copied, not mounted.
+// The build diffs are kept on the S3-compatible storage too.
+type ArtifactStore struct {
+	SFTP   *sftp.Config     `yaml:"sftp,omitempty"`
+	WebDAV *webdav.Config   `yaml:"webdav,omitempty"`
+	S3     *s3compat.Config `yaml:"s3,omitempty"`
+}
+
+// Price is per hour, SpotHourly is used for the spot instances if set
+type Price struct {
+	Hourly     float64 `yaml:"hourly"`
+	SpotHourly float64 `yaml:"spot_hourly,omitempty"`
+	Currency   string  `yaml:"currency,omitempty"`
+}
+
+// Registries configure the pulls of the job images, see container.Registries
+type Registries struct {
+	Mirrors  map[string][]string            `yaml:"mirrors,omitempty"`
+	Insecure []string                       `yaml:"insecure,omitempty"`
+	Auth     map[string]models.RegistryAuth `yaml:"auth,omitempty"`
+}
+
+type Daemon struct {
+	// PollInterval is in seconds
+	PollInterval int `yaml:"poll_interval,omitempty"`
+	// GC tunes the cleanup of the Docker images and containers between the jobs
+	GC *GC `yaml:"gc,omitempty"`
+	// IdleTimeout stops the instance if no job is claimed in time, in seconds. Zero keeps it forever.
+	IdleTimeout int `yaml:"idle_timeout,omitempty"`
+}
+
+// Slot is a share of the host given to one job of a runner pool
+type Slot struct {
+	// Id is the runner ID the backend reads the slot jobs by
+	Id string `yaml:"id"`
+	// GPUs are the indexes of the slot GPUs, all the GPUs are visible if empty
+	GPUs []int `yaml:"gpus,omitempty"`
+	// CPUSet is in the cpuset format, e.g. 0-7,16-23
+	CPUSet    string `yaml:"cpuset,omitempty"`
+	MemoryMiB int64  `yaml:"memory_mib,omitempty"`
+	// ExposePort is the slot range of the app ports, by default the runner range is split evenly between the slots
+	ExposePort *string `yaml:"expose_ports,omitempty"`
+}
+
+// Hooks are shell commands executed on the host. Post-run hooks are executed whatever the job result is.
+type Hooks struct {
+	PreRun  []string `yaml:"pre_run,omitempty"`
+	PostRun []string `yaml:"post_run,omitempty"`
+	// Timeout limits every command, in seconds
+	Timeout int `yaml:"timeout,omitempty"`
+}
+
+// Webhook receives the job status transitions, the payloads are signed with Secret if it is set
+type Webhook struct {
+	URL    string `yaml:"url"`
+	Secret string `yaml:"secret,omitempty"`
+	// Timeout limits every delivery attempt, in seconds
+	Timeout int `yaml:"timeout,omitempty"`
 }
 
 func (ex *Executor) loadConfig(configDir string) error {
-	thePathConfig := filepath.Join(configDir, consts.RUNNER_FILE_NAME)
-	if _, err := os.Stat(thePathConfig); os.IsNotExist(err) {
-		log.Error(context.Background(), "Failed to load config", "err", gerrors.Wrap(err))
+	config, err := LoadConfig(configDir)
+	if err != nil {
+		log.Error(context.Background(), "Failed to load config", "err", err)
 		return err
 	}
+	ex.config = config
+	return nil
+}
+
+// LoadConfig reads the runner config of the config dir
+func LoadConfig(configDir string) (*Config, error) {
+	thePathConfig := filepath.Join(configDir, consts.RUNNER_FILE_NAME)
 	theConfigFile, err := ioutil.ReadFile(thePathConfig)
 	if err != nil {
-		log.Error(context.Background(), "Unexpected error, please try to rerun", "err", gerrors.Wrap(err))
-		return err
+		return nil, gerrors.Wrap(err)
 	}
-	if err = yaml.Unmarshal(theConfigFile, &ex.config); err != nil {
-		log.Error(context.Background(), "Config file is corrupted or does not exists", "err", gerrors.Wrap(err))
-		return err
+	config := new(Config)
+	if err = yaml.Unmarshal(theConfigFile, config); err != nil {
+		return nil, gerrors.Wrap(err)
 	}
-	return nil
+	return config, nil
+}
+
+// ReloadConfig applies the tunables of the fresh config, before Init there is nothing to reload
+func (ex *Executor) ReloadConfig(ctx context.Context, fresh *Config) {
+	if ex.config != nil {
+		ex.config.Reload(ctx, fresh)
+	}
+}
+
+// tunablesMu guards the fields Reload changes, they are read with the accessors
+var tunablesMu sync.RWMutex
+
+// Reload applies the tunables of the fresh config: the log level, the daemon intervals, the disk space required
+// and the heartbeat interval. The rest is read once on start, the running jobs keep the heartbeat they started with.
+func (c *Config) Reload(ctx context.Context, fresh *Config) {
+	tunablesMu.Lock()
+	defer tunablesMu.Unlock()
+	if fresh.LogLevel != "" {
+		if level, err := logrus.ParseLevel(fresh.LogLevel); err == nil {
+			log.L.Logger.SetLevel(level)
+		} else {
+			log.Warning(ctx, "Unknown log level", "log_level", fresh.LogLevel)
+		}
+	}
+	c.LogLevel = fresh.LogLevel
+	c.MinFreeDiskMiB = fresh.MinFreeDiskMiB
+	c.HeartbeatInterval = fresh.HeartbeatInterval
+	if c.Daemon != nil && fresh.Daemon != nil {
+		c.Daemon.PollInterval = fresh.Daemon.PollInterval
+		c.Daemon.IdleTimeout = fresh.Daemon.IdleTimeout
+	}
+}
+
+// forSlot returns the config of the index-th slot out of count
+func (c Config) forSlot(slot Slot, index, count int) *Config {
+	c.Id = slot.Id
+	c.Slots = nil
+	// the control API serves the runner, not a slot
+	c.ControlPort = 0
+	// the app proxy and the gateway are served in the single mode only, the slot apps stay bound on every interface
+	c.AppProxy = nil
+	c.Gateway = nil
+	// the slots share the instance price evenly
+	if c.Price != nil {
+		price := *c.Price
+		price.Hourly /= float64(count)
+		price.SpotHourly /= float64(count)
+		c.Price = &price
+	}
+	if slot.ExposePort != nil {
+		c.ExposePort = slot.ExposePort
+	} else {
+		start, end := c.ExposePorts()
+		size := (end - start + 1) / count
+		ports := fmt.Sprintf("%d-%d", start+index*size, start+(index+1)*size-1)
+		c.ExposePort = &ports
+	}
+	return &c
 }
+
 func (c *Config) ExposePorts() (defaultStart int, defaultEnd int) {
 	defaultStart = consts.EXPOSE_PORT_START
 	defaultEnd = consts.EXPOSE_PORT_END
@@ -67,3 +343,57 @@ func (c *Config) ExposePorts() (defaultStart int, defaultEnd int) {
 	}
 	return
 }
+
+type GC struct {
+	// MaxAge is in seconds
+	MaxAge       int   `yaml:"max_age,omitempty"`
+	MaxBuildsMiB int64 `yaml:"max_builds_mib,omitempty"`
+}
+
+func (c *Config) GCPolicy() container.GCPolicy {
+	policy := container.GCPolicy{MaxAge: consts.GC_MAX_AGE}
+	if c.Daemon == nil || c.Daemon.GC == nil {
+		return policy
+	}
+	if c.Daemon.GC.MaxAge > 0 {
+		policy.MaxAge = time.Duration(c.Daemon.GC.MaxAge) * time.Second
+	}
+	policy.MaxBuildsSize = c.Daemon.GC.MaxBuildsMiB * 1024 * 1024
+	return policy
+}
+
+func (c *Config) PollInterval() time.Duration {
+	tunablesMu.RLock()
+	defer tunablesMu.RUnlock()
+	if c.Daemon != nil && c.Daemon.PollInterval > 0 {
+		return time.Duration(c.Daemon.PollInterval) * time.Second
+	}
+	return consts.DELAY_QUEUE_POLL
+}
+
+func (c *Config) IdleTimeout() time.Duration {
+	tunablesMu.RLock()
+	defer tunablesMu.RUnlock()
+	if c.Daemon != nil {
+		return time.Duration(c.Daemon.IdleTimeout) * time.Second
+	}
+	return 0
+}
+
+func (c *Config) MinFreeDisk() int {
+	tunablesMu.RLock()
+	defer tunablesMu.RUnlock()
+	if c.MinFreeDiskMiB > 0 {
+		return c.MinFreeDiskMiB
+	}
+	return consts.MIN_FREE_DISK_MIB
+}
+
+func (c *Config) Heartbeat() time.Duration {
+	tunablesMu.RLock()
+	defer tunablesMu.RUnlock()
+	if c.HeartbeatInterval > 0 {
+		return time.Duration(c.HeartbeatInterval) * time.Second
+	}
+	return consts.DELAY_HEARTBEAT
+}
@@ -0,0 +1,26 @@
+package executor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfigReload(t *testing.T) {
+	config := &Config{Id: "runner", Daemon: &Daemon{IdleTimeout: 60}, Hooks: &Hooks{Timeout: 10}}
+	config.Reload(context.Background(), &Config{
+		Id:                "other",
+		Daemon:            &Daemon{IdleTimeout: 120, PollInterval: 5},
+		HeartbeatInterval: 15,
+		MinFreeDiskMiB:    2048,
+	})
+	assert.Equal(t, 2*time.Minute, config.IdleTimeout())
+	assert.Equal(t, 5*time.Second, config.PollInterval())
+	assert.Equal(t, 15*time.Second, config.Heartbeat())
+	assert.Equal(t, 2048, config.MinFreeDisk())
+	// the rest is read once on start
+	assert.Equal(t, "runner", config.Id)
+	assert.Equal(t, 10, config.Hooks.Timeout)
+}
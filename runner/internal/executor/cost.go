@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"context"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// hourlyPrice is the instance price of the job, zero if neither the backend nor the config sets it
+func (ex *Executor) hourlyPrice(job *models.Job) (float64, string) {
+	var currency string
+	price := job.PricePerHour
+	if p := ex.config.Price; p != nil {
+		currency = p.Currency
+		if price == 0 {
+			price = p.Hourly
+			if p.SpotHourly > 0 && ex.config.Resources != nil && ex.config.Resources.Spot {
+				price = p.SpotHourly
+			}
+		}
+	}
+	return price, currency
+}
+
+// estimateCost multiplies the price by the time since the job started and by the phase durations
+func (ex *Executor) estimateCost(job *models.Job, timings models.Timings, elapsed time.Duration) *models.Cost {
+	hourly, currency := ex.hourlyPrice(job)
+	if hourly == 0 {
+		return nil
+	}
+	perMs := hourly / float64(time.Hour.Milliseconds())
+	cost := &models.Cost{
+		Currency:    currency,
+		HourlyPrice: hourly,
+		Estimated:   perMs * float64(elapsed.Milliseconds()),
+		UpdatedAt:   uint64(time.Now().UnixMilli()),
+	}
+	phases := map[string]uint64{
+		"clone":    timings.CloneMs,
+		"download": timings.DownloadMs,
+		"build":    timings.BuildMs,
+		"exec":     timings.ExecMs,
+		"upload":   timings.UploadMs,
+	}
+	for name, ms := range phases {
+		if ms == 0 {
+			continue
+		}
+		if cost.Phases == nil {
+			cost.Phases = make(map[string]float64)
+		}
+		cost.Phases[name] = perMs * float64(ms)
+	}
+	return cost
+}
+
+// reportCost updates the cost estimate of the running job, the final one is written with the run summary
+func (ex *Executor) reportCost(ctx context.Context) {
+	if hourly, _ := ex.hourlyPrice(ex.backend.Job(ctx)); hourly == 0 {
+		return
+	}
+	ticker := time.NewTicker(consts.DELAY_COST)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		timings := ex.timings.snapshot()
+		err := ex.updateJob(ctx, func(job *models.Job) {
+			job.Cost = ex.estimateCost(job, timings, time.Since(ex.startedAt))
+		})
+		if err != nil {
+			log.Error(ctx, "Failed to write the cost estimate", "err", err)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEstimateCost(t *testing.T) {
+	ex := &Executor{config: &Config{Price: &Price{Hourly: 2, Currency: "USD"}}}
+	cost := ex.estimateCost(&models.Job{}, models.Timings{ExecMs: 45 * 60 * 1000}, time.Hour)
+	assert.Equal(t, "USD", cost.Currency)
+	assert.InDelta(t, 2.0, cost.Estimated, 1e-9)
+	assert.InDelta(t, 1.5, cost.Phases["exec"], 1e-9)
+	_, ok := cost.Phases["upload"]
+	assert.Equal(t, false, ok)
+}
+
+func TestEstimateCostPrices(t *testing.T) {
+	ex := &Executor{config: &Config{
+		Price:     &Price{Hourly: 2, SpotHourly: 0.5},
+		Resources: &models.Resource{Spot: true},
+	}}
+	cost := ex.estimateCost(&models.Job{}, models.Timings{}, time.Hour)
+	assert.InDelta(t, 0.5, cost.Estimated, 1e-9)
+	cost = ex.estimateCost(&models.Job{PricePerHour: 3}, models.Timings{}, time.Hour)
+	assert.InDelta(t, 3.0, cost.Estimated, 1e-9)
+	ex.config.Price = nil
+	assert.Equal(t, (*models.Cost)(nil), ex.estimateCost(&models.Job{}, models.Timings{}, time.Hour))
+}
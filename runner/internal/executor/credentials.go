@@ -0,0 +1,45 @@
+package executor
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/repo"
+)
+
+func netrcPath(credPath string) string {
+	return credPath + ".netrc"
+}
+
+// writeTokenCredentials writes the token to .netrc for git and to hosts.yml for the GitHub CLI.
+// It returns the mounts into the home directory, the files are rewritten in place on refresh.
+func writeTokenCredentials(homeDir, host, credPath, token string) ([]mount.Mount, error) {
+	mounts := make([]mount.Mount, 0, 2)
+	if err := writePrivateFile(netrcPath(credPath), repo.Netrc(host, token)); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	mounts = append(mounts, mount.Mount{
+		Type:   mount.TypeBind,
+		Source: netrcPath(credPath),
+		Target: path.Join(homeDir, ".netrc"),
+	})
+	if repo.ProviderOf(host) == repo.GitHub {
+		if err := os.WriteFile(credPath, ghHosts(host, token), 0644); err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		mounts = append(mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: credPath,
+			Target: path.Join(homeDir, ".config/gh/hosts.yml"),
+		})
+	}
+	return mounts, nil
+}
+
+// ghHosts is the GitHub CLI hosts.yml
+func ghHosts(host, token string) []byte {
+	return []byte(fmt.Sprintf("%s:\n  oauth_token: \"%s\"\n", host, token))
+}
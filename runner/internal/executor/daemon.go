@@ -0,0 +1,445 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/consts/states"
+	"github.com/dstackai/dstack/runner/internal/backend"
+	localbackend "github.com/dstackai/dstack/runner/internal/backend/local"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/internal/ports"
+	"github.com/dstackai/dstack/runner/internal/stream"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	daemonIdle = "idle"
+	daemonBusy = "busy"
+)
+
+// claimTTL expires the claims of the runners died between the claim and the job start
+const claimTTL = 10 * consts.DELAY_QUEUE_CLAIM
+
+// queueRunner is the persistent runner: it runs the job it was provisioned for, if any,
+// then claims the queued jobs matching its resources and runs them one by one
+type queueRunner struct {
+	backend    backend.Backend
+	newBackend func() (backend.Backend, error)
+	streamLogs *stream.Server
+	configDir  string
+	config     *Config
+	// state is the template of the runner state of the claimed jobs
+	state models.State
+	// pausingLogs streams the logs of the jobs run while the preempted one is paused
+	pausingLogs *stream.Server
+}
+
+// Serve runs the jobs of the queue until ctx is done. Every job gets a fresh backend from newBackend,
+// b is used for the queue itself.
+func Serve(ctx context.Context, b backend.Backend, newBackend func() (backend.Backend, error), streamLogs *stream.Server, configDir string, config *Config) error {
+	r := &queueRunner{
+		backend:    b,
+		newBackend: newBackend,
+		streamLogs: streamLogs,
+		configDir:  configDir,
+		config:     config,
+	}
+	hasJob, err := r.loadState(ctx)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() {
+		if err := r.backend.DeletePrefix(context.Background(), r.daemonKey()); err != nil {
+			log.Error(ctx, "Failed to deregister the runner", "err", err)
+		}
+	}()
+	for {
+		for hasJob {
+			// a job of a higher priority claimed meanwhile runs next
+			hasJob = r.runJob(ctx, r.streamLogs, true)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err = r.register(ctx, daemonIdle, ""); err != nil {
+			return gerrors.Wrap(err)
+		}
+		if hasJob, err = r.poll(ctx); err != nil {
+			return gerrors.Wrap(err)
+		}
+		if !hasJob && ctx.Err() == nil {
+			r.shutdown(ctx)
+			return nil
+		}
+	}
+}
+
+// shutdown stops the idle instance, the backend needs the runner state of the last job to find it
+func (r *queueRunner) shutdown(ctx context.Context) {
+	if err := r.backend.Init(ctx, r.config.Id); err != nil {
+		log.Warning(ctx, "No runner state, the instance is left running", "err", err)
+		return
+	}
+	if err := r.backend.Shutdown(ctx); err != nil {
+		log.Error(ctx, "Failed to shut the idle instance down", "err", err)
+	}
+}
+
+// loadState reads the runner state the instance was provisioned with, the resources come from the config otherwise
+func (r *queueRunner) loadState(ctx context.Context) (bool, error) {
+	r.state.RunnerID = r.config.Id
+	if r.config.Resources != nil {
+		r.state.Resources = *r.config.Resources
+	}
+	contents, err := r.backend.GetFile(ctx, r.runnerKey())
+	if err != nil {
+		log.Info(ctx, "No job to run, polling the queue", "runner ID", r.config.Id)
+		return false, nil
+	}
+	var state models.State
+	if err = yaml.Unmarshal(contents, &state); err != nil {
+		return false, gerrors.Wrap(err)
+	}
+	r.state.RequestID = state.RequestID
+	r.state.Resources = state.Resources
+	if state.Job == nil {
+		return false, nil
+	}
+	// the runner state keeps the last claimed job, it has ended if the daemon is restarted after it
+	if job, err := r.backend.GetJobByPath(ctx, state.Job.JobFilepath()); err == nil && states.IsFinal(job.Status) {
+		log.Info(ctx, "The last job has ended, polling the queue", "job ID", job.JobID, "status", job.Status)
+		return false, nil
+	}
+	return true, nil
+}
+
+// runJob runs the claimed job, a preemptible one is watched for the queued jobs of a higher priority.
+// It returns true if such a job was claimed to run next.
+func (r *queueRunner) runJob(ctx context.Context, streamLogs *stream.Server, preemptible bool) bool {
+	b, err := r.newBackend()
+	if err != nil {
+		log.Error(ctx, "Failed to create backend", "err", err)
+		return false
+	}
+	ex := New(b)
+	ex.SetStreamLogs(streamLogs)
+	if err = ex.Init(ctx, r.configDir); err != nil {
+		log.Error(ctx, "Failed to init executor", "err", err)
+		return false
+	}
+	job := b.Job(ctx)
+	if err = r.register(ctx, daemonBusy, job.JobID); err != nil {
+		log.Error(ctx, "Failed to register the runner", "err", err)
+	}
+	claimedNext := false
+	watchDone := make(chan struct{})
+	watchWg := sync.WaitGroup{}
+	if preemptible && job.Preemption != models.PreemptionNever {
+		watchWg.Add(1)
+		go func() {
+			defer watchWg.Done()
+			claimedNext = r.watchPreemption(ctx, ex, job, watchDone)
+		}()
+	}
+	if err = ex.Run(ctx); err != nil {
+		log.Error(ctx, "Job ended with an error", "job ID", job.JobID, "err", err)
+	}
+	close(watchDone)
+	watchWg.Wait()
+	select {
+	case <-streamLogs.Done:
+		log.Trace(ctx, "Done streaming logs")
+	case <-time.After(time.Second * 30):
+		log.Trace(ctx, "Timed out streaming logs")
+	}
+	streamLogs.Reset()
+	ex.collectGarbage(ctx)
+	return claimedNext
+}
+
+// watchPreemption claims the queued jobs of a higher priority until done is closed. A pausable job is frozen
+// while the claimed job runs, the others are preempted and the claimed job runs next, then it returns true.
+func (r *queueRunner) watchPreemption(ctx context.Context, ex *Executor, job *models.Job, done chan struct{}) bool {
+	ticker := time.NewTicker(r.config.PollInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return false
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+		claimed, err := r.claimNext(ctx, job.Priority+1)
+		if err != nil {
+			log.Error(ctx, "Failed to claim a job of a higher priority", "err", err)
+			continue
+		}
+		if !claimed {
+			continue
+		}
+		log.Info(ctx, "Job is preempted by a job of a higher priority", "job ID", job.JobID, "priority", job.Priority)
+		if job.Preemption == models.PreemptionPause {
+			if err = r.runPausing(ctx, ex); err == nil {
+				if err = r.register(ctx, daemonBusy, job.JobID); err != nil {
+					log.Error(ctx, "Failed to register the runner", "err", err)
+				}
+				continue
+			}
+			log.Warning(ctx, "Failed to pause the job, stopping it", "err", err)
+		}
+		ex.Preempt()
+		return true
+	}
+}
+
+// runPausing runs the claimed job while ex is paused, the claimed job streams its logs on a port of its own
+func (r *queueRunner) runPausing(ctx context.Context, ex *Executor) error {
+	if r.pausingLogs == nil {
+		port := vacantPortBelow(r.streamLogs.Port())
+		if port == 0 {
+			return gerrors.New("no vacant port for the logs streaming")
+		}
+		r.pausingLogs = stream.New(port)
+		go func() {
+			if err := r.pausingLogs.Run(ctx); err != nil {
+				log.Error(ctx, "Failed stream log", "err", err)
+			}
+		}()
+	}
+	if err := ex.Pause(ctx); err != nil {
+		return gerrors.Wrap(err)
+	}
+	r.runJob(ctx, r.pausingLogs, false)
+	return gerrors.Wrap(ex.Resume(ctx))
+}
+
+// vacantPortBelow picks the port of the second logs stream next to the first one
+func vacantPortBelow(port int) int {
+	for candidate := port - 1; candidate > 0 && candidate >= port-1000; candidate-- {
+		if vacant, _ := ports.CheckPort(candidate); vacant {
+			return candidate
+		}
+	}
+	return 0
+}
+
+// poll waits for a queued job and claims it, it returns false if ctx is done or the idle timeout expires first
+func (r *queueRunner) poll(ctx context.Context) (bool, error) {
+	ticker := time.NewTicker(r.config.PollInterval())
+	defer ticker.Stop()
+	var idleCh <-chan time.Time
+	if timeout := r.config.IdleTimeout(); timeout > 0 {
+		idle := time.NewTimer(timeout)
+		defer idle.Stop()
+		idleCh = idle.C
+	}
+	for {
+		claimed, err := r.claimNext(ctx, math.MinInt)
+		if err != nil {
+			log.Trace(ctx, "Failed to list the job queue", "err", err)
+		}
+		if claimed {
+			return true, nil
+		}
+		select {
+		case <-ctx.Done():
+			return false, nil
+		case <-idleCh:
+			log.Info(ctx, "No job in time, shutting the instance down", "idle timeout", r.config.IdleTimeout())
+			return false, nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// queuedJob is a job of the queue fitting the runner
+type queuedJob struct {
+	key      string
+	priority int
+}
+
+// claimNext claims the fitting queued job of the highest priority, at least minPriority
+func (r *queueRunner) claimNext(ctx context.Context, minPriority int) (bool, error) {
+	keys, err := r.backend.ListSubDir(ctx, consts.QUEUE_PREFIX)
+	if err != nil {
+		return false, gerrors.Wrap(err)
+	}
+	var queued []queuedJob
+	for _, key := range keys {
+		if !strings.HasSuffix(key, ".yaml") {
+			continue
+		}
+		contents, err := r.backend.GetFile(ctx, key)
+		if err != nil {
+			continue
+		}
+		var state models.State
+		if err = yaml.Unmarshal(contents, &state); err != nil || state.Job == nil {
+			continue
+		}
+		if state.Job.Priority >= minPriority && fits(r.state.Resources, state.Job.Requirements) {
+			queued = append(queued, queuedJob{key: key, priority: state.Job.Priority})
+		}
+	}
+	for _, job := range byPriority(queued) {
+		claimed, err := r.claim(ctx, job.key)
+		if err != nil {
+			log.Error(ctx, "Failed to claim the job", "key", job.key, "err", err)
+			continue
+		}
+		if claimed {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// byPriority orders the jobs by the priority, the jobs of the same priority keep the queue order
+func byPriority(queued []queuedJob) []queuedJob {
+	sort.SliceStable(queued, func(i, j int) bool { return queued[i].priority > queued[j].priority })
+	return queued
+}
+
+// claim takes the queued job if it fits the runner. The backends have no conditional writes,
+// so the runner writes its claim, waits for the others to overwrite it and checks it is still the owner.
+func (r *queueRunner) claim(ctx context.Context, key string) (bool, error) {
+	contents, err := r.backend.GetFile(ctx, key)
+	if err != nil {
+		// claimed by another runner meanwhile
+		return false, nil
+	}
+	var queued models.State
+	if err = yaml.Unmarshal(contents, &queued); err != nil {
+		return false, gerrors.Wrap(err)
+	}
+	if queued.Job == nil || !fits(r.state.Resources, queued.Job.Requirements) {
+		return false, nil
+	}
+	claimKey := strings.TrimSuffix(key, ".yaml") + ".claim"
+	if owner, ok := r.claimOwner(ctx, claimKey); ok && owner != r.config.Id {
+		return false, nil
+	}
+	claim := fmt.Sprintf("%s %d", r.config.Id, time.Now().UnixMilli())
+	if err = r.backend.PutFile(ctx, claimKey, []byte(claim)); err != nil {
+		return false, gerrors.Wrap(err)
+	}
+	select {
+	case <-ctx.Done():
+		return false, nil
+	case <-time.After(consts.DELAY_QUEUE_CLAIM):
+	}
+	if owner, _ := r.claimOwner(ctx, claimKey); owner != r.config.Id {
+		return false, nil
+	}
+
+	state := r.state
+	state.Job = queued.Job
+	state.Job.RunnerID = r.state.RunnerID
+	state.Job.RequestID = r.state.RequestID
+	if contents, err = yaml.Marshal(state); err != nil {
+		return false, gerrors.Wrap(err)
+	}
+	if err = r.backend.PutFile(ctx, r.runnerKey(), contents); err != nil {
+		return false, gerrors.Wrap(err)
+	}
+	for _, k := range []string{key, claimKey} {
+		if err = r.backend.DeletePrefix(ctx, k); err != nil {
+			log.Warning(ctx, "Failed to delete the claimed job from the queue", "key", k, "err", err)
+		}
+	}
+	log.Info(ctx, "Claimed the job", "job ID", state.Job.JobID)
+	return true, nil
+}
+
+// claimOwner returns the runner ID of a live claim
+func (r *queueRunner) claimOwner(ctx context.Context, claimKey string) (string, bool) {
+	contents, err := r.backend.GetFile(ctx, claimKey)
+	if err != nil {
+		return "", false
+	}
+	fields := strings.Fields(string(contents))
+	if len(fields) != 2 {
+		return "", false
+	}
+	claimedAt, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || time.Since(time.UnixMilli(claimedAt)) > claimTTL {
+		return "", false
+	}
+	return fields[0], true
+}
+
+func (r *queueRunner) register(ctx context.Context, status, jobID string) error {
+	contents, err := yaml.Marshal(models.DaemonState{
+		RunnerID:  r.state.RunnerID,
+		RequestID: r.state.RequestID,
+		Resources: r.state.Resources,
+		Status:    status,
+		JobID:     jobID,
+		UpdatedAt: uint64(time.Now().UnixMilli()),
+	})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(r.backend.PutFile(ctx, r.daemonKey(), contents))
+}
+
+func (r *queueRunner) runnerKey() string {
+	return fmt.Sprintf("runners/%s.yaml", r.config.Id)
+}
+
+func (r *queueRunner) daemonKey() string {
+	return fmt.Sprintf("%s/%s.yaml", consts.DAEMONS_DIR, r.config.Id)
+}
+
+// fits checks the resources satisfy the job requirements
+func fits(res models.Resource, req models.Requirements) bool {
+	if req.Local != res.Local {
+		return false
+	}
+	// a spot job may run on an on-demand instance, not the other way around
+	if res.Spot && !req.Spot {
+		return false
+	}
+	if req.CPUs > res.CPUs || uint64(req.Memory) > res.Memory {
+		return false
+	}
+	if req.GPUs.Count == 0 {
+		return true
+	}
+	if req.Local && len(res.GPUs) == 0 && noGPUHost {
+		return true
+	}
+	matching := 0
+	for _, gpu := range res.GPUs {
+		// nvidia-smi reports the full name, e.g. Tesla T4 for T4
+		if !strings.Contains(strings.ToUpper(gpu.Name), strings.ToUpper(req.GPUs.Name)) {
+			continue
+		}
+		if gpu.MemoryMiB < req.GPUs.MemoryMiB {
+			continue
+		}
+		matching++
+	}
+	return matching >= req.GPUs.Count
+}
+
+// collectGarbage prunes the Docker leftovers of the jobs, the local runners share the Docker with the user
+func (ex *Executor) collectGarbage(ctx context.Context) {
+	if _, isLocalBackend := ex.backend.(*localbackend.Local); isLocalBackend {
+		return
+	}
+	if err := ex.engine.GC(ctx, ex.config.GCPolicy()); err != nil {
+		log.Warning(ctx, "Failed to collect the Docker garbage", "err", err)
+	}
+}
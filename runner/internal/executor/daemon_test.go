@@ -0,0 +1,72 @@
+package executor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/consts/states"
+	fakebackend "github.com/dstackai/dstack/runner/internal/backend/testing"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+func TestFits(t *testing.T) {
+	res := models.Resource{
+		CPUs:   8,
+		Memory: 32768,
+		GPUs:   []models.GPU{{Name: "Tesla T4", MemoryMiB: 15360}, {Name: "Tesla T4", MemoryMiB: 15360}},
+	}
+	assert.Equal(t, true, fits(res, models.Requirements{CPUs: 4, Memory: 16384}))
+	assert.Equal(t, true, fits(res, models.Requirements{GPUs: models.GPU{Count: 2, Name: "t4"}}))
+	assert.Equal(t, true, fits(res, models.Requirements{Spot: true}))
+	assert.Equal(t, false, fits(res, models.Requirements{CPUs: 16}))
+	assert.Equal(t, false, fits(res, models.Requirements{GPUs: models.GPU{Count: 3}}))
+	assert.Equal(t, false, fits(res, models.Requirements{GPUs: models.GPU{Count: 1, Name: "A100"}}))
+	assert.Equal(t, false, fits(res, models.Requirements{GPUs: models.GPU{Count: 1, MemoryMiB: 40960}}))
+	res.Spot = true
+	assert.Equal(t, false, fits(res, models.Requirements{}))
+}
+
+func TestFitsNoGPUHost(t *testing.T) {
+	defer func(value bool) { noGPUHost = value }(noGPUHost)
+	res := models.Resource{CPUs: 8, Memory: 16384, Local: true}
+	req := models.Requirements{GPUs: models.GPU{Count: 1}, Local: true}
+	noGPUHost = false
+	assert.Equal(t, false, fits(res, req))
+	noGPUHost = true
+	assert.Equal(t, true, fits(res, req))
+}
+
+func TestByPriority(t *testing.T) {
+	queued := byPriority([]queuedJob{{key: "a", priority: 0}, {key: "b", priority: 10}, {key: "c"}, {key: "d", priority: 10}})
+	keys := make([]string, len(queued))
+	for i, job := range queued {
+		keys[i] = job.key
+	}
+	assert.Equal(t, []string{"b", "d", "a", "c"}, keys)
+}
+
+func TestLoadStateAfterJobEnded(t *testing.T) {
+	job := &models.Job{JobID: "job-1", RepoId: "repo", Status: "submitted"}
+	b := fakebackend.New(nil, t.TempDir())
+	contents, err := yaml.Marshal(models.State{RunnerID: "runner-1", Job: job})
+	assert.Equal(t, nil, err)
+	b.SetFile("runners/runner-1.yaml", contents)
+	r := &queueRunner{backend: b, config: &Config{Id: "runner-1"}}
+
+	// the job of the provisioned instance hasn't run yet
+	hasJob, err := r.loadState(context.Background())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, hasJob)
+
+	// the daemon is restarted after the job is done, the runner state still has it
+	ended := *job
+	ended.Status = states.Done
+	contents, err = yaml.Marshal(&ended)
+	assert.Equal(t, nil, err)
+	b.SetFile(job.JobFilepath(), contents)
+	hasJob, err = r.loadState(context.Background())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, hasJob)
+}
@@ -0,0 +1,47 @@
+package executor
+
+import (
+	"context"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// datasetArtifact binds the dataset read-only and never uploads it
+type datasetArtifact struct {
+	artifacts.Artifacter
+	dataset models.Dataset
+}
+
+func (d datasetArtifact) AfterRun(ctx context.Context) error {
+	// FUSE mounts are released, downloaded data is left as is
+	if d.dataset.Mount {
+		return d.Artifacter.AfterRun(ctx)
+	}
+	return nil
+}
+
+func (d datasetArtifact) DockerBindings(workDir string) ([]mount.Mount, error) {
+	bindings, err := d.Artifacter.DockerBindings(workDir)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	for i := range bindings {
+		bindings[i].ReadOnly = true
+	}
+	return bindings, nil
+}
+
+func (ex *Executor) processDatasets(ctx context.Context) error {
+	job := ex.backend.Job(ctx)
+	for _, dataset := range job.Datasets {
+		art := ex.withChecksums(ex.backend.GetDataset(ctx, job.RunName, dataset.Path, dataset.Source, dataset.Mount), dataset.Source, dataset.Mount)
+		if art == nil {
+			return gerrors.Newf("failed to prepare dataset %s", dataset.Source)
+		}
+		ex.datasets = append(ex.datasets, datasetArtifact{Artifacter: art, dataset: dataset})
+	}
+	return nil
+}
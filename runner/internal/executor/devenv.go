@@ -0,0 +1,183 @@
+package executor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// jetbrainsDist is where Gateway looks for the IDE backends installed on the remote host
+const jetbrainsDist = "~/.cache/JetBrains/RemoteDev/dist"
+
+// devEnvironmentApps are the servers of the dev environment, they are bound and tunneled like the job apps
+func devEnvironmentApps(dev *models.DevEnvironment) []models.App {
+	apps := []models.App{{Name: "ssh", Port: consts.DEV_ENV_SSH_PORT}}
+	if dev.IDE == models.IDEVSCode {
+		apps = append(apps, models.App{Name: "code-server", Port: consts.DEV_ENV_CODE_SERVER_PORT})
+	}
+	return apps
+}
+
+// prepareDevEnvironment adds the server apps to the job and generates the code-server password
+func (ex *Executor) prepareDevEnvironment(ctx context.Context) error {
+	job := ex.backend.Job(ctx)
+	dev := job.DevEnvironment
+	if dev.IDE != models.IDEVSCode && dev.IDE != models.IDEJetBrains {
+		return gerrors.Newf("unknown IDE: %s", dev.IDE)
+	}
+	if job.SSHKeyPub == "" {
+		log.Warning(ctx, "The dev environment has no SSH key, sshd accepts no client")
+	}
+	password := dev.Password
+	if dev.IDE == models.IDEVSCode && password == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			return gerrors.Wrap(err)
+		}
+		password = hex.EncodeToString(b)
+	}
+	if password != "" {
+		ex.logSecrets.Add(password)
+	}
+	return ex.updateJob(ctx, func(job *models.Job) {
+		for _, app := range devEnvironmentApps(job.DevEnvironment) {
+			if !hasApp(job.Apps, app.Name) {
+				job.Apps = append(job.Apps, app)
+			}
+		}
+		job.DevEnvironment.Password = password
+	})
+}
+
+func hasApp(apps []models.App, name string) bool {
+	for _, app := range apps {
+		if app.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// devEnvironmentCommands install and start the servers, run the job commands and keep the container alive.
+// The installs need root and apt, the values of the job are passed with devEnvironmentEnv to stay unquoted.
+func devEnvironmentCommands(job *models.Job) []string {
+	commands := []string{
+		"test -x /usr/sbin/sshd || (apt-get update -qq && DEBIAN_FRONTEND=noninteractive apt-get install -y -qq openssh-server curl)",
+		`mkdir -p /run/sshd ~/.ssh && chmod 700 ~/.ssh && printf '%s\n' "$DSTACK_SSH_KEY_PUB" >> ~/.ssh/authorized_keys && chmod 600 ~/.ssh/authorized_keys`,
+		"ssh-keygen -A",
+		fmt.Sprintf("/usr/sbin/sshd -p %d -o PasswordAuthentication=no", consts.DEV_ENV_SSH_PORT),
+	}
+	switch job.DevEnvironment.IDE {
+	case models.IDEVSCode:
+		install := "curl -fsSL https://code-server.dev/install.sh | sh -s -- --method standalone --prefix /usr/local"
+		if job.DevEnvironment.Version != "" {
+			install += ` --version "$DSTACK_IDE_VERSION"`
+		}
+		commands = append(commands,
+			"command -v code-server >/dev/null 2>&1 || ("+install+")",
+			fmt.Sprintf("code-server --bind-addr 0.0.0.0:%d --auth password --disable-telemetry /workflow >/tmp/code-server.log 2>&1 &", consts.DEV_ENV_CODE_SERVER_PORT),
+		)
+	case models.IDEJetBrains:
+		if job.DevEnvironment.BackendURL != "" {
+			commands = append(commands, fmt.Sprintf(`mkdir -p %[1]s && curl -fsSL "$DSTACK_IDE_BACKEND_URL" | tar -xz -C %[1]s`, jetbrainsDist))
+		}
+	}
+	commands = append(commands, job.Commands...)
+	return append(commands, "sleep infinity")
+}
+
+func devEnvironmentEnv(job *models.Job) map[string]string {
+	dev := job.DevEnvironment
+	env := map[string]string{"DSTACK_SSH_KEY_PUB": job.SSHKeyPub}
+	switch dev.IDE {
+	case models.IDEVSCode:
+		env["PASSWORD"] = dev.Password
+		if dev.Version != "" {
+			env["DSTACK_IDE_VERSION"] = dev.Version
+		}
+	case models.IDEJetBrains:
+		if dev.BackendURL != "" {
+			env["DSTACK_IDE_BACKEND_URL"] = dev.BackendURL
+		}
+	}
+	return env
+}
+
+// watchIdle stops the dev environment once no client is connected to its servers for the idle timeout
+func (ex *Executor) watchIdle(ctx context.Context, docker *container.DockerRuntime, dev *models.DevEnvironment, done chan struct{}) {
+	timeout := time.Duration(dev.IdleTimeout) * time.Second
+	serverPorts := make(map[int]bool)
+	for _, app := range devEnvironmentApps(dev) {
+		serverPorts[app.Port] = true
+	}
+	lastActive := time.Now()
+	ticker := time.NewTicker(consts.DELAY_IDLE_CHECK)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+		connected, err := clientsConnected(ctx, docker, serverPorts)
+		if err != nil {
+			log.Warning(ctx, "Failed to check the dev environment connections", "err", err)
+			continue
+		}
+		if connected {
+			lastActive = time.Now()
+			continue
+		}
+		if time.Since(lastActive) >= timeout {
+			log.Info(ctx, "Dev environment is idle, stopping", "idle_timeout", dev.IdleTimeout)
+			ex.Stop()
+			return
+		}
+	}
+}
+
+// clientsConnected reads the TCP sockets of the container network namespace
+func clientsConnected(ctx context.Context, docker *container.DockerRuntime, ports map[int]bool) (bool, error) {
+	session, err := docker.Exec(ctx, []string{"cat", "/proc/net/tcp", "/proc/net/tcp6"}, container.ExecOptions{})
+	if err != nil {
+		return false, gerrors.Wrap(err)
+	}
+	defer func() { _ = session.Close() }()
+	_ = session.CloseWrite()
+	out, err := io.ReadAll(session)
+	if err != nil {
+		return false, gerrors.Wrap(err)
+	}
+	return establishedOn(string(out), ports), nil
+}
+
+// establishedOn tells if the /proc/net/tcp table has an established connection to one of the local ports
+func establishedOn(table string, ports map[int]bool) bool {
+	for _, line := range strings.Split(table, "\n") {
+		fields := strings.Fields(line)
+		// 01 is TCP_ESTABLISHED, the header line has st
+		if len(fields) < 4 || fields[3] != "01" {
+			continue
+		}
+		i := strings.LastIndexByte(fields[1], ':')
+		if i < 0 {
+			continue
+		}
+		port, err := strconv.ParseUint(fields[1][i+1:], 16, 16)
+		if err == nil && ports[int(port)] {
+			return true
+		}
+	}
+	return false
+}
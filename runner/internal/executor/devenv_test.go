@@ -0,0 +1,33 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+const procNetTCP = `  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode
+   0: 00000000:2742 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 1 1 0000000000000000 100 0 0 10 0
+   1: 0100007F:2726 0100007F:A3C2 01 00000000:00000000 00:00000000 00000000     0        0 2 1 0000000000000000 20 4 30 10 -1
+`
+
+func TestEstablishedOn(t *testing.T) {
+	// 10050 is listening, 10022 has a client connected from 41922
+	assert.Equal(t, false, establishedOn(procNetTCP, map[int]bool{10050: true}))
+	assert.Equal(t, false, establishedOn(procNetTCP, map[int]bool{41922: true}))
+	assert.Equal(t, true, establishedOn(procNetTCP, map[int]bool{10022: true}))
+}
+
+func TestDevEnvironmentCommands(t *testing.T) {
+	job := &models.Job{
+		Commands:       []string{"pip install -r requirements.txt"},
+		DevEnvironment: &models.DevEnvironment{IDE: models.IDEJetBrains},
+	}
+	commands := devEnvironmentCommands(job)
+	assert.Equal(t, "pip install -r requirements.txt", commands[len(commands)-2])
+	assert.Equal(t, "sleep infinity", commands[len(commands)-1])
+	assert.Equal(t, 1, len(devEnvironmentApps(job.DevEnvironment)))
+	assert.Equal(t, consts.DEV_ENV_SSH_PORT, devEnvironmentApps(job.DevEnvironment)[0].Port)
+}
@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+type NoDiskSpaceError struct {
+	Path      string
+	Required  uint64
+	Available uint64
+}
+
+func (e NoDiskSpaceError) Error() string {
+	return fmt.Sprintf("not enough disk space on %s: %d bytes required, %d bytes available", e.Path, e.Required, e.Available)
+}
+
+// checkDiskSpace fails early if the workdir or the Docker root can't hold the artifacts and the images
+func (ex *Executor) checkDiskSpace(ctx context.Context) error {
+	required := uint64(ex.config.MinFreeDisk()) * 1024 * 1024
+	paths := []string{ex.backend.GetTMPDir(ctx)}
+	// Docker Desktop keeps the root in a VM
+	if root := ex.engine.DockerRootDir(); root != "" && runtime.GOOS == "linux" {
+		paths = append(paths, root)
+	}
+	for _, path := range paths {
+		available, err := freeDiskSpace(existingParent(path))
+		if err != nil {
+			log.Warning(ctx, "Failed to check the disk space", "path", path, "err", err)
+			continue
+		}
+		log.Trace(ctx, "Disk space", "path", path, "available", available, "required", required)
+		if available < required {
+			return NoDiskSpaceError{Path: path, Required: required, Available: available}
+		}
+	}
+	return nil
+}
+
+// existingParent returns the path or its closest existing parent, the workdir is created later
+func existingParent(path string) string {
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return path
+		}
+		path = parent
+	}
+}
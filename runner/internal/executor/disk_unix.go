@@ -0,0 +1,14 @@
+//go:build !windows
+
+package executor
+
+import "syscall"
+
+// freeDiskSpace returns the bytes available to the unprivileged users
+func freeDiskSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,16 @@
+package executor
+
+import "golang.org/x/sys/windows"
+
+// freeDiskSpace returns the bytes available to the user
+func freeDiskSpace(path string) (uint64, error) {
+	dir, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available uint64
+	if err = windows.GetDiskFreeSpaceEx(dir, &available, nil, nil); err != nil {
+		return 0, err
+	}
+	return available, nil
+}
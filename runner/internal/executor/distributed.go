@@ -0,0 +1,93 @@
+package executor
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/internal/ports"
+)
+
+// distributedEnv configures torch.distributed, NCCL and Gloo from the master job record
+func (ex *Executor) distributedEnv(ctx context.Context) map[string]string {
+	job := ex.backend.Job(ctx)
+	d := job.Distributed
+	masterAddr := job.HostName
+	if ex.config.Hostname != nil {
+		masterAddr = *ex.config.Hostname
+	}
+	masterPort := d.MasterPort
+	if job.MasterJobID != "" && job.MasterJobID != job.JobID {
+		master := ex.backend.MasterJob(ctx)
+		if master == nil {
+			log.Error(ctx, "Failed to read the master job", "master_job_id", job.MasterJobID)
+			return map[string]string{}
+		}
+		masterAddr = master.HostName
+		if master.Distributed != nil {
+			masterPort = master.Distributed.MasterPort
+		}
+	}
+	if masterPort == 0 {
+		masterPort = consts.DEFAULT_MASTER_PORT
+	}
+	env := map[string]string{
+		"MASTER_ADDR": masterAddr,
+		"MASTER_PORT": strconv.Itoa(masterPort),
+		"NODE_RANK":   strconv.Itoa(d.NodeRank),
+		"NNODES":      strconv.Itoa(d.Nodes),
+	}
+	iface, err := socketInterface(masterAddr)
+	if err != nil {
+		log.Error(ctx, "Failed to detect the inter-node interface", "err", err)
+		return env
+	}
+	env["NCCL_SOCKET_IFNAME"] = iface
+	env["GLOO_SOCKET_IFNAME"] = iface
+	return env
+}
+
+// publishDistributedPorts opens the inter-node ports if the container can't use the host network
+func publishDistributedPorts(spec *container.Spec, d *models.Distributed) {
+	spec.HostNetwork = true
+	if d.PortsStart == 0 {
+		return
+	}
+	end := d.PortsEnd
+	if end < d.PortsStart {
+		end = d.PortsStart
+	}
+	ports.PublishRange(spec.ExposedPorts, spec.BindingPorts, ports.Range{Start: d.PortsStart, End: end})
+}
+
+// socketInterface returns the name of the interface routing to addr
+func socketInterface(addr string) (string, error) {
+	// no packets are sent, the kernel only picks the route
+	conn, err := net.Dial("udp", net.JoinHostPort(addr, strconv.Itoa(consts.DEFAULT_MASTER_PORT)))
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	localIP := conn.LocalAddr().(*net.UDPAddr).IP
+	_ = conn.Close()
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			if ipNet, ok := a.(*net.IPNet); ok && ipNet.IP.Equal(localIP) {
+				return iface.Name, nil
+			}
+		}
+	}
+	return "", gerrors.Newf("no interface has address %s", localIP)
+}
@@ -0,0 +1,19 @@
+package executor
+
+import (
+	"net"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// extraHosts validates the host:ip entries of /etc/hosts, the IP may be IPv6
+func extraHosts(entries []string) ([]string, error) {
+	for _, entry := range entries {
+		host, ip, ok := strings.Cut(entry, ":")
+		if !ok || host == "" || net.ParseIP(ip) == nil {
+			return nil, gerrors.Newf("extra host is not in the host:ip format: %s", entry)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,20 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtraHosts(t *testing.T) {
+	hosts, err := extraHosts([]string{"registry.internal:10.0.0.5", "data.internal:fd00::1"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"registry.internal:10.0.0.5", "data.internal:fd00::1"}, hosts)
+
+	_, err = extraHosts([]string{"registry.internal"})
+	assert.NotEqual(t, nil, err)
+	_, err = extraHosts([]string{":10.0.0.5"})
+	assert.NotEqual(t, nil, err)
+	_, err = extraHosts([]string{"registry.internal:10.0.0"})
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,117 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/joblog"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// DrySpec is the resolved container spec of the job, the secrets are masked and the registry credentials are left out
+type DrySpec struct {
+	Image       string              `json:"image"`
+	Entrypoint  []string            `json:"entrypoint,omitempty"`
+	Commands    []string            `json:"commands"`
+	WorkDir     string              `json:"work_dir"`
+	User        string              `json:"user,omitempty"`
+	Env         []string            `json:"env"`
+	Mounts      []DryMount          `json:"mounts"`
+	Ports       map[string][]string `json:"ports,omitempty"`
+	Network     string              `json:"network,omitempty"`
+	HostNetwork bool                `json:"host_network,omitempty"`
+	GPUDevices  []int               `json:"gpu_devices,omitempty"`
+	CPUSet      string              `json:"cpu_set,omitempty"`
+	MemoryMiB   int64               `json:"memory_mib,omitempty"`
+	ShmSizeMiB  int64               `json:"shm_size_mib,omitempty"`
+}
+
+type DryMount struct {
+	Type     string `json:"type"`
+	Source   string `json:"source,omitempty"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+// DryRun prepares the repo and resolves the container spec like Run, then writes it to out as JSON.
+// Nothing is pulled or started. The executor has to be inited after SetDryRun for the job state to be
+// left as is, the ports and the other job changes are resolved on the job in memory.
+func (ex *Executor) DryRun(ctx context.Context, out io.Writer) error {
+	job := ex.backend.Job(ctx)
+	switch job.RepoType {
+	case "remote":
+		if err := ex.prepareGit(ctx); err != nil {
+			return gerrors.Wrap(err)
+		}
+	case "local":
+		if err := ex.prepareArchive(ctx); err != nil {
+			return gerrors.Wrap(err)
+		}
+	default:
+		log.Warning(ctx, "Unknown RepoType", "RepoType", job.RepoType)
+	}
+	if err := ex.prepareExtraRepos(ctx); err != nil {
+		return gerrors.Wrap(err)
+	}
+	credPath := ex.credentialsPath(ctx)
+	defer func() {
+		_ = os.Remove(credPath)
+		_ = os.Remove(netrcPath(credPath))
+		_ = os.RemoveAll(ex.envFilesDir(ctx))
+	}()
+	spec, err := ex.newSpec(ctx, credPath)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	ex.logSecrets.Add(ex.secretValues(ctx)...)
+	resolved, err := json.MarshalIndent(newDrySpec(spec, ex.logSecrets), "", "  ")
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	log.Info(ctx, "Resolved container spec", "spec", string(resolved))
+	_, err = out.Write(append(resolved, '\n'))
+	return gerrors.Wrap(err)
+}
+
+func newDrySpec(spec *container.Spec, secrets *joblog.Secrets) *DrySpec {
+	dry := &DrySpec{
+		Image:       spec.Image,
+		Entrypoint:  spec.Entrypoint,
+		WorkDir:     spec.WorkDir,
+		User:        spec.User,
+		Network:     spec.Network,
+		HostNetwork: spec.HostNetwork,
+		GPUDevices:  spec.GPUDevices,
+		CPUSet:      spec.CPUSet,
+		MemoryMiB:   spec.MemoryMiB,
+		ShmSizeMiB:  spec.ShmSize,
+		Env:         make([]string, 0, len(spec.Env)),
+		Mounts:      make([]DryMount, 0, len(spec.Mounts)),
+	}
+	for _, command := range spec.Commands {
+		dry.Commands = append(dry.Commands, secrets.Redact(command))
+	}
+	for _, env := range spec.Env {
+		dry.Env = append(dry.Env, secrets.Redact(env))
+	}
+	sort.Strings(dry.Env)
+	for _, m := range spec.Mounts {
+		dry.Mounts = append(dry.Mounts, DryMount{Type: string(m.Type), Source: m.Source, Target: m.Target, ReadOnly: m.ReadOnly})
+	}
+	if len(spec.BindingPorts) > 0 {
+		dry.Ports = make(map[string][]string, len(spec.BindingPorts))
+		for port, bindings := range spec.BindingPorts {
+			hostPorts := make([]string, 0, len(bindings))
+			for _, binding := range bindings {
+				hostPorts = append(hostPorts, binding.HostIP+":"+binding.HostPort)
+			}
+			dry.Ports[string(port)] = hostPorts
+		}
+	}
+	return dry
+}
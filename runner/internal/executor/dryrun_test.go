@@ -0,0 +1,47 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/consts"
+	fakebackend "github.com/dstackai/dstack/runner/internal/backend/testing"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/internal/stream"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	configDir := t.TempDir()
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(configDir, consts.RUNNER_FILE_NAME), []byte("id: runner-1\n"), 0o644))
+	job := new(models.Job)
+	b := fakebackend.New(job, t.TempDir())
+	*job = *newFakeJob(t, b)
+	job.Apps = []models.App{{Name: "web", Port: 8080}}
+	job.Environment = map[string]string{"HF_TOKEN": "${{ secrets.HF_TOKEN }}"}
+	b.SetSecret("HF_TOKEN", "hf_secret_value")
+	client := container.NewFakeClient()
+	ex := NewWithEngine(b, container.NewEngineWithClient(client))
+	ex.SetStreamLogs(stream.New(0))
+	ex.SetDryRun()
+	assert.Equal(t, nil, ex.Init(context.Background(), configDir))
+
+	var out bytes.Buffer
+	assert.Equal(t, nil, ex.DryRun(context.Background(), &out))
+	assert.False(t, strings.Contains(out.String(), "hf_secret_value"))
+	var spec DrySpec
+	assert.Equal(t, nil, json.Unmarshal(out.Bytes(), &spec))
+	assert.Equal(t, "ubuntu:22.04", spec.Image)
+	assert.Contains(t, spec.Env, "HF_TOKEN=***")
+	assert.Contains(t, spec.Ports, "8080/tcp")
+	assert.Equal(t, 0, len(client.Created()))
+	// the ports and the logs port are resolved in memory, neither the job nor the capabilities are written
+	assert.Equal(t, 0, b.Updates())
+	assert.Equal(t, 0, b.Puts())
+}
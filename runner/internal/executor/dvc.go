@@ -0,0 +1,86 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/joblog"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// dvcTailLines are the last lines of the dvc output kept for the failure
+const dvcTailLines = 20
+
+// pullDVC materializes the DVC-tracked data of the repo in /workflow before the job commands start
+func (ex *Executor) pullDVC(ctx context.Context, job *models.Job) error {
+	config := job.DVC
+	secrets, err := ex.fetchSecrets(ctx)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	// the remote may be public, the secrets are optional
+	env := []string{"HOME=/tmp"}
+	for _, name := range config.Secrets {
+		value, ok := secrets[name]
+		if !ok {
+			return gerrors.Newf("no secret %s for dvc pull", name)
+		}
+		ex.logSecrets.Add(value)
+		env = append(env, fmt.Sprintf("%s=%s", name, value))
+	}
+	image := config.Image
+	if image == "" {
+		image = consts.DVC_IMAGE
+	}
+	spec := &container.HelperSpec{
+		Image:      image,
+		Commands:   []string{dvcPullCommand(config)},
+		Env:        env,
+		WorkingDir: path.Join("/workflow", job.WorkingDir),
+		Mounts: []mount.Mount{{
+			Type:   mount.TypeBind,
+			Source: ex.repoDir(ctx),
+			Target: "/workflow",
+		}},
+	}
+	// the pulled files are owned by the runner like the repo, the job container user gets them with the inputs
+	if runtime.GOOS == "linux" {
+		spec.User = fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+	}
+	ctx, cancel := context.WithTimeout(ctx, consts.DVC_PULL_TIMEOUT)
+	defer cancel()
+	log.Info(ctx, "Pulling the DVC data", "image", image, "remote", config.Remote)
+	tail := joblog.NewTail(dvcTailLines)
+	output := joblog.NewMaskWriter(tail, ex.logSecrets)
+	err = ex.engine.RunHelper(ctx, spec, output)
+	_ = output.Flush()
+	if err != nil {
+		return gerrors.Newf("dvc pull failed: %v\n%s", err, strings.Join(tail.Lines(), "\n"))
+	}
+	log.Trace(ctx, "DVC data is pulled", "output", strings.Join(tail.Lines(), "\n"))
+	return nil
+}
+
+func dvcPullCommand(config *models.DVC) string {
+	args := []string{"dvc", "pull"}
+	if config.Remote != "" {
+		args = append(args, "--remote", shellQuote(config.Remote))
+	}
+	for _, target := range config.Targets {
+		args = append(args, shellQuote(target))
+	}
+	return strings.Join(args, " ")
+}
+
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
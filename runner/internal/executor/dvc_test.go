@@ -0,0 +1,16 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDVCPullCommand(t *testing.T) {
+	assert.Equal(t, "dvc pull", dvcPullCommand(&models.DVC{}))
+	assert.Equal(t, "dvc pull --remote 'storage' 'data/train' 'it'\\''s.dvc'", dvcPullCommand(&models.DVC{
+		Remote:  "storage",
+		Targets: []string{"data/train", "it's.dvc"},
+	}))
+}
@@ -0,0 +1,107 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// envFilesDir is in memory if the host has /dev/shm, the files are removed when the job ends
+func (ex *Executor) envFilesDir(ctx context.Context) string {
+	job := ex.backend.Job(ctx)
+	if info, err := os.Stat(path.Dir(consts.ENV_FILES_DIR)); err == nil && info.IsDir() {
+		return path.Join(consts.ENV_FILES_DIR, job.JobID)
+	}
+	return filepath.Join(ex.backend.GetTMPDir(ctx), consts.RUNS_DIR, job.RunName, "env-files")
+}
+
+// renderEnvFiles writes the env files of the job and returns their read-only mounts
+func (ex *Executor) renderEnvFiles(ctx context.Context, interpolator *VariablesInterpolator, secrets map[string]string) ([]mount.Mount, error) {
+	job := ex.backend.Job(ctx)
+	if len(job.EnvFiles) == 0 {
+		return nil, nil
+	}
+	dir := ex.envFilesDir(ctx)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	repoDir := ex.repoDir(ctx)
+	mounts := make([]mount.Mount, 0, len(job.EnvFiles))
+	for i, envFile := range job.EnvFiles {
+		contents, err := renderEnvFile(ctx, repoDir, envFile, interpolator, secrets)
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		for _, name := range envFile.Secrets {
+			ex.logSecrets.Add(secrets[name])
+		}
+		file := filepath.Join(dir, fmt.Sprintf("%d.env", i))
+		if err = writePrivateFile(file, contents); err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		target := envFile.Path
+		if !path.IsAbs(target) {
+			target = path.Join("/workflow", job.WorkingDir, target)
+		}
+		mounts = append(mounts, mount.Mount{Type: mount.TypeBind, Source: file, Target: target, ReadOnly: true})
+	}
+	return mounts, nil
+}
+
+// renderEnvFile interpolates the source file, it can't be outside of the repo dir, and appends the secrets
+func renderEnvFile(ctx context.Context, repoDir string, envFile models.EnvFile, interpolator *VariablesInterpolator, secrets map[string]string) ([]byte, error) {
+	var sb strings.Builder
+	if envFile.Source != "" {
+		source, err := os.ReadFile(filepath.Join(repoDir, filepath.Clean("/"+envFile.Source)))
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		rendered, err := interpolator.Interpolate(ctx, string(source))
+		if err != nil {
+			return nil, gerrors.Newf("failed rendering %s: %v", envFile.Source, err)
+		}
+		sb.WriteString(rendered)
+		if rendered != "" && !strings.HasSuffix(rendered, "\n") {
+			sb.WriteByte('\n')
+		}
+	}
+	for _, name := range envFile.Secrets {
+		value, ok := secrets[name]
+		if !ok {
+			return nil, gerrors.Newf("secret %s of %s is missing", name, envFile.Path)
+		}
+		sb.WriteString(name + "=" + dotenvValue(value) + "\n")
+	}
+	return []byte(sb.String()), nil
+}
+
+// dotenvValue quotes the value literally if it can, the dotenv parsers don't expand the single-quoted values
+func dotenvValue(value string) string {
+	if !strings.ContainsAny(value, "'\n\r") {
+		return "'" + value + "'"
+	}
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`, "$", `\$`)
+	return `"` + replacer.Replace(value) + `"`
+}
+
+// processSecrets are the secrets passed in the container env, the ones of the env files are left out
+func processSecrets(job *models.Job, secrets map[string]string) map[string]string {
+	result := make(map[string]string, len(secrets))
+	for k, v := range secrets {
+		result[k] = v
+	}
+	for _, envFile := range job.EnvFiles {
+		for _, name := range envFile.Secrets {
+			delete(result, name)
+		}
+	}
+	return result
+}
@@ -0,0 +1,37 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderEnvFile(t *testing.T) {
+	repoDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(repoDir, ".env.template"), []byte("DB_URL=${{ secrets.db_url }}\nMODE=${env.MODE:-dev}"), 0600)
+	assert.Equal(t, nil, err)
+	secrets := map[string]string{"db_url": "postgres://db", "token": "it's\n$x"}
+	var vi VariablesInterpolator
+	vi.Add("secrets", secrets)
+	vi.Add("env", map[string]string{})
+
+	contents, err := renderEnvFile(context.Background(), repoDir, models.EnvFile{
+		Path:    ".env",
+		Source:  "../.env.template",
+		Secrets: []string{"db_url", "token"},
+	}, &vi, secrets)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "DB_URL=postgres://db\nMODE=dev\ndb_url='postgres://db'\ntoken=\"it's\\n\\$x\"\n", string(contents))
+
+	_, err = renderEnvFile(context.Background(), repoDir, models.EnvFile{Path: ".env", Secrets: []string{"missing"}}, &vi, secrets)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestProcessSecrets(t *testing.T) {
+	job := &models.Job{EnvFiles: []models.EnvFile{{Path: ".env", Secrets: []string{"token"}}}}
+	assert.Equal(t, map[string]string{"user": "u"}, processSecrets(job, map[string]string{"user": "u", "token": "t"}))
+}
@@ -0,0 +1,65 @@
+package executor
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/control"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// setRunning sets the job container the exec sessions attach to, nil once it exits
+func (ex *Executor) setRunning(docker *container.DockerRuntime, spec *container.Spec) {
+	ex.runningMu.Lock()
+	defer ex.runningMu.Unlock()
+	ex.running, ex.runningSpec = docker, spec
+}
+
+func (ex *Executor) runningContainer() (*container.DockerRuntime, error) {
+	ex.runningMu.Lock()
+	defer ex.runningMu.Unlock()
+	if ex.running == nil {
+		return nil, gerrors.New("the job container is not running")
+	}
+	return ex.running, nil
+}
+
+// Exec starts a process in the running job container for the control API and the SSH sessions
+func (ex *Executor) Exec(ctx context.Context, req *control.ExecRequest) (control.ExecSession, error) {
+	docker, err := ex.runningContainer()
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	session, err := docker.Exec(ctx, req.Cmd, container.ExecOptions{
+		User:       req.User,
+		Env:        req.Env,
+		WorkingDir: req.WorkingDir,
+		TTY:        req.TTY,
+		Rows:       req.Rows,
+		Cols:       req.Cols,
+	})
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return session, nil
+}
+
+// DialContainer connects to a port of the running job container for the SSH port forwarding
+func (ex *Executor) DialContainer(ctx context.Context, port int) (net.Conn, error) {
+	docker, err := ex.runningContainer()
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	addr, err := docker.Address(ctx)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return conn, nil
+}
@@ -2,6 +2,7 @@ package executor
 
 import (
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -10,30 +11,47 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/internal/retry"
 	"github.com/dustin/go-humanize"
 
 	localbackend "github.com/dstackai/dstack/runner/internal/backend/local"
 
 	"github.com/docker/docker/api/types"
 
-	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/go-connections/nat"
 	"github.com/dstackai/dstack/runner/consts"
 	"github.com/dstackai/dstack/runner/consts/errorcodes"
 	"github.com/dstackai/dstack/runner/consts/states"
 	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/artifacts/client"
 	"github.com/dstackai/dstack/runner/internal/backend"
+	"github.com/dstackai/dstack/runner/internal/compress"
 	"github.com/dstackai/dstack/runner/internal/container"
 	"github.com/dstackai/dstack/runner/internal/environment"
+	"github.com/dstackai/dstack/runner/internal/gateway"
 	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/githubapp"
+	"github.com/dstackai/dstack/runner/internal/gpu"
+	"github.com/dstackai/dstack/runner/internal/joblog"
 	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/logsink"
 	"github.com/dstackai/dstack/runner/internal/ports"
+	"github.com/dstackai/dstack/runner/internal/registryauth"
 	"github.com/dstackai/dstack/runner/internal/repo"
+	"github.com/dstackai/dstack/runner/internal/scaling"
+	"github.com/dstackai/dstack/runner/internal/secrets"
+	"github.com/dstackai/dstack/runner/internal/secrets/awssecrets"
 	"github.com/dstackai/dstack/runner/internal/stream"
+	"github.com/dstackai/dstack/runner/internal/tunnel"
 )
 
 type Executor struct {
@@ -41,28 +59,123 @@ type Executor struct {
 	configDir      string
 	config         *Config
 	engine         *container.Engine
-	cacheArtifacts []artifacts.Artifacter
+	cacheArtifacts []cacheArtifact
 	artifactsIn    []artifacts.Artifacter
 	artifactsOut   []artifacts.Artifacter
 	artifactsFUSE  []artifacts.Artifacter
+	datasets       []datasetArtifact
 	repo           *repo.Manager
 	portID         string
 	streamLogs     *stream.Server
 	stoppedCh      chan struct{}
+	// gateway serves the model service jobs, nil if not configured
+	gateway *gateway.Server
+	// meter counts the requests of the app proxy and the gateway
+	meter *scaling.Meter
+
+	secretProviders []secrets.Provider
+	secretRefs      *awssecrets.Resolver
+	logSecrets      *joblog.Secrets
+
+	tunnel *tunnel.Tunnel
+	// githubApp mints the repo tokens for the github_app credentials
+	githubApp *githubapp.TokenSource
+	// registryTokens mints the credentials of the cloud registries
+	registryTokens *registryauth.Minter
+	// machine validates and records the job status transitions
+	machine stateMachine
+	// logTail keeps the last job log lines for the failure summary
+	logTail *joblog.Tail
+	// webhook delivers the job status transitions, nil if not configured
+	webhook *webhookSender
+	// timings accumulates the phase durations of the job
+	timings phaseTimings
+	// startedAt is when Run started, the cost is estimated since then
+	startedAt time.Time
+	// running is the job container of the exec sessions and the file sync, nil if it is not running
+	running     *container.DockerRuntime
+	runningSpec *container.Spec
+	runningMu   sync.Mutex
+	// stateDegraded is set while the job state can't be written
+	stateDegraded atomic.Bool
+	// ready is set once Init accepted the job
+	ready atomic.Bool
+	// preempted ends the stopped job as preempted
+	preempted atomic.Bool
+	// interrupted is set once the instance of the job with a checkpoint is interrupted
+	interrupted atomic.Bool
+	// volumes are the persistent volumes attached for the job
+	volumes []*attachedVolume
+	// trackingEnv attaches the job code to the linked tracker runs
+	trackingEnv map[string]string
+	// transfer tunes the S3 transfers of the artifacts and the build diffs
+	transfer client.Options
+	// backoff retries the backend calls
+	backoff retry.Policy
+	// repoDiffSum is the sha256 of the diff applied on top of the repo commit
+	repoDiffSum string
+	// buildDigest names the build image of the job
+	buildDigest string
+	// selfUpdate replaces the runner with the version pinned by the job, the single job runners only do
+	selfUpdate bool
+	// dryRun applies the job changes in memory only, neither the job state nor the capabilities are written
+	dryRun bool
+	// stateQueue holds the job changes not written while the backend is unreachable, guarded by jobMu
+	stateQueue stateQueue
+	// jobMu serializes the job updates and state writes of runJob, the heartbeat, the GPU stats and the control API
+	jobMu sync.Mutex
+
+	// slot confines the executor to a share of the host in the pool mode
+	slot                 *Slot
+	slotIndex, slotCount int
 }
 
 func New(b backend.Backend) *Executor {
+	return NewWithEngine(b, container.NewEngine())
+}
+
+// NewWithEngine is the executor running the jobs on engine, e.g. the one of a fake daemon in the tests
+func NewWithEngine(b backend.Backend, engine *container.Engine) *Executor {
 	return &Executor{
-		backend:   b,
-		engine:    container.NewEngine(),
-		stoppedCh: make(chan struct{}),
+		backend:        b,
+		engine:         engine,
+		stoppedCh:      make(chan struct{}),
+		logSecrets:     joblog.NewSecrets(),
+		registryTokens: registryauth.New(),
+		meter:          scaling.NewMeter(),
 	}
 }
 
+func (ex *Executor) Meter() *scaling.Meter {
+	return ex.meter
+}
+
+// NewSlot returns the executor of the index-th slot out of count of a runner pool
+func NewSlot(b backend.Backend, slot Slot, index, count int) *Executor {
+	ex := New(b)
+	ex.slot = &slot
+	ex.slotIndex, ex.slotCount = index, count
+	return ex
+}
+
 func (ex *Executor) SetStreamLogs(w *stream.Server) {
 	ex.streamLogs = w
 }
 
+func (ex *Executor) SetGateway(g *gateway.Server) {
+	ex.gateway = g
+}
+
+// AllowSelfUpdate makes Init return UpdateRequired once the runner version pinned by the job is installed
+func (ex *Executor) AllowSelfUpdate() {
+	ex.selfUpdate = true
+}
+
+// SetDryRun keeps the stored job and the capabilities as they are, see DryRun
+func (ex *Executor) SetDryRun() {
+	ex.dryRun = true
+}
+
 func (ex *Executor) Init(ctx context.Context, configDir string) error {
 	defer func() {
 		if r := recover(); r != nil {
@@ -76,39 +189,84 @@ func (ex *Executor) Init(ctx context.Context, configDir string) error {
 	if err != nil {
 		return err
 	}
-	attemts := 0
-	for attemts < consts.MAX_ATTEMPTS {
-		err = ex.backend.Init(ctx, ex.config.Id)
-		if err != nil && !errors.Is(err, backend.ErrNotFoundTask) {
-			panic(err)
-		}
-		if err == nil {
-			break
+	if ex.slot != nil {
+		ex.config = ex.config.forSlot(*ex.slot, ex.slotIndex, ex.slotCount)
+	}
+	if err = ex.initSecretProviders(); err != nil {
+		return gerrors.Wrap(err)
+	}
+	if ex.config.Proxy != nil && ex.engine != nil && !ex.engine.HasProxy() {
+		log.Warning(ctx, "The Docker daemon has no proxy, the images are pulled directly")
+	}
+	if ex.config.Registries != nil && ex.engine != nil {
+		ex.engine.CheckInsecureRegistries(ctx, ex.config.Registries.Insecure)
+	}
+	if ex.config.Webhook != nil {
+		ex.webhook = newWebhookSender(ex.config.Webhook)
+		ex.machine.listen(ex.webhook.transition)
+	}
+	ex.transfer = ex.config.Transfer.options()
+	ex.backoff = ex.config.Retry.policy()
+	if transfers, ok := ex.backend.(backend.Transfers); ok && ex.config.Transfer != nil {
+		if err = transfers.SetTransfer(ctx, ex.transfer); err != nil {
+			return gerrors.Wrap(err)
 		}
-		attemts++
-		time.Sleep(consts.DELAY_TRY)
 	}
-	if attemts == consts.MAX_ATTEMPTS {
-		return err
+	// the task of the runner may not be registered yet, the other errors are transient API ones too
+	if err = ex.backoff.Do(ctx, "init", func() error {
+		return ex.backend.Init(ctx, ex.config.Id)
+	}); err != nil {
+		return gerrors.Wrap(err)
+	}
+	if err = ex.updateRunner(ctx); err != nil {
+		return gerrors.Wrap(err)
+	}
+	if !ex.dryRun {
+		if err = ex.advertise(ctx); err != nil {
+			log.Warning(ctx, "Failed to advertise the runner capabilities", "err", err)
+		}
 	}
 
 	job := ex.backend.Job(ctx)
 
 	//Update port logs
 	if ex.streamLogs != nil {
-		job.Environment["WS_LOGS_PORT"] = strconv.Itoa(ex.streamLogs.Port())
-		if err = ex.backend.UpdateState(ctx); err != nil {
+		err = ex.updateJob(ctx, func(job *models.Job) {
+			job.Environment["WS_LOGS_PORT"] = strconv.Itoa(ex.streamLogs.Port())
+		})
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	if job.DevEnvironment != nil {
+		if err = ex.prepareDevEnvironment(ctx); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	if ex.config.AppProxy != nil {
+		if err = ex.prepareAppProxy(ctx); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	if job.ModelService != nil {
+		if err = ex.prepareModelService(ctx); err != nil {
 			return gerrors.Wrap(err)
 		}
 	}
 
+	pathInterpolator := ex.pathInterpolator(ctx)
 	for _, artifact := range job.Artifacts {
-		artOut := ex.backend.GetArtifact(ctx, job.RunName, artifact.Path, path.Join("artifacts", job.RepoId, job.JobID, artifact.Path), artifact.Mount)
+		artifactPath, err := pathInterpolator.Interpolate(ctx, artifact.Path)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		remotePath := path.Join("artifacts", job.RepoId, job.JobID, artifactPath)
+		artOut := ex.withChecksums(ex.getArtifact(ctx, job.RunName, artifactPath, remotePath, artifact.Mount), remotePath, artifact.Mount)
 		if artOut != nil {
 			ex.artifactsOut = append(ex.artifactsOut, artOut)
 		}
-		if artifact.Mount {
-			art := ex.backend.GetArtifact(ctx, job.RunName, artifact.Path, path.Join("artifacts", job.RepoId, job.JobID, artifact.Path), artifact.Mount)
+		if artifact.Mount && ex.config.Artifacts == nil {
+			art := ex.backendArtifact(ctx, job.RunName, artifactPath, remotePath, artifact.Mount)
 			if art != nil {
 				ex.artifactsFUSE = append(ex.artifactsFUSE, art)
 			}
@@ -117,6 +275,7 @@ func (ex *Executor) Init(ctx context.Context, configDir string) error {
 
 	cloudLog := ex.backend.CreateLogger(ctx, fmt.Sprintf("/dstack/runners/%s", ex.backend.Bucket(ctx)), job.RunnerID)
 	log.SetCloudLogger(cloudLog)
+	ex.ready.Store(true)
 	return nil
 }
 
@@ -125,79 +284,247 @@ func (ex *Executor) Run(ctx context.Context) error {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Error(runCtx, "[PANIC]", "", r)
-			job, _ := ex.backend.RefetchJob(runCtx)
-			job.Status = states.Failed
-			_ = ex.backend.UpdateState(runCtx)
+			_ = ex.refetchJob(runCtx, func(job *models.Job) {
+				ex.machine.transit(runCtx, job, states.Failed)
+			})
 			time.Sleep(1 * time.Second)
 			panic(r)
 		}
 	}()
+	// the final status is delivered before the instance is shut down
+	defer ex.webhook.close(runCtx)
+	startedAt := time.Now()
+	ex.startedAt = startedAt
+	defer ex.notifyEnd(runCtx, startedAt)
+	// the final status may still be queued
+	defer ex.drainState(runCtx)
+	watchCtx, cancelWatch := context.WithCancel(runCtx)
+	defer cancelWatch()
+	stopRequestCh, err := backend.WatchStop(watchCtx, ex.backend, consts.DELAY_READ_STATUS)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	go ex.heartbeat(watchCtx)
+	go ex.reportCost(watchCtx)
 	erCh := make(chan error)
 	go ex.runJob(runCtx, erCh, ex.stoppedCh)
-	timer := time.NewTicker(consts.DELAY_READ_STATUS)
 	for {
 		select {
-		case <-timer.C:
-			stopped, err := ex.backend.CheckStop(runCtx)
-			if err != nil {
-				return err
-			}
-			if stopped {
-				log.Info(runCtx, "Stopped")
-				ex.Stop()
-				log.Info(runCtx, "Waiting job end")
-				errRun := <-erCh
-				job, err := ex.backend.RefetchJob(runCtx)
-				if err != nil {
+		case <-stopRequestCh:
+			return ex.waitStopped(runCtx, erCh)
+		case <-ex.stoppedCh: // stopped over the control API
+			return ex.waitStopped(runCtx, erCh)
+		case <-ctx.Done():
+			return ex.waitStopped(runCtx, erCh)
+		case errRun := <-erCh:
+			if errRun == nil {
+				if err = ex.refetchJob(runCtx, func(job *models.Job) {
+					ex.machine.transit(runCtx, job, states.Done)
+				}); err != nil {
 					return gerrors.Wrap(err)
 				}
-				job.Status = states.Stopped
-				_ = ex.backend.UpdateState(runCtx)
-				return errRun
+				return nil
 			}
-		case <-ctx.Done():
-			log.Info(runCtx, "Stopped")
-			ex.Stop()
-			log.Info(runCtx, "Waiting job end")
-			errRun := <-erCh
-			job, err := ex.backend.RefetchJob(runCtx)
-			if err != nil {
-				return gerrors.Wrap(err)
+			stoppedByExit := &ExitStoppedError{}
+			if errors.As(errRun, stoppedByExit) {
+				if err = ex.refetchJob(runCtx, func(job *models.Job) {
+					if ex.machine.transit(runCtx, job, states.Stopped) {
+						job.ContainerExitCode = fmt.Sprintf("%d", stoppedByExit.ExitCode)
+					}
+				}); err != nil {
+					return gerrors.Wrap(err)
+				}
+				return nil
 			}
-			job.Status = states.Stopped
-			_ = ex.backend.UpdateState(runCtx)
-			return errRun
-		case errRun := <-erCh:
-			job, err := ex.backend.RefetchJob(runCtx)
+			// The container may fail due to instance interruption.
+			// In this case we'll let the CLI/hub update the job state accodingly.
+			isInterrupted, err := ex.backend.IsInterrupted(runCtx)
 			if err != nil {
-				return gerrors.Wrap(err)
+				log.Error(runCtx, "Failed to check if spot was interrupted", "err", err)
+			} else if isInterrupted {
+				log.Trace(runCtx, "Spot was interrupted")
+				if err = ex.refetchJob(runCtx, func(job *models.Job) {
+					job.Result = ex.runResult(runCtx, job, errRun, true)
+				}); err != nil {
+					log.Error(runCtx, "Failed to write the run result", "err", err)
+				}
+				return nil
 			}
-			if errRun == nil {
-				job.Status = states.Done
-			} else {
-				// The container may fail due to instance interruption.
-				// In this case we'll let the CLI/hub update the job state accodingly.
-				isInterrupted, err := ex.backend.IsInterrupted(runCtx)
-				if err != nil {
-					log.Error(runCtx, "Failed to check if spot was interrupted", "err", err)
-				} else if isInterrupted {
-					log.Trace(runCtx, "Spot was interrupted")
-					return nil
+			log.Error(runCtx, "Failed run", "err", errRun)
+			if err = ex.refetchJob(runCtx, func(job *models.Job) {
+				if !ex.machine.transit(runCtx, job, states.Failed) {
+					return
 				}
-				log.Error(runCtx, "Failed run", "err", errRun)
-				job.Status = states.Failed
+				job.Result = ex.runResult(runCtx, job, errRun, false)
 				containerExitedError := &container.ContainerExitedError{}
 				if errors.As(errRun, containerExitedError) {
 					job.ErrorCode = errorcodes.ContainerExitedWithError
 					job.ContainerExitCode = fmt.Sprintf("%d", containerExitedError.ExitCode)
+					if containerExitedError.OOMKilled {
+						job.ErrorCode = errorcodes.ContainerOOM
+					}
+				}
+				if errors.As(errRun, &ChecksumMismatchError{}) {
+					job.ErrorCode = errorcodes.ChecksumMismatch
 				}
+				if errors.As(errRun, &NoDiskSpaceError{}) {
+					job.ErrorCode = errorcodes.NoDiskSpace
+				}
+				if errors.As(errRun, &ImageSignatureError{}) {
+					job.ErrorCode = errorcodes.ImageSignatureInvalid
+				}
+				if errors.As(errRun, &WorkingDirError{}) {
+					job.ErrorCode = errorcodes.WorkingDirInvalid
+				}
+				if errors.As(errRun, &EmulationError{}) {
+					job.ErrorCode = errorcodes.PlatformEmulated
+				}
+			}); err != nil {
+				return gerrors.Wrap(err)
 			}
-			_ = ex.backend.UpdateState(runCtx)
 			return errRun
 		}
 	}
 }
 
+// waitStopped stops the job, waits for runJob to return and marks the job stopped
+func (ex *Executor) waitStopped(ctx context.Context, erCh chan error) error {
+	log.Info(ctx, "Stopped")
+	ex.Stop()
+	log.Info(ctx, "Waiting job end")
+	errRun := <-erCh
+	if ex.interrupted.Load() {
+		// the CLI/hub updates the state of the interrupted jobs
+		if err := ex.refetchJob(ctx, func(job *models.Job) {
+			job.Result = ex.runResult(ctx, job, errRun, true)
+		}); err != nil {
+			return gerrors.Wrap(err)
+		}
+		return nil
+	}
+	status := states.Stopped
+	if ex.preempted.Load() {
+		status = states.Preempted
+	}
+	if err := ex.refetchJob(ctx, func(job *models.Job) {
+		ex.machine.transit(ctx, job, status)
+	}); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return errRun
+}
+
+// heartbeat renews the runner lease until ctx is done
+func (ex *Executor) heartbeat(ctx context.Context) {
+	interval := ex.config.Heartbeat()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := ex.updateJob(ctx, func(job *models.Job) {
+			job.HeartbeatAt = uint64(time.Now().UnixMilli())
+			job.LeaseTTL = int(interval.Seconds()) * consts.LEASE_TTL_HEARTBEATS
+		})
+		if err != nil {
+			log.Error(ctx, "Failed to write heartbeat", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// JobSnapshot copies the job under the lock, so readers don't race with the job updates
+func (ex *Executor) JobSnapshot(ctx context.Context) models.Job {
+	ex.jobMu.Lock()
+	defer ex.jobMu.Unlock()
+	job := *ex.backend.Job(ctx)
+	job.GPUStats = append([]models.GPUStat(nil), job.GPUStats...)
+	if job.ContainerStats != nil {
+		stats := *job.ContainerStats
+		job.ContainerStats = &stats
+	}
+	if job.StatusTimes != nil {
+		statusTimes := make(map[string]uint64, len(job.StatusTimes))
+		for status, at := range job.StatusTimes {
+			statusTimes[status] = at
+		}
+		job.StatusTimes = statusTimes
+	}
+	return job
+}
+
+// updateJob applies change to the job and writes the state under the lock
+func (ex *Executor) updateJob(ctx context.Context, change func(job *models.Job)) error {
+	ex.jobMu.Lock()
+	defer ex.jobMu.Unlock()
+	change(ex.backend.Job(ctx))
+	return ex.writeState(ctx, change)
+}
+
+// refetchJob is updateJob on the job reread from the storage
+func (ex *Executor) refetchJob(ctx context.Context, change func(job *models.Job)) error {
+	ex.jobMu.Lock()
+	defer ex.jobMu.Unlock()
+	job, err := ex.backend.RefetchJob(ctx)
+	if err != nil {
+		if ex.config.maxOffline() == 0 {
+			return gerrors.Wrap(err)
+		}
+		log.Warning(ctx, "Failed to reread the job, the change is applied to the current one", "err", err)
+		job = ex.backend.Job(ctx)
+	}
+	change(job)
+	return ex.writeState(ctx, change)
+}
+
+// writeState retries the state write with a backoff. If the job file was changed meanwhile, e.g. by the hub,
+// the job is reread and change is applied again. The executor is degraded until a write succeeds, meanwhile
+// the changes are queued for up to maxOffline and the next writes flush them without waiting for the backoff.
+// Nothing is written in the dry run, the changes stay on the job in memory.
+func (ex *Executor) writeState(ctx context.Context, change func(job *models.Job)) error {
+	if ex.dryRun {
+		return nil
+	}
+	policy := ex.backoff.WithMaxElapsed(consts.UPDATE_STATE_MAX_ELAPSED)
+	if ex.stateQueue.offline() {
+		policy = retry.Policy{}
+	}
+	ex.stateQueue.push(change)
+	err := ex.flushState(ctx, policy)
+	if err == nil {
+		if ex.stateDegraded.Swap(false) {
+			log.Info(ctx, "Job state is written again")
+		}
+		return nil
+	}
+	if !ex.stateDegraded.Swap(true) {
+		log.Error(ctx, "Job state can't be written, the executor is degraded", "err", err)
+	}
+	if maxOffline := ex.config.maxOffline(); maxOffline > 0 {
+		if !ex.stateQueue.offline() {
+			ex.stateQueue.since = time.Now()
+			log.Warning(ctx, "Backend is unreachable, the job state updates are queued", "max_offline", maxOffline)
+		}
+		if time.Since(ex.stateQueue.since) < maxOffline {
+			return nil
+		}
+	}
+	return gerrors.Wrap(err)
+}
+
+// StateDegraded reports the last job state write has failed
+func (ex *Executor) StateDegraded() bool {
+	return ex.stateDegraded.Load()
+}
+
+func (ex *Executor) setStatus(ctx context.Context, status string) error {
+	return ex.updateJob(ctx, func(job *models.Job) {
+		ex.machine.transit(ctx, job, status)
+	})
+}
+
 func (ex *Executor) Stop() {
 	select {
 	case <-ex.stoppedCh:
@@ -207,47 +534,99 @@ func (ex *Executor) Stop() {
 	close(ex.stoppedCh)
 }
 
-func (ex *Executor) runJob(ctx context.Context, erCh chan error, stoppedCh chan struct{}) {
+func (ex *Executor) runJob(ctx context.Context, done chan error, stoppedCh chan struct{}) {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Error(ctx, "[PANIC]", "", r)
-			job := ex.backend.Job(ctx)
-			job.Status = states.Failed
-			_ = ex.backend.UpdateState(ctx)
+			_ = ex.updateJob(ctx, func(job *models.Job) {
+				ex.machine.transit(ctx, job, states.Failed)
+			})
 			time.Sleep(1 * time.Second)
 			panic(r)
 		}
 	}()
+	// the mounts are released on every return before the result is passed to done
+	var mounted []artifacts.Artifacter
+	erCh := make(chan error, 1)
+	defer func() {
+		var errRelease error
+		for i := len(mounted) - 1; i >= 0; i-- {
+			if err := mounted[i].AfterRun(ctx); err != nil {
+				log.Error(ctx, "Failed to release the mount", "err", err)
+				errRelease = err
+			}
+		}
+		if err := ex.detachVolumes(ctx); err != nil {
+			errRelease = err
+		}
+		select {
+		case err := <-erCh:
+			if err == nil && errRelease != nil {
+				err = gerrors.Wrap(errRelease)
+			}
+			ex.saveRunSummary(ctx)
+			done <- err
+		default: // panicking
+		}
+	}()
 	job := ex.backend.Job(ctx)
+	ex.renewSecrets(ctx, stoppedCh)
 	jctx := log.AppendArgsCtx(ctx,
 		"run_name", job.RunName,
 		"job_id", job.JobID,
 		"workflow", job.WorkflowName,
 	)
 	if ex.config.Hostname != nil {
+		ex.jobMu.Lock()
 		job.HostName = *ex.config.Hostname
+		ex.jobMu.Unlock()
 	}
+	ex.applyPlatform(jctx, job)
 
 	var err error
-	switch job.RepoType {
-	case "remote":
-		log.Trace(jctx, "Fetching git repository")
-		if err = ex.prepareGit(jctx); err != nil {
-			erCh <- gerrors.Wrap(err)
-			return
-		}
-	case "local":
-		log.Trace(jctx, "Fetching tar archive")
-		if err = ex.prepareArchive(jctx); err != nil {
-			erCh <- gerrors.Wrap(err)
-			return
+	if err = ex.checkDiskSpace(jctx); err != nil {
+		erCh <- gerrors.Wrap(err)
+		return
+	}
+	workflowKept, err := ex.attachVolumes(jctx)
+	if err != nil {
+		erCh <- gerrors.Wrap(err)
+		return
+	}
+	cloneStart := time.Now()
+	if workflowKept {
+		log.Info(jctx, "Keeping the workflow dir of the volume")
+	} else {
+		switch job.RepoType {
+		case "remote":
+			log.Trace(jctx, "Fetching git repository")
+			if err = ex.prepareGit(jctx); err != nil {
+				erCh <- gerrors.Wrap(err)
+				return
+			}
+		case "local":
+			log.Trace(jctx, "Fetching tar archive")
+			if err = ex.prepareArchive(jctx); err != nil {
+				erCh <- gerrors.Wrap(err)
+				return
+			}
+		default:
+			log.Error(jctx, "Unknown RepoType", "RepoType", job.RepoType)
 		}
-	default:
-		log.Error(jctx, "Unknown RepoType", "RepoType", job.RepoType)
 	}
+	if err = ex.prepareExtraRepos(jctx); err != nil {
+		erCh <- gerrors.Wrap(err)
+		return
+	}
+	if err = ex.prepareWorkingDir(jctx); err != nil {
+		erCh <- gerrors.Wrap(err)
+		return
+	}
+	ex.timings.since(phaseClone, cloneStart)
 
 	if job.BuildPolicy != models.BuildOnly {
 		log.Trace(jctx, "Dependency processing")
+		downloadStart := time.Now()
 		if err = ex.processCache(jctx); err != nil {
 			erCh <- gerrors.Wrap(err)
 			return
@@ -256,18 +635,21 @@ func (ex *Executor) runJob(ctx context.Context, erCh chan error, stoppedCh chan
 			erCh <- gerrors.Wrap(err)
 			return
 		}
+		if err = ex.processDatasets(jctx); err != nil {
+			erCh <- gerrors.Wrap(err)
+			return
+		}
 		for _, artifact := range ex.artifactsFUSE {
 			err = artifact.BeforeRun(jctx)
 			if err != nil {
 				erCh <- gerrors.Wrap(err)
 				return
 			}
+			mounted = append(mounted, artifact)
 		}
-		if len(ex.artifactsIn) > 0 || len(ex.cacheArtifacts) > 0 {
+		if len(ex.artifactsIn) > 0 || len(ex.cacheArtifacts) > 0 || len(ex.datasets) > 0 {
 			log.Trace(jctx, "Start downloading artifacts")
-			job.Status = states.Downloading
-			err = ex.backend.UpdateState(jctx)
-			if err != nil {
+			if err = ex.setStatus(jctx, states.Downloading); err != nil {
 				erCh <- gerrors.Wrap(err)
 				return
 			}
@@ -285,109 +667,291 @@ func (ex *Executor) runJob(ctx context.Context, erCh chan error, stoppedCh chan
 					return
 				}
 			}
+			for _, dataset := range ex.datasets {
+				err = dataset.BeforeRun(jctx)
+				if err != nil {
+					erCh <- gerrors.Wrap(err)
+					return
+				}
+				mounted = append(mounted, dataset)
+			}
+		}
+		ex.timings.since(phaseDownload, downloadStart)
+		var downloaded int64
+		for _, artifact := range ex.artifactsIn {
+			downloaded += transferSize(artifact)
+		}
+		for _, artifact := range ex.cacheArtifacts {
+			if artifact.restore != nil {
+				downloaded += transferSize(artifact)
+			}
 		}
+		ex.timings.transferred(downloaded, 0)
 	}
 
-	credPath := path.Join(ex.backend.GetTMPDir(ctx), consts.RUNS_DIR, job.RunName, "credentials")
+	if err = ex.prepareOutputs(jctx, job); err != nil {
+		erCh <- gerrors.Wrap(err)
+		return
+	}
+	if job.DVC != nil {
+		if err = ex.pullDVC(jctx, job); err != nil {
+			erCh <- gerrors.Wrap(err)
+			return
+		}
+	}
+	ex.linkTracking(jctx, job)
+	credPath := ex.credentialsPath(ctx)
 	spec, err := ex.newSpec(ctx, credPath)
 	if err != nil {
+		_ = os.RemoveAll(ex.envFilesDir(ctx))
 		erCh <- gerrors.Wrap(err)
 		return
 	}
+	credsDone := make(chan struct{})
+	credsRefreshed := make(chan struct{})
 	defer func() { // cleanup credentials
+		close(credsDone)
+		<-credsRefreshed
 		_ = os.Remove(credPath)
+		_ = os.Remove(netrcPath(credPath))
+		_ = os.RemoveAll(ex.envFilesDir(ctx))
+	}()
+	go func() {
+		defer close(credsRefreshed)
+		if ex.githubApp != nil {
+			ex.refreshGitHubAppToken(ctx, credPath, credsDone)
+		}
 	}()
 
-	logger := ex.backend.CreateLogger(ctx, fmt.Sprintf("/dstack/jobs/%s/%s", ex.backend.Bucket(ctx), job.RepoId), job.RunName)
 	logGroup := fmt.Sprintf("/jobs/%s", job.RepoId)
-	fileLog, err := createLocalLog(filepath.Join(ex.configDir, "logs", logGroup), job.RunName)
+	fileLog, err := ex.createLocalLog(filepath.Join(ex.configDir, "logs", logGroup), job.RunName)
 	if err != nil {
 		erCh <- gerrors.Wrap(err)
 		return
 	}
 	defer func() { _ = fileLog.Close() }()
-	allLogs := io.MultiWriter(logger, ex.streamLogs, fileLog)
+	sinks := logsink.Sinks(jctx, ex.config.LogSinks, map[string]string{
+		"job_id":    job.JobID,
+		"run_name":  job.RunName,
+		"repo_id":   job.RepoId,
+		"runner_id": job.RunnerID,
+	})
+	defer func() {
+		for _, sink := range sinks {
+			_ = sink.Close()
+		}
+	}()
+	persisted := append([]io.Writer{fileLog}, logsink.Writers(sinks)...)
+	if ex.config.LogSinks == nil || !ex.config.LogSinks.DisableBackend {
+		persisted = append(persisted, ex.backend.CreateLogger(ctx, fmt.Sprintf("/dstack/jobs/%s/%s", ex.backend.Bucket(ctx), job.RepoId), job.RunName))
+	}
+	var persistedLogs io.Writer = io.MultiWriter(persisted...)
+	var ansi *joblog.ANSIWriter
+	if ex.config.LogANSI == joblog.ANSIStrip || ex.config.LogANSI == joblog.ANSINormalize {
+		ansi = joblog.NewANSIWriter(persistedLogs, ex.config.LogANSI)
+		persistedLogs = ansi
+	}
+	var allLogs io.Writer = io.MultiWriter(ex.streamLogs, persistedLogs)
+	// JSON logs tag the demultiplexed streams, plain logs prefix the stderr lines
+	var errLogs io.Writer
+	var flushers []interface{ Flush() error }
+	if ex.config.LogFormat != LogFormatJSON {
+		stderr := joblog.NewPrefixWriter(allLogs, joblog.StderrPrefix)
+		errLogs = stderr
+		flushers = append(flushers, stderr)
+	} else {
+		formatter := joblog.NewJSONFormatter(allLogs, job.JobID, job.RunName)
+		stdout, stderr := formatter.Stream(joblog.Stdout), formatter.Stream(joblog.Stderr)
+		defer func() {
+			_ = stdout.Flush()
+			_ = stderr.Flush()
+		}()
+		allLogs, errLogs = stdout, stderr
+		flushers = append(flushers, stdout, stderr)
+	}
+	// secrets resolved later for sidecars and services are added to the same set
+	ex.logSecrets.Add(ex.secretValues(ctx)...)
+	ex.logTail = joblog.NewTail(consts.RESULT_LOG_LINES)
+	outMask := joblog.NewMaskWriter(io.MultiWriter(allLogs, ex.logTail), ex.logSecrets)
+	errMask := joblog.NewMaskWriter(io.MultiWriter(errLogs, ex.logTail), ex.logSecrets)
+	statusLogs := joblog.NewMaskWriter(ex.streamLogs, ex.logSecrets)
+	allLogs, errLogs = outMask, errMask
+	flushers = append([]interface{ Flush() error }{outMask, errMask, statusLogs}, flushers...)
+	if ansi != nil {
+		flushers = append(flushers, ansi)
+	}
+	// the output held back by the masks is written before the stream is closed
+	closeLogs := func() {
+		for _, f := range flushers {
+			if err := f.Flush(); err != nil {
+				log.Error(jctx, "Failed to flush the logs", "err", err)
+			}
+		}
+		ex.streamLogs.Close()
+	}
 
-	_, isLocalBackend := ex.backend.(*localbackend.Local)
-	if isLocalBackend {
-		err := ex.warnOnLongImagePull(ctx, job.Image)
-		if err != nil {
+	buildStart := time.Now()
+	if job.Dockerfile == "" {
+		log.Trace(jctx, "Pulling image", "image", spec.Image)
+		if err = ex.setStatus(jctx, states.Pulling); err != nil {
+			erCh <- gerrors.Wrap(err)
+			return
+		}
+		if err = ex.pullImage(ctx, spec, statusLogs); err != nil {
+			erCh <- gerrors.Wrap(err)
+			return
+		}
+		if err = ex.verifyImage(jctx, spec.Image); err != nil {
 			erCh <- gerrors.Wrap(err)
 			return
 		}
 	}
 
+	baseImage := spec.Image
 	log.Trace(ctx, "Building container", "mode", job.BuildPolicy)
-	job.Status = states.Building
-	if err = ex.backend.UpdateState(jctx); err != nil {
+	if err = ex.setStatus(jctx, states.Building); err != nil {
+		erCh <- gerrors.Wrap(err)
+		return
+	}
+	if err = ex.build(ctx, spec, stoppedCh, allLogs, statusLogs); err != nil {
 		erCh <- gerrors.Wrap(err)
 		return
 	}
-	if err = ex.build(ctx, spec, stoppedCh, allLogs); err != nil {
+	ex.timings.since(phaseBuild, buildStart)
+	if err = ex.checkEmulation(jctx, spec.Image, statusLogs); err != nil {
+		closeLogs()
 		erCh <- gerrors.Wrap(err)
 		return
 	}
 
 	if job.BuildPolicy == models.BuildOnly {
 		log.Trace(ctx, "Build only, do not run the job")
-		ex.streamLogs.Close()
+		closeLogs()
 		erCh <- nil
 		return
 	}
-	log.Trace(jctx, "Running job")
-	job.Status = states.Running
-	if err = ex.backend.UpdateState(jctx); err != nil {
+	ex.writeSnapshot(jctx, job, spec, baseImage)
+	if ex.config.Tunnel != nil {
+		ex.tunnel, err = ex.openTunnel(jctx)
+		if err != nil {
+			closeLogs()
+			erCh <- gerrors.Wrap(err)
+			return
+		}
+		defer func() { _ = ex.tunnel.Close() }()
+	}
+	// once the pre-run hooks are entered, the post-run hooks run on every exit path
+	var postRunOnce sync.Once
+	runPostRunHooks := func(jobErr error) {
+		postRunOnce.Do(func() { ex.runPostRunHooks(jctx, job, jobErr) })
+	}
+	defer func() { runPostRunHooks(err) }()
+	if err = ex.runPreRunHooks(jctx, job); err != nil {
+		closeLogs()
 		erCh <- gerrors.Wrap(err)
 		return
 	}
-	if err = ex.processJob(ctx, spec, stoppedCh, allLogs); err != nil {
+	ex.chownInputs(jctx, spec)
+	execStart := time.Now()
+	for attempt := 1; ; attempt++ {
+		log.Trace(jctx, "Running job", "attempt", attempt)
+		err = ex.updateJob(jctx, func(job *models.Job) {
+			ex.machine.transit(jctx, job, states.Running)
+			if job.ContainerRetry != nil {
+				job.Attempt = attempt
+			}
+		})
+		if err != nil {
+			closeLogs()
+			erCh <- gerrors.Wrap(err)
+			return
+		}
+		if len(job.Services) > 0 {
+			err = ex.processServices(ctx, spec, stoppedCh, allLogs)
+		} else {
+			err = ex.processJob(ctx, spec, stoppedCh, allLogs, errLogs)
+		}
+		if !shouldRetry(job.ContainerRetry, job.ExitCodes, attempt, err) {
+			break
+		}
+		backoff := retryBackoff(job.ContainerRetry, attempt)
+		log.Info(jctx, "Retrying failed container", "attempt", attempt, "backoff", backoff, "err", err)
+		if _, errLog := fmt.Fprintf(statusLogs, "\nAttempt %d failed: %v. Retrying in %s...\n\n", attempt, err, backoff); errLog != nil {
+			log.Error(jctx, "Failed to write to the log stream", "err", errLog)
+		}
+		select {
+		case <-stoppedCh:
+		case <-time.After(backoff):
+			continue
+		}
+		break
+	}
+	ex.timings.since(phaseExec, execStart)
+	closeLogs()
+	log.Info(ctx, "Docker log stream closed")
+	ex.chownOutputs(jctx, spec)
+	ex.collectOutputs(jctx, job)
+	// the jobs ended by a stopped exit code upload the artifacts like the successful ones
+	var stoppedByExit error
+	mapped := mapExitCode(job.ExitCodes, err)
+	if errors.As(mapped, &ExitStoppedError{}) {
+		stoppedByExit, mapped = mapped, nil
+	}
+	if err != nil && mapped == nil {
+		log.Info(jctx, "Exit code is mapped by the job", "err", err, "stopped", stoppedByExit != nil)
+	}
+	err = mapped
+	runPostRunHooks(err)
+	ex.finishTracking(jctx, err)
+	if err != nil {
 		erCh <- gerrors.Wrap(err)
 		return
 	}
 
 	if len(ex.artifactsOut) > 0 || len(ex.cacheArtifacts) > 0 {
 		log.Trace(jctx, "Start uploading artifacts")
-		job.Status = states.Uploading
-		err = ex.backend.UpdateState(jctx)
-		if err != nil {
+		if err = ex.setStatus(jctx, states.Uploading); err != nil {
 			erCh <- gerrors.Wrap(err)
 			return
 		}
+		uploadStart := time.Now()
+		var uploaded int64
 		for _, artifact := range ex.artifactsOut {
 			err = artifact.AfterRun(jctx)
 			if err != nil {
 				erCh <- gerrors.Wrap(err)
 				return
 			}
+			uploaded += transferSize(artifact)
 		}
-		for _, artifact := range ex.cacheArtifacts {
-			err = artifact.AfterRun(jctx)
-			if err != nil {
+		if len(ex.cacheArtifacts) > 0 {
+			if err = ex.uploadCache(jctx); err != nil {
 				erCh <- gerrors.Wrap(err)
 				return
 			}
 		}
+		ex.timings.since(phaseUpload, uploadStart)
+		ex.timings.transferred(0, uploaded)
 	}
-	for _, artifact := range ex.artifactsFUSE {
-		err = artifact.AfterRun(jctx)
-		if err != nil {
+	if job.HuggingFace != nil && stoppedByExit == nil {
+		if err = ex.publishHuggingFace(jctx, job); err != nil {
 			erCh <- gerrors.Wrap(err)
 			return
 		}
 	}
-	erCh <- nil
+	erCh <- stoppedByExit
 }
 
 func (ex *Executor) prepareGit(ctx context.Context) error {
 	job := ex.backend.Job(ctx)
-	dir := path.Join(ex.backend.GetTMPDir(ctx), consts.RUNS_DIR, job.RunName, job.JobID)
+	dir := ex.repoDir(ctx)
 	if _, err := os.Stat(dir); err != nil {
 		if err = os.MkdirAll(dir, 0777); err != nil {
 			return gerrors.Wrap(err)
 		}
 
 	}
-	ex.repo = repo.NewManager(ctx, fmt.Sprintf(consts.REPO_HTTPS_URL, job.RepoHostNameWithPort(), job.RepoUserName, job.RepoName), job.RepoBranch, job.RepoHash).WithLocalPath(dir)
+	ex.repo = ex.newRepoManager(ctx, fmt.Sprintf(consts.REPO_HTTPS_URL, job.RepoHostNameWithPort(), job.RepoUserName, job.RepoName), dir)
 	cred := ex.backend.GitCredentials(ctx)
 	if cred != nil {
 		log.Trace(ctx, "Credentials is not empty")
@@ -399,6 +963,13 @@ func (ex *Executor) prepareGit(ctx context.Context) error {
 				break
 			}
 			ex.repo.WithTokenAuth(*cred.OAuthToken)
+		case "github_app":
+			log.Trace(ctx, "Select GitHub App installation token")
+			token, err := ex.gitHubAppToken(ctx, cred)
+			if err != nil {
+				return gerrors.Wrap(err)
+			}
+			ex.repo.WithTokenAuth(token)
 		case "ssh":
 			log.Trace(ctx, "Select SSH protocol")
 			if cred.PrivateKey == nil {
@@ -409,7 +980,7 @@ func (ex *Executor) prepareGit(ctx context.Context) error {
 			if cred.Passphrase != nil {
 				password = *cred.Passphrase
 			}
-			ex.repo = repo.NewManager(ctx, fmt.Sprintf(consts.REPO_GIT_URL, job.RepoHostNameWithPort(), job.RepoUserName, job.RepoName), job.RepoBranch, job.RepoHash).WithLocalPath(dir)
+			ex.repo = ex.newRepoManager(ctx, fmt.Sprintf(consts.REPO_GIT_URL, job.RepoHostNameWithPort(), job.RepoUserName, job.RepoName), dir)
 			ex.repo.WithSSHAuth(*cred.PrivateKey, password)
 		default:
 			log.Error(ctx, "Unsupported protocol", "protocol", cred.Protocol)
@@ -436,13 +1007,35 @@ func (ex *Executor) prepareGit(ctx context.Context) error {
 		if err := repo.ApplyDiff(ctx, dir, repoDiff); err != nil {
 			return gerrors.Wrap(err)
 		}
+		ex.repoDiffSum = fmt.Sprintf("%x", sha256.Sum256([]byte(repoDiff)))
 	}
 	return nil
 }
 
+func (ex *Executor) newRepoManager(ctx context.Context, url, dir string) *repo.Manager {
+	job := ex.backend.Job(ctx)
+	return repo.NewManager(ctx, url, job.RepoBranch, job.RepoHash).
+		WithLocalPath(dir).
+		WithDepth(job.RepoCloneDepth).
+		WithSparseCheckout(job.RepoSparsePaths).
+		WithMirror(filepath.Join(ex.backend.GetTMPDir(ctx), consts.GIT_MIRRORS_DIR))
+}
+
+// repoDir is the host dir of the job repo, it is mounted at /workflow
+func (ex *Executor) repoDir(ctx context.Context) string {
+	job := ex.backend.Job(ctx)
+	return filepath.Join(ex.backend.GetTMPDir(ctx), consts.RUNS_DIR, job.RunName, job.JobID)
+}
+
+// credentialsPath is the host file of the git credentials mounted into the job container
+func (ex *Executor) credentialsPath(ctx context.Context) string {
+	job := ex.backend.Job(ctx)
+	return filepath.Join(ex.backend.GetTMPDir(ctx), consts.RUNS_DIR, job.RunName, "credentials")
+}
+
 func (ex *Executor) prepareArchive(ctx context.Context) error {
 	job := ex.backend.Job(ctx)
-	dir := path.Join(ex.backend.GetTMPDir(ctx), consts.RUNS_DIR, job.RunName, job.JobID)
+	dir := ex.repoDir(ctx)
 	if _, err := os.Stat(dir); err != nil {
 		if err = os.MkdirAll(dir, 0777); err != nil {
 			return gerrors.Wrap(err)
@@ -467,7 +1060,8 @@ func (ex *Executor) processDeps(ctx context.Context) error {
 				return gerrors.Wrap(err)
 			}
 			for _, artifact := range jobDep.Artifacts {
-				artIn := ex.backend.GetArtifact(ctx, jobDep.RunName, artifact.Path, path.Join("artifacts", jobDep.RepoId, jobDep.JobID, artifact.Path), artifact.Mount)
+				remotePath := path.Join("artifacts", jobDep.RepoId, jobDep.JobID, artifact.Path)
+				artIn := ex.withChecksums(ex.getArtifact(ctx, jobDep.RunName, artifact.Path, remotePath, artifact.Mount), remotePath, artifact.Mount)
 				if artIn != nil {
 					ex.artifactsIn = append(ex.artifactsIn, artIn)
 				}
@@ -479,19 +1073,60 @@ func (ex *Executor) processDeps(ctx context.Context) error {
 
 func (ex *Executor) processCache(ctx context.Context) error {
 	job := ex.backend.Job(ctx)
+	if len(job.Cache) == 0 {
+		return nil
+	}
+	repoDir := ex.repoDir(ctx)
+	// local caches are bound in place, there is nothing to compress
+	format := compress.Zstd
+	if _, isLocalBackend := ex.backend.(*localbackend.Local); isLocalBackend {
+		format = ""
+	}
+	manifest := ex.loadCacheManifest(ctx)
 	for _, cache := range job.Cache {
-		cacheArt := ex.backend.GetCache(ctx, job.RunName, cache.Path, path.Join("cache", job.RepoId, job.HubUserName, job.WorkflowName, cache.Path))
-		if cacheArt != nil {
-			ex.cacheArtifacts = append(ex.cacheArtifacts, cacheArt)
+		key := ""
+		if cache.Key != "" {
+			var err error
+			if key, err = evalCacheKey(cache.Key, repoDir); err != nil {
+				return gerrors.Wrap(err)
+			}
+		}
+		name := cacheName(cache.Path, key)
+		cacheArt := ex.backend.GetCache(ctx, job.RunName, cache.Path, path.Join(cacheRoot(job), name))
+		if cacheArt == nil {
+			continue
+		}
+		artifact := cacheArtifact{Artifacter: cacheArt, cache: cache, name: name, format: format}
+		restoreName := name
+		if key != "" {
+			restoreName, artifact.hit = restoreCacheName(manifest.Entries, cache, key)
+		}
+		var err error
+		if restoreName != "" {
+			if restoreName != name {
+				log.Info(ctx, "Restoring cache", "key", key, "from", restoreName)
+			}
+			if artifact.restore, err = ex.cacheTransfer(ctx, cache, restoreName, manifest.Entries[restoreName].Format); err != nil {
+				return gerrors.Wrap(err)
+			}
+		}
+		if artifact.save, err = ex.cacheTransfer(ctx, cache, name, format); err != nil {
+			return gerrors.Wrap(err)
 		}
+		if artifact.save == nil {
+			continue
+		}
+		ex.cacheArtifacts = append(ex.cacheArtifacts, artifact)
 	}
 	return nil
 }
 
-func (ex *Executor) environment(ctx context.Context, includeRun bool) []string {
+func (ex *Executor) environment(ctx context.Context, includeRun bool) ([]string, error) {
 	log.Trace(ctx, "Start generate env")
 	job := ex.backend.Job(ctx)
 	env := environment.New()
+	env.AddMapString(ex.config.Proxy.Env())
+	vars := make(map[string]string)
 
 	if includeRun {
 		cons := make(map[string]string)
@@ -500,6 +1135,7 @@ func (ex *Executor) environment(ctx context.Context, includeRun bool) []string {
 		cons["JOB_ID"] = job.JobID
 
 		cons["RUN_NAME"] = job.RunName
+		cons["DSTACK_OUTPUTS"] = path.Join("/workflow", consts.OUTPUTS_FILE)
 
 		if ex.config.Hostname != nil {
 			cons["JOB_HOSTNAME"] = *ex.config.Hostname
@@ -512,18 +1148,92 @@ func (ex *Executor) environment(ctx context.Context, includeRun bool) []string {
 			cons["MASTER_JOB_ID"] = master.JobID
 			cons["MASTER_JOB_HOSTNAME"] = master.HostName
 		}
-		env.AddMapString(job.RunEnvironment)
-		env.AddMapString(cons)
+		if job.Distributed != nil {
+			for k, v := range ex.distributedEnv(ctx) {
+				cons[k] = v
+			}
+		}
+		if job.DevEnvironment != nil {
+			for k, v := range devEnvironmentEnv(job) {
+				cons[k] = v
+			}
+		}
+		for k, v := range ex.trackingEnv {
+			cons[k] = v
+		}
+		runEnv, err := ex.resolveSecretRefs(ctx, job.RunEnvironment)
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		for k, v := range runEnv {
+			vars[k] = v
+		}
+		for k, v := range cons {
+			vars[k] = v
+		}
+		for _, app := range job.Apps {
+			for k, v := range app.Env {
+				vars[k] = v
+			}
+		}
 	}
-	env.AddMapString(job.Environment)
-	secrets, err := ex.backend.Secrets(ctx)
+	jobEnv, err := ex.resolveSecretRefs(ctx, job.Environment)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	for k, v := range jobEnv {
+		vars[k] = v
+	}
+	secrets, err := ex.fetchSecrets(ctx)
 	if err != nil {
 		log.Error(ctx, "Fail fetching secrets", "err", err)
 	}
-	env.AddMapString(secrets)
+	// the values may refer to the secrets and to the other variables, e.g. ${env.HOME:-/root}
+	var interpolator VariablesInterpolator
+	interpolator.Add("secrets", secrets)
+	interpolator.Add("env", vars)
+	// the apps are bound by then, the ports of the job env are resolved with the host ones
+	interpolator.Add("port", ports.AppVariables(job.Apps))
+	for k, v := range vars {
+		if !strings.Contains(v, shortOpening) {
+			continue
+		}
+		if vars[k], err = interpolator.Interpolate(ctx, v); err != nil {
+			return nil, gerrors.Newf("failed interpolating %s: %v", k, err)
+		}
+	}
+	env.AddMapString(vars)
+	env.AddMapString(processSecrets(job, secrets))
 
 	log.Trace(ctx, "Stop generate env", "slice", env.ToSlice())
-	return env.ToSlice()
+	return env.ToSlice(), nil
+}
+
+// pathInterpolator resolves the artifact paths with the job variables, the secrets are not available in the paths
+func (ex *Executor) pathInterpolator(ctx context.Context) *VariablesInterpolator {
+	job := ex.backend.Job(ctx)
+	vars := make(map[string]string)
+	for _, source := range []map[string]string{job.RunEnvironment, job.Environment} {
+		for k, v := range source {
+			vars[k] = v
+		}
+	}
+	vars["RUN_NAME"] = job.RunName
+	vars["JOB_ID"] = job.JobID
+	var interpolator VariablesInterpolator
+	interpolator.Add("env", vars)
+	return &interpolator
+}
+
+// envMap parses the KEY=VALUE pairs of the container environment
+func envMap(env []string) map[string]string {
+	vars := make(map[string]string, len(env))
+	for _, pair := range env {
+		if i := strings.IndexByte(pair, '='); i > 0 {
+			vars[pair[:i]] = pair[i+1:]
+		}
+	}
+	return vars
 }
 
 func (ex *Executor) newSpec(ctx context.Context, credPath string) (*container.Spec, error) {
@@ -533,7 +1243,7 @@ func (ex *Executor) newSpec(ctx context.Context, credPath string) (*container.Sp
 	bindings := make([]mount.Mount, 0)
 	bindings = append(bindings, mount.Mount{
 		Type:   mount.TypeBind,
-		Source: path.Join(ex.backend.GetTMPDir(ctx), consts.RUNS_DIR, job.RunName, job.JobID),
+		Source: ex.repoDir(ctx),
 		Target: "/workflow",
 	})
 	bindings = append(bindings, mount.Mount{
@@ -542,6 +1252,7 @@ func (ex *Executor) newSpec(ctx context.Context, credPath string) (*container.Sp
 		Target: filepath.Join(job.HomeDir, ".dstack", consts.CONFIG_FILE_NAME),
 	})
 	bindings = append(bindings, ex.backend.GetDockerBindings(ctx)...)
+	bindings = append(bindings, ex.volumeBindings()...)
 
 	for _, artifact := range ex.artifactsIn {
 		art, err := artifact.DockerBindings(path.Join("/workflow", job.WorkingDir))
@@ -564,29 +1275,47 @@ func (ex *Executor) newSpec(ctx context.Context, credPath string) (*container.Sp
 		}
 		bindings = append(bindings, art...)
 	}
+	for _, dataset := range ex.datasets {
+		art, err := dataset.DockerBindings(path.Join("/workflow", job.WorkingDir))
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		bindings = append(bindings, art...)
+	}
 	if job.RepoType == "remote" && job.HomeDir != "" {
 		cred := ex.backend.GitCredentials(ctx)
 		if cred != nil {
 			log.Trace(ctx, "Trying to mount git credentials")
 			credMountPath := ""
+			token := ""
 			switch cred.Protocol {
 			case "ssh":
 				if cred.PrivateKey != nil {
 					credMountPath = path.Join(job.HomeDir, ".ssh/id_rsa")
-					if err := os.WriteFile(credPath, []byte(*cred.PrivateKey), 0600); err != nil {
+					if err := writePrivateFile(credPath, []byte(*cred.PrivateKey)); err != nil {
 						log.Error(ctx, "Failed writing credentials", "err", err)
 					}
 				}
 			case "https":
 				if cred.OAuthToken != nil {
-					credMountPath = path.Join(job.HomeDir, ".config/gh/hosts.yml")
-					ghHost := fmt.Sprintf("%s:\n  oauth_token: \"%s\"\n", job.RepoHostName, *cred.OAuthToken)
-					if err := os.WriteFile(credPath, []byte(ghHost), 0644); err != nil {
-						log.Error(ctx, "Failed writing credentials", "err", err)
-					}
+					token = *cred.OAuthToken
+				}
+			case "github_app":
+				var err error
+				if token, err = ex.gitHubAppToken(ctx, cred); err != nil {
+					log.Error(ctx, "Failed to mint the GitHub App token", "err", err)
 				}
 			default:
 			}
+			if token != "" {
+				mounts, err := writeTokenCredentials(job.HomeDir, job.RepoHostName, credPath, token)
+				if err != nil {
+					log.Error(ctx, "Failed writing credentials", "err", err)
+				} else {
+					log.Trace(ctx, "Mounting git credentials", "provider", repo.ProviderOf(job.RepoHostName))
+					bindings = append(bindings, mounts...)
+				}
+			}
 			if credMountPath != "" {
 				log.Trace(ctx, "Mounting git credentials", "target", credMountPath)
 				bindings = append(bindings, mount.Mount{
@@ -598,7 +1327,7 @@ func (ex *Executor) newSpec(ctx context.Context, credPath string) (*container.Sp
 		}
 	}
 
-	secrets, err := ex.backend.Secrets(ctx)
+	secrets, err := ex.fetchSecrets(ctx)
 	if err != nil {
 		log.Error(ctx, "Fail fetching secrets", "err", err)
 	}
@@ -613,69 +1342,189 @@ func (ex *Executor) newSpec(ctx context.Context, credPath string) (*container.Sp
 		log.Error(ctx, "Failed interpolating registry_auth.password", "err", err, "password", job.RegistryAuth.Password)
 	}
 
+	ex.engine.SetRegistries(ex.registries(ctx, &interpolator))
+
 	_, isLocalBackend := ex.backend.(*localbackend.Local)
-	appsBindingPorts, err := ports.GetAppsBindingPorts(ctx, job.Apps, isLocalBackend)
+	appsBindingPorts, err := ex.bindPorts(ctx)
 	if err != nil {
-		log.Error(ctx, "Failed binding ports", "err", err)
-		job.ErrorCode = errorcodes.PortsBindingFailed
-		_ = ex.backend.UpdateState(ctx)
 		return nil, gerrors.Wrap(err)
 	}
-	if err = ex.backend.UpdateState(ctx); err != nil {
+	env, err := ex.environment(ctx, true)
+	if err != nil {
 		return nil, gerrors.Wrap(err)
 	}
 
+	// the host network would expose the app ports on every interface, bypassing the tunnel and the app proxy
+	allowHostMode := !isLocalBackend && ex.config.Tunnel == nil && ex.config.AppProxy == nil
+	interpolator.Add("env", envMap(env))
+	commands, err := interpolator.InterpolateAll(ctx, job.Commands)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	envFileMounts, err := ex.renderEnvFiles(ctx, &interpolator, secrets)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	bindings = append(bindings, envFileMounts...)
+	if job.DevEnvironment != nil {
+		devJob := *job
+		devJob.Commands = commands
+		commands = devEnvironmentCommands(&devJob)
+	}
 	spec := &container.Spec{
 		Image:              job.Image,
 		RegistryAuthBase64: makeRegistryAuthBase64(username, password),
 		WorkDir:            path.Join("/workflow", job.WorkingDir),
-		Commands:           container.ShellCommands(job.Commands),
+		Commands:           container.ShellCommands(commands),
 		Entrypoint:         job.Entrypoint,
-		Env:                ex.environment(ctx, true),
+		Env:                env,
 		Mounts:             uniqueMount(bindings),
 		ExposedPorts:       ports.GetAppsExposedPorts(ctx, job.Apps, isLocalBackend),
 		BindingPorts:       appsBindingPorts,
 		ShmSize:            resource.ShmSize,
-		AllowHostMode:      !isLocalBackend,
+		User:               containerUser(job.User),
+		ReadOnlyRootfs:     job.ReadOnlyRootfs,
+		Tmpfs:              tmpfsMounts(job),
+		AllowHostMode:      allowHostMode,
+	}
+	if job.Distributed != nil {
+		publishDistributedPorts(spec, job.Distributed)
+		if ex.config.Tunnel != nil {
+			log.Warning(ctx, "Multi-node jobs use the host network, app ports are reachable bypassing the tunnel")
+		}
+	}
+	if job.ContainerRetry != nil {
+		spec.KeepFailed = job.ContainerRetry.KeepFailed
+	}
+	spec.DNS = append(append([]string{}, ex.config.DNS...), job.DNS...)
+	spec.DNSSearch = append(append([]string{}, ex.config.DNSSearch...), job.DNSSearch...)
+	if spec.ExtraHosts, err = extraHosts(append(append([]string{}, ex.config.ExtraHosts...), job.ExtraHosts...)); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if err = ex.applySecurity(spec, job.Security); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	for _, device := range job.Devices {
+		parsed, err := container.ParseDevice(device)
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		spec.Devices = append(spec.Devices, parsed)
+	}
+	if job.Network != nil {
+		spec.Network = job.Network.Mode
+		spec.NetworkAliases = job.Network.Aliases
+		if spec.Network == container.NetworkHost && ex.config.Tunnel != nil {
+			log.Warning(ctx, "The job uses the host network, app ports are reachable bypassing the tunnel")
+		}
+	}
+	if err = ex.nestedDocker(ctx, spec, job.Docker); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if ex.slot != nil {
+		spec.GPUDevices = ex.slot.GPUs
+		spec.CPUSet = ex.slot.CPUSet
+		spec.MemoryMiB = ex.slot.MemoryMiB
 	}
 	return spec, nil
 }
 
-func (ex *Executor) warnOnLongImagePull(ctx context.Context, image string) error {
-	client := ex.engine.DockerClient()
-	imageFilters := filters.NewArgs()
-	imageFilters.Add("reference", image)
-	images, err := client.ImageList(ctx, types.ImageListOptions{All: false, Filters: imageFilters})
-	if err != nil {
+func (ex *Executor) pullImage(ctx context.Context, spec *container.Spec, progress io.Writer) error {
+	if _, err := fmt.Fprintf(progress, "Pulling the image %s...\n", spec.Image); err != nil {
 		return gerrors.Wrap(err)
 	}
-	if len(images) == 0 {
-		if _, err := fmt.Fprintf(ex.streamLogs, "Pulling a docker image. This may take a while...\n\n"); err != nil {
-			return gerrors.Wrap(err)
-		}
-		return nil
+	if err := ex.engine.PullImage(ctx, spec.Image, spec.RegistryAuthBase64, progress); err != nil {
+		return gerrors.Wrap(err)
+	}
+	if _, err := fmt.Fprintf(progress, "The image is pulled\n\n"); err != nil {
+		return gerrors.Wrap(err)
 	}
 	return nil
 }
 
-func (ex *Executor) processJob(ctx context.Context, spec *container.Spec, stoppedCh chan struct{}, logs io.Writer) error {
-	docker, err := ex.engine.Create(ctx, spec, logs)
-	if err != nil {
+// processJob runs the job container, stdout goes to logs and stderr goes to errLogs
+func (ex *Executor) processJob(ctx context.Context, spec *container.Spec, stoppedCh chan struct{}, logs, errLogs io.Writer) error {
+	var docker *container.DockerRuntime
+	var err error
+	job := ex.backend.Job(ctx)
+	if spec.Sidecars, err = ex.sidecarSpecs(ctx, spec, logs); err != nil {
 		return gerrors.Wrap(err)
 	}
-	err = docker.Run(ctx)
-	if err != nil {
-		return gerrors.Wrap(err)
+	if ex.config.Signatures != nil {
+		// the sidecar images are verified before they run, so they are pulled ahead of the container creation
+		for _, sidecar := range spec.Sidecars {
+			if err = ex.engine.PullImage(ctx, sidecar.Image, sidecar.RegistryAuthBase64, nil); err != nil {
+				return gerrors.Wrap(err)
+			}
+			if err = ex.verifyImage(ctx, sidecar.Image); err != nil {
+				return gerrors.Wrap(err)
+			}
+		}
+	}
+	if job.Checkpoint != nil && job.Checkpoint.RestoreFrom != "" {
+		cleanup, err := ex.restoreCheckpoint(ctx, spec)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		defer cleanup()
+	}
+	for attempt := 1; ; attempt++ {
+		if job.TTY {
+			docker, err = ex.engine.Create(ctx, spec, logs)
+		} else {
+			docker, err = ex.engine.CreateWithStreams(ctx, spec, logs, errLogs)
+		}
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		err = docker.Run(ctx)
+		if err == nil {
+			break
+		}
+		// the container may have never started, ForceStop would fail to kill it and leave it behind
+		if errRemove := docker.Remove(ctx); errRemove != nil {
+			log.Error(ctx, "Failed to remove the container", "err", errRemove)
+		}
+		if !ports.IsPortAllocatedError(err) || attempt >= consts.MAX_PORT_BINDING_ATTEMPTS {
+			return gerrors.Wrap(err)
+		}
+		// the port was taken after the check, the next binding skips it
+		log.Info(ctx, "Host port is taken, rebinding", "attempt", attempt, "err", err)
+		if spec.BindingPorts, err = ex.bindPorts(ctx); err != nil {
+			return gerrors.Wrap(err)
+		}
+		ex.repointTunnel(ctx)
+	}
+	ex.setRunning(docker, spec)
+	defer ex.setRunning(nil, nil)
+	if ex.engine.DockerRuntime() == consts.NVIDIA_RUNTIME {
+		defer ex.startWatcher(ctx, ex.collectGPUStats)()
+	}
+	defer ex.startWatcher(ctx, func(ctx context.Context, stopCh chan struct{}) {
+		ex.collectUsage(ctx, docker, logs, stopCh)
+	})()
+	if job.ModelService != nil && ex.gateway != nil {
+		defer ex.startWatcher(ctx, ex.reportModelMetrics)()
+	}
+	if job.Scaling != nil {
+		defer ex.startWatcher(ctx, ex.reportScaling)()
+	}
+	if hasProbes(job.Apps) {
+		defer ex.startWatcher(ctx, ex.watchProbes)()
+	}
+	if job.Checkpoint != nil {
+		defer ex.startWatcher(ctx, ex.watchInterruption)()
+	}
+	if dev := job.DevEnvironment; dev != nil && dev.IdleTimeout > 0 {
+		defer ex.startWatcher(ctx, func(ctx context.Context, stopCh chan struct{}) {
+			ex.watchIdle(ctx, docker, dev, stopCh)
+		})()
 	}
 	errCh := make(chan error, 2) // err and nil
 	go func() {
-		defer func() {
-			ex.streamLogs.Close()
-			log.Info(ctx, "Docker log stream closed")
-		}()
-		err = docker.Wait(ctx)
-		if err != nil && !errors.Is(err, context.Canceled) {
-			errCh <- gerrors.Wrap(err)
+		errWait := docker.Wait(ctx)
+		if errWait != nil && !errors.Is(errWait, context.Canceled) {
+			errCh <- gerrors.Wrap(errWait)
 		}
 		errCh <- nil
 	}()
@@ -686,6 +1535,15 @@ func (ex *Executor) processJob(ctx context.Context, spec *container.Spec, stoppe
 		}
 		return nil
 	case <-stoppedCh:
+		if ex.shouldCheckpoint(job) {
+			checkpointed, err := ex.checkpoint(ctx, docker)
+			if err != nil {
+				log.Error(ctx, "Failed to checkpoint the container", "err", err)
+			}
+			if checkpointed {
+				return nil
+			}
+		}
 		err = docker.Stop(ctx)
 		if err != nil {
 			return gerrors.Wrap(err)
@@ -694,6 +1552,229 @@ func (ex *Executor) processJob(ctx context.Context, spec *container.Spec, stoppe
 	}
 }
 
+// bindPorts maps app ports to host ports and reports the actual mapping
+func (ex *Executor) bindPorts(ctx context.Context) (nat.PortMap, error) {
+	_, isLocalBackend := ex.backend.(*localbackend.Local)
+	start, end := ex.config.ExposePorts()
+	var appsBindingPorts nat.PortMap
+	var errBind error
+	// the apps get their host ports assigned in place
+	err := ex.updateJob(ctx, func(job *models.Job) {
+		appsBindingPorts, errBind = ports.GetAppsBindingPorts(ctx, job.Apps, isLocalBackend, ports.Range{Start: start, End: end})
+		if errBind != nil {
+			job.ErrorCode = errorcodes.PortsBindingFailed
+		}
+	})
+	if errBind != nil {
+		log.Error(ctx, "Failed binding ports", "err", errBind)
+		return nil, gerrors.Wrap(errBind)
+	}
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if ex.config.Tunnel != nil || ex.config.AppProxy != nil {
+		ports.BindLocalhost(appsBindingPorts)
+	}
+	return appsBindingPorts, nil
+}
+
+// openTunnel forwards every app port from the tunnel gateway and reports the gateway ports
+func (ex *Executor) openTunnel(ctx context.Context) (*tunnel.Tunnel, error) {
+	job := ex.backend.Job(ctx)
+	t, err := tunnel.Connect(ctx, *ex.config.Tunnel)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	remotePorts := make([]int, len(job.Apps))
+	for i, app := range job.Apps {
+		localPort := app.Port
+		if app.MapToPort > 0 {
+			localPort = app.MapToPort
+		}
+		remotePorts[i], err = t.Forward(ctx, 0, tunnel.LocalAddr(localPort))
+		if err != nil {
+			_ = t.Close()
+			return nil, gerrors.Wrap(err)
+		}
+	}
+	err = ex.updateJob(ctx, func(job *models.Job) {
+		for i := range job.Apps {
+			job.Apps[i].TunnelPort = remotePorts[i]
+		}
+		job.TunnelHost = ex.config.Tunnel.Host
+	})
+	if err != nil {
+		_ = t.Close()
+		return nil, gerrors.Wrap(err)
+	}
+	return t, nil
+}
+
+// repointTunnel forwards the tunnel ports to the app ports after they are rebound
+func (ex *Executor) repointTunnel(ctx context.Context) {
+	if ex.tunnel == nil {
+		return
+	}
+	for _, app := range ex.backend.Job(ctx).Apps {
+		localPort := app.Port
+		if app.MapToPort > 0 {
+			localPort = app.MapToPort
+		}
+		ex.tunnel.Repoint(ctx, app.TunnelPort, tunnel.LocalAddr(localPort))
+	}
+}
+
+// sidecarSpecs describes the job sidecars, they have the same mounts as the job container
+func (ex *Executor) sidecarSpecs(ctx context.Context, spec *container.Spec, logs io.Writer) ([]container.SidecarSpec, error) {
+	job := ex.backend.Job(ctx)
+	specs := make([]container.SidecarSpec, 0, len(job.Sidecars))
+	for _, sidecar := range job.Sidecars {
+		sidecarEnv, err := ex.resolveSecretRefs(ctx, sidecar.Environment)
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		env := environment.New()
+		env.AddMapString(sidecarEnv)
+		specs = append(specs, container.SidecarSpec{
+			Name:               sidecar.Name,
+			Image:              sidecar.Image,
+			RegistryAuthBase64: spec.RegistryAuthBase64,
+			Commands:           container.ShellCommands(sidecar.Commands),
+			Entrypoint:         shellEntrypoint(sidecar.Entrypoint, sidecar.Commands),
+			Env:                env.ToSlice(),
+			Mounts:             spec.Mounts,
+			Logs:               joblog.NewPrefixWriter(logs, fmt.Sprintf("[%s] ", sidecar.Name)),
+		})
+	}
+	if job.Docker == models.DockerInDocker {
+		specs = append(specs, dindSidecar(logs))
+	}
+	return specs, nil
+}
+
+// processServices runs the job services instead of the job container, all of them share the job mounts and env
+func (ex *Executor) processServices(ctx context.Context, spec *container.Spec, stoppedCh chan struct{}, logs io.Writer) error {
+	job := ex.backend.Job(ctx)
+	primary := job.PrimaryService
+	if primary == "" {
+		primary = job.Services[0].Name
+	}
+	services := make([]container.ServiceSpec, 0, len(job.Services))
+	for _, service := range job.Services {
+		serviceEnv, err := ex.resolveSecretRefs(ctx, service.Environment)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		env := environment.New()
+		env.AddMapString(serviceEnv)
+		serviceSpec := container.ServiceSpec{
+			Name:               service.Name,
+			Image:              service.Image,
+			RegistryAuthBase64: spec.RegistryAuthBase64,
+			Commands:           container.ShellCommands(service.Commands),
+			Entrypoint:         shellEntrypoint(service.Entrypoint, service.Commands),
+			Env:                append(append([]string{}, spec.Env...), env.ToSlice()...),
+			Volumes:            service.Volumes,
+			Mounts:             spec.Mounts,
+		}
+		// the primary service replaces the job container, so it serves the app ports
+		if service.Name == primary {
+			serviceSpec.ExposedPorts = spec.ExposedPorts
+			serviceSpec.BindingPorts = spec.BindingPorts
+		}
+		services = append(services, serviceSpec)
+	}
+	writers := make([]*joblog.PrefixWriter, 0, len(services))
+	defer func() {
+		for _, w := range writers {
+			_ = w.Flush()
+		}
+	}()
+	compose, err := ex.engine.Compose(ctx, &container.ComposeSpec{
+		Project:  composeProjectName(job.JobID),
+		Services: services,
+		Primary:  primary,
+	}, func(service string) io.Writer {
+		w := joblog.NewPrefixWriter(logs, fmt.Sprintf("[%s] ", service))
+		writers = append(writers, w)
+		return w
+	})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		err := compose.Wait(ctx)
+		if err != nil && errors.Is(err, context.Canceled) {
+			err = nil
+		}
+		errCh <- err
+	}()
+	select {
+	case err = <-errCh:
+		return gerrors.Wrap(err)
+	case <-stoppedCh:
+		return gerrors.Wrap(compose.Stop(ctx))
+	}
+}
+
+// shellEntrypoint runs commands with sh unless the entrypoint is set,
+// without commands the container runs the default command of its image
+func shellEntrypoint(entrypoint []string, commands []string) []string {
+	if len(entrypoint) == 0 && len(commands) > 0 {
+		return []string{"/bin/sh", "-c"}
+	}
+	return entrypoint
+}
+
+var composeProjectRe = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
+func composeProjectName(jobID string) string {
+	return "dstack_" + composeProjectRe.ReplaceAllString(jobID, "_")
+}
+
+// startWatcher runs watch until the returned stop func is called, stop waits for watch to return
+func (ex *Executor) startWatcher(ctx context.Context, watch func(ctx context.Context, stopCh chan struct{})) (stop func()) {
+	stopCh := make(chan struct{})
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		watch(ctx, stopCh)
+	}()
+	return func() {
+		close(stopCh)
+		wg.Wait()
+	}
+}
+
+func (ex *Executor) collectGPUStats(ctx context.Context, stopCh chan struct{}) {
+	ticker := time.NewTicker(consts.DELAY_GPU_STATS)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			stats, err := gpu.Query(ctx)
+			if err != nil {
+				log.Warning(ctx, "Failed to query GPU stats", "err", err)
+				continue
+			}
+			// nvidia-smi may print no GPU, the empty sample would trim the whole history
+			if len(stats) == 0 {
+				continue
+			}
+			err = ex.updateJob(ctx, func(job *models.Job) {
+				job.GPUStats = appendGPUStats(job.GPUStats, stats)
+			})
+			if err != nil {
+				log.Error(ctx, "Failed to update GPU stats", "err", err)
+			}
+		}
+	}
+}
+
 func (ex *Executor) Shutdown(ctx context.Context) {
 	defer func() {
 		if r := recover(); r != nil {
@@ -708,11 +1789,15 @@ func (ex *Executor) Shutdown(ctx context.Context) {
 	}
 }
 
-func (ex *Executor) build(ctx context.Context, spec *container.Spec, stoppedCh chan struct{}, logs io.Writer) error {
+func (ex *Executor) build(ctx context.Context, spec *container.Spec, stoppedCh chan struct{}, logs, progress io.Writer) error {
 	job := ex.backend.Job(ctx)
 	_, isLocalBackend := ex.backend.(*localbackend.Local)
 	commands := append([]string{}, job.BuildCommands...)
 	commands = append(commands, job.OptionalBuildCommands...)
+	env, err := ex.environment(ctx, false)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
 
 	buildSpec := &container.BuildSpec{
 		BaseImageName:      spec.Image,
@@ -721,14 +1806,21 @@ func (ex *Executor) build(ctx context.Context, spec *container.Spec, stoppedCh c
 		ConfigurationType:  job.ConfigurationType,
 		Commands:           container.ShellCommands(commands),
 		Entrypoint:         spec.Entrypoint,
-		Env:                ex.environment(ctx, false),
+		Env:                env,
 		RegistryAuthBase64: spec.RegistryAuthBase64,
-		RepoPath:           path.Join(ex.backend.GetTMPDir(ctx), consts.RUNS_DIR, job.RunName, job.JobID),
+		RepoPath:           ex.repoDir(ctx),
+		Dockerfile:         job.Dockerfile,
 	}
 	buildName, err := ex.engine.GetBuildDigest(ctx, buildSpec)
 	if err != nil {
 		return gerrors.Wrap(err)
 	}
+	if job.SharedBuildCache() {
+		if buildName, err = buildSpec.ContentHash(); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	ex.buildDigest = buildName
 
 	tempDir, err := os.MkdirTemp("", "build")
 	if err != nil {
@@ -736,12 +1828,15 @@ func (ex *Executor) build(ctx context.Context, spec *container.Spec, stoppedCh c
 	}
 	defer func() { _ = os.RemoveAll(tempDir) }()
 	diffPath := filepath.Join(tempDir, "layer.tar")
-	key := fmt.Sprintf("builds/%s/%s.tar", job.RepoId, buildName)
-	imageName := fmt.Sprintf("dstackai/build:%s", buildName)
+	// the diff is transferred compressed under its own key, diffs uploaded uncompressed by older runners are still accepted
+	compressedPath := filepath.Join(tempDir, "layer.tar.zst")
+	key := job.CompressedBuildDiffFilepath(buildName)
+	legacyKey := job.BuildDiffFilepath(buildName)
+	imageName := fmt.Sprintf("%s:%s", container.BUILD_IMAGE_REPO, buildName)
 
 	if job.BuildPolicy == models.UseBuild || job.BuildPolicy == models.Build {
 		log.Trace(ctx, "Trying to fetch build image diff", "key", key, "image", imageName)
-		if _, err := fmt.Fprintf(ex.streamLogs, "Looking for the image...\n"); err != nil {
+		if _, err := fmt.Fprintf(progress, "Looking for the image...\n"); err != nil {
 			return gerrors.Wrap(err)
 		}
 		if isLocalBackend {
@@ -750,64 +1845,105 @@ func (ex *Executor) build(ctx context.Context, spec *container.Spec, stoppedCh c
 				return gerrors.Wrap(err)
 			}
 			if exists {
-				if _, err := fmt.Fprintf(ex.streamLogs, "Using the image from the cache\n\n"); err != nil {
+				if _, err := fmt.Fprintf(progress, "Using the image from the cache\n\n"); err != nil {
 					return gerrors.Wrap(err)
 				}
 				spec.Image = imageName
 				return nil
 			}
 		} else {
-			if err := ex.backend.GetBuildDiff(ctx, key, diffPath); err != nil {
-				return gerrors.Wrap(err)
+			var stat os.FileInfo
+			foundKey := ""
+			for _, candidate := range []string{key, legacyKey} {
+				if err := ex.getBuildDiff(ctx, candidate, compressedPath); err != nil {
+					return gerrors.Wrap(err)
+				}
+				if stat, err = os.Stat(compressedPath); err == nil {
+					foundKey = candidate
+					break
+				}
 			}
-			if stat, err := os.Stat(diffPath); err == nil {
-				if _, err = fmt.Fprintf(ex.streamLogs, "Loading the image (%s)...\n", humanize.Bytes(uint64(stat.Size()))); err != nil {
+			if foundKey != "" && !ex.verifyBuildSignature(ctx, foundKey, compressedPath) {
+				log.Warning(ctx, "The cached build is not signed, building the image", "key", foundKey)
+				foundKey = ""
+			}
+			if foundKey != "" {
+				if err = ex.verifyBuildDiff(ctx, foundKey, compressedPath); err != nil {
+					return gerrors.Wrap(err)
+				}
+				if err = compress.DecompressFile(compressedPath, diffPath); err != nil {
 					return gerrors.Wrap(err)
 				}
-				if err := ex.engine.ImportImageDiff(ctx, diffPath); err != nil {
+				if _, err = fmt.Fprintf(progress, "Loading the image (%s)...\n", humanize.Bytes(uint64(stat.Size()))); err != nil {
 					return gerrors.Wrap(err)
 				}
-				if _, err = fmt.Fprintf(ex.streamLogs, "The image is loaded\n\n"); err != nil {
+				if job.Dockerfile != "" {
+					err = ex.engine.LoadImage(ctx, diffPath)
+				} else {
+					err = ex.engine.ImportImageDiff(ctx, diffPath)
+				}
+				if err != nil {
+					return gerrors.Wrap(err)
+				}
+				if _, err = fmt.Fprintf(progress, "The image is loaded\n\n"); err != nil {
 					return gerrors.Wrap(err)
 				}
 				spec.Image = imageName
 				return nil
 			}
 		}
-		if _, err = fmt.Fprintf(ex.streamLogs, "No image is found\n\n"); err != nil {
+		if _, err = fmt.Fprintf(progress, "No image is found\n\n"); err != nil {
 			return gerrors.Wrap(err)
 		}
-		if job.BuildPolicy == models.UseBuild && len(job.BuildCommands) > 0 {
-			job.ErrorCode = errorcodes.BuildNotFound
-			_ = ex.backend.UpdateState(ctx)
+		if job.BuildPolicy == models.UseBuild && (len(job.BuildCommands) > 0 || job.Dockerfile != "") {
+			_ = ex.updateJob(ctx, func(job *models.Job) {
+				job.ErrorCode = errorcodes.BuildNotFound
+			})
 			return gerrors.New("no build image is found")
 		}
 	}
 
 	if job.BuildPolicy == models.Build || job.BuildPolicy == models.ForceBuild || job.BuildPolicy == models.BuildOnly {
+		buildStart := time.Now()
 		err := ex.engine.Build(ctx, buildSpec, imageName, stoppedCh, logs)
 		if err != nil {
 			return gerrors.Wrap(err)
 		}
 		// local backend: store image in daemon cache
 		if !isLocalBackend {
-			if _, err := fmt.Fprintf(ex.streamLogs, "Saving the image...\n"); err != nil {
+			if _, err := fmt.Fprintf(progress, "Saving the image...\n"); err != nil {
+				return gerrors.Wrap(err)
+			}
+			// Dockerfile builds have many layers, the whole image is saved instead of the top layer
+			if job.Dockerfile != "" {
+				err = ex.engine.SaveImage(ctx, imageName, diffPath)
+			} else {
+				err = ex.engine.ExportImageDiff(ctx, imageName, diffPath)
+			}
+			if err != nil {
 				return gerrors.Wrap(err)
 			}
-			if err := ex.engine.ExportImageDiff(ctx, imageName, diffPath); err != nil {
+			if err = compress.CompressFile(diffPath, compressedPath); err != nil {
 				return gerrors.Wrap(err)
 			}
-			stat, err := os.Stat(diffPath)
+			stat, err := os.Stat(compressedPath)
 			if err != nil {
 				return gerrors.Wrap(err)
 			}
 			log.Trace(ctx, "Putting build image diff", "key", key, "image", imageName, "size", stat.Size())
-			if _, err = fmt.Fprintf(ex.streamLogs, "Uploading the image (%s)...\n", humanize.Bytes(uint64(stat.Size()))); err != nil {
+			if _, err = fmt.Fprintf(progress, "Uploading the image (%s)...\n", humanize.Bytes(uint64(stat.Size()))); err != nil {
+				return gerrors.Wrap(err)
+			}
+			if err = ex.putBuildDiff(ctx, compressedPath, key); err != nil {
 				return gerrors.Wrap(err)
 			}
-			if err = ex.backend.PutBuildDiff(ctx, diffPath, key); err != nil {
+			if err = ex.putBuildDiffChecksum(ctx, key, compressedPath); err != nil {
 				return gerrors.Wrap(err)
 			}
+			if err = ex.signBuild(ctx, key, compressedPath); err != nil {
+				return gerrors.Wrap(err)
+			}
+			ex.attestBuild(ctx, key, imageName, compressedPath, buildSpec, buildStart)
 		}
 		spec.Image = imageName
 	}
@@ -827,13 +1963,9 @@ func uniqueMount(m []mount.Mount) []mount.Mount {
 	return result
 }
 
-func createLocalLog(dir, fileName string) (*os.File, error) {
-	if _, err := os.Stat(dir); err != nil {
-		if err = os.MkdirAll(dir, 0777); err != nil {
-			return nil, gerrors.Wrap(err)
-		}
-	}
-	fileLog, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("%s.log", fileName)), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o777)
+// createLocalLog opens the rotated log file of the job, the rotated files count towards the cap of the logs dir
+func (ex *Executor) createLocalLog(dir, fileName string) (*joblog.RotatingFile, error) {
+	fileLog, err := joblog.OpenRotating(filepath.Join(dir, fmt.Sprintf("%s.log", fileName)), filepath.Join(ex.configDir, "logs"), ex.config.LogRotation)
 	if err != nil {
 		return nil, gerrors.Wrap(err)
 	}
@@ -0,0 +1,59 @@
+package executor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// prepareModelService generates the token of the gateway clients, unless the runner config has its own tokens
+func (ex *Executor) prepareModelService(ctx context.Context) error {
+	if ex.config.Gateway == nil {
+		log.Warning(ctx, "The job is a model service, but the runner has no gateway")
+		return nil
+	}
+	if len(ex.config.Gateway.Tokens) > 0 {
+		return nil
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return gerrors.Wrap(err)
+	}
+	token := hex.EncodeToString(b)
+	ex.logSecrets.Add(token)
+	return ex.updateJob(ctx, func(job *models.Job) {
+		job.ModelService.Token = token
+	})
+}
+
+// reportModelMetrics writes the gateway metrics to the job state when they change
+func (ex *Executor) reportModelMetrics(ctx context.Context, stopCh chan struct{}) {
+	ticker := time.NewTicker(consts.DELAY_USAGE_STATS)
+	defer ticker.Stop()
+	var reported models.ModelMetrics
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		metrics := ex.gateway.Metrics()
+		if metrics == reported {
+			continue
+		}
+		err := ex.updateJob(ctx, func(job *models.Job) {
+			job.ModelMetrics = &metrics
+		})
+		if err != nil {
+			log.Error(ctx, "Failed to update the model metrics", "err", err)
+			continue
+		}
+		reported = metrics
+	}
+}
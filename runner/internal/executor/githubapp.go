@@ -0,0 +1,59 @@
+package executor
+
+import (
+	"context"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/githubapp"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// gitHubAppToken mints an installation token of the GitHub App, the token is masked in the logs
+func (ex *Executor) gitHubAppToken(ctx context.Context, cred *models.GitCredentials) (string, error) {
+	if ex.githubApp == nil {
+		if cred.AppID == nil || cred.InstallationID == nil || cred.AppPrivateKey == nil {
+			return "", gerrors.New("GitHub App credentials are incomplete")
+		}
+		job := ex.backend.Job(ctx)
+		ex.githubApp = githubapp.New(job.RepoHostName, *cred.AppID, *cred.InstallationID, *cred.AppPrivateKey)
+	}
+	token, err := ex.githubApp.Token(ctx)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	ex.logSecrets.Add(token)
+	return token, nil
+}
+
+// refreshGitHubAppToken rewrites the mounted credentials before the installation token expires, until stopCh is closed.
+// The files are rewritten in place, so the bind mounts keep pointing to them.
+func (ex *Executor) refreshGitHubAppToken(ctx context.Context, credPath string, stopCh chan struct{}) {
+	job := ex.backend.Job(ctx)
+	ticker := time.NewTicker(consts.DELAY_GITHUB_APP_TOKEN_REFRESH)
+	defer ticker.Stop()
+	last := ""
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		token, err := ex.githubApp.Token(ctx)
+		if err != nil {
+			log.Error(ctx, "Failed to refresh the GitHub App token", "err", err)
+			continue
+		}
+		if token == last {
+			continue
+		}
+		ex.logSecrets.Add(token)
+		if _, err = writeTokenCredentials(job.HomeDir, job.RepoHostName, credPath, token); err != nil {
+			log.Error(ctx, "Failed writing credentials", "err", err)
+			continue
+		}
+		last = token
+	}
+}
@@ -0,0 +1,33 @@
+package executor
+
+import (
+	"context"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/health"
+)
+
+func (ex *Executor) CheckDocker(ctx context.Context) error {
+	if ex.engine == nil || ex.engine.DockerClient() == nil {
+		return gerrors.New("docker is not available")
+	}
+	_, err := ex.engine.DockerClient().Ping(ctx)
+	return gerrors.Wrap(err)
+}
+
+// CheckBackend reads the stop flag of the job, the backend is not probed until the job is accepted
+func (ex *Executor) CheckBackend(ctx context.Context) error {
+	if !ex.Ready() {
+		return health.ErrPending
+	}
+	if ex.StateDegraded() {
+		return gerrors.New("job state can't be written")
+	}
+	_, err := ex.backend.CheckStop(ctx)
+	return gerrors.Wrap(err)
+}
+
+// Ready tells the job is accepted, Init is done
+func (ex *Executor) Ready() bool {
+	return ex.ready.Load()
+}
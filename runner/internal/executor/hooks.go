@@ -0,0 +1,74 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+const (
+	hookPreRun  = "pre_run"
+	hookPostRun = "post_run"
+)
+
+func (ex *Executor) runPreRunHooks(ctx context.Context, job *models.Job) error {
+	if ex.config.Hooks == nil {
+		return nil
+	}
+	return gerrors.Wrap(ex.runHooks(ctx, hookPreRun, ex.config.Hooks.PreRun, hookEnv(job, nil)))
+}
+
+// runPostRunHooks never fails the job, errors are only logged
+func (ex *Executor) runPostRunHooks(ctx context.Context, job *models.Job, jobErr error) {
+	if ex.config.Hooks == nil {
+		return
+	}
+	if err := ex.runHooks(ctx, hookPostRun, ex.config.Hooks.PostRun, hookEnv(job, jobErr)); err != nil {
+		log.Error(ctx, "Post-run hook failed", "err", err)
+	}
+}
+
+func (ex *Executor) runHooks(ctx context.Context, phase string, commands []string, env []string) error {
+	timeout := consts.DEFAULT_HOOK_TIMEOUT
+	if ex.config.Hooks.Timeout > 0 {
+		timeout = time.Duration(ex.config.Hooks.Timeout) * time.Second
+	}
+	for _, command := range commands {
+		log.Trace(ctx, "Running hook", "phase", phase, "command", command)
+		hookCtx, cancel := context.WithTimeout(ctx, timeout)
+		cmd := exec.CommandContext(hookCtx, "sh", "-c", command)
+		cmd.Env = append(os.Environ(), env...)
+		output, err := cmd.CombinedOutput()
+		cancel()
+		log.Info(ctx, "Hook finished", "phase", phase, "command", command, "output", string(output))
+		if err != nil {
+			return gerrors.Newf("%s hook %q: %v", phase, command, err)
+		}
+	}
+	return nil
+}
+
+func hookEnv(job *models.Job, jobErr error) []string {
+	env := []string{
+		fmt.Sprintf("DSTACK_JOB_ID=%s", job.JobID),
+		fmt.Sprintf("DSTACK_RUN_NAME=%s", job.RunName),
+		fmt.Sprintf("DSTACK_REPO_ID=%s", job.RepoId),
+	}
+	if jobErr != nil {
+		env = append(env, fmt.Sprintf("DSTACK_JOB_ERROR=%s", jobErr.Error()))
+		exited := &container.ContainerExitedError{}
+		if errors.As(jobErr, exited) {
+			env = append(env, fmt.Sprintf("DSTACK_CONTAINER_EXIT_CODE=%d", exited.ExitCode))
+		}
+	}
+	return env
+}
@@ -0,0 +1,18 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHookEnv(t *testing.T) {
+	job := &models.Job{JobID: "job", RunName: "run", RepoId: "repo"}
+	assert.Equal(t, []string{"DSTACK_JOB_ID=job", "DSTACK_RUN_NAME=run", "DSTACK_REPO_ID=repo"}, hookEnv(job, nil))
+
+	env := hookEnv(job, gerrors.Wrap(container.ContainerExitedError{ExitCode: 2}))
+	assert.Equal(t, "DSTACK_CONTAINER_EXIT_CODE=2", env[len(env)-1])
+}
@@ -0,0 +1,116 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/hfhub"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// publishHuggingFace commits the artifact paths of the job to its hub repo and records the commit
+func (ex *Executor) publishHuggingFace(ctx context.Context, job *models.Job) error {
+	config := job.HuggingFace
+	secrets, err := ex.fetchSecrets(ctx)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	tokenSecret := config.TokenSecret
+	if tokenSecret == "" {
+		tokenSecret = consts.HF_TOKEN_SECRET
+	}
+	token, ok := secrets[tokenSecret]
+	if !ok {
+		return gerrors.Newf("no secret %s with the Hugging Face token", tokenSecret)
+	}
+	ex.logSecrets.Add(token)
+	var files []hfhub.File
+	for _, p := range config.Paths {
+		local, err := ex.artifactLocalPath(ctx, job, p)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		found, err := publishedFiles(local)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		files = append(files, found...)
+	}
+	if len(files) == 0 {
+		return gerrors.New("no files to publish to Hugging Face")
+	}
+	message := config.CommitMessage
+	if message == "" {
+		message = fmt.Sprintf("Upload the artifacts of the dstack run %s", job.RunName)
+	}
+	ctx, cancel := context.WithTimeout(ctx, consts.HF_PUBLISH_TIMEOUT)
+	defer cancel()
+	log.Info(ctx, "Publishing the artifacts to Hugging Face", "repo", config.Repo, "files", len(files))
+	repo := hfhub.Repo{ID: config.Repo, Type: config.RepoType, Revision: config.Revision}
+	commit, err := hfhub.New(config.Endpoint, token).Commit(ctx, repo, files, message)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	log.Info(ctx, "Artifacts are published to Hugging Face", "repo", config.Repo, "commit", commit)
+	return gerrors.Wrap(ex.updateJob(ctx, func(job *models.Job) {
+		job.HuggingFace.Commit = commit
+	}))
+}
+
+// artifactLocalPath finds the host path of a path inside one of the job artifacts
+func (ex *Executor) artifactLocalPath(ctx context.Context, job *models.Job, p string) (string, error) {
+	pathInterpolator := ex.pathInterpolator(ctx)
+	p = path.Clean(p)
+	for _, artifact := range job.Artifacts {
+		artifactPath, err := pathInterpolator.Interpolate(ctx, artifact.Path)
+		if err != nil {
+			return "", gerrors.Wrap(err)
+		}
+		artifactPath = path.Clean(artifactPath)
+		if p != artifactPath && !strings.HasPrefix(p, artifactPath+"/") {
+			continue
+		}
+		// the mounted artifacts of the backends live in the FUSE dir, the others are copied
+		rootDir := consts.USER_ARTIFACTS_DIR
+		if artifact.Mount && ex.config.Artifacts == nil {
+			rootDir = consts.FUSE_DIR
+		}
+		return filepath.Join(ex.backend.GetTMPDir(ctx), rootDir, job.RunName, filepath.FromSlash(p)), nil
+	}
+	return "", gerrors.Newf("%s is not in the job artifacts", p)
+}
+
+// publishedFiles lists the regular files of the dir by their paths inside it, a file is published by its name
+func publishedFiles(local string) ([]hfhub.File, error) {
+	info, err := os.Stat(local)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if !info.IsDir() {
+		return []hfhub.File{{Path: filepath.Base(local), Local: local}}, nil
+	}
+	var files []hfhub.File
+	err = filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(local, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, hfhub.File{Path: filepath.ToSlash(rel), Local: p})
+		return nil
+	})
+	return files, gerrors.Wrap(err)
+}
@@ -2,26 +2,52 @@ package executor
 
 import (
 	"context"
-	"errors"
+	"encoding/base64"
 	"fmt"
-	"github.com/dstackai/dstack/runner/internal/common"
-	"github.com/dstackai/dstack/runner/internal/log"
 	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
 )
 
 const (
 	PatternOpening = "${{"
 	PatternClosing = "}}"
+	// the short form ${namespace.name} is an expression only for the added namespaces, the shell variables are kept
+	shortOpening = "${"
+	shortClosing = "}"
+	// defaultSeparator is followed by the value of the missing or empty variables, it may have expressions
+	defaultSeparator = ":-"
 )
 
+// interpolatorFunctions transform the value of their argument, e.g. ${{ upper(env.NAME) }}
+var interpolatorFunctions = map[string]func(string) string{
+	"lower":  strings.ToLower,
+	"upper":  strings.ToUpper,
+	"trim":   strings.TrimSpace,
+	"base64": func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	// quote makes the value a single shell word
+	"quote": func(s string) string { return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'" },
+}
+
+// VariablesInterpolator replaces the expressions ${{ name }} and ${namespace.name} with the variable values.
+// An expression is a variable, a 'literal' or a function of an expression, followed by an optional :-default.
+// The defaults may have nested expressions, $$ is an escaped $.
 type VariablesInterpolator struct {
-	Variables map[string]string
+	Variables  map[string]string
+	namespaces map[string]bool
+	// shell keeps $$ as is unless it escapes an expression, the commands use it for the shell PID
+	shell bool
 }
 
 func (vi *VariablesInterpolator) Add(namespace string, vars map[string]string) {
 	if vi.Variables == nil {
 		vi.Variables = make(map[string]string, len(vars))
 	}
+	if vi.namespaces == nil {
+		vi.namespaces = make(map[string]bool)
+	}
+	vi.namespaces[namespace] = true
 	for k, v := range vars {
 		vi.Variables[fmt.Sprintf("%s.%s", namespace, k)] = v
 	}
@@ -29,40 +55,165 @@ func (vi *VariablesInterpolator) Add(namespace string, vars map[string]string) {
 
 func (vi *VariablesInterpolator) Interpolate(ctx context.Context, s string) (string, error) {
 	log.Trace(ctx, "Interpolating", "s", s)
-	var sb strings.Builder
+	result, _, err := vi.text(ctx, s, "")
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return result, nil
+}
+
+// InterpolateAll interpolates the shell commands, $$ is an escaped $ only before an expression, e.g. $${{ name }},
+// elsewhere it is kept for the shell
+func (vi *VariablesInterpolator) InterpolateAll(ctx context.Context, values []string) ([]string, error) {
+	shell := *vi
+	shell.shell = true
+	result := make([]string, len(values))
+	for i, value := range values {
+		if !strings.Contains(value, shortOpening) {
+			result[i] = value
+			continue
+		}
+		interpolated, err := shell.Interpolate(ctx, value)
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		result[i] = interpolated
+	}
+	return result, nil
+}
 
-	start := 0
-	for start < len(s) {
-		dollar := common.IndexWithOffset(s, "$", start)
-		if dollar == -1 || dollar == len(s)-1 {
-			sb.WriteString(s[start:])
-			break
+// text interpolates s until the stop string at the top level, it returns the consumed length including the stop
+func (vi *VariablesInterpolator) text(ctx context.Context, s, stop string) (string, int, error) {
+	var sb strings.Builder
+	i := 0
+	for i < len(s) {
+		if stop != "" && strings.HasPrefix(s[i:], stop) {
+			return sb.String(), i + len(stop), nil
 		}
-		if s[dollar+1] == '$' { // $$ = escaped $
-			sb.WriteString(s[start : dollar+1])
-			start = dollar + 2
+		if s[i] != '$' {
+			sb.WriteByte(s[i])
+			i++
 			continue
 		}
+		switch {
+		case strings.HasPrefix(s[i:], "$$") && vi.shell && !vi.opensExpression(s[i+1:]):
+			sb.WriteString("$$")
+			i += 2
+		case strings.HasPrefix(s[i:], "$$"):
+			sb.WriteByte('$')
+			i += 2
+		case strings.HasPrefix(s[i:], PatternOpening):
+			value, n, err := vi.expression(ctx, s[i+len(PatternOpening):], PatternClosing)
+			if err != nil {
+				return "", 0, err
+			}
+			sb.WriteString(value)
+			i += len(PatternOpening) + n
+		case strings.HasPrefix(s[i:], shortOpening) && vi.namespaces[namespaceOf(s[i+len(shortOpening):])]:
+			value, n, err := vi.expression(ctx, s[i+len(shortOpening):], shortClosing)
+			if err != nil {
+				return "", 0, err
+			}
+			sb.WriteString(value)
+			i += len(shortOpening) + n
+		default:
+			sb.WriteByte('$')
+			i++
+		}
+	}
+	if stop != "" {
+		return "", 0, gerrors.Newf("no pattern closing: %s", s)
+	}
+	return sb.String(), i, nil
+}
 
-		opening := common.IndexWithOffset(s, PatternOpening, start)
-		if opening == -1 {
-			sb.WriteString(s[start:])
-			break
+// expression evaluates s until the stop string, it returns the consumed length including the stop
+func (vi *VariablesInterpolator) expression(ctx context.Context, s, stop string) (string, int, error) {
+	i := skipSpaces(s, 0)
+	value, found, n, err := vi.term(ctx, s[i:])
+	if err != nil {
+		return "", 0, err
+	}
+	i = skipSpaces(s, i+n)
+	if strings.HasPrefix(s[i:], defaultSeparator) {
+		i += len(defaultSeparator)
+		fallback, n, err := vi.text(ctx, s[i:], stop)
+		if err != nil {
+			return "", 0, err
 		}
-		sb.WriteString(s[start:opening])
-		closing := common.IndexWithOffset(s, PatternClosing, opening)
-		if closing == -1 {
-			return "", errors.New(fmt.Sprintf("no pattern closing: %s", s[opening:]))
+		if !found || value == "" {
+			value = fallback
+			if stop == PatternClosing {
+				value = strings.TrimSpace(value)
+			}
 		}
+		return value, i + n, nil
+	}
+	if !strings.HasPrefix(s[i:], stop) {
+		return "", 0, gerrors.Newf("no pattern closing: %s", s)
+	}
+	return value, i + len(stop), nil
+}
 
-		name := strings.TrimSpace(s[opening+len(PatternOpening) : closing])
+// term is a variable, a quoted literal or a function call. Found is false for the missing variables.
+func (vi *VariablesInterpolator) term(ctx context.Context, s string) (string, bool, int, error) {
+	if strings.HasPrefix(s, "'") {
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", false, 0, gerrors.Newf("no literal closing: %s", s)
+		}
+		return s[1 : end+1], true, end + 2, nil
+	}
+	name := s[:nameLength(s)]
+	if name == "" {
+		return "", false, 0, gerrors.Newf("expression expected: %s", s)
+	}
+	i := skipSpaces(s, len(name))
+	if !strings.HasPrefix(s[i:], "(") {
 		value, ok := vi.Variables[name]
-		if ok {
-			sb.WriteString(value)
-		} else {
+		if !ok {
 			log.Warning(ctx, "Variable is missing", "name", name)
 		}
-		start = closing + len(PatternClosing)
+		return value, ok, len(name), nil
+	}
+	fn, ok := interpolatorFunctions[name]
+	if !ok {
+		return "", false, 0, gerrors.Newf("unknown function: %s", name)
+	}
+	arg, n, err := vi.expression(ctx, s[i+1:], ")")
+	if err != nil {
+		return "", false, 0, err
+	}
+	return fn(arg), true, i + 1 + n, nil
+}
+
+// opensExpression reports whether s starts with an expression, ${{ or ${namespace.name}
+func (vi *VariablesInterpolator) opensExpression(s string) bool {
+	return strings.HasPrefix(s, PatternOpening) || strings.HasPrefix(s, shortOpening) && vi.namespaces[namespaceOf(s[len(shortOpening):])]
+}
+
+// namespaceOf returns the namespace of the name at the start of s, if it has one
+func namespaceOf(s string) string {
+	name := s[:nameLength(s)]
+	dot := strings.IndexByte(name, '.')
+	if dot <= 0 {
+		return ""
+	}
+	return name[:dot]
+}
+
+func nameLength(s string) int {
+	for i, c := range s {
+		if !(c == '_' || c == '.' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+			return i
+		}
+	}
+	return len(s)
+}
+
+func skipSpaces(s string, i int) int {
+	for i < len(s) && (s[i] == ' ' || s[i] == '\t') {
+		i++
 	}
-	return sb.String(), nil
+	return i
 }
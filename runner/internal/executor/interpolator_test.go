@@ -61,3 +61,49 @@ func TestSecrets(t *testing.T) {
 	assert.Equal(t, nil, err)
 	assert.Equal(t, "qwerty", result)
 }
+
+func TestDefault(t *testing.T) {
+	var vi VariablesInterpolator
+	vi.Add("secrets", map[string]string{"empty": ""})
+	result, err := vi.Interpolate(context.Background(), "${{ secrets.token :- anonymous }} ${secrets.empty:-none}")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "anonymous none", result)
+}
+
+func TestNestedDefault(t *testing.T) {
+	var vi VariablesInterpolator
+	vi.Add("env", map[string]string{"HOME": "/root"})
+	result, err := vi.Interpolate(context.Background(), "${env.CACHE:-${env.HOME}/.cache}")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "/root/.cache", result)
+}
+
+func TestShellVariable(t *testing.T) {
+	var vi VariablesInterpolator
+	vi.Add("env", map[string]string{"HOME": "/root"})
+	result, err := vi.Interpolate(context.Background(), "${HOME} ${env.HOME} $${env.HOME}")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "${HOME} /root ${env.HOME}", result)
+}
+
+func TestFunctions(t *testing.T) {
+	var vi VariablesInterpolator
+	vi.Add("env", map[string]string{"NAME": " Run ", "QUOTED": "it's"})
+	result, err := vi.Interpolate(context.Background(), "${{ lower(trim(env.NAME)) }} ${{ quote(env.QUOTED) }} ${{ base64(env.MISSING:-a) }} ${{ upper('x') }}")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `run 'it'\''s' YQ== X`, result)
+}
+
+func TestUnknownFunction(t *testing.T) {
+	var vi VariablesInterpolator
+	_, err := vi.Interpolate(context.Background(), "${{ sha(env.NAME) }}")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestInterpolateCommands(t *testing.T) {
+	var vi VariablesInterpolator
+	vi.Add("env", map[string]string{"HOME": "/root"})
+	result, err := vi.InterpolateAll(context.Background(), []string{"echo ${HOME} $$", "echo ${env.HOME} $$ $${env.HOME} $${{ env.HOME }}", "kill $$"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{"echo ${HOME} $$", "echo /root $$ ${env.HOME} ${{ env.HOME }}", "kill $$"}, result)
+}
@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"context"
+	"io"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/joblog"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// dockerSocket is where the job container finds the host daemon
+const dockerSocket = "/var/run/docker.sock"
+
+// nestedDocker gives the job container a Docker daemon. Either way the job is root on the host in effect.
+func (ex *Executor) nestedDocker(ctx context.Context, spec *container.Spec, mode string) error {
+	switch mode {
+	case "":
+		return nil
+	case models.DockerSocket:
+		socket := ex.engine.SocketPath()
+		if socket == "" {
+			return gerrors.New("the Docker daemon is not reachable with a unix socket")
+		}
+		log.Warning(ctx, "The job gets the host Docker socket, it controls every container of the host")
+		spec.Mounts = append(spec.Mounts, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: socket,
+			Target: dockerSocket,
+		})
+		return nil
+	case models.DockerInDocker:
+		log.Warning(ctx, "The job runs a privileged Docker daemon sidecar")
+		if spec.Network == container.NetworkHost || spec.HostNetwork {
+			log.Warning(ctx, "The Docker daemon sidecar listens on the host network", "address", consts.DIND_HOST)
+		}
+		spec.Env = append(spec.Env, "DOCKER_HOST="+consts.DIND_HOST)
+		return nil
+	}
+	return gerrors.Newf("unknown docker mode: %s", mode)
+}
+
+// dindSidecar is the daemon of the dind jobs, it shares the network of the job container and takes a few seconds to listen
+func dindSidecar(logs io.Writer) container.SidecarSpec {
+	return container.SidecarSpec{
+		Name:  "dind",
+		Image: consts.DIND_IMAGE,
+		// an empty cert dir disables TLS, the daemon is reachable from the job network namespace only
+		Env:        []string{"DOCKER_TLS_CERTDIR="},
+		Privileged: true,
+		Logs:       joblog.NewPrefixWriter(logs, "[dind] "),
+	}
+}
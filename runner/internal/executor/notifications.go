@@ -0,0 +1,37 @@
+package executor
+
+import (
+	"context"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/notify"
+)
+
+// notifyEnd sends the notifications of the job end, the errors are only logged
+func (ex *Executor) notifyEnd(ctx context.Context, startedAt time.Time) {
+	job := ex.JobSnapshot(ctx)
+	config := ex.config.Notifications
+	if job.Notifications != nil {
+		config = job.Notifications
+	}
+	if config == nil || !notify.Wanted(config, job.Status) {
+		return
+	}
+	n := notify.Notification{
+		RunName:   job.RunName,
+		JobID:     job.JobID,
+		Status:    job.Status,
+		ErrorCode: job.ErrorCode,
+		ExitCode:  job.ContainerExitCode,
+		Duration:  time.Since(startedAt),
+	}
+	if config.LogsURL != "" {
+		n.LogsURL = notify.LogsURL(config.LogsURL, &job)
+	}
+	for _, sink := range notify.Sinks(config) {
+		if err := sink.Notify(ctx, n); err != nil {
+			log.Error(ctx, "Failed to send the notification", "sink", sink.Name(), "err", err)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/backend"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/internal/retry"
+)
+
+// stateQueue are the job changes since the last written state. A write sends the whole job, so the queue only
+// matters on a conflict: the job is reread and all the changes are applied again.
+type stateQueue struct {
+	changes []func(job *models.Job)
+	// since is when the backend became unreachable, zero while it is online
+	since time.Time
+}
+
+func (q *stateQueue) push(change func(job *models.Job)) {
+	q.changes = append(q.changes, change)
+}
+
+func (q *stateQueue) offline() bool {
+	return !q.since.IsZero()
+}
+
+// flushState writes the job with the queued changes, the queue is emptied on success
+func (ex *Executor) flushState(ctx context.Context, policy retry.Policy) error {
+	attempt := 0
+	err := policy.Do(ctx, "update state", func() error {
+		attempt++
+		err := ex.backend.UpdateState(ctx)
+		if err == nil || !errors.Is(err, backend.ErrStateConflict) {
+			return err
+		}
+		log.Warning(ctx, "Job state was changed concurrently, reapplying the update", "attempt", attempt)
+		job, errRefetch := ex.backend.RefetchJob(ctx)
+		if errRefetch != nil {
+			return errRefetch
+		}
+		for _, change := range ex.stateQueue.changes {
+			change(job)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if ex.stateQueue.offline() {
+		log.Info(ctx, "Queued job state updates are flushed", "changes", len(ex.stateQueue.changes), "offline", time.Since(ex.stateQueue.since))
+	}
+	ex.stateQueue = stateQueue{}
+	return nil
+}
+
+// drainState waits for the backend to write the queued changes before the runner exits, up to maxOffline since it became unreachable
+func (ex *Executor) drainState(ctx context.Context) {
+	ex.jobMu.Lock()
+	defer ex.jobMu.Unlock()
+	if !ex.stateQueue.offline() {
+		return
+	}
+	left := time.Until(ex.stateQueue.since.Add(ex.config.maxOffline()))
+	if left < consts.UPDATE_STATE_MAX_ELAPSED {
+		left = consts.UPDATE_STATE_MAX_ELAPSED
+	}
+	log.Info(ctx, "Flushing the queued job state updates", "changes", len(ex.stateQueue.changes), "timeout", left)
+	policy := ex.backoff
+	policy.MaxElapsed = left
+	if err := ex.flushState(ctx, policy); err != nil {
+		log.Error(ctx, "Queued job state updates are lost", "changes", len(ex.stateQueue.changes), "err", err)
+		return
+	}
+	ex.stateDegraded.Store(false)
+}
@@ -0,0 +1,87 @@
+package executor
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// outputsPath is the outputs file on the host, it is inside the /workflow bind of the job container
+func (ex *Executor) outputsPath(ctx context.Context, job *models.Job) string {
+	return filepath.Join(ex.backend.GetTMPDir(ctx), consts.RUNS_DIR, job.RunName, job.JobID, consts.OUTPUTS_FILE)
+}
+
+// prepareOutputs creates the outputs dir writable by any container user and drops the outputs of a previous attempt
+func (ex *Executor) prepareOutputs(ctx context.Context, job *models.Job) error {
+	file := ex.outputsPath(ctx, job)
+	if err := os.MkdirAll(filepath.Dir(file), 0777); err != nil {
+		return gerrors.Wrap(err)
+	}
+	// MkdirAll is subject to umask
+	if err := os.Chmod(filepath.Dir(file), 0777); err != nil {
+		return gerrors.Wrap(err)
+	}
+	if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+// collectOutputs persists the outputs the job wrote. Bad outputs don't fail the job, they are only logged.
+func (ex *Executor) collectOutputs(ctx context.Context, job *models.Job) {
+	file, err := os.Open(ex.outputsPath(ctx, job))
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		log.Warning(ctx, "Failed to open the job outputs", "err", err)
+		return
+	}
+	defer func() { _ = file.Close() }()
+	outputs, err := parseOutputs(file)
+	if err != nil {
+		log.Warning(ctx, "Failed to read the job outputs", "err", err)
+		return
+	}
+	if len(outputs) == 0 {
+		return
+	}
+	log.Info(ctx, "Job outputs are collected", "count", len(outputs))
+	if err = ex.updateJob(ctx, func(job *models.Job) {
+		job.Outputs = outputs
+	}); err != nil {
+		log.Error(ctx, "Failed to write the job outputs", "err", err)
+	}
+}
+
+// parseOutputs reads key=value lines, the later value of a key wins. Empty lines and # comments are skipped.
+func parseOutputs(r io.Reader) (map[string]string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, consts.MAX_OUTPUTS_SIZE+1))
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if len(data) > consts.MAX_OUTPUTS_SIZE {
+		return nil, gerrors.Newf("outputs exceed %d bytes", consts.MAX_OUTPUTS_SIZE)
+	}
+	outputs := make(map[string]string)
+	for n, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, found := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, gerrors.Newf("line %d is not key=value", n+1)
+		}
+		outputs[key] = strings.TrimSpace(value)
+	}
+	return outputs, nil
+}
@@ -0,0 +1,29 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseOutputs(t *testing.T) {
+	outputs, err := parseOutputs(strings.NewReader("# model\nmodel=s3://bucket/model.pt\n\naccuracy = 0.93\nargs=--lr=0.1\nmodel=s3://bucket/best.pt\n"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]string{
+		"model":    "s3://bucket/best.pt",
+		"accuracy": "0.93",
+		"args":     "--lr=0.1",
+	}, outputs)
+}
+
+func TestParseOutputsInvalid(t *testing.T) {
+	_, err := parseOutputs(strings.NewReader("model=a\nmodel\n"))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestParseOutputsTooLarge(t *testing.T) {
+	_, err := parseOutputs(strings.NewReader("key=" + strings.Repeat("a", consts.MAX_OUTPUTS_SIZE)))
+	assert.NotEqual(t, nil, err)
+}
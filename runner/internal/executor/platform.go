@@ -0,0 +1,55 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// noGPUHost is set on the Macs, they have no NVIDIA GPUs and the local jobs run on the CPU there
+var noGPUHost = runtime.GOOS == "darwin"
+
+type EmulationError struct {
+	Image    string
+	Platform string
+}
+
+func (e EmulationError) Error() string {
+	return fmt.Sprintf("the image %s is built for %s, it would run emulated and no_emulation is set", e.Image, e.Platform)
+}
+
+// applyPlatform requests the platform of the job, or the default one of the runner, and drops the GPU requirements the host can't meet
+func (ex *Executor) applyPlatform(ctx context.Context, job *models.Job) {
+	switch {
+	case job.Platform != "":
+		ex.engine.SetPlatform(job.Platform)
+	case ex.config.Platform != "":
+		log.Trace(ctx, "Using the default platform of the runner", "platform", ex.config.Platform)
+		ex.engine.SetPlatform(ex.config.Platform)
+	}
+	if req := ex.backend.Requirements(ctx); req.GPUs.Count > 0 && noGPUHost {
+		log.Warning(ctx, "The host has no NVIDIA GPUs, the job runs without them", "gpus", req.GPUs.Count)
+	}
+}
+
+// checkEmulation warns the image runs emulated, e.g. an amd64 image on Apple Silicon, or fails the job if the runner forbids it
+func (ex *Executor) checkEmulation(ctx context.Context, image string, progress io.Writer) error {
+	platform, emulated, err := ex.engine.ImagePlatform(ctx, image)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if !emulated {
+		return nil
+	}
+	if ex.config.NoEmulation {
+		return gerrors.Wrap(EmulationError{Image: image, Platform: platform})
+	}
+	log.Warning(ctx, "The image runs emulated", "image", image, "platform", platform)
+	_, err = fmt.Fprintf(progress, "The image is built for %s, it runs emulated and may be slow\n\n", platform)
+	return gerrors.Wrap(err)
+}
@@ -0,0 +1,44 @@
+package executor
+
+import (
+	"context"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// Preempt stops the job for a job of a higher priority, it ends as preempted
+func (ex *Executor) Preempt() {
+	ex.preempted.Store(true)
+	ex.Stop()
+}
+
+// Pause freezes the running job container, the job is marked paused until Resume
+func (ex *Executor) Pause(ctx context.Context) error {
+	docker, err := ex.runningContainer()
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if err = docker.Pause(ctx); err != nil {
+		return gerrors.Wrap(err)
+	}
+	log.Info(ctx, "Job is paused for a job of a higher priority")
+	return gerrors.Wrap(ex.updateJob(ctx, func(job *models.Job) {
+		job.Paused = true
+	}))
+}
+
+func (ex *Executor) Resume(ctx context.Context) error {
+	docker, err := ex.runningContainer()
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if err = docker.Unpause(ctx); err != nil {
+		return gerrors.Wrap(err)
+	}
+	log.Info(ctx, "Job is resumed")
+	return gerrors.Wrap(ex.updateJob(ctx, func(job *models.Job) {
+		job.Paused = false
+	}))
+}
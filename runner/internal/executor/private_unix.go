@@ -0,0 +1,10 @@
+//go:build !windows
+
+package executor
+
+import "os"
+
+// writePrivateFile writes the credentials readable by the owner only, the existing file is rewritten in place
+func writePrivateFile(name string, data []byte) error {
+	return os.WriteFile(name, data, 0600)
+}
@@ -0,0 +1,130 @@
+package executor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+type dialFunc func(ctx context.Context) (net.Conn, error)
+
+func hasProbes(apps []models.App) bool {
+	for _, app := range apps {
+		if app.Probe != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// watchProbes probes the apps of the running container until they are ready or done is closed
+func (ex *Executor) watchProbes(ctx context.Context, done chan struct{}) {
+	// a restarted container listens anew
+	err := ex.updateJob(ctx, func(job *models.Job) {
+		for i := range job.Apps {
+			job.Apps[i].Ready = false
+		}
+	})
+	if err != nil {
+		log.Error(ctx, "Failed to reset the apps readiness", "err", err)
+	}
+	var wg sync.WaitGroup
+	for _, app := range ex.backend.Job(ctx).Apps {
+		if app.Probe == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(app models.App) {
+			defer wg.Done()
+			ex.probeApp(ctx, app, done)
+		}(app)
+	}
+	wg.Wait()
+}
+
+func (ex *Executor) probeApp(ctx context.Context, app models.App, done chan struct{}) {
+	probe := app.Probe
+	if probe.Type != models.ProbeHTTP && probe.Type != models.ProbeTCP {
+		log.Warning(ctx, "Unknown probe type, the app is never ready", "app", app.Name, "type", probe.Type)
+		return
+	}
+	interval := consts.DELAY_PROBE
+	if probe.IntervalSeconds > 0 {
+		interval = time.Duration(probe.IntervalSeconds) * time.Second
+	}
+	timeout := consts.PROBE_TIMEOUT
+	if probe.TimeoutSeconds > 0 {
+		timeout = time.Duration(probe.TimeoutSeconds) * time.Second
+	}
+	dial := func(ctx context.Context) (net.Conn, error) { return ex.DialContainer(ctx, app.Port) }
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := runProbe(probeCtx, probe, app.Port, dial)
+		cancel()
+		if err == nil {
+			break
+		}
+		log.Trace(ctx, "App is not ready", "app", app.Name, "err", err)
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+	log.Info(ctx, "App is ready", "app", app.Name, "port", app.Port)
+	err := ex.updateJob(ctx, func(job *models.Job) {
+		for i := range job.Apps {
+			if job.Apps[i].Name == app.Name {
+				job.Apps[i].Ready = true
+			}
+		}
+	})
+	if err != nil {
+		log.Error(ctx, "Failed to mark the app ready", "app", app.Name, "err", err)
+	}
+}
+
+func runProbe(ctx context.Context, probe *models.Probe, port int, dial dialFunc) error {
+	if probe.Type == models.ProbeTCP {
+		conn, err := dial(ctx)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		return gerrors.Wrap(conn.Close())
+	}
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext:       func(ctx context.Context, _, _ string) (net.Conn, error) { return dial(ctx) },
+			DisableKeepAlives: true,
+		},
+		// a redirect, e.g. to a login page, is a response of the listening app
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	path := probe.Path
+	if path == "" || path[0] != '/' {
+		path = "/" + path
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost:"+strconv.Itoa(port)+path, nil)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return gerrors.Newf("unexpected status %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package executor
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunProbe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/health" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	dial := func(ctx context.Context) (net.Conn, error) {
+		var dialer net.Dialer
+		return dialer.DialContext(ctx, "tcp", server.Listener.Addr().String())
+	}
+	ctx := context.Background()
+	assert.Equal(t, nil, runProbe(ctx, &models.Probe{Type: models.ProbeHTTP, Path: "health"}, 80, dial))
+	assert.NotEqual(t, nil, runProbe(ctx, &models.Probe{Type: models.ProbeHTTP, Path: "/"}, 80, dial))
+	assert.Equal(t, nil, runProbe(ctx, &models.Probe{Type: models.ProbeTCP}, 80, dial))
+
+	server.Close()
+	assert.NotEqual(t, nil, runProbe(ctx, &models.Probe{Type: models.ProbeTCP}, 80, dial))
+}
@@ -0,0 +1,42 @@
+package executor
+
+import (
+	"os"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// Proxy is the HTTP(S) proxy of the host network. The runner itself, i.e. git and the backend clients,
+// and the job containers go through it. The Docker daemon has its own proxy settings for the image pulls.
+type Proxy struct {
+	HTTP    string `yaml:"http,omitempty"`
+	HTTPS   string `yaml:"https,omitempty"`
+	NoProxy string `yaml:"no_proxy,omitempty"`
+}
+
+// Env returns the proxy variables in both cases, the tools disagree on which one they read
+func (p *Proxy) Env() map[string]string {
+	env := make(map[string]string)
+	if p == nil {
+		return env
+	}
+	for name, value := range map[string]string{"HTTP_PROXY": p.HTTP, "HTTPS_PROXY": p.HTTPS, "NO_PROXY": p.NoProxy} {
+		if value == "" {
+			continue
+		}
+		env[name] = value
+		env[strings.ToLower(name)] = value
+	}
+	return env
+}
+
+// Apply sets the proxy of the runner process. The HTTP clients read it once, so it must precede any request.
+func (p *Proxy) Apply() error {
+	for name, value := range p.Env() {
+		if err := os.Setenv(name, value); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package executor
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// canReexec is set where the runner replaces its process with the updated binary
+const canReexec = true
+
+// Exec replaces the runner with the updated binary, it is started with the same arguments and returns only on failure
+func (e UpdateRequired) Exec() error {
+	args := append([]string{e.Binary}, os.Args[1:]...)
+	env := append(os.Environ(), fmt.Sprintf("%s=%s", consts.ENV_RUNNER_UPDATED, e.Version))
+	return gerrors.Wrap(syscall.Exec(e.Binary, args, env))
+}
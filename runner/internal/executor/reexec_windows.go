@@ -0,0 +1,10 @@
+package executor
+
+import "github.com/dstackai/dstack/runner/internal/gerrors"
+
+// canReexec is unset on Windows, there is no exec and a child runner can't bind the ports held by the parent
+const canReexec = false
+
+func (e UpdateRequired) Exec() error {
+	return gerrors.New("the runner can't re-execute itself on Windows")
+}
@@ -0,0 +1,46 @@
+package executor
+
+import (
+	"context"
+
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// registries merges the registries of the runner config and the credentials of the job, the job ones take precedence.
+// The registries with no credentials get them minted from the cloud identity of the instance.
+func (ex *Executor) registries(ctx context.Context, interpolator *VariablesInterpolator) container.Registries {
+	job := ex.backend.Job(ctx)
+	registries := container.Registries{
+		Auth: make(map[string]string),
+		Mint: ex.mintRegistryAuth,
+	}
+	if ex.config.Registries != nil {
+		registries.Mirrors = ex.config.Registries.Mirrors
+		registries.Insecure = ex.config.Registries.Insecure
+		for host, auth := range ex.config.Registries.Auth {
+			registries.Auth[host] = makeRegistryAuthBase64(auth.Username, auth.Password)
+		}
+	}
+	for host, auth := range job.RegistryAuths {
+		username, err := interpolator.Interpolate(ctx, auth.Username)
+		if err != nil {
+			log.Error(ctx, "Failed interpolating registry_auths.username", "err", err, "registry", host)
+		}
+		password, err := interpolator.Interpolate(ctx, auth.Password)
+		if err != nil {
+			log.Error(ctx, "Failed interpolating registry_auths.password", "err", err, "registry", host)
+		}
+		registries.Auth[host] = makeRegistryAuthBase64(username, password)
+	}
+	return registries
+}
+
+func (ex *Executor) mintRegistryAuth(ctx context.Context, host string) (string, error) {
+	username, password, ok, err := ex.registryTokens.Auth(ctx, host)
+	if err != nil || !ok {
+		return "", err
+	}
+	ex.logSecrets.Add(password)
+	return makeRegistryAuthBase64(username, password), nil
+}
@@ -0,0 +1,80 @@
+package executor
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/repo"
+	"github.com/dstackai/dstack/runner/internal/secrets/awssecrets"
+)
+
+// prepareExtraRepos clones the extra repos into the job repo, so they are available under /workflow
+func (ex *Executor) prepareExtraRepos(ctx context.Context) error {
+	job := ex.backend.Job(ctx)
+	if len(job.ExtraRepos) == 0 {
+		return nil
+	}
+	dir := ex.repoDir(ctx)
+	for _, extra := range job.ExtraRepos {
+		target, err := extraRepoDir(dir, extra.Path)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		log.Trace(ctx, "Cloning extra repo", "url", extra.URL, "path", extra.Path)
+		manager := repo.NewManager(ctx, extra.URL, extra.Ref, "").WithLocalPath(target)
+		if extra.CredentialsRef != "" {
+			credentials, err := ex.extraRepoCredentials(ctx, extra.CredentialsRef)
+			if err != nil {
+				return gerrors.Wrap(err)
+			}
+			if strings.HasPrefix(strings.TrimSpace(credentials), "-----BEGIN") {
+				manager.WithSSHAuth(credentials, "")
+			} else {
+				manager.WithTokenAuth(credentials)
+			}
+		}
+		if err = manager.Checkout(); err != nil {
+			return gerrors.Newf("failed to clone %s: %s", extra.URL, err)
+		}
+		if err = manager.SetConfig(job.RepoConfigName, job.RepoConfigEmail); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	return nil
+}
+
+// extraRepoCredentials resolves a secret reference or looks the secret up by name
+func (ex *Executor) extraRepoCredentials(ctx context.Context, credentialsRef string) (string, error) {
+	var value string
+	if ref, ok := awssecrets.ParseRef(credentialsRef); ok {
+		resolved, err := ex.secretRefs.Resolve(ctx, ref)
+		if err != nil {
+			return "", gerrors.Wrap(err)
+		}
+		value = resolved
+	} else {
+		secrets, err := ex.fetchSecrets(ctx)
+		if err != nil {
+			return "", gerrors.Wrap(err)
+		}
+		found, ok := secrets[credentialsRef]
+		if !ok {
+			return "", gerrors.Newf("secret %s is not found", credentialsRef)
+		}
+		value = found
+	}
+	ex.logSecrets.Add(value)
+	return value, nil
+}
+
+// extraRepoDir returns the clone directory, it must be a subdirectory of the job repo
+func extraRepoDir(repoDir, repoPath string) (string, error) {
+	cleanPath := filepath.Clean(filepath.FromSlash(repoPath))
+	if repoPath == "" || filepath.IsAbs(cleanPath) || cleanPath == "." || cleanPath == ".." || strings.HasPrefix(cleanPath, ".."+string(filepath.Separator)) {
+		return "", gerrors.Newf("extra repo path must be a subdirectory of the repo: %s", repoPath)
+	}
+	return filepath.Join(repoDir, cleanPath), nil
+}
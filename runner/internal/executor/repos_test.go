@@ -0,0 +1,17 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtraRepoDir(t *testing.T) {
+	dir, err := extraRepoDir("/runs/job", "libs/common")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "/runs/job/libs/common", dir)
+	for _, repoPath := range []string{"", ".", "..", "../other", "/etc", "libs/../../other"} {
+		_, err = extraRepoDir("/runs/job", repoPath)
+		assert.NotEqual(t, nil, err, repoPath)
+	}
+}
@@ -0,0 +1,57 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// resultLineSize cuts the log lines of the run result, the job state is read on every CLI poll
+const resultLineSize = 1024
+
+// runResult summarizes the failure for the CLI: the exit of the container, the last log lines
+// and the state of the instance
+func (ex *Executor) runResult(ctx context.Context, job *models.Job, errRun error, interrupted bool) *models.RunResult {
+	result := &models.RunResult{
+		Interrupted: interrupted,
+		GPUs:        latestGPUStats(job.GPUStats),
+		FinishedAt:  uint64(time.Now().UnixMilli()),
+	}
+	if errRun != nil {
+		result.Error = ex.logSecrets.Redact(errRun.Error())
+	}
+	exited := &container.ContainerExitedError{}
+	if errors.As(errRun, exited) {
+		result.ExitCode = exited.ExitCode
+		result.OOMKilled = exited.OOMKilled
+	}
+	if result.OOMKilled {
+		ex.oomDetails(job, exited, result)
+	}
+	if ex.logTail != nil {
+		for _, line := range ex.logTail.Lines() {
+			if len(line) > resultLineSize {
+				line = line[:resultLineSize]
+			}
+			result.LastLogs = append(result.LastLogs, line)
+		}
+	}
+	if free, err := freeDiskSpace(existingParent(ex.backend.GetTMPDir(ctx))); err == nil {
+		result.DiskFreeMiB = free / 1024 / 1024
+	}
+	return result
+}
+
+// oomDetails tells how much memory the job had, the whole host if the container had no limit
+func (ex *Executor) oomDetails(job *models.Job, exited *container.ContainerExitedError, result *models.RunResult) {
+	result.MemoryLimitMiB = uint64(exited.MemoryLimitMiB)
+	if result.MemoryLimitMiB == 0 {
+		result.MemoryLimitMiB = ex.engine.MemMiB()
+	}
+	if job.ContainerStats != nil {
+		result.MemoryUsedMiB = job.ContainerStats.MemoryUsedMiB
+	}
+}
@@ -0,0 +1,78 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// shouldRetry reports whether a failed container attempt is restarted in place
+func shouldRetry(policy *models.ContainerRetry, codes *models.ExitCodes, attempt int, err error) bool {
+	exited := &container.ContainerExitedError{}
+	if err == nil || !errors.As(err, exited) {
+		return false
+	}
+	if codes != nil && containsCode(codes.Retry, exited.ExitCode) {
+		maxAttempts := consts.DEFAULT_EXIT_CODE_ATTEMPTS
+		if policy != nil {
+			maxAttempts = policy.MaxAttempts
+		}
+		return attempt < maxAttempts
+	}
+	if policy == nil || attempt >= policy.MaxAttempts {
+		return false
+	}
+	return len(policy.ExitCodes) == 0 || containsCode(policy.ExitCodes, exited.ExitCode)
+}
+
+func containsCode(codes []int, code int) bool {
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// ExitStoppedError ends the job as stopped, see models.ExitCodes
+type ExitStoppedError struct {
+	ExitCode int
+}
+
+func (e ExitStoppedError) Error() string {
+	return fmt.Sprintf("container exited with the stopped exit code: %d", e.ExitCode)
+}
+
+// mapExitCode applies the exit codes of the job: the success ones are no error, the stopped ones are ExitStoppedError
+func mapExitCode(codes *models.ExitCodes, err error) error {
+	exited := &container.ContainerExitedError{}
+	if codes == nil || err == nil || !errors.As(err, exited) || exited.OOMKilled {
+		return err
+	}
+	if containsCode(codes.Success, exited.ExitCode) {
+		return nil
+	}
+	if containsCode(codes.Stopped, exited.ExitCode) {
+		return ExitStoppedError{ExitCode: exited.ExitCode}
+	}
+	return err
+}
+
+// retryBackoff doubles the delay after every failed attempt
+func retryBackoff(policy *models.ContainerRetry, attempt int) time.Duration {
+	if policy == nil {
+		return 0
+	}
+	backoff := time.Duration(policy.BackoffSeconds) * time.Second
+	for i := 1; i < attempt && backoff < consts.MAX_CONTAINER_RETRY_BACKOFF; i++ {
+		backoff *= 2
+	}
+	if backoff > consts.MAX_CONTAINER_RETRY_BACKOFF {
+		backoff = consts.MAX_CONTAINER_RETRY_BACKOFF
+	}
+	return backoff
+}
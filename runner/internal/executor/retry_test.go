@@ -0,0 +1,49 @@
+package executor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShouldRetry(t *testing.T) {
+	policy := &models.ContainerRetry{MaxAttempts: 3, ExitCodes: []int{137}}
+	exited := gerrors.Wrap(container.ContainerExitedError{ExitCode: 137})
+	assert.Equal(t, true, shouldRetry(policy, nil, 1, exited))
+	assert.Equal(t, false, shouldRetry(policy, nil, 3, exited))
+	assert.Equal(t, false, shouldRetry(policy, nil, 1, container.ContainerExitedError{ExitCode: 1}))
+	assert.Equal(t, false, shouldRetry(policy, nil, 1, errors.New("no space left on device")))
+	assert.Equal(t, false, shouldRetry(nil, nil, 1, exited))
+	assert.Equal(t, true, shouldRetry(&models.ContainerRetry{MaxAttempts: 2}, nil, 1, exited))
+}
+
+func TestShouldRetryExitCodes(t *testing.T) {
+	codes := &models.ExitCodes{Retry: []int{75}}
+	exited := container.ContainerExitedError{ExitCode: 75}
+	assert.Equal(t, true, shouldRetry(nil, codes, 1, exited))
+	assert.Equal(t, false, shouldRetry(nil, codes, consts.DEFAULT_EXIT_CODE_ATTEMPTS, exited))
+	assert.Equal(t, true, shouldRetry(&models.ContainerRetry{MaxAttempts: 5, ExitCodes: []int{1}}, codes, 4, exited))
+	assert.Equal(t, false, shouldRetry(nil, codes, 1, container.ContainerExitedError{ExitCode: 1}))
+}
+
+func TestMapExitCode(t *testing.T) {
+	codes := &models.ExitCodes{Success: []int{3}, Stopped: []int{137}}
+	assert.Equal(t, nil, mapExitCode(codes, gerrors.Wrap(container.ContainerExitedError{ExitCode: 3})))
+	assert.Equal(t, true, errors.As(mapExitCode(codes, container.ContainerExitedError{ExitCode: 137}), &ExitStoppedError{}))
+	oom := container.ContainerExitedError{ExitCode: 137, OOMKilled: true}
+	assert.Equal(t, oom, mapExitCode(codes, oom))
+	assert.Equal(t, nil, mapExitCode(codes, nil))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	policy := &models.ContainerRetry{BackoffSeconds: 10}
+	assert.Equal(t, 10*time.Second, retryBackoff(policy, 1))
+	assert.Equal(t, 40*time.Second, retryBackoff(policy, 3))
+	assert.Equal(t, consts.MAX_CONTAINER_RETRY_BACKOFF, retryBackoff(policy, 20))
+}
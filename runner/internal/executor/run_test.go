@@ -0,0 +1,136 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/consts/states"
+	fakebackend "github.com/dstackai/dstack/runner/internal/backend/testing"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/joblog"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/internal/stream"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFakeJob(t *testing.T, b *fakebackend.Backend) *models.Job {
+	var archive bytes.Buffer
+	tw := tar.NewWriter(&archive)
+	contents := []byte("hello\n")
+	assert.Equal(t, nil, tw.WriteHeader(&tar.Header{Name: "README.md", Mode: 0o644, Size: int64(len(contents))}))
+	_, err := tw.Write(contents)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, tw.Close())
+	b.SetFile("repos/code.tar", archive.Bytes())
+	return &models.Job{
+		JobID:            "job-1",
+		RunName:          "fast-moth-1",
+		RepoId:           "repo",
+		RepoType:         "local",
+		RepoCodeFilename: "repos/code.tar",
+		Image:            "ubuntu:22.04",
+		Commands:         []string{"echo hello"},
+		Artifacts:        []models.Artifact{{Path: "output"}},
+	}
+}
+
+// newFakeExecutor inits the executor of the fake job, changes are applied to the job before
+func newFakeExecutor(t *testing.T, program container.FakeProgram, changes ...func(job *models.Job)) (*Executor, *fakebackend.Backend, *container.FakeClient) {
+	configDir := t.TempDir()
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(configDir, consts.RUNNER_FILE_NAME), []byte("id: runner-1\n"), 0o644))
+	job := new(models.Job)
+	b := fakebackend.New(job, t.TempDir())
+	*job = *newFakeJob(t, b)
+	for _, change := range changes {
+		change(job)
+	}
+	client := container.NewFakeClient()
+	client.SetProgram(job.Image, program)
+	ex := NewWithEngine(b, container.NewEngineWithClient(client))
+	ex.SetStreamLogs(stream.New(0))
+	assert.Equal(t, nil, ex.Init(context.Background(), configDir))
+	return ex, b, client
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		program     container.FakeProgram
+		stop        bool
+		interrupted bool
+		err         bool
+		statuses    []string
+		exitCode    string
+		uploads     int
+	}{
+		{
+			name:     "done",
+			program:  container.FakeProgram{Output: "hello\n"},
+			statuses: []string{"", states.Pulling, states.Building, states.Running, states.Uploading, states.Done},
+			uploads:  1,
+		},
+		{
+			name:     "failed",
+			program:  container.FakeProgram{ExitCode: 3},
+			err:      true,
+			statuses: []string{"", states.Pulling, states.Building, states.Running, states.Failed},
+			exitCode: "3",
+		},
+		{
+			name:     "stopped",
+			program:  container.FakeProgram{Block: true},
+			stop:     true,
+			statuses: []string{"", states.Pulling, states.Building, states.Running, states.Uploading, states.Stopped},
+			uploads:  1,
+		},
+		{
+			name:        "interrupted",
+			program:     container.FakeProgram{ExitCode: 137},
+			interrupted: true,
+			statuses:    []string{"", states.Pulling, states.Building, states.Running},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex, b, client := newFakeExecutor(t, tt.program)
+			if tt.interrupted {
+				b.Interrupt()
+			}
+			if tt.stop {
+				go func() {
+					for client.Running() == 0 {
+						time.Sleep(10 * time.Millisecond)
+					}
+					ex.Stop()
+				}()
+			}
+			err := ex.Run(context.Background())
+			assert.Equal(t, tt.err, err != nil, err)
+			assert.Equal(t, tt.statuses, b.Statuses())
+			stored, err := b.Stored()
+			assert.Equal(t, nil, err)
+			assert.Equal(t, tt.exitCode, stored.ContainerExitCode)
+			assert.Equal(t, 1, len(client.Created()))
+			assert.Equal(t, 0, client.Running())
+			artifacts := b.Artifacts()
+			assert.Equal(t, 1, len(artifacts))
+			_, uploads := artifacts[0].Transfers()
+			assert.Equal(t, tt.uploads, uploads)
+		})
+	}
+}
+
+func TestPlainLogsTagStderr(t *testing.T) {
+	ex, _, _ := newFakeExecutor(t, container.FakeProgram{Output: "hello\n", Stderr: "oops\n"})
+	assert.Equal(t, nil, ex.Run(context.Background()))
+	contents, err := os.ReadFile(filepath.Join(ex.configDir, "logs", "jobs", "repo", "fast-moth-1.log"))
+	assert.Equal(t, nil, err)
+	assert.Contains(t, string(contents), "hello\n")
+	assert.Contains(t, string(contents), joblog.StderrPrefix+"oops\n")
+}
@@ -0,0 +1,62 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"gopkg.in/yaml.v2"
+)
+
+// reportScaling publishes the traffic of the running job for the hub autoscaler and stops the job once it is idle.
+// Only the requests of the app proxy and the gateway are counted, without them the job is never stopped.
+func (ex *Executor) reportScaling(ctx context.Context, stopCh chan struct{}) {
+	job := ex.backend.Job(ctx)
+	if ex.config.AppProxy == nil && ex.gateway == nil {
+		log.Warning(ctx, "The job has scaling, but the runner serves no app proxy nor gateway")
+		return
+	}
+	key := fmt.Sprintf("%s/%s/%s.yaml", consts.SCALING_DIR, job.RunName, job.JobID)
+	idleTimeout := time.Duration(job.Scaling.IdleTimeout) * time.Second
+	started := time.Now()
+	// the rates start with the container
+	ex.meter.Sample()
+	ticker := time.NewTicker(consts.DELAY_SCALING_SIGNALS)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+		}
+		sample := ex.meter.Sample()
+		idle := sample.Idle
+		if running := time.Since(started); idle > running {
+			idle = running
+		}
+		signal := models.ScalingSignal{
+			JobID:       job.JobID,
+			RunName:     job.RunName,
+			RPS:         sample.RPS,
+			LatencyMs:   sample.LatencyMs,
+			QueueDepth:  sample.QueueDepth,
+			IdleSeconds: int(idle.Seconds()),
+			Timestamp:   uint64(time.Now().UnixMilli()),
+		}
+		contents, err := yaml.Marshal(signal)
+		if err == nil {
+			err = ex.backend.PutFile(ctx, key, contents)
+		}
+		if err != nil {
+			log.Warning(ctx, "Failed to publish the scaling signal", "err", err)
+		}
+		if idleTimeout > 0 && idle >= idleTimeout {
+			log.Info(ctx, "Service is idle, scaling to zero", "idle_timeout", job.Scaling.IdleTimeout)
+			ex.Stop()
+			return
+		}
+	}
+}
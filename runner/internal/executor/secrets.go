@@ -0,0 +1,93 @@
+package executor
+
+import (
+	"context"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/secrets"
+	"github.com/dstackai/dstack/runner/internal/secrets/awssecrets"
+	"github.com/dstackai/dstack/runner/internal/secrets/vault"
+)
+
+func (ex *Executor) initSecretProviders() error {
+	ex.secretRefs = awssecrets.NewResolver()
+	if ex.config.Vault != nil {
+		provider, err := vault.New(*ex.config.Vault)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		ex.secretProviders = append(ex.secretProviders, provider)
+	}
+	return nil
+}
+
+// fetchSecrets merges the backend secrets with the configured providers, providers take precedence
+func (ex *Executor) fetchSecrets(ctx context.Context) (map[string]string, error) {
+	result := make(map[string]string)
+	var backendSecrets map[string]string
+	err := ex.backoff.Do(ctx, "secrets", func() error {
+		var err error
+		backendSecrets, err = ex.backend.Secrets(ctx)
+		return err
+	})
+	if err != nil {
+		return result, gerrors.Wrap(err)
+	}
+	for k, v := range backendSecrets {
+		result[k] = v
+	}
+	for _, provider := range ex.secretProviders {
+		values, err := provider.Secrets(ctx)
+		if err != nil {
+			return result, gerrors.Wrap(err)
+		}
+		for k, v := range values {
+			result[k] = v
+		}
+	}
+	return result, nil
+}
+
+// renewSecrets keeps provider leases alive until stopCh is closed
+func (ex *Executor) renewSecrets(ctx context.Context, stopCh chan struct{}) {
+	for _, provider := range ex.secretProviders {
+		if renewer, ok := provider.(secrets.Renewer); ok {
+			go renewer.Renew(ctx, stopCh)
+		}
+	}
+}
+
+func (ex *Executor) secretValues(ctx context.Context) []string {
+	secrets, err := ex.fetchSecrets(ctx)
+	if err != nil {
+		log.Error(ctx, "Fail fetching secrets", "err", err)
+	}
+	values := make([]string, 0, len(secrets))
+	for _, value := range secrets {
+		values = append(values, value)
+	}
+	return values
+}
+
+// resolveSecretRefs replaces AWS Secrets Manager and SSM references with their values.
+// Resolved values only live in the container env and are never written back to the backend.
+// They are masked in the logs, a reference that can't be resolved fails the job.
+func (ex *Executor) resolveSecretRefs(ctx context.Context, env map[string]string) (map[string]string, error) {
+	result := make(map[string]string, len(env))
+	for key, value := range env {
+		result[key] = value
+		ref, ok := awssecrets.ParseRef(value)
+		if !ok {
+			continue
+		}
+		resolved, err := ex.secretRefs.Resolve(ctx, ref)
+		if err != nil {
+			log.Error(ctx, "Fail resolving secret reference", "key", key, "err", err)
+			return nil, gerrors.Newf("failed to resolve secret reference for %s: %s", key, err)
+		}
+		result[key] = resolved
+		ex.logSecrets.Add(resolved)
+	}
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package executor
+
+import (
+	"os"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+const unconfined = "unconfined"
+
+// applySecurity sets the capabilities and the security options of the job container
+func (ex *Executor) applySecurity(spec *container.Spec, security *models.Security) error {
+	if security == nil {
+		return nil
+	}
+	for _, capability := range security.CapAdd {
+		if !capabilityAllowed(ex.config.AllowedCapabilities, capability) {
+			return gerrors.Newf("the capability is not allowed by the runner: %s", capability)
+		}
+	}
+	spec.CapAdd = security.CapAdd
+	spec.CapDrop = security.CapDrop
+	if security.Seccomp != "" {
+		profile := security.Seccomp
+		if profile != unconfined {
+			// the daemon takes the profile itself, not its path
+			contents, err := os.ReadFile(profile)
+			if err != nil {
+				return gerrors.Wrap(err)
+			}
+			profile = string(contents)
+		}
+		spec.SecurityOpt = append(spec.SecurityOpt, "seccomp="+profile)
+	}
+	if security.AppArmor != "" {
+		spec.SecurityOpt = append(spec.SecurityOpt, "apparmor="+security.AppArmor)
+	}
+	return nil
+}
+
+// capabilityAllowed compares the capabilities with or without the CAP_ prefix
+func capabilityAllowed(allowed []string, capability string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	normalize := func(c string) string {
+		return strings.TrimPrefix(strings.ToUpper(c), "CAP_")
+	}
+	for _, a := range allowed {
+		if normalize(a) == normalize(capability) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapabilityAllowed(t *testing.T) {
+	assert.Equal(t, true, capabilityAllowed(nil, "SYS_ADMIN"))
+	assert.Equal(t, true, capabilityAllowed([]string{"SYS_PTRACE"}, "CAP_SYS_PTRACE"))
+	assert.Equal(t, true, capabilityAllowed([]string{"cap_sys_ptrace"}, "SYS_PTRACE"))
+	assert.Equal(t, false, capabilityAllowed([]string{"SYS_PTRACE"}, "SYS_ADMIN"))
+}
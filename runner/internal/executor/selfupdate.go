@@ -0,0 +1,198 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/version"
+)
+
+// SelfUpdate tunes where the runner binaries pinned by the jobs come from
+type SelfUpdate struct {
+	// URL of the binaries with the {version}, {os} and {arch} placeholders, the checksum is at URL.sha256
+	// and the signature at URL.sig. The binaries are read from the backend storage if empty.
+	URL string `yaml:"url,omitempty"`
+	// Disabled keeps the runner, the jobs pinning another version are run as is
+	Disabled bool `yaml:"disabled,omitempty"`
+}
+
+// UpdateRequired is returned by Init once the runner version pinned by the job is installed, the runner re-executes Binary
+type UpdateRequired struct {
+	Version string
+	Binary  string
+}
+
+func (e UpdateRequired) Error() string {
+	return fmt.Sprintf("the job requires runner %s, installed at %s", e.Version, e.Binary)
+}
+
+// runnerBinaryName is the name of the runner binary of the host in the storage
+func runnerBinaryName() string {
+	name := fmt.Sprintf("dstack-runner-%s-%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// updateRunner installs the runner version pinned by the job. The runner is kept if the update fails,
+// a mismatching runner may still run the job.
+func (ex *Executor) updateRunner(ctx context.Context) error {
+	pinned := ex.backend.Job(ctx).RunnerVersion
+	if pinned == "" || pinned == version.Version || !ex.selfUpdate {
+		return nil
+	}
+	switch {
+	case ex.config.SelfUpdate != nil && ex.config.SelfUpdate.Disabled:
+		log.Warning(ctx, "The job pins another runner version, the self-update is disabled", "pinned", pinned, "version", version.Version)
+		return nil
+	case !canReexec:
+		log.Warning(ctx, "The job pins another runner version, the runner can't re-execute itself on the host", "pinned", pinned, "version", version.Version)
+		return nil
+	case os.Getenv(consts.ENV_RUNNER_UPDATED) == pinned:
+		log.Error(ctx, "The updated runner reports another version, keeping it", "pinned", pinned, "version", version.Version)
+		return nil
+	}
+	log.Info(ctx, "Updating the runner", "from", version.Version, "to", pinned)
+	binary, err := ex.installRunner(ctx, pinned)
+	if err != nil {
+		log.Error(ctx, "Failed to update the runner, keeping the current version", "pinned", pinned, "err", err)
+		return nil
+	}
+	return gerrors.Wrap(UpdateRequired{Version: pinned, Binary: binary})
+}
+
+// installRunner downloads the binary of the version under the config dir, it is verified with its checksum and,
+// if the runner has a signature policy, with its signature
+func (ex *Executor) installRunner(ctx context.Context, v string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, consts.RUNNER_DOWNLOAD_TIMEOUT)
+	defer cancel()
+	fetch := ex.runnerSource(v)
+	name := runnerBinaryName()
+	dir := filepath.Join(ex.configDir, "bin", v)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	tmp, err := os.CreateTemp(dir, "download-*")
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	defer func() { _ = os.Remove(tmp.Name()) }()
+	err = fetch(ctx, "", tmp)
+	if errClose := tmp.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	var checksums strings.Builder
+	if err = fetch(ctx, consts.CHECKSUMS_SUFFIX, &checksums); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	digest, err := fileDigest(tmp.Name())
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	if checksumOf([]byte(checksums.String()), name) != digest {
+		return "", gerrors.Wrap(ChecksumMismatchError{Path: name})
+	}
+	if err = ex.verifyRunnerSignature(ctx, fetch, tmp.Name()); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	if err = os.Chmod(tmp.Name(), 0o755); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	binary := filepath.Join(dir, name)
+	if err = os.Rename(tmp.Name(), binary); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return binary, nil
+}
+
+// runnerSource fetches the binary of the version with the suffix, e.g. its checksum, from the URL of the config or the backend storage
+func (ex *Executor) runnerSource(v string) func(ctx context.Context, suffix string, w io.Writer) error {
+	if ex.config.SelfUpdate != nil && ex.config.SelfUpdate.URL != "" {
+		url := strings.NewReplacer("{version}", v, "{os}", runtime.GOOS, "{arch}", runtime.GOARCH).Replace(ex.config.SelfUpdate.URL)
+		return func(ctx context.Context, suffix string, w io.Writer) error {
+			return download(ctx, url+suffix, w)
+		}
+	}
+	key := path.Join(consts.RUNNER_BINARIES_DIR, v, runnerBinaryName())
+	return func(ctx context.Context, suffix string, w io.Writer) error {
+		contents, err := ex.backend.GetFile(ctx, key+suffix)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		_, err = w.Write(contents)
+		return gerrors.Wrap(err)
+	}
+}
+
+func download(ctx context.Context, url string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return gerrors.Newf("download %s: %s", url, resp.Status)
+	}
+	_, err = io.Copy(w, resp.Body)
+	return gerrors.Wrap(err)
+}
+
+// checksumOf is the digest of the file in the sha256sum output, a single digest may name the file otherwise
+func checksumOf(contents []byte, name string) string {
+	digests := parseChecksums(contents)
+	if digest, ok := digests[name]; ok {
+		return digest
+	}
+	if len(digests) == 1 {
+		for _, digest := range digests {
+			return digest
+		}
+	}
+	return strings.TrimSpace(string(contents))
+}
+
+// verifyRunnerSignature checks the signature of the downloaded binary by any of the keys of the signature policy
+func (ex *Executor) verifyRunnerSignature(ctx context.Context, fetch func(ctx context.Context, suffix string, w io.Writer) error, binaryPath string) error {
+	policy := ex.config.Signatures
+	if policy == nil {
+		return nil
+	}
+	sigPath := binaryPath + consts.SIGNATURE_SUFFIX
+	sig, err := os.Create(sigPath)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = os.Remove(sigPath) }()
+	err = fetch(ctx, consts.SIGNATURE_SUFFIX, sig)
+	if errClose := sig.Close(); err == nil {
+		err = errClose
+	}
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	for _, key := range policy.Keys {
+		if err = policy.cosign("verify-blob", "--key", key, "--signature", sigPath, binaryPath); err == nil {
+			return nil
+		}
+		log.Trace(ctx, "Runner signature is not verified", "public key", key, "err", err)
+	}
+	return gerrors.New("no valid signature of the runner binary")
+}
@@ -0,0 +1,50 @@
+package executor
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateRunner(t *testing.T) {
+	binary := []byte("#!/bin/sh\n")
+	tests := []struct {
+		name     string
+		checksum string
+		updated  bool
+	}{
+		{name: "verified", checksum: fmt.Sprintf("%x  %s\n", sha256.Sum256(binary), runnerBinaryName()), updated: true},
+		{name: "mismatch", checksum: fmt.Sprintf("%x  %s\n", sha256.Sum256([]byte("other")), runnerBinaryName())},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex, b, _ := newFakeExecutor(t, container.FakeProgram{}, func(job *models.Job) {
+				job.RunnerVersion = "0.42.0"
+			})
+			key := path.Join(consts.RUNNER_BINARIES_DIR, "0.42.0", runnerBinaryName())
+			b.SetFile(key, binary)
+			b.SetFile(key+consts.CHECKSUMS_SUFFIX, []byte(tt.checksum))
+			ex.AllowSelfUpdate()
+			err := ex.updateRunner(context.Background())
+			var update UpdateRequired
+			assert.Equal(t, tt.updated, errors.As(err, &update), err)
+			if !tt.updated {
+				assert.Equal(t, nil, err)
+				return
+			}
+			assert.Equal(t, "0.42.0", update.Version)
+			contents, err := os.ReadFile(update.Binary)
+			assert.Equal(t, nil, err)
+			assert.Equal(t, binary, contents)
+		})
+	}
+}
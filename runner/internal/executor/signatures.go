@@ -0,0 +1,111 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// SignaturePolicy requires the job images and the cached builds to be signed with cosign by any of the keys
+type SignaturePolicy struct {
+	// Keys are the cosign public keys: paths, KMS URIs or k8s secrets
+	Keys []string `yaml:"keys"`
+	// SigningKey signs the builds uploaded by the runner, COSIGN_PASSWORD is read from the environment.
+	// Without it the builds are accepted only if signed by other means.
+	SigningKey string `yaml:"signing_key,omitempty"`
+	// Cosign is the path of the binary, cosign in PATH by default
+	Cosign string `yaml:"cosign,omitempty"`
+}
+
+type ImageSignatureError struct {
+	Image string
+}
+
+func (e ImageSignatureError) Error() string {
+	return fmt.Sprintf("no valid signature of the image: %s", e.Image)
+}
+
+func (p *SignaturePolicy) cosign(args ...string) error {
+	bin := p.Cosign
+	if bin == "" {
+		bin = "cosign"
+	}
+	cmd := exec.Command(bin, args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return gerrors.Newf("cosign %s: %s: %s", args[0], err, output)
+	}
+	return nil
+}
+
+// verifyImage checks the signature of the pulled image by its digest, the tag may have moved since the pull
+func (ex *Executor) verifyImage(ctx context.Context, image string) error {
+	policy := ex.config.Signatures
+	if policy == nil {
+		return nil
+	}
+	ref, err := ex.engine.RepoDigest(ctx, image)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if ref == "" {
+		return gerrors.Wrap(ImageSignatureError{Image: image})
+	}
+	for _, key := range policy.Keys {
+		if err = policy.cosign("verify", "--key", key, ref); err == nil {
+			log.Trace(ctx, "Verified the image signature", "image", ref, "key", key)
+			return nil
+		}
+		log.Trace(ctx, "Image signature is not verified", "image", ref, "key", key, "err", err)
+	}
+	return gerrors.Wrap(ImageSignatureError{Image: image})
+}
+
+// verifyBuildSignature checks the signature of the cached build diff, stored next to it
+func (ex *Executor) verifyBuildSignature(ctx context.Context, key, diffPath string) bool {
+	policy := ex.config.Signatures
+	if policy == nil {
+		return true
+	}
+	signature, err := ex.backend.GetFile(ctx, key+consts.SIGNATURE_SUFFIX)
+	if err != nil {
+		log.Trace(ctx, "No build signature", "key", key)
+		return false
+	}
+	sigPath := filepath.Join(filepath.Dir(diffPath), filepath.Base(key)+consts.SIGNATURE_SUFFIX)
+	if err = os.WriteFile(sigPath, signature, 0o644); err != nil {
+		log.Error(ctx, "Failed to write the build signature", "err", err)
+		return false
+	}
+	defer func() { _ = os.Remove(sigPath) }()
+	for _, pubKey := range policy.Keys {
+		if err = policy.cosign("verify-blob", "--key", pubKey, "--signature", sigPath, diffPath); err == nil {
+			return true
+		}
+		log.Trace(ctx, "Build signature is not verified", "key", key, "public key", pubKey, "err", err)
+	}
+	return false
+}
+
+// signBuild uploads the signature of the build diff if the runner has the signing key
+func (ex *Executor) signBuild(ctx context.Context, key, diffPath string) error {
+	policy := ex.config.Signatures
+	if policy == nil || policy.SigningKey == "" {
+		return nil
+	}
+	sigPath := diffPath + consts.SIGNATURE_SUFFIX
+	if err := policy.cosign("sign-blob", "--yes", "--key", policy.SigningKey, "--output-signature", sigPath, diffPath); err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = os.Remove(sigPath) }()
+	signature, err := os.ReadFile(sigPath)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(ex.backend.PutFile(ctx, key+consts.SIGNATURE_SUFFIX, signature))
+}
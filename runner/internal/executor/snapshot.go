@@ -0,0 +1,95 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/version"
+)
+
+// Snapshot is what the job was started with, stored next to the job to reproduce the run
+type Snapshot struct {
+	JobID         string   `json:"job_id"`
+	RunName       string   `json:"run_name"`
+	RunnerVersion string   `json:"runner_version"`
+	CreatedAt     uint64   `json:"created_at"`
+	Spec          *DrySpec `json:"spec"`
+	// BaseImage is the pulled image pinned by its digest, empty for the Dockerfile builds
+	BaseImage   string `json:"base_image,omitempty"`
+	ImageID     string `json:"image_id"`
+	BuildDigest string `json:"build_digest,omitempty"`
+	RepoURL     string `json:"repo_url,omitempty"`
+	RepoCommit  string `json:"repo_commit,omitempty"`
+	// RepoDiffSHA256 is the sha256 of the diff applied on top of RepoCommit
+	RepoDiffSHA256 string `json:"repo_diff_sha256,omitempty"`
+	// RepoArchive is the key of the code of the local repo
+	RepoArchive string `json:"repo_archive,omitempty"`
+}
+
+// writeSnapshot stores the snapshot of the job, the job is run even if it can't be stored
+func (ex *Executor) writeSnapshot(ctx context.Context, job *models.Job, spec *container.Spec, baseImage string) {
+	snapshot, err := ex.newSnapshot(ctx, job, spec, baseImage)
+	if err != nil {
+		log.Warning(ctx, "Failed to resolve the job snapshot", "err", err)
+		return
+	}
+	contents, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		log.Warning(ctx, "Failed to marshal the job snapshot", "err", err)
+		return
+	}
+	key := job.SnapshotFilepath()
+	if err = ex.backoff.Do(ctx, "put snapshot", func() error {
+		return ex.backend.PutFile(ctx, key, contents)
+	}); err != nil {
+		log.Warning(ctx, "Failed to store the job snapshot", "key", key, "err", err)
+		return
+	}
+	log.Trace(ctx, "Stored the job snapshot", "key", key)
+}
+
+func (ex *Executor) newSnapshot(ctx context.Context, job *models.Job, spec *container.Spec, baseImage string) (*Snapshot, error) {
+	snapshot := &Snapshot{
+		JobID:          job.JobID,
+		RunName:        job.RunName,
+		RunnerVersion:  version.Version,
+		CreatedAt:      uint64(time.Now().UnixMilli()),
+		Spec:           newDrySpec(spec, ex.logSecrets),
+		BuildDigest:    ex.buildDigest,
+		RepoDiffSHA256: ex.repoDiffSum,
+	}
+	imageID, err := ex.engine.ImageID(ctx, spec.Image)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	snapshot.ImageID = imageID
+	if job.Dockerfile == "" {
+		if snapshot.BaseImage, err = ex.engine.RepoDigest(ctx, baseImage); err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+	}
+	if snapshot.RepoURL, snapshot.RepoCommit, err = ex.repoSource(ctx); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if job.RepoType == "local" {
+		snapshot.RepoArchive = job.RepoCodeFilename
+	}
+	return snapshot, nil
+}
+
+// repoSource is the URL and the checked out commit of the cloned repo, empty for the local repos
+func (ex *Executor) repoSource(ctx context.Context) (string, string, error) {
+	if ex.repo == nil {
+		return "", "", nil
+	}
+	commit, err := ex.repo.Head()
+	if err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	return ex.repo.URL(), commit, nil
+}
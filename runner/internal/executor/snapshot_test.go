@@ -0,0 +1,27 @@
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshot(t *testing.T) {
+	ex, b, _ := newFakeExecutor(t, container.FakeProgram{})
+	b.SetSecret("HF_TOKEN", "hf_secret")
+	assert.Equal(t, nil, ex.Run(context.Background()))
+	job := b.Job(context.Background())
+	contents, err := b.GetFile(context.Background(), job.SnapshotFilepath())
+	assert.Equal(t, nil, err)
+	snapshot := new(Snapshot)
+	assert.Equal(t, nil, json.Unmarshal(contents, snapshot))
+	assert.Equal(t, "job-1", snapshot.JobID)
+	assert.Equal(t, "ubuntu:22.04", snapshot.ImageID)
+	assert.Equal(t, "repos/code.tar", snapshot.RepoArchive)
+	assert.Equal(t, []string{"echo hello"}, snapshot.Spec.Commands)
+	assert.Contains(t, snapshot.Spec.Env, "HF_TOKEN=***")
+	assert.NotEqual(t, "", snapshot.BuildDigest)
+}
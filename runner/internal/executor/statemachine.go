@@ -0,0 +1,44 @@
+package executor
+
+import (
+	"context"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts/states"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// transitionListener is told about every status change, it is called under the job lock
+type transitionListener func(ctx context.Context, from string, job *models.Job)
+
+// stateMachine is the only writer of the job status: it rejects the invalid transitions,
+// e.g. a failed job being marked stopped, and stamps the time every status is entered
+type stateMachine struct {
+	listeners []transitionListener
+}
+
+func (m *stateMachine) listen(listener transitionListener) {
+	m.listeners = append(m.listeners, listener)
+}
+
+// transit moves the job to the status, it returns false and leaves the job as is if the transition is invalid
+func (m *stateMachine) transit(ctx context.Context, job *models.Job, to string) bool {
+	from := job.Status
+	if from == to {
+		return true
+	}
+	if !states.CanTransit(from, to) {
+		log.Warning(ctx, "Invalid job status transition, ignored", "from", from, "to", to)
+		return false
+	}
+	job.Status = to
+	if job.StatusTimes == nil {
+		job.StatusTimes = make(map[string]uint64)
+	}
+	job.StatusTimes[to] = uint64(time.Now().UnixMilli())
+	for _, listener := range m.listeners {
+		listener(ctx, from, job)
+	}
+	return true
+}
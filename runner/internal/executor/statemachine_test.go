@@ -0,0 +1,29 @@
+package executor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/consts/states"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStateMachineTransit(t *testing.T) {
+	ctx := context.Background()
+	var transitions []string
+	m := &stateMachine{}
+	m.listen(func(ctx context.Context, from string, job *models.Job) {
+		transitions = append(transitions, from+">"+job.Status)
+	})
+	job := &models.Job{Status: "submitted"}
+	assert.Equal(t, true, m.transit(ctx, job, states.Running))
+	assert.Equal(t, true, m.transit(ctx, job, states.Running))
+	assert.Equal(t, true, m.transit(ctx, job, states.Failed))
+	assert.Equal(t, false, m.transit(ctx, job, states.Stopped))
+	assert.Equal(t, states.Failed, job.Status)
+	assert.Equal(t, []string{"submitted>running", "running>failed"}, transitions)
+	assert.NotEqual(t, uint64(0), job.StatusTimes[states.Failed])
+	_, stopped := job.StatusTimes[states.Stopped]
+	assert.Equal(t, false, stopped)
+}
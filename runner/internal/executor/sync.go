@@ -0,0 +1,42 @@
+package executor
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/dstackai/dstack/runner/internal/compress"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// Sync applies the code changes pushed by the CLI to the /workflow mount of the running job: the deleted paths
+// are removed, then the tar is extracted over the directory. The job is not restarted.
+func (ex *Executor) Sync(ctx context.Context, deleted []string, archive io.Reader) error {
+	ex.runningMu.Lock()
+	spec := ex.runningSpec
+	ex.runningMu.Unlock()
+	if spec == nil {
+		return gerrors.New("the job container is not running")
+	}
+	dir := ex.repoDir(ctx)
+	for _, name := range deleted {
+		target, err := compress.Target(dir, name)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		if target == dir {
+			return gerrors.New("the workflow directory can't be deleted")
+		}
+		if err = os.RemoveAll(target); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	if err := compress.Untar(archive, dir); err != nil {
+		return gerrors.Wrap(err)
+	}
+	// the container user owns the synced files like the cloned ones
+	ex.chownInputs(ctx, spec)
+	log.Info(ctx, "Files are synced to the workflow directory", "deleted", len(deleted))
+	return nil
+}
@@ -0,0 +1,99 @@
+package executor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/artifacts"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+type phase int
+
+const (
+	phaseClone phase = iota
+	phaseDownload
+	phaseBuild
+	phaseExec
+	phaseUpload
+)
+
+// phaseTimings accumulates the durations of the job phases and the transferred bytes
+type phaseTimings struct {
+	mu      sync.Mutex
+	timings models.Timings
+}
+
+// since adds the time passed since start to the phase
+func (t *phaseTimings) since(p phase, start time.Time) {
+	ms := uint64(time.Since(start).Milliseconds())
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch p {
+	case phaseClone:
+		t.timings.CloneMs += ms
+	case phaseDownload:
+		t.timings.DownloadMs += ms
+	case phaseBuild:
+		t.timings.BuildMs += ms
+	case phaseExec:
+		t.timings.ExecMs += ms
+	case phaseUpload:
+		t.timings.UploadMs += ms
+	}
+}
+
+func (t *phaseTimings) transferred(downloaded, uploaded int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.timings.DownloadedBytes += downloaded
+	t.timings.UploadedBytes += uploaded
+}
+
+func (t *phaseTimings) snapshot() models.Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.timings
+}
+
+// transferSize is the size of the files an artifact moved. The mounted and local artifacts are not wrapped
+// with checksums and move no files.
+func transferSize(art artifacts.Artifacter) int64 {
+	var size int64
+	var err error
+	switch art := art.(type) {
+	case *checksumArtifact:
+		var dir string
+		if dir, err = cacheDir(art.Artifacter); err == nil {
+			size, err = dirSize(dir)
+		}
+	case cacheArtifact:
+		size, err = cacheSize(art)
+	}
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+// saveRunSummary writes the timings and the final cost estimate to the job state
+func (ex *Executor) saveRunSummary(ctx context.Context) {
+	timings := ex.timings.snapshot()
+	log.Info(ctx, "Job phases are timed",
+		"clone_ms", timings.CloneMs,
+		"download_ms", timings.DownloadMs,
+		"build_ms", timings.BuildMs,
+		"exec_ms", timings.ExecMs,
+		"upload_ms", timings.UploadMs,
+		"downloaded_bytes", timings.DownloadedBytes,
+		"uploaded_bytes", timings.UploadedBytes,
+	)
+	if err := ex.updateJob(ctx, func(job *models.Job) {
+		job.Timings = &timings
+		job.Cost = ex.estimateCost(job, timings, time.Since(ex.startedAt))
+	}); err != nil {
+		log.Error(ctx, "Failed to write the run summary", "err", err)
+	}
+}
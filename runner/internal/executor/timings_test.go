@@ -0,0 +1,23 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhaseTimings(t *testing.T) {
+	var timings phaseTimings
+	timings.since(phaseExec, time.Now().Add(-2*time.Second))
+	timings.since(phaseExec, time.Now().Add(-time.Second))
+	timings.since(phaseClone, time.Now().Add(-500*time.Millisecond))
+	timings.transferred(1024, 0)
+	timings.transferred(0, 2048)
+	snapshot := timings.snapshot()
+	assert.InDelta(t, 3000, snapshot.ExecMs, 100)
+	assert.InDelta(t, 500, snapshot.CloneMs, 100)
+	assert.Equal(t, uint64(0), snapshot.UploadMs)
+	assert.Equal(t, int64(1024), snapshot.DownloadedBytes)
+	assert.Equal(t, int64(2048), snapshot.UploadedBytes)
+}
@@ -0,0 +1,24 @@
+package executor
+
+import (
+	"fmt"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// tmpfsMounts returns the tmpfs options by path. A read-only container gets a /tmp unless the job declares one,
+// most tools can't do without it.
+func tmpfsMounts(job *models.Job) map[string]string {
+	mounts := make(map[string]string)
+	if job.ReadOnlyRootfs {
+		mounts["/tmp"] = "rw,exec"
+	}
+	for _, tmpfs := range job.Tmpfs {
+		options := "rw,exec"
+		if tmpfs.SizeMiB > 0 {
+			options += fmt.Sprintf(",size=%dm", tmpfs.SizeMiB)
+		}
+		mounts[tmpfs.Path] = options
+	}
+	return mounts
+}
@@ -0,0 +1,17 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTmpfsMounts(t *testing.T) {
+	assert.Equal(t, map[string]string{}, tmpfsMounts(&models.Job{}))
+	assert.Equal(t, map[string]string{"/tmp": "rw,exec"}, tmpfsMounts(&models.Job{ReadOnlyRootfs: true}))
+	assert.Equal(t, map[string]string{"/tmp": "rw,exec,size=512m", "/scratch": "rw,exec"}, tmpfsMounts(&models.Job{
+		ReadOnlyRootfs: true,
+		Tmpfs:          []models.Tmpfs{{Path: "/tmp", SizeMiB: 512}, {Path: "/scratch"}},
+	}))
+}
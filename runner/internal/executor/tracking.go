@@ -0,0 +1,145 @@
+package executor
+
+import (
+	"context"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/internal/tracking"
+)
+
+// linkTracking creates the tracker runs of the job and keeps the env the job code attaches to them with.
+// The trackers don't fail the job: if a run can't be created, the credentials are still passed and the code creates it.
+func (ex *Executor) linkTracking(ctx context.Context, job *models.Job) {
+	if job.Tracking == nil {
+		return
+	}
+	secrets, err := ex.fetchSecrets(ctx)
+	if err != nil {
+		log.Error(ctx, "Fail fetching secrets", "err", err)
+	}
+	env := make(map[string]string)
+	if config := job.Tracking.WandB; config != nil {
+		ex.linkWandB(ctx, job, config, secrets, env)
+	}
+	if config := job.Tracking.MLflow; config != nil {
+		ex.linkMLflow(ctx, job, config, secrets, env)
+	}
+	ex.trackingEnv = env
+}
+
+func (ex *Executor) linkWandB(ctx context.Context, job *models.Job, config *models.WandB, secrets, env map[string]string) {
+	keySecret := config.KeySecret
+	if keySecret == "" {
+		keySecret = consts.WANDB_KEY_SECRET
+	}
+	key, ok := secrets[keySecret]
+	if !ok {
+		log.Warning(ctx, "No W&B key in the secrets, the run is not linked", "secret", keySecret)
+		return
+	}
+	ex.logSecrets.Add(key)
+	// the run ID is stable across the runner restarts and the container retries, W&B resumes the run
+	runID := config.RunID
+	if runID == "" {
+		runID = wandbRunID(job.JobID)
+	}
+	env["WANDB_API_KEY"] = key
+	env["WANDB_PROJECT"] = config.Project
+	env["WANDB_RUN_ID"] = runID
+	env["WANDB_NAME"] = job.RunName
+	env["WANDB_RESUME"] = "allow"
+	if config.Entity != "" {
+		env["WANDB_ENTITY"] = config.Entity
+	}
+	if config.BaseURL != "" {
+		env["WANDB_BASE_URL"] = config.BaseURL
+	}
+	if config.RunURL != "" {
+		return
+	}
+	entity, runURL, err := tracking.NewWandB(config.BaseURL, key).UpsertRun(ctx, config.Entity, config.Project, runID, job.RunName, []string{"dstack"})
+	if err != nil {
+		log.Warning(ctx, "Failed to create the W&B run", "err", err)
+		return
+	}
+	env["WANDB_ENTITY"] = entity
+	log.Info(ctx, "W&B run is linked", "url", runURL)
+	if err = ex.updateJob(ctx, func(job *models.Job) {
+		job.Tracking.WandB.RunID = runID
+		job.Tracking.WandB.RunURL = runURL
+	}); err != nil {
+		log.Error(ctx, "Failed to write the W&B run", "err", err)
+	}
+}
+
+func (ex *Executor) linkMLflow(ctx context.Context, job *models.Job, config *models.MLflow, secrets, env map[string]string) {
+	tokenSecret := config.TokenSecret
+	if tokenSecret == "" {
+		tokenSecret = consts.MLFLOW_TOKEN_SECRET
+	}
+	token := secrets[tokenSecret]
+	if token != "" {
+		ex.logSecrets.Add(token)
+		env["MLFLOW_TRACKING_TOKEN"] = token
+	}
+	experiment := config.Experiment
+	if experiment == "" {
+		experiment = job.RunName
+	}
+	env["MLFLOW_TRACKING_URI"] = config.TrackingURI
+	env["MLFLOW_EXPERIMENT_NAME"] = experiment
+	runID := config.RunID
+	if runID == "" {
+		var runURL string
+		var err error
+		tags := map[string]string{"dstack.run_name": job.RunName, "dstack.job_id": job.JobID}
+		runID, runURL, err = tracking.NewMLflow(config.TrackingURI, token).CreateRun(ctx, experiment, job.RunName, tags)
+		if err != nil {
+			log.Warning(ctx, "Failed to create the MLflow run", "err", err)
+			return
+		}
+		log.Info(ctx, "MLflow run is linked", "url", runURL)
+		if err = ex.updateJob(ctx, func(job *models.Job) {
+			job.Tracking.MLflow.RunID = runID
+			job.Tracking.MLflow.RunURL = runURL
+		}); err != nil {
+			log.Error(ctx, "Failed to write the MLflow run", "err", err)
+		}
+	}
+	// mlflow.start_run() continues the run of the env
+	env["MLFLOW_RUN_ID"] = runID
+}
+
+// finishTracking ends the MLflow run with the job result, W&B ends its runs when the job code exits
+func (ex *Executor) finishTracking(ctx context.Context, jobErr error) {
+	job := ex.backend.Job(ctx)
+	if job.Tracking == nil || job.Tracking.MLflow == nil || job.Tracking.MLflow.RunID == "" {
+		return
+	}
+	config := job.Tracking.MLflow
+	status := tracking.MLflowFinished
+	switch {
+	case ex.preempted.Load() || ex.interrupted.Load():
+		status = tracking.MLflowKilled
+	case jobErr != nil:
+		status = tracking.MLflowFailed
+	}
+	token := ex.trackingEnv["MLFLOW_TRACKING_TOKEN"]
+	if err := tracking.NewMLflow(config.TrackingURI, token).FinishRun(ctx, config.RunID, status); err != nil {
+		log.Warning(ctx, "Failed to finish the MLflow run", "err", err)
+	}
+}
+
+// wandbRunID turns the job ID into a W&B run ID, the IDs allow the letters, the digits, - and _
+func wandbRunID(jobID string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		}
+		return '-'
+	}, jobID)
+}
@@ -0,0 +1,88 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// collectUsage samples the job container and writes a usage line to the job log, so the users see it in dstack logs
+func (ex *Executor) collectUsage(ctx context.Context, docker *container.DockerRuntime, logs io.Writer, stopCh chan struct{}) {
+	ticker := time.NewTicker(consts.DELAY_USAGE_STATS)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			stat, err := docker.Stats(ctx)
+			if err != nil {
+				log.Warning(ctx, "Failed to query container stats", "err", err)
+				continue
+			}
+			var gpus []models.GPUStat
+			err = ex.updateJob(ctx, func(job *models.Job) {
+				job.ContainerStats = &stat
+				gpus = latestGPUStats(job.GPUStats)
+			})
+			if err != nil {
+				log.Error(ctx, "Failed to update container stats", "err", err)
+			}
+			if _, err = fmt.Fprintln(logs, formatUsage(stat, gpus)); err != nil {
+				log.Warning(ctx, "Failed to write usage to the job log", "err", err)
+			}
+		}
+	}
+}
+
+// appendGPUStats adds the sample to the history, every sample has a row per GPU and whole samples are trimmed
+func appendGPUStats(history, sample []models.GPUStat) []models.GPUStat {
+	if len(sample) == 0 {
+		return history
+	}
+	history = append(history, sample...)
+	if maxRows := consts.MAX_GPU_STATS_SAMPLES * len(sample); len(history) > maxRows {
+		history = history[len(history)-maxRows:]
+	}
+	return history
+}
+
+// latestGPUStats is the last sample, it has a row per GPU
+func latestGPUStats(stats []models.GPUStat) []models.GPUStat {
+	if len(stats) == 0 {
+		return nil
+	}
+	last := stats[len(stats)-1].Timestamp
+	start := len(stats)
+	for start > 0 && stats[start-1].Timestamp == last {
+		start--
+	}
+	return append([]models.GPUStat(nil), stats[start:]...)
+}
+
+// formatUsage is a compact line, e.g. [usage] CPU 143% | MEM 1.2/15.6 GiB | GPU0 97% 10.1/16.0 GiB | DISK 0.3 GiB
+func formatUsage(stat models.ContainerStat, gpus []models.GPUStat) string {
+	parts := []string{fmt.Sprintf("CPU %.0f%%", stat.CPUPercent)}
+	mem := fmt.Sprintf("MEM %.1f", gib(stat.MemoryUsedMiB))
+	if stat.MemoryLimitMiB > 0 {
+		mem += fmt.Sprintf("/%.1f", gib(stat.MemoryLimitMiB))
+	}
+	parts = append(parts, mem+" GiB")
+	for _, gpu := range gpus {
+		parts = append(parts, fmt.Sprintf("GPU%d %d%% %.1f/%.1f GiB", gpu.Index, gpu.Utilization,
+			gib(uint64(gpu.MemoryUsedMiB)), gib(uint64(gpu.MemoryTotalMiB))))
+	}
+	parts = append(parts, fmt.Sprintf("DISK %.1f GiB", gib(stat.DiskUsedMiB)))
+	return "[usage] " + strings.Join(parts, " | ")
+}
+
+func gib(mib uint64) float64 {
+	return float64(mib) / 1024
+}
@@ -0,0 +1,31 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatUsage(t *testing.T) {
+	stat := models.ContainerStat{CPUPercent: 143.4, MemoryUsedMiB: 1229, MemoryLimitMiB: 16000, DiskUsedMiB: 307}
+	gpus := latestGPUStats([]models.GPUStat{
+		{Index: 0, Utilization: 10, MemoryUsedMiB: 1024, MemoryTotalMiB: 16384, Timestamp: 1},
+		{Index: 0, Utilization: 97, MemoryUsedMiB: 10342, MemoryTotalMiB: 16384, Timestamp: 2},
+		{Index: 1, Utilization: 0, MemoryUsedMiB: 0, MemoryTotalMiB: 16384, Timestamp: 2},
+	})
+	assert.Equal(t, "[usage] CPU 143% | MEM 1.2/15.6 GiB | GPU0 97% 10.1/16.0 GiB | GPU1 0% 0.0/16.0 GiB | DISK 0.3 GiB", formatUsage(stat, gpus))
+	assert.Equal(t, "[usage] CPU 0% | MEM 0.0 GiB | DISK 0.0 GiB", formatUsage(models.ContainerStat{}, nil))
+}
+
+func TestAppendGPUStats(t *testing.T) {
+	var history []models.GPUStat
+	for i := 0; i < consts.MAX_GPU_STATS_SAMPLES+1; i++ {
+		history = appendGPUStats(history, []models.GPUStat{{Index: 0, Timestamp: uint64(i)}, {Index: 1, Timestamp: uint64(i)}})
+	}
+	assert.Equal(t, 2*consts.MAX_GPU_STATS_SAMPLES, len(history))
+	assert.Equal(t, uint64(1), history[0].Timestamp)
+	// nvidia-smi printing nothing keeps the history
+	assert.Equal(t, history, appendGPUStats(history, []models.GPUStat{}))
+}
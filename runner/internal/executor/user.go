@@ -0,0 +1,83 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// containerUser resolves the user of the job container, see models.UserHost
+func containerUser(user string) string {
+	if user != models.UserHost {
+		return user
+	}
+	// Docker Desktop maps the owners of the bind mounts itself
+	if runtime.GOOS != "linux" {
+		return ""
+	}
+	return fmt.Sprintf("%d:%d", os.Getuid(), os.Getgid())
+}
+
+// chownInputs gives the job files to the numeric user of the container, so it can write them.
+// Only a root runner can do it, an unprivileged one runs the containers as itself.
+func (ex *Executor) chownInputs(ctx context.Context, spec *container.Spec) {
+	if runtime.GOOS != "linux" || os.Getuid() != 0 || spec.User == "" {
+		return
+	}
+	uidPart, gidPart, _ := strings.Cut(spec.User, ":")
+	uid, err := strconv.Atoi(uidPart)
+	if err != nil {
+		log.Trace(ctx, "The container user is a name, skip chowning", "user", spec.User)
+		return
+	}
+	gid := uid
+	if gidPart != "" {
+		if gid, err = strconv.Atoi(gidPart); err != nil {
+			return
+		}
+	}
+	for _, source := range ex.jobMountSources(ctx, spec) {
+		err = filepath.WalkDir(source, func(path string, _ fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return os.Lchown(path, uid, gid)
+		})
+		if err != nil {
+			log.Warning(ctx, "Failed to chown the job files", "path", source, "err", err)
+		}
+	}
+}
+
+// jobMountSources are the writable bind mounts of the runner files, not of the host or the backend config
+func (ex *Executor) jobMountSources(ctx context.Context, spec *container.Spec) []string {
+	root := ex.backend.GetTMPDir(ctx) + "/"
+	var sources []string
+	for _, m := range spec.Mounts {
+		if m.Type == mount.TypeBind && !m.ReadOnly && strings.HasPrefix(m.Source, root) {
+			sources = append(sources, m.Source)
+		}
+	}
+	return sources
+}
+
+// chownOutputs gives the files written by a root container back to an unprivileged runner,
+// otherwise the uploads and the reused caches fail on permissions
+func (ex *Executor) chownOutputs(ctx context.Context, spec *container.Spec) {
+	if runtime.GOOS != "linux" || os.Getuid() == 0 || spec.User != "" {
+		return
+	}
+	if err := ex.engine.Chown(ctx, spec.Image, ex.jobMountSources(ctx, spec), os.Getuid(), os.Getgid()); err != nil {
+		log.Warning(ctx, "Failed to chown the job files", "err", err)
+	}
+}
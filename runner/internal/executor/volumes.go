@@ -0,0 +1,172 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/backend"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+const (
+	workflowPath      = "/workflow"
+	defaultFileSystem = "ext4"
+	// blkidNoFileSystem is the exit code of blkid for the devices without a file system
+	blkidNoFileSystem = 2
+)
+
+// attachedVolume is a persistent volume attached to the instance, dir is its mount point on the host once mounted
+type attachedVolume struct {
+	volume models.Volume
+	dir    string
+}
+
+// attachVolumes attaches and mounts the job volumes on the host. Kept is true if the /workflow volume has the files
+// of a previous run, the repo is not prepared then.
+func (ex *Executor) attachVolumes(ctx context.Context) (bool, error) {
+	job := ex.backend.Job(ctx)
+	if len(job.Volumes) == 0 {
+		return false, nil
+	}
+	volumes, ok := ex.backend.(backend.Volumes)
+	if !ok {
+		return false, gerrors.New("the backend attaches no volumes")
+	}
+	kept := false
+	for _, volume := range job.Volumes {
+		log.Info(ctx, "Attaching the volume", "name", volume.Name, "path", volumePath(volume))
+		device, err := volumes.AttachVolume(ctx, volume.Name)
+		if err != nil {
+			return false, gerrors.Wrap(err)
+		}
+		attached := &attachedVolume{volume: volume}
+		ex.volumes = append(ex.volumes, attached)
+		if err = waitDevice(ctx, device); err != nil {
+			return false, gerrors.Wrap(err)
+		}
+		if err = formatVolume(ctx, device, volume.FileSystem); err != nil {
+			return false, gerrors.Wrap(err)
+		}
+		dir := filepath.Join(ex.configDir, consts.VOLUMES_DIR, volume.Name)
+		if volumePath(volume) == workflowPath {
+			dir = ex.repoDir(ctx)
+		}
+		if err = os.MkdirAll(dir, 0o755); err != nil {
+			return false, gerrors.Wrap(err)
+		}
+		if out, err := exec.CommandContext(ctx, "mount", device, dir).CombinedOutput(); err != nil {
+			return false, gerrors.Newf("failed to mount the volume %s: %s", volume.Name, out)
+		}
+		attached.dir = dir
+		if volumePath(volume) == workflowPath {
+			kept = hasFiles(dir)
+		}
+	}
+	return kept, nil
+}
+
+// detachVolumes unmounts and detaches the job volumes, the other volumes are detached if one fails
+func (ex *Executor) detachVolumes(ctx context.Context) error {
+	volumes, ok := ex.backend.(backend.Volumes)
+	if !ok {
+		return nil
+	}
+	var errDetach error
+	for i := len(ex.volumes) - 1; i >= 0; i-- {
+		attached := ex.volumes[i]
+		if attached.dir != "" {
+			if out, err := exec.CommandContext(ctx, "umount", attached.dir).CombinedOutput(); err != nil {
+				log.Error(ctx, "Failed to unmount the volume", "name", attached.volume.Name, "output", string(out))
+				errDetach = gerrors.Wrap(err)
+				continue
+			}
+		}
+		if err := volumes.DetachVolume(ctx, attached.volume.Name); err != nil {
+			log.Error(ctx, "Failed to detach the volume", "name", attached.volume.Name, "err", err)
+			errDetach = gerrors.Wrap(err)
+		}
+	}
+	ex.volumes = nil
+	return errDetach
+}
+
+// volumeBindings mounts the volumes into the container, the /workflow volume is the repo dir itself
+func (ex *Executor) volumeBindings() []mount.Mount {
+	var bindings []mount.Mount
+	for _, attached := range ex.volumes {
+		if attached.dir == "" || volumePath(attached.volume) == workflowPath {
+			continue
+		}
+		bindings = append(bindings, mount.Mount{
+			Type:   mount.TypeBind,
+			Source: attached.dir,
+			Target: attached.volume.Path,
+		})
+	}
+	return bindings
+}
+
+func volumePath(volume models.Volume) string {
+	if volume.Path == "" {
+		return workflowPath
+	}
+	return path.Clean(volume.Path)
+}
+
+// waitDevice waits for the device of the attached volume to appear on the host
+func waitDevice(ctx context.Context, device string) error {
+	deadline := time.Now().Add(consts.VOLUME_ATTACH_TIMEOUT)
+	for {
+		if _, err := os.Stat(device); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return gerrors.Newf("device %s did not appear", device)
+		}
+		select {
+		case <-ctx.Done():
+			return gerrors.Wrap(ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// formatVolume makes the file system on the blank volumes, the formatted ones are kept as is
+func formatVolume(ctx context.Context, device, fileSystem string) error {
+	err := exec.CommandContext(ctx, "blkid", device).Run()
+	exitErr := &exec.ExitError{}
+	if err == nil || !errors.As(err, &exitErr) || exitErr.ExitCode() != blkidNoFileSystem {
+		return gerrors.Wrap(err)
+	}
+	if fileSystem == "" {
+		fileSystem = defaultFileSystem
+	}
+	log.Info(ctx, "Formatting the blank volume", "device", device, "file_system", fileSystem)
+	if out, err := exec.CommandContext(ctx, "mkfs", "-t", fileSystem, device).CombinedOutput(); err != nil {
+		return gerrors.Newf("failed to format %s: %s", device, out)
+	}
+	return nil
+}
+
+// hasFiles reports whether the dir has anything but the lost+found of the file system
+func hasFiles(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false
+	}
+	for _, entry := range entries {
+		if entry.Name() != "lost+found" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,28 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVolumeBindings(t *testing.T) {
+	ex := &Executor{volumes: []*attachedVolume{
+		{volume: models.Volume{Name: "workflow"}, dir: "/runs/run/job"},
+		{volume: models.Volume{Name: "data", Path: "/data"}, dir: "/volumes/data"},
+		{volume: models.Volume{Name: "unmounted", Path: "/cache"}},
+	}}
+	assert.Equal(t, []mount.Mount{{Type: mount.TypeBind, Source: "/volumes/data", Target: "/data"}}, ex.volumeBindings())
+}
+
+func TestHasFiles(t *testing.T) {
+	dir := t.TempDir()
+	assert.Equal(t, nil, os.Mkdir(filepath.Join(dir, "lost+found"), 0o755))
+	assert.Equal(t, false, hasFiles(dir))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(dir, "state"), nil, 0o644))
+	assert.Equal(t, true, hasFiles(dir))
+}
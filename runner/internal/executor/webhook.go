@@ -0,0 +1,159 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+const (
+	webhookEventHeader     = "X-Dstack-Event"
+	webhookSignatureHeader = "X-Dstack-Signature"
+	webhookStatusEvent     = "job.status"
+	// webhookQueueSize bounds the undelivered events, the newer ones are dropped if the receiver is down
+	webhookQueueSize = 64
+)
+
+type webhookEvent struct {
+	Event             string `json:"event"`
+	RunnerID          string `json:"runner_id"`
+	JobID             string `json:"job_id"`
+	RunName           string `json:"run_name"`
+	RepoID            string `json:"repo_id"`
+	PreviousStatus    string `json:"previous_status"`
+	Status            string `json:"status"`
+	ErrorCode         string `json:"error_code,omitempty"`
+	ContainerExitCode string `json:"container_exit_code,omitempty"`
+	Timestamp         int64  `json:"timestamp"`
+}
+
+// webhookSender posts the events one by one in the order of the transitions, the job never waits for the receiver
+type webhookSender struct {
+	config *Webhook
+	client *http.Client
+	events chan webhookEvent
+	done   chan struct{}
+	// mu guards events against the transitions after close
+	mu     sync.Mutex
+	closed bool
+}
+
+func newWebhookSender(config *Webhook) *webhookSender {
+	timeout := consts.WEBHOOK_TIMEOUT
+	if config.Timeout > 0 {
+		timeout = time.Duration(config.Timeout) * time.Second
+	}
+	s := &webhookSender{
+		config: config,
+		client: &http.Client{Timeout: timeout},
+		events: make(chan webhookEvent, webhookQueueSize),
+		done:   make(chan struct{}),
+	}
+	go s.deliver()
+	return s
+}
+
+// transition queues the event if the status has changed, it is called under the job lock
+func (s *webhookSender) transition(ctx context.Context, previous string, job *models.Job) {
+	if s == nil || previous == job.Status {
+		return
+	}
+	event := webhookEvent{
+		Event:             webhookStatusEvent,
+		RunnerID:          job.RunnerID,
+		JobID:             job.JobID,
+		RunName:           job.RunName,
+		RepoID:            job.RepoId,
+		PreviousStatus:    previous,
+		Status:            job.Status,
+		ErrorCode:         job.ErrorCode,
+		ContainerExitCode: job.ContainerExitCode,
+		Timestamp:         time.Now().UnixMilli(),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.events <- event:
+	default:
+		log.Warning(ctx, "Webhook queue is full, the event is dropped", "status", job.Status)
+	}
+}
+
+// close waits for the queued events to be delivered
+func (s *webhookSender) close(ctx context.Context) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.closed = true
+	close(s.events)
+	s.mu.Unlock()
+	select {
+	case <-s.done:
+	case <-time.After(consts.WEBHOOK_FLUSH_TIMEOUT):
+		log.Warning(ctx, "Timed out delivering the webhook events")
+	}
+}
+
+func (s *webhookSender) deliver() {
+	defer close(s.done)
+	ctx := context.Background()
+	for event := range s.events {
+		var err error
+		for attempt := 1; attempt <= consts.WEBHOOK_ATTEMPTS; attempt++ {
+			if err = s.post(ctx, event); err == nil {
+				break
+			}
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		if err != nil {
+			log.Error(ctx, "Failed to deliver the webhook event", "status", event.Status, "err", err)
+		}
+	}
+}
+
+func (s *webhookSender) post(ctx context.Context, event webhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.URL, bytes.NewReader(body))
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, event.Event)
+	if s.config.Secret != "" {
+		req.Header.Set(webhookSignatureHeader, signPayload(s.config.Secret, body))
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return gerrors.Newf("webhook responded %s", resp.Status)
+	}
+	return nil
+}
+
+// signPayload is the HMAC-SHA256 of the body in the GitHub format, sha256=<hex>
+func signPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,31 @@
+package executor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignPayload(t *testing.T) {
+	assert.Equal(t, "sha256=f7bc83f430538424b13298e6aa6fb143ef4d59a14946175997479dbc2d1a3cd8",
+		signPayload("key", []byte("The quick brown fox jumps over the lazy dog")))
+}
+
+func TestWebhookTransition(t *testing.T) {
+	s := &webhookSender{events: make(chan webhookEvent, webhookQueueSize)}
+	ctx := context.Background()
+	job := &models.Job{JobID: "job", Status: "running"}
+	s.transition(ctx, "running", job)
+	assert.Equal(t, 0, len(s.events))
+	s.transition(ctx, "building", job)
+	assert.Equal(t, 1, len(s.events))
+	event := <-s.events
+	assert.Equal(t, "building", event.PreviousStatus)
+	assert.Equal(t, "running", event.Status)
+
+	s.closed = true
+	s.transition(ctx, "running", &models.Job{Status: "done"})
+	assert.Equal(t, 0, len(s.events))
+}
@@ -0,0 +1,64 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+type WorkingDirError struct {
+	Path   string
+	Reason string
+}
+
+func (e WorkingDirError) Error() string {
+	return fmt.Sprintf("working dir %s %s", e.Path, e.Reason)
+}
+
+// prepareWorkingDir checks the working dir of the job is a dir of the repo, the missing one is created if the job asks to
+func (ex *Executor) prepareWorkingDir(ctx context.Context) error {
+	job := ex.backend.Job(ctx)
+	if job.WorkingDir == "" {
+		return nil
+	}
+	workDir := path.Join(workflowPath, job.WorkingDir)
+	if workDir != workflowPath && !strings.HasPrefix(workDir, workflowPath+"/") {
+		return gerrors.Wrap(WorkingDirError{Path: job.WorkingDir, Reason: "is outside of the repo"})
+	}
+	hostDir := ex.hostWorkflowPath(ctx, workDir)
+	stat, err := os.Stat(hostDir)
+	switch {
+	case err == nil && stat.IsDir():
+		return nil
+	case err == nil:
+		return gerrors.Wrap(WorkingDirError{Path: job.WorkingDir, Reason: "is not a directory"})
+	case !os.IsNotExist(err):
+		return gerrors.Wrap(err)
+	case !job.CreateWorkingDir:
+		return gerrors.Wrap(WorkingDirError{Path: job.WorkingDir, Reason: "does not exist in the repo, set create_working_dir to create it"})
+	}
+	log.Info(ctx, "Creating the working dir", "path", workDir)
+	return gerrors.Wrap(os.MkdirAll(hostDir, 0o755))
+}
+
+// hostWorkflowPath maps the container path under /workflow to the host, through the volume mounted over it if any
+func (ex *Executor) hostWorkflowPath(ctx context.Context, containerPath string) string {
+	dir, target := ex.repoDir(ctx), workflowPath
+	for _, attached := range ex.volumes {
+		volPath := volumePath(attached.volume)
+		if attached.dir == "" || len(volPath) <= len(target) {
+			continue
+		}
+		if containerPath == volPath || strings.HasPrefix(containerPath, volPath+"/") {
+			dir, target = attached.dir, volPath
+		}
+	}
+	rel := strings.TrimPrefix(strings.TrimPrefix(containerPath, target), "/")
+	return filepath.Join(dir, filepath.FromSlash(rel))
+}
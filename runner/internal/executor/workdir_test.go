@@ -0,0 +1,49 @@
+package executor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/consts/errorcodes"
+	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkingDir(t *testing.T) {
+	tests := []struct {
+		name       string
+		workingDir string
+		create     bool
+		errorCode  string
+	}{
+		{name: "exists", workingDir: "."},
+		{name: "missing", workingDir: "src", errorCode: errorcodes.WorkingDirInvalid},
+		{name: "created", workingDir: "src/app", create: true},
+		{name: "file", workingDir: "README.md", create: true, errorCode: errorcodes.WorkingDirInvalid},
+		{name: "outside", workingDir: "../etc", create: true, errorCode: errorcodes.WorkingDirInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ex, b, _ := newFakeExecutor(t, container.FakeProgram{}, func(job *models.Job) {
+				job.WorkingDir = tt.workingDir
+				job.CreateWorkingDir = tt.create
+			})
+			err := ex.Run(context.Background())
+			assert.Equal(t, tt.errorCode != "", err != nil, err)
+			stored, err := b.Stored()
+			assert.Equal(t, nil, err)
+			assert.Equal(t, tt.errorCode, stored.ErrorCode)
+			if tt.create && tt.errorCode == "" {
+				job := b.Job(context.Background())
+				stat, err := os.Stat(filepath.Join(b.GetTMPDir(context.Background()), consts.RUNS_DIR, job.RunName, job.JobID, tt.workingDir))
+				if assert.Equal(t, nil, err) {
+					assert.Equal(t, true, stat.IsDir())
+				}
+			}
+		})
+	}
+}
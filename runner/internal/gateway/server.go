@@ -0,0 +1,227 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/internal/scaling"
+)
+
+// usageBodyLimit bounds the responses read for the token usage, the bigger ones are passed through uncounted
+const usageBodyLimit = 1 << 20
+
+// idleConnTimeout closes the kept-alive connections to the model server nobody calls anymore
+const idleConnTimeout = 90 * time.Second
+
+// Config of the OpenAI-compatible gateway of the model service jobs. The clients are authorized by one of Tokens,
+// or by the token generated for the job if there are none.
+type Config struct {
+	Host   string   `yaml:"host,omitempty"`
+	Port   int      `yaml:"port"`
+	Tokens []string `yaml:"tokens,omitempty"`
+}
+
+// Runner is the part of the executor the requests are forwarded to, the service and its token are read from the job
+type Runner interface {
+	JobSnapshot(ctx context.Context) models.Job
+	DialContainer(ctx context.Context, port int) (net.Conn, error)
+}
+
+type Server struct {
+	config Config
+	runner Runner
+	server *http.Server
+	// transport keeps the connections to the model server alive between the requests
+	transport *http.Transport
+	// meter counts the requests for the autoscaling signals
+	meter *scaling.Meter
+
+	requests         atomic.Uint64
+	errors           atomic.Uint64
+	promptTokens     atomic.Uint64
+	completionTokens atomic.Uint64
+	latencyMs        atomic.Uint64
+}
+
+func New(config Config, runner Runner) *Server {
+	s := &Server{config: config, runner: runner, transport: newTransport(runner)}
+	s.server = &http.Server{
+		Addr:    net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		Handler: s,
+	}
+	return s
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	log.Info(ctx, "Model gateway is listening", "host", s.config.Host, "port", s.config.Port)
+	s.server.BaseContext = func(net.Listener) context.Context { return ctx }
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+func (s *Server) SetMeter(meter *scaling.Meter) {
+	s.meter = meter
+}
+
+func (s *Server) Shutdown() {
+	_ = s.server.Shutdown(context.Background())
+	s.transport.CloseIdleConnections()
+}
+
+// Metrics are the totals since the start, the tokens are counted for the non-streamed responses only
+func (s *Server) Metrics() models.ModelMetrics {
+	return models.ModelMetrics{
+		Requests:         s.requests.Load(),
+		Errors:           s.errors.Load(),
+		PromptTokens:     s.promptTokens.Load(),
+		CompletionTokens: s.completionTokens.Load(),
+		LatencyMs:        s.latencyMs.Load(),
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1" && !strings.HasPrefix(r.URL.Path, "/v1/") {
+		writeError(w, http.StatusNotFound, "not_found", "unknown path")
+		return
+	}
+	job := s.runner.JobSnapshot(r.Context())
+	service := job.ModelService
+	if service == nil {
+		writeError(w, http.StatusServiceUnavailable, "unavailable", "the job serves no model")
+		return
+	}
+	if !s.authorize(r, service.Token) {
+		writeError(w, http.StatusUnauthorized, "invalid_api_key", "invalid token")
+		return
+	}
+	defer s.meter.Start()()
+	started := time.Now()
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = "http"
+			req.URL.Host = net.JoinHostPort("localhost", strconv.Itoa(service.Port))
+			// the model server may have its own auth, it is not given the gateway token
+			req.Header.Del("Authorization")
+		},
+		Transport: s.transport,
+		// the streamed completions are flushed chunk by chunk
+		FlushInterval:  -1,
+		ModifyResponse: s.countUsage,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Warning(r.Context(), "Model gateway request failed", "path", r.URL.Path, "err", err)
+			writeError(w, http.StatusBadGateway, "unavailable", "the model server is unavailable")
+		},
+	}
+	proxy.ServeHTTP(recorder, r)
+	latency := time.Since(started)
+	s.requests.Add(1)
+	s.latencyMs.Add(uint64(latency.Milliseconds()))
+	if recorder.status >= http.StatusInternalServerError {
+		s.errors.Add(1)
+	}
+	log.Trace(r.Context(), "Model gateway request", "method", r.Method, "path", r.URL.Path, "status", recorder.status, "latency", latency)
+}
+
+// newTransport dials the service port of the request address in the job container
+func newTransport(runner Runner) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, addr string) (net.Conn, error) {
+			_, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, gerrors.Wrap(err)
+			}
+			servicePort, err := strconv.Atoi(port)
+			if err != nil {
+				return nil, gerrors.Wrap(err)
+			}
+			return runner.DialContainer(ctx, servicePort)
+		},
+		IdleConnTimeout: idleConnTimeout,
+	}
+}
+
+func (s *Server) authorize(r *http.Request, jobToken string) bool {
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(header, "Bearer ")
+	tokens := s.config.Tokens
+	if len(tokens) == 0 {
+		tokens = []string{jobToken}
+	}
+	for _, valid := range tokens {
+		if valid != "" && subtle.ConstantTimeCompare([]byte(token), []byte(valid)) == 1 {
+			return true
+		}
+	}
+	return false
+}
+
+// countUsage adds the usage of the JSON responses to the metrics, the body is restored for the client
+func (s *Server) countUsage(resp *http.Response) error {
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") ||
+		resp.ContentLength < 0 || resp.ContentLength > usageBodyLimit {
+		return nil
+	}
+	body, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	var completion struct {
+		Usage *struct {
+			PromptTokens     uint64 `json:"prompt_tokens"`
+			CompletionTokens uint64 `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if json.Unmarshal(body, &completion) == nil && completion.Usage != nil {
+		s.promptTokens.Add(completion.Usage.PromptTokens)
+		s.completionTokens.Add(completion.Usage.CompletionTokens)
+	}
+	return nil
+}
+
+// writeError responds in the format of the OpenAI API errors
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]string{"message": message, "type": "gateway_error", "code": code},
+	})
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Flush keeps the streamed responses flowing through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,73 @@
+package gateway
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRunner struct {
+	job  models.Job
+	addr string
+}
+
+func (r *fakeRunner) JobSnapshot(context.Context) models.Job {
+	return r.job
+}
+
+func (r *fakeRunner) DialContainer(ctx context.Context, _ int) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "tcp", r.addr)
+}
+
+func TestServeHTTP(t *testing.T) {
+	model := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if r.URL.Path == "/v1/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, `{"choices":[],"usage":{"prompt_tokens":12,"completion_tokens":34}}`)
+	}))
+	defer model.Close()
+	runner := &fakeRunner{
+		job:  models.Job{ModelService: &models.ModelService{Port: 8000, Token: "secret"}},
+		addr: model.Listener.Addr().String(),
+	}
+	s := New(Config{}, runner)
+	defer s.Shutdown()
+	request := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"model":"m"}`))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, request("/v1/chat/completions", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, request("/v1/chat/completions", "other").Code)
+	assert.Equal(t, http.StatusNotFound, request("/health", "secret").Code)
+	w := request("/v1/chat/completions", "secret")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, true, strings.Contains(w.Body.String(), `"completion_tokens":34`))
+	assert.Equal(t, http.StatusInternalServerError, request("/v1/broken", "secret").Code)
+
+	metrics := s.Metrics()
+	assert.Equal(t, uint64(2), metrics.Requests)
+	assert.Equal(t, uint64(1), metrics.Errors)
+	assert.Equal(t, uint64(12), metrics.PromptTokens)
+	assert.Equal(t, uint64(34), metrics.CompletionTokens)
+}
@@ -0,0 +1,102 @@
+package githubapp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// refreshBefore renews the installation token before it expires, tokens live for an hour
+const refreshBefore = 15 * time.Minute
+
+// TokenSource mints GitHub App installation tokens and caches them until they are about to expire
+type TokenSource struct {
+	apiURL         string
+	appID          string
+	installationID string
+	privateKey     []byte
+	client         *http.Client
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// New returns the token source for the installation. The API of GitHub Enterprise is on the repo host.
+func New(host, appID, installationID, privateKey string) *TokenSource {
+	apiURL := "https://api.github.com"
+	if host != "" && host != "github.com" {
+		apiURL = fmt.Sprintf("https://%s/api/v3", host)
+	}
+	return &TokenSource{
+		apiURL:         apiURL,
+		appID:          appID,
+		installationID: installationID,
+		privateKey:     []byte(privateKey),
+		client:         &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Token returns a token valid for at least refreshBefore
+func (s *TokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.token != "" && time.Until(s.expiresAt) > refreshBefore {
+		return s.token, nil
+	}
+	appToken, err := s.appJWT()
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	url := fmt.Sprintf("%s/app/installations/%s/access_tokens", strings.TrimSuffix(s.apiURL, "/"), s.installationID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, nil)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+appToken)
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusCreated {
+		return "", gerrors.Newf("failed to create an installation token: %s", resp.Status)
+	}
+	var body struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	s.token = body.Token
+	s.expiresAt = body.ExpiresAt
+	return s.token, nil
+}
+
+// appJWT authenticates as the app, the issue time is backdated to allow for clock drift
+func (s *TokenSource) appJWT() (string, error) {
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(s.privateKey)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+		ExpiresAt: jwt.NewNumericDate(now.Add(9 * time.Minute)),
+		Issuer:    s.appID,
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return signed, nil
+}
@@ -0,0 +1,53 @@
+package gpu
+
+import (
+	"context"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// Query samples utilization and memory of every GPU visible to nvidia-smi on the host.
+func Query(ctx context.Context) ([]models.GPUStat, error) {
+	args := strings.Split(consts.NVIDIA_SMI_STATS_CMD, " ")
+	out, err := exec.CommandContext(ctx, args[0], args[1:]...).Output()
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return ParseStats(string(out), uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+}
+
+// ParseStats parses `index, utilization.gpu, memory.used, memory.total` csv lines without units.
+func ParseStats(output string, timestamp uint64) ([]models.GPUStat, error) {
+	stats := make([]models.GPUStat, 0)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != 4 {
+			return nil, gerrors.Newf("unexpected nvidia-smi output: %s", line)
+		}
+		values := make([]int, len(fields))
+		for i, field := range fields {
+			value, err := strconv.Atoi(strings.TrimSpace(field))
+			if err != nil {
+				return nil, gerrors.Wrap(err)
+			}
+			values[i] = value
+		}
+		stats = append(stats, models.GPUStat{
+			Index:          values[0],
+			Utilization:    values[1],
+			MemoryUsedMiB:  values[2],
+			MemoryTotalMiB: values[3],
+			Timestamp:      timestamp,
+		})
+	}
+	return stats, nil
+}
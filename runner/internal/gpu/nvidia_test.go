@@ -0,0 +1,29 @@
+package gpu
+
+import (
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseStats(t *testing.T) {
+	output := "0, 87, 30211, 40960\n1, 0, 3, 40960\n"
+	stats, err := ParseStats(output, 42)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []models.GPUStat{
+		{Index: 0, Utilization: 87, MemoryUsedMiB: 30211, MemoryTotalMiB: 40960, Timestamp: 42},
+		{Index: 1, Utilization: 0, MemoryUsedMiB: 3, MemoryTotalMiB: 40960, Timestamp: 42},
+	}, stats)
+}
+
+func TestParseStatsEmpty(t *testing.T) {
+	stats, err := ParseStats("\n", 42)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(stats))
+}
+
+func TestParseStatsMalformed(t *testing.T) {
+	_, err := ParseStats("0, [N/A], 3, 40960", 42)
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,104 @@
+// Package health serves the liveness and readiness probes of the runner, e.g. for the load balancers and the hub
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+const checkTimeout = 5 * time.Second
+
+// ErrPending is returned by the checks that can't run yet, e.g. before the job is accepted. It fails no probe.
+var ErrPending = errors.New("pending")
+
+// Checker is the part of the executor the probes ask
+type Checker interface {
+	CheckDocker(ctx context.Context) error
+	CheckBackend(ctx context.Context) error
+	// Ready tells the job is accepted
+	Ready() bool
+}
+
+type Server struct {
+	host    string
+	port    int
+	checker Checker
+	server  *http.Server
+}
+
+// Response of the probes, Checks are ok, pending or the error of every check
+type Response struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+func New(host string, port int, checker Checker) *Server {
+	s := &Server{host: host, port: port, checker: checker}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/ready", s.ready)
+	s.server = &http.Server{Addr: net.JoinHostPort(host, strconv.Itoa(port)), Handler: mux, ReadHeaderTimeout: checkTimeout}
+	return s
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	log.Info(ctx, "Health server is listening", "host", s.host, "port", s.port)
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+func (s *Server) Shutdown() {
+	_ = s.server.Close()
+}
+
+// healthz answers if the process is alive, the Docker daemon and the backend are reachable
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), checkTimeout)
+	defer cancel()
+	checks := map[string]func(context.Context) error{
+		"docker":  s.checker.CheckDocker,
+		"backend": s.checker.CheckBackend,
+	}
+	resp := Response{Status: "ok", Checks: make(map[string]string, len(checks))}
+	for name, check := range checks {
+		err := check(ctx)
+		switch {
+		case err == nil:
+			resp.Checks[name] = "ok"
+		case errors.Is(err, ErrPending):
+			resp.Checks[name] = "pending"
+		default:
+			resp.Checks[name] = err.Error()
+			resp.Status = "failing"
+		}
+	}
+	code := http.StatusOK
+	if resp.Status != "ok" {
+		code = http.StatusServiceUnavailable
+	}
+	respond(w, code, resp)
+}
+
+func (s *Server) ready(w http.ResponseWriter, _ *http.Request) {
+	if !s.checker.Ready() {
+		respond(w, http.StatusServiceUnavailable, Response{Status: "pending"})
+		return
+	}
+	respond(w, http.StatusOK, Response{Status: "ok"})
+}
+
+func respond(w http.ResponseWriter, code int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(resp)
+}
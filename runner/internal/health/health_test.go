@@ -0,0 +1,53 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeChecker struct {
+	docker, backend error
+	ready           bool
+}
+
+func (c *fakeChecker) CheckDocker(context.Context) error  { return c.docker }
+func (c *fakeChecker) CheckBackend(context.Context) error { return c.backend }
+func (c *fakeChecker) Ready() bool                        { return c.ready }
+
+func probe(t *testing.T, s *Server, path string) (int, Response) {
+	rec := httptest.NewRecorder()
+	s.server.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	resp := Response{}
+	assert.Equal(t, nil, json.NewDecoder(rec.Body).Decode(&resp))
+	return rec.Code, resp
+}
+
+func TestHealthz(t *testing.T) {
+	checker := &fakeChecker{backend: ErrPending}
+	s := New("127.0.0.1", 0, checker)
+	code, resp := probe(t, s, "/healthz")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, map[string]string{"docker": "ok", "backend": "pending"}, resp.Checks)
+
+	checker.docker = errors.New("docker is down")
+	code, resp = probe(t, s, "/healthz")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, "docker is down", resp.Checks["docker"])
+}
+
+func TestReady(t *testing.T) {
+	checker := &fakeChecker{}
+	s := New("127.0.0.1", 0, checker)
+	code, _ := probe(t, s, "/ready")
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	checker.ready = true
+	code, resp := probe(t, s, "/ready")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "ok", resp.Status)
+}
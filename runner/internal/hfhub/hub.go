@@ -0,0 +1,391 @@
+package hfhub
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+const (
+	DefaultEndpoint = "https://huggingface.co"
+
+	RepoTypeModel   = "model"
+	RepoTypeDataset = "dataset"
+	RepoTypeSpace   = "space"
+
+	// sampleSize is the head of the file the hub decides the upload mode by
+	sampleSize = 512
+	// preuploadBatch is the number of files asked about in one request
+	preuploadBatch = 250
+	lfsMediaType   = "application/vnd.git-lfs+json"
+)
+
+// Repo is a hub repo, the empty type is a model and the empty revision is main
+type Repo struct {
+	ID       string
+	Type     string
+	Revision string
+}
+
+func (r Repo) revision() string {
+	if r.Revision == "" {
+		return "main"
+	}
+	return r.Revision
+}
+
+func (r Repo) apiPath() string {
+	typ := r.Type
+	if typ == "" {
+		typ = RepoTypeModel
+	}
+	return fmt.Sprintf("/api/%ss/%s", typ, r.ID)
+}
+
+// gitPath is the repo path of the git and LFS endpoints, the models have no prefix
+func (r Repo) gitPath() string {
+	if r.Type == "" || r.Type == RepoTypeModel {
+		return "/" + r.ID
+	}
+	return fmt.Sprintf("/%ss/%s", r.Type, r.ID)
+}
+
+// File is a local file committed at Path of the repo
+type File struct {
+	Path  string
+	Local string
+}
+
+// Client commits the files to the hub, the large ones are uploaded to LFS first
+type Client struct {
+	endpoint string
+	token    string
+	client   *http.Client
+}
+
+func New(endpoint, token string) *Client {
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return &Client{
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		token:    token,
+		// the LFS uploads of the weights take long, the requests are bounded by the context only
+		client: &http.Client{},
+	}
+}
+
+// Commit uploads the files in one commit and returns its hash
+func (c *Client) Commit(ctx context.Context, repo Repo, files []File, message string) (string, error) {
+	modes, err := c.uploadModes(ctx, repo, files)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	if err = encoder.Encode(operation{Key: "header", Value: map[string]string{"summary": message, "description": ""}}); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	for _, file := range files {
+		if modes[file.Path] == "lfs" {
+			oid, size, err := fileOid(file.Local)
+			if err != nil {
+				return "", gerrors.Wrap(err)
+			}
+			if err = c.uploadLFS(ctx, repo, file.Local, oid, size); err != nil {
+				return "", gerrors.Wrap(err)
+			}
+			err = encoder.Encode(operation{Key: "lfsFile", Value: map[string]interface{}{"path": file.Path, "algo": "sha256", "oid": oid, "size": size}})
+			if err != nil {
+				return "", gerrors.Wrap(err)
+			}
+			continue
+		}
+		content, err := os.ReadFile(file.Local)
+		if err != nil {
+			return "", gerrors.Wrap(err)
+		}
+		err = encoder.Encode(operation{Key: "file", Value: map[string]string{"path": file.Path, "encoding": "base64", "content": base64.StdEncoding.EncodeToString(content)}})
+		if err != nil {
+			return "", gerrors.Wrap(err)
+		}
+	}
+	commitURL := fmt.Sprintf("%s%s/commit/%s", c.endpoint, repo.apiPath(), url.PathEscape(repo.revision()))
+	var reply struct {
+		CommitOid string `json:"commitOid"`
+	}
+	if err = c.do(ctx, http.MethodPost, commitURL, "application/x-ndjson", &body, c.authHeaders(), &reply); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	if reply.CommitOid == "" {
+		return "", gerrors.New("hub returned no commit")
+	}
+	return reply.CommitOid, nil
+}
+
+type operation struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// uploadModes asks the hub which files go to LFS by their size and sample
+func (c *Client) uploadModes(ctx context.Context, repo Repo, files []File) (map[string]string, error) {
+	modes := make(map[string]string, len(files))
+	preuploadURL := fmt.Sprintf("%s%s/preupload/%s", c.endpoint, repo.apiPath(), url.PathEscape(repo.revision()))
+	for start := 0; start < len(files); start += preuploadBatch {
+		end := start + preuploadBatch
+		if end > len(files) {
+			end = len(files)
+		}
+		type preuploadFile struct {
+			Path   string `json:"path"`
+			Sample string `json:"sample"`
+			Size   int64  `json:"size"`
+		}
+		var request struct {
+			Files []preuploadFile `json:"files"`
+		}
+		for _, file := range files[start:end] {
+			sample, size, err := fileSample(file.Local)
+			if err != nil {
+				return nil, gerrors.Wrap(err)
+			}
+			request.Files = append(request.Files, preuploadFile{Path: file.Path, Sample: base64.StdEncoding.EncodeToString(sample), Size: size})
+		}
+		body, err := json.Marshal(request)
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		var reply struct {
+			Files []struct {
+				Path       string `json:"path"`
+				UploadMode string `json:"uploadMode"`
+			} `json:"files"`
+		}
+		if err = c.do(ctx, http.MethodPost, preuploadURL, "application/json", bytes.NewReader(body), c.authHeaders(), &reply); err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		for _, file := range reply.Files {
+			modes[file.Path] = file.UploadMode
+		}
+	}
+	return modes, nil
+}
+
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+// uploadLFS uploads the object unless the hub has it already, the large objects are uploaded in parts
+func (c *Client) uploadLFS(ctx context.Context, repo Repo, local, oid string, size int64) error {
+	request := map[string]interface{}{
+		"operation": "upload",
+		"transfers": []string{"basic", "multipart"},
+		"objects":   []map[string]interface{}{{"oid": oid, "size": size}},
+		"hash_algo": "sha256",
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	headers := c.authHeaders()
+	headers["Accept"] = lfsMediaType
+	var reply struct {
+		Objects []struct {
+			Actions map[string]lfsAction `json:"actions"`
+			Error   *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		} `json:"objects"`
+	}
+	batchURL := fmt.Sprintf("%s%s.git/info/lfs/objects/batch", c.endpoint, repo.gitPath())
+	if err = c.do(ctx, http.MethodPost, batchURL, lfsMediaType, bytes.NewReader(body), headers, &reply); err != nil {
+		return gerrors.Wrap(err)
+	}
+	if len(reply.Objects) != 1 {
+		return gerrors.Newf("hub returned %d LFS objects", len(reply.Objects))
+	}
+	object := reply.Objects[0]
+	if object.Error != nil {
+		return gerrors.Newf("LFS upload refused: %s", object.Error.Message)
+	}
+	upload, ok := object.Actions["upload"]
+	if !ok {
+		// the hub has the object
+		return nil
+	}
+	if chunkSize, ok := upload.Header["chunk_size"]; ok {
+		err = c.uploadParts(ctx, upload, local, oid, chunkSize)
+	} else {
+		err = c.uploadBasic(ctx, upload, local, size)
+	}
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if verify, ok := object.Actions["verify"]; ok {
+		body, err = json.Marshal(map[string]interface{}{"oid": oid, "size": size})
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		headers = c.authHeaders()
+		for k, v := range verify.Header {
+			headers[k] = v
+		}
+		return gerrors.Wrap(c.do(ctx, http.MethodPost, verify.Href, lfsMediaType, bytes.NewReader(body), headers, nil))
+	}
+	return nil
+}
+
+func (c *Client) uploadBasic(ctx context.Context, upload lfsAction, local string, size int64) error {
+	file, err := os.Open(local)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, upload.Href, file)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	req.ContentLength = size
+	for k, v := range upload.Header {
+		req.Header.Set(k, v)
+	}
+	_, err = c.send(req)
+	return gerrors.Wrap(err)
+}
+
+// uploadParts puts the parts to the presigned URLs of the header, numbered 00001 and up, and completes the upload
+func (c *Client) uploadParts(ctx context.Context, upload lfsAction, local, oid, chunkSize string) error {
+	partSize, err := strconv.ParseInt(chunkSize, 10, 64)
+	if err != nil || partSize <= 0 {
+		return gerrors.Newf("bad LFS chunk size %q", chunkSize)
+	}
+	var numbers []string
+	for k := range upload.Header {
+		if _, err := strconv.Atoi(k); err == nil {
+			numbers = append(numbers, k)
+		}
+	}
+	sort.Strings(numbers)
+	file, err := os.Open(local)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	type part struct {
+		PartNumber int    `json:"partNumber"`
+		ETag       string `json:"etag"`
+	}
+	parts := make([]part, 0, len(numbers))
+	for i, number := range numbers {
+		section := io.NewSectionReader(file, int64(i)*partSize, partSize)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, upload.Header[number], section)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		req.ContentLength = section.Size()
+		resp, err := c.send(req)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		n, _ := strconv.Atoi(number)
+		parts = append(parts, part{PartNumber: n, ETag: resp.Header.Get("ETag")})
+	}
+	body, err := json.Marshal(map[string]interface{}{"oid": oid, "parts": parts})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(c.do(ctx, http.MethodPost, upload.Href, "application/json", bytes.NewReader(body), c.authHeaders(), nil))
+}
+
+func (c *Client) authHeaders() map[string]string {
+	return map[string]string{"Authorization": "Bearer " + c.token}
+}
+
+// do sends the request and decodes the JSON reply into out if it is not nil
+func (c *Client) do(ctx context.Context, method, url, contentType string, body io.Reader, headers map[string]string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if out == nil {
+		return nil
+	}
+	return gerrors.Wrap(json.NewDecoder(bytes.NewReader(resp.body)).Decode(out))
+}
+
+type response struct {
+	Header http.Header
+	body   []byte
+}
+
+func (c *Client) send(req *http.Request) (*response, error) {
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, gerrors.Newf("%s %s: %s %s", req.Method, req.URL.Path, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return &response{Header: resp.Header, body: body}, nil
+}
+
+func fileSample(local string) ([]byte, int64, error) {
+	file, err := os.Open(local)
+	if err != nil {
+		return nil, 0, gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, gerrors.Wrap(err)
+	}
+	sample := make([]byte, sampleSize)
+	n, err := io.ReadFull(file, sample)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, 0, gerrors.Wrap(err)
+	}
+	return sample[:n], info.Size(), nil
+}
+
+// fileOid is the sha256 the LFS objects are addressed by
+func fileOid(local string) (string, int64, error) {
+	file, err := os.Open(local)
+	if err != nil {
+		return "", 0, gerrors.Wrap(err)
+	}
+	defer func() { _ = file.Close() }()
+	h := sha256.New()
+	size, err := io.Copy(h, file)
+	if err != nil {
+		return "", 0, gerrors.Wrap(err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
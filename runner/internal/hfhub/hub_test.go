@@ -0,0 +1,83 @@
+package hfhub
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCommit(t *testing.T) {
+	var server *httptest.Server
+	lfsObjects := map[string][]byte{}
+	var committed []map[string]interface{}
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" && r.URL.Path != "/lfs/upload" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/models/user/model/preupload/main":
+			var request struct {
+				Files []struct {
+					Path string `json:"path"`
+					Size int64  `json:"size"`
+				} `json:"files"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			var files []map[string]string
+			for _, f := range request.Files {
+				mode := "regular"
+				if strings.HasSuffix(f.Path, ".safetensors") {
+					mode = "lfs"
+				}
+				files = append(files, map[string]string{"path": f.Path, "uploadMode": mode})
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"files": files})
+		case "/user/model.git/info/lfs/objects/batch":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"objects": []interface{}{map[string]interface{}{
+				"actions": map[string]interface{}{"upload": map[string]interface{}{"href": server.URL + "/lfs/upload"}},
+			}}})
+		case "/lfs/upload":
+			body, _ := io.ReadAll(r.Body)
+			lfsObjects[r.URL.Path] = body
+		case "/api/models/user/model/commit/main":
+			scanner := bufio.NewScanner(r.Body)
+			scanner.Buffer(nil, 1<<20)
+			for scanner.Scan() {
+				var op map[string]interface{}
+				_ = json.Unmarshal(scanner.Bytes(), &op)
+				committed = append(committed, op)
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"commitOid": "abc123"})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(dir, "model.safetensors"), []byte("weights"), 0o644))
+	assert.Equal(t, nil, os.WriteFile(filepath.Join(dir, "tokenizer.json"), []byte("{}"), 0o644))
+	files := []File{
+		{Path: "model.safetensors", Local: filepath.Join(dir, "model.safetensors")},
+		{Path: "tokenizer.json", Local: filepath.Join(dir, "tokenizer.json")},
+	}
+	commit, err := New(server.URL, "token").Commit(context.Background(), Repo{ID: "user/model"}, files, "Upload")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "abc123", commit)
+	assert.Equal(t, []byte("weights"), lfsObjects["/lfs/upload"])
+	assert.Equal(t, 3, len(committed))
+	assert.Equal(t, "header", committed[0]["key"])
+	assert.Equal(t, "lfsFile", committed[1]["key"])
+	assert.Equal(t, "file", committed[2]["key"])
+	assert.Equal(t, "e30=", committed[2]["value"].(map[string]interface{})["content"])
+}
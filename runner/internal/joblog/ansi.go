@@ -0,0 +1,128 @@
+package joblog
+
+import (
+	"io"
+	"sync"
+)
+
+// The modes of the ANSI handling, the escape sequences are kept by default
+const (
+	ANSIKeep      = "keep"
+	ANSIStrip     = "strip"
+	ANSINormalize = "normalize"
+)
+
+// the states of the escape sequence parser
+const (
+	ansiText = iota
+	ansiEsc
+	ansiCSI
+	ansiOSC
+	ansiOSCEsc
+	ansiCharset
+)
+
+// ANSIWriter removes the ANSI escape sequences, e.g. the colors and the cursor moves.
+// Normalizing keeps only the last carriage return rewrite of every line, e.g. the final state of a progress bar.
+type ANSIWriter struct {
+	mu        sync.Mutex
+	w         io.Writer
+	normalize bool
+	state     int
+	cr        bool
+	line      []byte
+}
+
+func NewANSIWriter(w io.Writer, mode string) *ANSIWriter {
+	return &ANSIWriter{w: w, normalize: mode == ANSINormalize}
+}
+
+func (w *ANSIWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make([]byte, 0, len(p))
+	for _, b := range p {
+		switch w.state {
+		case ansiText:
+			if b == 0x1b {
+				w.state = ansiEsc
+				continue
+			}
+			if !w.normalize {
+				out = append(out, b)
+				continue
+			}
+			out = w.normalized(out, b)
+		case ansiEsc:
+			switch b {
+			case '[':
+				w.state = ansiCSI
+			case ']':
+				w.state = ansiOSC
+			case '(', ')':
+				w.state = ansiCharset
+			default:
+				w.state = ansiText
+			}
+		case ansiCSI:
+			if b >= 0x40 && b <= 0x7e {
+				w.state = ansiText
+			}
+		case ansiOSC:
+			if b == 0x07 {
+				w.state = ansiText
+			} else if b == 0x1b {
+				w.state = ansiOSCEsc
+			}
+		case ansiOSCEsc:
+			w.state = ansiOSC
+			if b == '\\' {
+				w.state = ansiText
+			}
+		case ansiCharset:
+			w.state = ansiText
+		}
+	}
+	if len(out) > 0 {
+		if _, err := w.w.Write(out); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// normalized holds the line until its end, a carriage return not followed by a newline starts it over
+func (w *ANSIWriter) normalized(out []byte, b byte) []byte {
+	if w.cr {
+		w.cr = false
+		if b != '\n' {
+			w.line = w.line[:0]
+		}
+	}
+	switch b {
+	case '\r':
+		w.cr = true
+	case '\n':
+		out = append(append(out, w.line...), '\n')
+		w.line = w.line[:0]
+	default:
+		w.line = append(w.line, b)
+		if len(w.line) >= maxLineSize {
+			out = append(out, w.line...)
+			w.line = w.line[:0]
+		}
+	}
+	return out
+}
+
+// Flush writes the held line without a newline
+func (w *ANSIWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.line) == 0 {
+		return nil
+	}
+	_, err := w.w.Write(w.line)
+	w.line = w.line[:0]
+	return err
+}
@@ -0,0 +1,27 @@
+package joblog
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestANSIStrip(t *testing.T) {
+	var out bytes.Buffer
+	w := NewANSIWriter(&out, ANSIStrip)
+	_, _ = w.Write([]byte("\x1b[31mred\x1b"))
+	_, _ = w.Write([]byte("[0m \x1b]0;title\x07done\r\n"))
+	assert.Equal(t, nil, w.Flush())
+	assert.Equal(t, "red done\r\n", out.String())
+}
+
+func TestANSINormalize(t *testing.T) {
+	var out bytes.Buffer
+	w := NewANSIWriter(&out, ANSINormalize)
+	_, _ = w.Write([]byte(" 10%|\x1b[32m#\x1b[0m|\r 50%|##|\r"))
+	_, _ = w.Write([]byte("100%|###|\r\nnext\npartial"))
+	assert.Equal(t, "100%|###|\nnext\n", out.String())
+	assert.Equal(t, nil, w.Flush())
+	assert.Equal(t, "100%|###|\nnext\npartial", out.String())
+}
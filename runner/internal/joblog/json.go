@@ -0,0 +1,120 @@
+package joblog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// maxLineSize bounds the buffered partial line, e.g. progress bars without a newline
+const maxLineSize = 64 * 1024
+
+type Envelope struct {
+	Timestamp string `json:"timestamp"`
+	JobID     string `json:"job_id"`
+	RunName   string `json:"run_name"`
+	Stream    string `json:"stream"`
+	Seq       uint64 `json:"seq"`
+	Log       string `json:"log"`
+}
+
+// JSONFormatter wraps every log line into an Envelope. Streams created by the same
+// formatter share the output and the sequence counter.
+type JSONFormatter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	jobID   string
+	runName string
+	seq     uint64
+}
+
+type LineWriter struct {
+	formatter *JSONFormatter
+	stream    string
+	mu        sync.Mutex
+	buf       []byte
+}
+
+func NewJSONFormatter(out io.Writer, jobID, runName string) *JSONFormatter {
+	return &JSONFormatter{
+		out:     out,
+		jobID:   jobID,
+		runName: runName,
+	}
+}
+
+func (f *JSONFormatter) Stream(name string) *LineWriter {
+	return &LineWriter{
+		formatter: f,
+		stream:    name,
+	}
+}
+
+func (f *JSONFormatter) writeLine(stream string, line []byte) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	msg, err := json.Marshal(Envelope{
+		Timestamp: time.Now().UTC().Format(time.RFC3339Nano),
+		JobID:     f.jobID,
+		RunName:   f.runName,
+		Stream:    stream,
+		Seq:       f.seq,
+		Log:       string(line),
+	})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	f.seq++
+	if _, err = f.out.Write(append(msg, '\n')); err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+func (w *LineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.buf = append(w.buf, p...)
+	for {
+		idx := bytes.IndexByte(w.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		line := bytes.TrimSuffix(w.buf[:idx], []byte{'\r'})
+		if err := w.formatter.writeLine(w.stream, line); err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[idx+1:]
+	}
+	if len(w.buf) >= maxLineSize {
+		if err := w.flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes the pending partial line, if any
+func (w *LineWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.flush()
+}
+
+func (w *LineWriter) flush() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	err := w.formatter.writeLine(w.stream, w.buf)
+	w.buf = w.buf[:0]
+	return err
+}
@@ -0,0 +1,48 @@
+package joblog
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func decode(t *testing.T, out string) []Envelope {
+	var result []Envelope
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var e Envelope
+		assert.Equal(t, nil, json.Unmarshal([]byte(line), &e))
+		result = append(result, e)
+	}
+	return result
+}
+
+func TestJSONFormatterLines(t *testing.T) {
+	var out bytes.Buffer
+	f := NewJSONFormatter(&out, "job", "run")
+	w := f.Stream(Stdout)
+	_, _ = w.Write([]byte("first\r\nsec"))
+	_, _ = w.Write([]byte("ond\n"))
+	envelopes := decode(t, out.String())
+	assert.Equal(t, 2, len(envelopes))
+	assert.Equal(t, "first", envelopes[0].Log)
+	assert.Equal(t, "second", envelopes[1].Log)
+	assert.Equal(t, uint64(1), envelopes[1].Seq)
+	assert.Equal(t, "job", envelopes[1].JobID)
+	assert.Equal(t, "run", envelopes[1].RunName)
+	assert.Equal(t, Stdout, envelopes[1].Stream)
+}
+
+func TestJSONFormatterFlush(t *testing.T) {
+	var out bytes.Buffer
+	f := NewJSONFormatter(&out, "job", "run")
+	w := f.Stream(Stderr)
+	_, _ = w.Write([]byte("no newline"))
+	assert.Equal(t, 0, out.Len())
+	assert.Equal(t, nil, w.Flush())
+	envelopes := decode(t, out.String())
+	assert.Equal(t, "no newline", envelopes[0].Log)
+	assert.Equal(t, Stderr, envelopes[0].Stream)
+}
@@ -0,0 +1,187 @@
+package joblog
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const Mask = "***"
+
+// minSecretLength prevents masking trivial values like "1" or "yes" all over the logs
+const minSecretLength = 4
+
+// maxTokenLength bounds how much output is held back to catch a token split between writes
+const maxTokenLength = 128
+
+var tokenPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`gh[pousr]_[A-Za-z0-9]{36,}`),          // GitHub
+	regexp.MustCompile(`github_pat_[A-Za-z0-9_]{22,}`),        // GitHub fine-grained
+	regexp.MustCompile(`(A3T[A-Z0-9]|AKIA|ASIA)[A-Z0-9]{16}`), // AWS access key ID
+	regexp.MustCompile(`xox[abposr]-[A-Za-z0-9-]{10,}`),       // Slack
+	regexp.MustCompile(`hf_[A-Za-z0-9]{30,}`),                 // Hugging Face
+}
+
+// Secrets is a set of values to mask, shared by the writers. Values resolved later are added with Add.
+type Secrets struct {
+	mu       sync.RWMutex
+	values   []string
+	seen     map[string]struct{}
+	replacer *strings.Replacer
+	// multiline is set once a value spans lines, e.g. a PEM key, the completed lines are then held back too
+	multiline bool
+}
+
+func NewSecrets(values ...string) *Secrets {
+	s := &Secrets{
+		seen:     make(map[string]struct{}),
+		replacer: strings.NewReplacer(),
+	}
+	s.Add(values...)
+	return s
+}
+
+func (s *Secrets) Add(values ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := false
+	for _, value := range values {
+		if _, ok := s.seen[value]; ok || len(value) < minSecretLength {
+			continue
+		}
+		s.seen[value] = struct{}{}
+		s.values = append(s.values, value)
+		s.multiline = s.multiline || strings.ContainsAny(value, "\r\n")
+		added = true
+	}
+	if !added {
+		return
+	}
+	// the longest secrets go first, so a secret containing another one is masked entirely
+	sort.Slice(s.values, func(i, j int) bool { return len(s.values[i]) > len(s.values[j]) })
+	tokens := make([]string, 0, 2*len(s.values))
+	for _, value := range s.values {
+		tokens = append(tokens, value, Mask)
+	}
+	s.replacer = strings.NewReplacer(tokens...)
+}
+
+func (s *Secrets) Redact(str string) string {
+	s.mu.RLock()
+	str = s.replacer.Replace(str)
+	s.mu.RUnlock()
+	for _, pattern := range tokenPatterns {
+		str = pattern.ReplaceAllString(str, Mask)
+	}
+	return str
+}
+
+// lookahead is the longest tail of the output that may be the beginning of a secret
+func (s *Secrets) lookahead() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	longest := maxTokenLength
+	if len(s.values) > 0 && len(s.values[0]) > longest {
+		longest = len(s.values[0])
+	}
+	return longest - 1
+}
+
+// cut returns the end of the prefix of buf that can't contain the beginning of a secret continued in the next write
+func (s *Secrets) cut(buf []byte) int {
+	keep := s.lookahead()
+	s.mu.RLock()
+	multiline := s.multiline
+	s.mu.RUnlock()
+	// the completed lines are not held back, unless a secret spans lines and may continue in the next write
+	if idx := bytes.LastIndexAny(buf, "\r\n"); !multiline && idx >= 0 && len(buf)-idx-1 < keep {
+		keep = len(buf) - idx - 1
+	}
+	cut := len(buf) - keep
+	if cut <= 0 {
+		return 0
+	}
+	s.mu.RLock()
+	values := s.values
+	s.mu.RUnlock()
+	for moved := true; moved && cut > 0; {
+		moved = false
+		start := cut - s.lookahead() - 1
+		if start < 0 {
+			start = 0
+		}
+		window := buf[start:]
+		straddles := func(from, to int) {
+			if start+from < cut && start+to > cut {
+				cut = start + from
+				moved = true
+			}
+		}
+		for _, value := range values {
+			for offset := 0; ; {
+				idx := bytes.Index(window[offset:], []byte(value))
+				if idx < 0 {
+					break
+				}
+				straddles(offset+idx, offset+idx+len(value))
+				offset += idx + 1
+			}
+		}
+		for _, pattern := range tokenPatterns {
+			for _, loc := range pattern.FindAllIndex(window, -1) {
+				straddles(loc[0], loc[1])
+			}
+		}
+	}
+	return cut
+}
+
+// MaskWriter redacts known secret values and common token patterns.
+// The tail of the output that may be the beginning of a secret is held back until the next Write or Flush.
+type MaskWriter struct {
+	mu      sync.Mutex
+	out     io.Writer
+	secrets *Secrets
+	pending []byte
+}
+
+func NewMaskWriter(out io.Writer, secrets *Secrets) *MaskWriter {
+	return &MaskWriter{
+		out:     out,
+		secrets: secrets,
+	}
+}
+
+func (w *MaskWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending = append(w.pending, p...)
+	cut := w.secrets.cut(w.pending)
+	if cut == 0 {
+		return len(p), nil
+	}
+	if _, err := io.WriteString(w.out, w.secrets.Redact(string(w.pending[:cut]))); err != nil {
+		return 0, err
+	}
+	w.pending = append(w.pending[:0], w.pending[cut:]...)
+	return len(p), nil
+}
+
+// Flush writes the held back output
+func (w *MaskWriter) Flush() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.pending) == 0 {
+		return nil
+	}
+	_, err := io.WriteString(w.out, w.secrets.Redact(string(w.pending)))
+	w.pending = w.pending[:0]
+	return err
+}
+
+func (w *MaskWriter) Redact(s string) string {
+	return w.secrets.Redact(s)
+}
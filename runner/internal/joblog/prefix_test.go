@@ -0,0 +1,18 @@
+package joblog
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	var out bytes.Buffer
+	w := NewPrefixWriter(&out, "[redis] ")
+	_, _ = w.Write([]byte("ready\nlisten"))
+	_, _ = w.Write([]byte("ing on 6379\nbye"))
+	assert.Equal(t, "[redis] ready\n[redis] listening on 6379\n", out.String())
+	assert.Equal(t, nil, w.Flush())
+	assert.Equal(t, "[redis] ready\n[redis] listening on 6379\n[redis] bye\n", out.String())
+}
@@ -0,0 +1,182 @@
+package joblog
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/compress"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// rotatedSuffix marks the compressed rotated files, the only ones removed by the total size cap
+const rotatedSuffix = ".zst"
+
+// Rotation of the local log files. The sizes are in MiB, MaxAgeHours of zero rotates by size only.
+type Rotation struct {
+	MaxSizeMiB  int `yaml:"max_size_mib,omitempty"`
+	MaxAgeHours int `yaml:"max_age_hours,omitempty"`
+	// MaxTotalMiB caps all the files under the logs directory, the oldest rotated files are removed first
+	MaxTotalMiB int `yaml:"max_total_mib,omitempty"`
+}
+
+func (r *Rotation) maxSize() int64 {
+	if r == nil || r.MaxSizeMiB <= 0 {
+		return consts.LOG_MAX_SIZE_MIB << 20
+	}
+	return int64(r.MaxSizeMiB) << 20
+}
+
+func (r *Rotation) maxAge() time.Duration {
+	if r == nil {
+		return 0
+	}
+	return time.Duration(r.MaxAgeHours) * time.Hour
+}
+
+func (r *Rotation) maxTotal() int64 {
+	if r == nil || r.MaxTotalMiB <= 0 {
+		return consts.LOG_MAX_TOTAL_MIB << 20
+	}
+	return int64(r.MaxTotalMiB) << 20
+}
+
+// RotatingFile appends to a log file and moves it aside once it is too big or too old.
+// The rotated files are compressed in the background, then the total size of root is capped.
+type RotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	root     string
+	rotation *Rotation
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	wg       sync.WaitGroup
+}
+
+// OpenRotating opens the log file at path, root is the directory the total size cap applies to
+func OpenRotating(path, root string, rotation *Rotation) (*RotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	f := &RotatingFile{path: path, root: root, rotation: rotation}
+	if err := f.open(); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return f, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o777)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return gerrors.Wrap(err)
+	}
+	f.file, f.size, f.openedAt = file, info.Size(), time.Now()
+	return nil
+}
+
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.file == nil {
+		return 0, gerrors.New("log file is closed")
+	}
+	if f.size > 0 && f.size+int64(len(p)) > f.rotation.maxSize() {
+		if err := f.rotate(); err != nil {
+			return 0, gerrors.Wrap(err)
+		}
+	} else if age := f.rotation.maxAge(); age > 0 && f.size > 0 && time.Since(f.openedAt) >= age {
+		if err := f.rotate(); err != nil {
+			return 0, gerrors.Wrap(err)
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file with the rotation time, the name sorts in the rotation order
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return gerrors.Wrap(err)
+	}
+	rotated := strings.TrimSuffix(f.path, ".log") + "." + time.Now().UTC().Format("20060102T150405.000000000") + ".log"
+	if err := os.Rename(f.path, rotated); err != nil {
+		return gerrors.Wrap(err)
+	}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		if err := compress.CompressFile(rotated, rotated+rotatedSuffix); err != nil {
+			// the uncompressed file is kept, it is still counted by the cap
+			_ = os.Remove(rotated + rotatedSuffix)
+		} else {
+			_ = os.Remove(rotated)
+		}
+		_ = capTotalSize(f.root, f.rotation.maxTotal())
+	}()
+	return gerrors.Wrap(f.open())
+}
+
+// Close waits for the compression of the rotated files
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return gerrors.Wrap(err)
+}
+
+// capTotalSize removes the oldest rotated files until the files under root fit in maxTotal.
+// The active log files are never removed.
+func capTotalSize(root string, maxTotal int64) error {
+	type rotatedFile struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var total int64
+	var rotated []rotatedFile
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		total += info.Size()
+		if strings.HasSuffix(path, ".log"+rotatedSuffix) {
+			rotated = append(rotated, rotatedFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		}
+		return nil
+	})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	sort.Slice(rotated, func(i, j int) bool { return rotated[i].modTime.Before(rotated[j].modTime) })
+	for _, file := range rotated {
+		if total <= maxTotal {
+			break
+		}
+		if err = os.Remove(file.path); err != nil {
+			return gerrors.Wrap(err)
+		}
+		total -= file.size
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package joblog
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRotatingFile(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "jobs", "run.log")
+	f, err := OpenRotating(path, root, &Rotation{MaxSizeMiB: 1})
+	assert.Equal(t, nil, err)
+	chunk := bytes.Repeat([]byte("line\n"), 120*1024)
+	_, err = f.Write(chunk)
+	assert.Equal(t, nil, err)
+	_, err = f.Write(chunk)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, nil, f.Close())
+
+	rotated, _ := filepath.Glob(filepath.Join(root, "jobs", "run.*.log.zst"))
+	assert.Equal(t, 1, len(rotated))
+	info, err := os.Stat(path)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, int64(len(chunk)), info.Size())
+}
+
+func TestCapTotalSize(t *testing.T) {
+	root := t.TempDir()
+	write := func(name string, size int, age time.Duration) {
+		p := filepath.Join(root, name)
+		assert.Equal(t, nil, os.WriteFile(p, make([]byte, size), 0o644))
+		mtime := time.Now().Add(-age)
+		assert.Equal(t, nil, os.Chtimes(p, mtime, mtime))
+	}
+	write("run.log", 100, 0)
+	write("run.1.log.zst", 100, 2*time.Hour)
+	write("run.2.log.zst", 100, time.Hour)
+	assert.Equal(t, nil, capTotalSize(root, 250))
+
+	_, err := os.Stat(filepath.Join(root, "run.1.log.zst"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "run.2.log.zst"))
+	assert.Equal(t, nil, err)
+	// the active file is kept over the cap
+	assert.Equal(t, nil, capTotalSize(root, 50))
+	_, err = os.Stat(filepath.Join(root, "run.log"))
+	assert.Equal(t, nil, err)
+}
@@ -0,0 +1,58 @@
+package joblog
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Tail keeps the last lines written to it, e.g. for the failure summary of a job
+type Tail struct {
+	mu    sync.Mutex
+	size  int
+	lines []string
+	buf   []byte
+}
+
+func NewTail(size int) *Tail {
+	return &Tail{size: size}
+}
+
+func (t *Tail) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	for {
+		idx := bytes.IndexByte(t.buf, '\n')
+		if idx < 0 {
+			break
+		}
+		t.add(string(bytes.TrimRight(t.buf[:idx], "\r")))
+		t.buf = t.buf[idx+1:]
+	}
+	if len(t.buf) >= maxLineSize {
+		t.add(string(t.buf))
+		t.buf = t.buf[:0]
+	}
+	return len(p), nil
+}
+
+// Lines returns the kept lines with the pending partial one
+func (t *Tail) Lines() []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	lines := append([]string(nil), t.lines...)
+	if len(t.buf) > 0 {
+		lines = append(lines, string(t.buf))
+	}
+	if len(lines) > t.size {
+		lines = lines[len(lines)-t.size:]
+	}
+	return lines
+}
+
+func (t *Tail) add(line string) {
+	t.lines = append(t.lines, line)
+	if len(t.lines) > t.size {
+		t.lines = t.lines[len(t.lines)-t.size:]
+	}
+}
@@ -0,0 +1,15 @@
+package joblog
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTail(t *testing.T) {
+	tail := NewTail(2)
+	_, _ = tail.Write([]byte("one\ntwo\r\nthr"))
+	assert.Equal(t, []string{"two", "thr"}, tail.Lines())
+	_, _ = tail.Write([]byte("ee\nfour\n"))
+	assert.Equal(t, []string{"three", "four"}, tail.Lines())
+}
@@ -119,7 +119,9 @@ func GetLogger(ctx context.Context) *logrus.Entry {
 
 func SetCloudLogger(l io.Writer) {
 	if CloudLog == "true" {
+		cloudMu.Lock()
 		cloud = l
+		cloudMu.Unlock()
 	}
 }
 
@@ -131,18 +133,16 @@ func writeCloud(level, msg string, args ...interface{}) {
 	for _, arg := range args {
 		bld.WriteString(fmt.Sprint(arg))
 	}
+	cloudMu.Lock()
+	defer cloudMu.Unlock()
 	if cloud == nil {
-		cloudMu.Lock()
 		cloudBuffer = append(cloudBuffer, bld.String())
-		cloudMu.Unlock()
 		return
 	}
-	cloudMu.Lock()
 	for len(cloudBuffer) > 0 {
 		b := cloudBuffer[0]
 		cloudBuffer = cloudBuffer[1:]
 		_, _ = cloud.Write([]byte(b))
 	}
-	cloudMu.Unlock()
 	_, _ = cloud.Write([]byte(bld.String()))
 }
@@ -0,0 +1,58 @@
+package logsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+const defaultFluentdTag = "dstack.job"
+
+// FluentdConfig of the HTTP input of Fluentd or Fluent Bit, URL is the base one, e.g. http://fluentd:9880.
+// The records have the log line, its time in seconds and the job labels.
+type FluentdConfig struct {
+	URL string `yaml:"url"`
+	Tag string `yaml:"tag,omitempty"`
+}
+
+type fluentd struct {
+	config *FluentdConfig
+	labels map[string]string
+}
+
+func (f *fluentd) name() string {
+	return "fluentd"
+}
+
+func (f *fluentd) send(ctx context.Context, entries []Entry) error {
+	records := make([]map[string]interface{}, 0, len(entries))
+	for _, e := range entries {
+		record := map[string]interface{}{
+			"log":  e.Line,
+			"time": float64(e.Time.UnixNano()) / 1e9,
+		}
+		for k, v := range f.labels {
+			record[k] = v
+		}
+		records = append(records, record)
+	}
+	body, err := json.Marshal(records)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	tag := f.config.Tag
+	if tag == "" {
+		tag = defaultFluentdTag
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(f.config.URL, "/")+"/"+url.PathEscape(tag), bytes.NewReader(body))
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return post(req, "fluentd")
+}
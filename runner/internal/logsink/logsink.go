@@ -0,0 +1,182 @@
+// Package logsink forwards the job logs to the logging stacks of the teams, Grafana Loki or Fluentd
+package logsink
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+const (
+	flushInterval = time.Second
+	// batchSize of the lines sent at once, maxBuffered lines wait for the sink at most, the next ones are dropped
+	batchSize   = 1000
+	maxBuffered = 10000
+	maxLineSize = 64 * 1024
+	sendTimeout = 10 * time.Second
+)
+
+// Config of the log sinks. DisableBackend stops writing the job logs to the backend, e.g. Cloudwatch.
+type Config struct {
+	Loki           *LokiConfig    `yaml:"loki,omitempty"`
+	Fluentd        *FluentdConfig `yaml:"fluentd,omitempty"`
+	DisableBackend bool           `yaml:"disable_backend,omitempty"`
+}
+
+// Entry is a log line without the line break
+type Entry struct {
+	Time time.Time
+	Line string
+}
+
+// sender delivers a batch to the logging stack
+type sender interface {
+	send(ctx context.Context, entries []Entry) error
+	name() string
+}
+
+// Sink buffers the written lines and sends them in batches, the writes never wait for the logging stack
+type Sink struct {
+	sender  sender
+	mu      sync.Mutex
+	partial []byte
+	entries []Entry
+	dropped uint64
+	notify  chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// Sinks are the configured sinks, labels identify the job, e.g. job_id and run_name
+func Sinks(ctx context.Context, config *Config, labels map[string]string) []*Sink {
+	sinks := make([]*Sink, 0)
+	if config == nil {
+		return sinks
+	}
+	if config.Loki != nil {
+		sinks = append(sinks, newSink(ctx, &loki{config: config.Loki, labels: labels}))
+	}
+	if config.Fluentd != nil {
+		sinks = append(sinks, newSink(ctx, &fluentd{config: config.Fluentd, labels: labels}))
+	}
+	return sinks
+}
+
+// Writers of the sinks, e.g. for io.MultiWriter
+func Writers(sinks []*Sink) []io.Writer {
+	writers := make([]io.Writer, 0, len(sinks))
+	for _, s := range sinks {
+		writers = append(writers, s)
+	}
+	return writers
+}
+
+func newSink(ctx context.Context, sender sender) *Sink {
+	s := &Sink{
+		sender:  sender,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run(ctx)
+	return s
+}
+
+func (s *Sink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.partial = append(s.partial, p...)
+	for {
+		idx := bytes.IndexByte(s.partial, '\n')
+		if idx < 0 {
+			break
+		}
+		s.add(Entry{Time: now, Line: string(bytes.TrimRight(s.partial[:idx], "\r"))})
+		s.partial = s.partial[idx+1:]
+	}
+	if len(s.partial) >= maxLineSize {
+		s.add(Entry{Time: now, Line: string(s.partial)})
+		s.partial = s.partial[:0]
+	}
+	return len(p), nil
+}
+
+func (s *Sink) add(entry Entry) {
+	if len(s.entries) >= maxBuffered {
+		atomic.AddUint64(&s.dropped, 1)
+		return
+	}
+	s.entries = append(s.entries, entry)
+	if len(s.entries) >= batchSize {
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Close sends the pending lines, the partial last line included
+func (s *Sink) Close() error {
+	s.mu.Lock()
+	if len(s.partial) > 0 {
+		s.entries = append(s.entries, Entry{Time: time.Now(), Line: string(s.partial)})
+		s.partial = nil
+	}
+	s.mu.Unlock()
+	close(s.done)
+	<-s.stopped
+	return nil
+}
+
+func (s *Sink) run(ctx context.Context) {
+	defer close(s.stopped)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			s.flush(context.Background())
+			if dropped := atomic.LoadUint64(&s.dropped); dropped > 0 {
+				log.Warning(ctx, "Log sink dropped lines", "sink", s.sender.name(), "dropped", dropped)
+			}
+			return
+		case <-ticker.C:
+		case <-s.notify:
+		}
+		s.flush(ctx)
+	}
+}
+
+// flush sends the buffered lines, a failed batch is dropped not to hold the next ones
+func (s *Sink) flush(ctx context.Context) {
+	for {
+		s.mu.Lock()
+		n := len(s.entries)
+		if n > batchSize {
+			n = batchSize
+		}
+		batch := s.entries[:n:n]
+		s.entries = s.entries[n:]
+		s.mu.Unlock()
+		if len(batch) == 0 {
+			return
+		}
+		if err := s.send(ctx, batch); err != nil {
+			atomic.AddUint64(&s.dropped, uint64(len(batch)))
+			log.Warning(ctx, "Failed to send the logs", "sink", s.sender.name(), "err", err)
+		}
+	}
+}
+
+func (s *Sink) send(ctx context.Context, batch []Entry) error {
+	ctx, cancel := context.WithTimeout(ctx, sendTimeout)
+	defer cancel()
+	return gerrors.Wrap(s.sender.send(ctx, batch))
+}
@@ -0,0 +1,60 @@
+package logsink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLokiSink(t *testing.T) {
+	var pushes []lokiPush
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, lokiPushPath, r.URL.Path)
+		assert.Equal(t, "team", r.Header.Get("X-Scope-OrgID"))
+		push := lokiPush{}
+		assert.Equal(t, nil, json.NewDecoder(r.Body).Decode(&push))
+		pushes = append(pushes, push)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	config := &Config{Loki: &LokiConfig{URL: server.URL + "/", TenantID: "team", Labels: map[string]string{"env": "dev"}}}
+	sinks := Sinks(context.Background(), config, map[string]string{"run_name": "sharp-fox-1"})
+	assert.Equal(t, 1, len(sinks))
+	_, _ = sinks[0].Write([]byte("one\r\ntw"))
+	_, _ = sinks[0].Write([]byte("o\nthree"))
+	assert.Equal(t, nil, sinks[0].Close())
+
+	var lines []string
+	for _, push := range pushes {
+		for _, stream := range push.Streams {
+			assert.Equal(t, map[string]string{"env": "dev", "run_name": "sharp-fox-1"}, stream.Stream)
+			for _, value := range stream.Values {
+				lines = append(lines, value[1])
+			}
+		}
+	}
+	assert.Equal(t, []string{"one", "two", "three"}, lines)
+}
+
+func TestFluentdSink(t *testing.T) {
+	var records []map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/dstack.job", r.URL.Path)
+		var batch []map[string]interface{}
+		assert.Equal(t, nil, json.NewDecoder(r.Body).Decode(&batch))
+		records = append(records, batch...)
+	}))
+	defer server.Close()
+
+	sinks := Sinks(context.Background(), &Config{Fluentd: &FluentdConfig{URL: server.URL}}, map[string]string{"job_id": "4f2a"})
+	_, _ = sinks[0].Write([]byte("hello\n"))
+	assert.Equal(t, nil, sinks[0].Close())
+	assert.Equal(t, 1, len(records))
+	assert.Equal(t, "hello", records[0]["log"])
+	assert.Equal(t, "4f2a", records[0]["job_id"])
+}
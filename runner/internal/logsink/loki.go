@@ -0,0 +1,84 @@
+package logsink
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+const lokiPushPath = "/loki/api/v1/push"
+
+// LokiConfig of a Grafana Loki server, URL is the base one, e.g. http://loki:3100.
+// Labels are added to the job ones, TenantID is sent as X-Scope-OrgID for the multi-tenant servers.
+type LokiConfig struct {
+	URL      string            `yaml:"url"`
+	Labels   map[string]string `yaml:"labels,omitempty"`
+	TenantID string            `yaml:"tenant_id,omitempty"`
+	Username string            `yaml:"username,omitempty"`
+	Password string            `yaml:"password,omitempty"`
+}
+
+type loki struct {
+	config *LokiConfig
+	labels map[string]string
+}
+
+type lokiPush struct {
+	Streams []lokiStream `json:"streams"`
+}
+
+type lokiStream struct {
+	Stream map[string]string `json:"stream"`
+	// Values are the pairs of the timestamp in nanoseconds and the line
+	Values [][2]string `json:"values"`
+}
+
+func (l *loki) name() string {
+	return "loki"
+}
+
+func (l *loki) send(ctx context.Context, entries []Entry) error {
+	stream := lokiStream{Stream: make(map[string]string), Values: make([][2]string, 0, len(entries))}
+	for k, v := range l.labels {
+		stream.Stream[k] = v
+	}
+	for k, v := range l.config.Labels {
+		stream.Stream[k] = v
+	}
+	for _, e := range entries {
+		stream.Values = append(stream.Values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), e.Line})
+	}
+	body, err := json.Marshal(lokiPush{Streams: []lokiStream{stream}})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(l.config.URL, "/")+lokiPushPath, bytes.NewReader(body))
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if l.config.TenantID != "" {
+		req.Header.Set("X-Scope-OrgID", l.config.TenantID)
+	}
+	if l.config.Username != "" {
+		req.SetBasicAuth(l.config.Username, l.config.Password)
+	}
+	return post(req, "loki")
+}
+
+func post(req *http.Request, name string) error {
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return gerrors.Newf("%s responded %s", name, resp.Status)
+	}
+	return nil
+}
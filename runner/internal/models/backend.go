@@ -19,14 +19,17 @@ type Job struct {
 	Artifacts             []Artifact        `yaml:"artifacts"`
 	Cache                 []Cache           `yaml:"cache"`
 	BuildCommands         []string          `yaml:"build_commands"`
+	Dockerfile            string            `yaml:"dockerfile,omitempty"`
 	OptionalBuildCommands []string          `yaml:"optional_build_commands"`
 	Commands              []string          `yaml:"commands"`
 	BuildPolicy           BuildPolicy       `yaml:"build_policy"`
+	BuildCacheScope       BuildCacheScope   `yaml:"build_cache_scope,omitempty"`
 	Entrypoint            []string          `yaml:"entrypoint"`
 	Environment           map[string]string `yaml:"env"`
 	RunEnvironment        map[string]string `yaml:"run_env"`
 	HostName              string            `yaml:"host_name"`
 	Image                 string            `yaml:"image_name"`
+	Platform              string            `yaml:"platform,omitempty"`
 	JobID                 string            `yaml:"job_id"`
 	MasterJobID           string            `yaml:"master_job_id"`
 	Deps                  []Dep             `yaml:"deps"`
@@ -35,6 +38,7 @@ type Job struct {
 	RepoId      string `yaml:"repo_id"`
 	RepoType    string `yaml:"repo_type"`
 	HubUserName string `yaml:"hub_user_name"`
+	ProjectName string `yaml:"project_name,omitempty"`
 
 	RepoHostName    string `yaml:"repo_host_name,omitempty"`
 	RepoPort        int    `yaml:"repo_port,omitempty"`
@@ -44,9 +48,14 @@ type Job struct {
 	RepoHash        string `yaml:"repo_hash,omitempty"`
 	RepoConfigName  string `yaml:"repo_config_name,omitempty"`
 	RepoConfigEmail string `yaml:"repo_config_email,omitempty"`
+	// RepoCloneDepth limits the fetched history, RepoSparsePaths limit the checked out directories
+	RepoCloneDepth  int      `yaml:"repo_clone_depth,omitempty"`
+	RepoSparsePaths []string `yaml:"repo_sparse_paths,omitempty"`
 
 	RepoCodeFilename string `yaml:"repo_code_filename"`
 
+	ExtraRepos []ExtraRepo `yaml:"extra_repos,omitempty"`
+
 	RequestID         string       `yaml:"request_id"`
 	Requirements      Requirements `yaml:"requirements"`
 	RunName           string       `yaml:"run_name"`
@@ -68,6 +77,337 @@ type Job struct {
 	WorkingDir        string       `yaml:"working_dir"`
 
 	RegistryAuth RegistryAuth `yaml:"registry_auth"`
+	// RegistryAuths are the credentials of the other registries, e.g. of the sidecar images, keyed by the registry host
+	RegistryAuths map[string]RegistryAuth `yaml:"registry_auths,omitempty"`
+
+	ContainerRetry *ContainerRetry `yaml:"container_retry,omitempty"`
+	ExitCodes      *ExitCodes      `yaml:"exit_codes,omitempty"`
+	Attempt        int             `yaml:"attempt,omitempty"`
+
+	Sidecars []Sidecar `yaml:"sidecars,omitempty"`
+
+	Datasets []Dataset `yaml:"datasets,omitempty"`
+
+	// Services replace the job container. PrimaryService defaults to the first service.
+	Services       []Service `yaml:"services,omitempty"`
+	PrimaryService string    `yaml:"primary_service,omitempty"`
+
+	// TunnelHost is set when app ports are reached over the runner tunnel, see App.TunnelPort
+	TunnelHost string `yaml:"tunnel_host,omitempty"`
+
+	// The runner is considered dead if HeartbeatAt (ms) is older than LeaseTTL (seconds)
+	HeartbeatAt uint64 `yaml:"heartbeat_at,omitempty"`
+	LeaseTTL    int    `yaml:"lease_ttl,omitempty"`
+
+	Distributed *Distributed `yaml:"distributed,omitempty"`
+
+	Network *Network `yaml:"network,omitempty"`
+	// User runs the job container as uid[:gid] or a user name of the image. UserHost maps it to the runner user,
+	// the files on the host bind mounts are then owned by the runner.
+	User string `yaml:"user,omitempty"`
+
+	// ReadOnlyRootfs hardens the job container, the job writes to the bind mounts and the Tmpfs mounts only
+	ReadOnlyRootfs bool    `yaml:"read_only_rootfs,omitempty"`
+	Tmpfs          []Tmpfs `yaml:"tmpfs,omitempty"`
+
+	Security *Security `yaml:"security,omitempty"`
+
+	// Notifications replace the ones of the runner config for this job
+	Notifications *Notifications `yaml:"notifications,omitempty"`
+
+	// Docker gives the job a Docker daemon: DockerSocket mounts the host one, DockerInDocker runs a privileged sidecar
+	Docker string `yaml:"docker,omitempty"`
+
+	// DevEnvironment replaces the job run with an IDE server kept alive until the job is stopped or idle
+	DevEnvironment *DevEnvironment `yaml:"dev_environment,omitempty"`
+
+	// TTY runs the job container with a terminal for the progress bars, stderr is merged into stdout
+	TTY bool `yaml:"tty,omitempty"`
+
+	// Devices are passed to the job container in the docker format /dev/host[:container][:permissions]
+	Devices []string `yaml:"devices,omitempty"`
+
+	// DNS servers, DNSSearch domains and ExtraHosts (host:ip) of the job container, in addition to the runner ones
+	DNS        []string `yaml:"dns,omitempty"`
+	DNSSearch  []string `yaml:"dns_search,omitempty"`
+	ExtraHosts []string `yaml:"extra_hosts,omitempty"`
+
+	// CacheSizeLimitMiB bounds the workflow caches, least recently used caches are evicted on upload
+	CacheSizeLimitMiB int64 `yaml:"cache_size_limit_mib,omitempty"`
+
+	GPUStats []GPUStat `yaml:"gpu_stats,omitempty"`
+	// StatusTimes are the times (ms) the job entered its statuses
+	StatusTimes map[string]uint64 `yaml:"status_times,omitempty"`
+	// Result explains how the job ended, it is set if the job fails or the instance is interrupted
+	Result *RunResult `yaml:"result,omitempty"`
+	// ContainerStats is the latest resource usage sample of the job container
+	ContainerStats *ContainerStat `yaml:"container_stats,omitempty"`
+	// Outputs are the key=value pairs the job wrote to the outputs file
+	Outputs map[string]string `yaml:"outputs,omitempty"`
+	// Timings are the durations of the job phases, they are written when the job ends
+	Timings *Timings `yaml:"timings,omitempty"`
+	// PricePerHour is the instance price set by the backend, it takes precedence over the runner config
+	PricePerHour float64 `yaml:"price_per_hour,omitempty"`
+	// Cost is the estimate of the job cost, it is updated periodically and when the job ends
+	Cost *Cost `yaml:"cost,omitempty"`
+	// SSHKeyPub are the public keys in the authorized_keys format the runner SSH server accepts
+	SSHKeyPub string `yaml:"ssh_key_pub,omitempty"`
+	// EnvFiles are rendered in memory on the host and mounted read-only, the secrets stay out of the process env
+	EnvFiles []EnvFile `yaml:"env_files,omitempty"`
+	// AppProxy is where the apps are served over HTTPS if the runner has the app proxy
+	AppProxy *AppProxy `yaml:"app_proxy,omitempty"`
+	// ModelService tags the job as a model server, the runner gateway serves it with the OpenAI API
+	ModelService *ModelService `yaml:"model_service,omitempty"`
+	// ModelMetrics are the totals of the gateway requests, they are updated periodically
+	ModelMetrics *ModelMetrics `yaml:"model_metrics,omitempty"`
+	// Scaling publishes the traffic of the service job served by the runner proxies
+	Scaling *Scaling `yaml:"scaling,omitempty"`
+	// Priority orders the jobs of the persistent runners, a queued job of a higher priority preempts the running one
+	Priority   int        `yaml:"priority,omitempty"`
+	Preemption Preemption `yaml:"preemption,omitempty"`
+	// Paused is set while the job is frozen for a job of a higher priority
+	Paused bool `yaml:"paused,omitempty"`
+	// Checkpoint saves the container processes on interruption and restores them in a follow-up job (experimental)
+	Checkpoint *Checkpoint `yaml:"checkpoint,omitempty"`
+	// Volumes are the persistent cloud disks attached to the instance for the job and mounted into the container
+	Volumes []Volume `yaml:"volumes,omitempty"`
+	// HuggingFace publishes the artifacts to a Hugging Face repo after a successful run
+	HuggingFace *HuggingFace `yaml:"hugging_face,omitempty"`
+	// Tracking links the job to a run of the experiment trackers named after the dstack run
+	Tracking *Tracking `yaml:"tracking,omitempty"`
+	// DVC pulls the DVC-tracked data of the repo into /workflow before the job starts
+	DVC *DVC `yaml:"dvc,omitempty"`
+	// CreateWorkingDir creates the working dir missing in the repo instead of failing the job
+	CreateWorkingDir bool `yaml:"create_working_dir,omitempty"`
+	// RunnerVersion pins the runner, a runner of another version replaces itself with it on start
+	RunnerVersion string `yaml:"runner_version,omitempty"`
+}
+
+// DVC runs dvc pull in a helper container of Image, the secrets are passed as env, e.g. the keys of the remote
+type DVC struct {
+	Image   string   `yaml:"image,omitempty"`
+	Remote  string   `yaml:"remote,omitempty"`
+	Targets []string `yaml:"targets,omitempty"`
+	Secrets []string `yaml:"secrets,omitempty"`
+}
+
+type Tracking struct {
+	WandB  *WandB  `yaml:"wandb,omitempty"`
+	MLflow *MLflow `yaml:"mlflow,omitempty"`
+}
+
+// WandB is the W&B project of the run, the key is taken from the secrets
+type WandB struct {
+	Project string `yaml:"project"`
+	Entity  string `yaml:"entity,omitempty"`
+	BaseURL string `yaml:"base_url,omitempty"`
+	// KeySecret is the name of the secret with the API key, WANDB_API_KEY by default
+	KeySecret string `yaml:"key_secret,omitempty"`
+	// RunID and RunURL are set once the run is created
+	RunID  string `yaml:"run_id,omitempty"`
+	RunURL string `yaml:"run_url,omitempty"`
+}
+
+// MLflow is the experiment of the run on the tracking server, the token is taken from the secrets if the server needs it
+type MLflow struct {
+	TrackingURI string `yaml:"tracking_uri"`
+	// Experiment is created if missing, the run name by default
+	Experiment string `yaml:"experiment,omitempty"`
+	// TokenSecret is the name of the secret with the token, MLFLOW_TRACKING_TOKEN by default
+	TokenSecret string `yaml:"token_secret,omitempty"`
+	// RunID and RunURL are set once the run is created
+	RunID  string `yaml:"run_id,omitempty"`
+	RunURL string `yaml:"run_url,omitempty"`
+}
+
+// HuggingFace is the hub repo the artifacts are committed to, with the write token from the secrets
+type HuggingFace struct {
+	Repo string `yaml:"repo"`
+	// RepoType is model, dataset or space, model by default
+	RepoType string `yaml:"repo_type,omitempty"`
+	Revision string `yaml:"revision,omitempty"`
+	// Paths are the artifact paths or the paths inside the artifacts, the contents of a dir are committed at the repo root
+	Paths []string `yaml:"paths"`
+	// TokenSecret is the name of the secret with the token, HF_TOKEN by default
+	TokenSecret   string `yaml:"token_secret,omitempty"`
+	CommitMessage string `yaml:"commit_message,omitempty"`
+	Endpoint      string `yaml:"endpoint,omitempty"`
+	// Commit is the hash of the published commit
+	Commit string `yaml:"commit,omitempty"`
+}
+
+// Volume is a cloud disk kept across the instances: the EBS volume ID, the persistent disk or the managed disk name.
+// The volume mounted at /workflow keeps the repo and the state of the previous runs, the repo is not prepared again.
+type Volume struct {
+	Name string `yaml:"name"`
+	// Path is where the volume is mounted in the container, /workflow by default
+	Path string `yaml:"path,omitempty"`
+	// FileSystem formats the blank volume, ext4 by default
+	FileSystem string `yaml:"file_system,omitempty"`
+}
+
+// Checkpoint is a CRIU checkpoint of the job container, it requires the experimental docker daemon.
+// The container of the job restored from a checkpoint has to be the same, e.g. the image and the mounts.
+type Checkpoint struct {
+	// OnStop checkpoints the stopped jobs too, the interrupted ones are always checkpointed
+	OnStop bool `yaml:"on_stop,omitempty"`
+	// RestoreFrom is the ID of the job of the run the container is restored from
+	RestoreFrom string `yaml:"restore_from,omitempty"`
+	// Key is set once the checkpoint of the job is uploaded
+	Key string `yaml:"key,omitempty"`
+}
+
+// Preemption is how a job gives way to a job of a higher priority: stop ends it as preempted, pause freezes it
+// until the other job ends, never keeps it running. Stop is the default.
+type Preemption string
+
+const (
+	PreemptionStop  Preemption = "stop"
+	PreemptionPause Preemption = "pause"
+	PreemptionNever Preemption = "never"
+)
+
+// Scaling stops the job once it serves no request for IdleTimeout seconds, zero keeps it running
+type Scaling struct {
+	IdleTimeout int `yaml:"idle_timeout,omitempty"`
+}
+
+// ScalingSignal is the traffic since the previous signal, LatencyMs is the average of the served requests.
+// QueueDepth is the number of the requests in flight, Timestamp is in ms.
+type ScalingSignal struct {
+	JobID       string  `yaml:"job_id"`
+	RunName     string  `yaml:"run_name"`
+	RPS         float64 `yaml:"rps"`
+	LatencyMs   float64 `yaml:"latency_ms"`
+	QueueDepth  int64   `yaml:"queue_depth"`
+	IdleSeconds int     `yaml:"idle_seconds"`
+	Timestamp   uint64  `yaml:"timestamp"`
+}
+
+// ModelService listens on Port with the OpenAI API, the gateway forwards /v1/* to it.
+// Token authorizes the gateway clients if the runner config has no tokens, it is generated by the runner.
+type ModelService struct {
+	Port  int    `yaml:"port"`
+	Token string `yaml:"token,omitempty"`
+}
+
+// ModelMetrics count the errors with the 5xx statuses, LatencyMs is the total of all the requests.
+// The tokens are read from the usage of the non-streamed responses.
+type ModelMetrics struct {
+	Requests         uint64 `yaml:"requests"`
+	Errors           uint64 `yaml:"errors"`
+	PromptTokens     uint64 `yaml:"prompt_tokens"`
+	CompletionTokens uint64 `yaml:"completion_tokens"`
+	LatencyMs        uint64 `yaml:"latency_ms"`
+}
+
+// AppProxy serves the apps at https://<app>.<Domain>:<Port> or at /<app>/ of the runner host.
+// Token is passed once with ?token=, or as a bearer token.
+type AppProxy struct {
+	Port   int    `yaml:"port"`
+	Domain string `yaml:"domain,omitempty"`
+	Token  string `yaml:"token,omitempty"`
+}
+
+// EnvFile is a dotenv file of the job container at Path, relative to the working dir if not absolute.
+// Source is a repo file with the interpolated expressions, Secrets are appended as NAME=value.
+type EnvFile struct {
+	Path    string   `yaml:"path"`
+	Source  string   `yaml:"source,omitempty"`
+	Secrets []string `yaml:"secrets,omitempty"`
+}
+
+// Security relaxes or tightens the confinement of the job container, e.g. CapAdd SYS_PTRACE for the profilers.
+// Seccomp is the path of a profile on the host or unconfined, AppArmor is the name of a loaded profile or unconfined.
+type Security struct {
+	CapAdd   []string `yaml:"cap_add,omitempty"`
+	CapDrop  []string `yaml:"cap_drop,omitempty"`
+	Seccomp  string   `yaml:"seccomp,omitempty"`
+	AppArmor string   `yaml:"apparmor,omitempty"`
+}
+
+// Tmpfs is a scratch mount in memory, SizeMiB is unlimited if zero
+type Tmpfs struct {
+	Path    string `yaml:"path"`
+	SizeMiB int    `yaml:"size_mib,omitempty"`
+}
+
+// UserHost is the User of the job containers running as the runner user
+const UserHost = "host"
+
+// Notifications are sent when the job ends with one of the On statuses, done and failed by default.
+// LogsURL is the link to the job logs, {run_name}, {job_id} and {repo_id} are replaced.
+type Notifications struct {
+	On      []string   `yaml:"on,omitempty"`
+	LogsURL string     `yaml:"logs_url,omitempty"`
+	Slack   *SlackSink `yaml:"slack,omitempty"`
+	Email   *EmailSink `yaml:"email,omitempty"`
+}
+
+// SlackSink posts to an incoming webhook of Slack
+type SlackSink struct {
+	WebhookURL string `yaml:"webhook_url"`
+}
+
+// EmailSink sends a mail over SMTP, with the PLAIN auth if Username is set
+type EmailSink struct {
+	Host     string   `yaml:"host"`
+	Port     int      `yaml:"port,omitempty"`
+	Username string   `yaml:"username,omitempty"`
+	Password string   `yaml:"password,omitempty"`
+	From     string   `yaml:"from"`
+	To       []string `yaml:"to"`
+}
+
+// The nested Docker of the jobs
+const (
+	DockerSocket   = "socket"
+	DockerInDocker = "dind"
+)
+
+// DevEnvironment bootstraps sshd authorized by SSHKeyPub, and code-server for IDEVSCode, in a Debian-based image.
+// The job commands run after the bootstrap. Password of code-server is generated if empty.
+// BackendURL is an archive of the JetBrains IDE backend, it is extracted where Gateway finds the installed IDEs.
+// IdleTimeout stops the job once no client is connected for so long, in seconds. Zero keeps it until stopped.
+type DevEnvironment struct {
+	IDE         string `yaml:"ide"`
+	Version     string `yaml:"version,omitempty"`
+	Password    string `yaml:"password,omitempty"`
+	BackendURL  string `yaml:"backend_url,omitempty"`
+	IdleTimeout int    `yaml:"idle_timeout,omitempty"`
+}
+
+// The IDEs of the dev environments
+const (
+	IDEVSCode    = "vscode"
+	IDEJetBrains = "jetbrains"
+)
+
+// Network is the Docker network of the job container: bridge, host, none or the name of an existing network.
+// Aliases are the DNS names of the container on the named network.
+type Network struct {
+	Mode    string   `yaml:"mode,omitempty"`
+	Aliases []string `yaml:"aliases,omitempty"`
+}
+
+// Distributed describes a node of a multi-node job, the master job has NodeRank 0
+type Distributed struct {
+	NodeRank   int `yaml:"node_rank"`
+	Nodes      int `yaml:"nodes"`
+	MasterPort int `yaml:"master_port,omitempty"`
+	// PortsStart and PortsEnd bound the inter-node ports, e.g. used by NCCL and Gloo
+	PortsStart int `yaml:"ports_start,omitempty"`
+	PortsEnd   int `yaml:"ports_end,omitempty"`
+}
+
+// ExtraRepo is cloned into Path under the job repo.
+// CredentialsRef names a secret or a secret reference holding an OAuth token or an SSH private key.
+type ExtraRepo struct {
+	URL string `yaml:"url"`
+	// Ref is the branch to check out, the default branch if empty
+	Ref            string `yaml:"ref,omitempty"`
+	Path           string `yaml:"path"`
+	CredentialsRef string `yaml:"credentials_ref,omitempty"`
 }
 
 type Dep struct {
@@ -82,8 +422,22 @@ type Artifact struct {
 	Mount bool   `yaml:"mount,omitempty"`
 }
 
+// Dataset is input data mounted read-only, it is never uploaded back
+type Dataset struct {
+	Path string `yaml:"path"`
+	// Source is the key prefix in the backend storage
+	Source string `yaml:"source"`
+	// Mount uses FUSE instead of downloading the data before the run
+	Mount bool `yaml:"mount,omitempty"`
+}
+
 type Cache struct {
 	Path string `yaml:"path"`
+	// Key may contain ${{ hashFiles('requirements.txt') }}, RestoreKeys are prefixes tried if the key misses
+	Key         string   `yaml:"key,omitempty"`
+	RestoreKeys []string `yaml:"restore_keys,omitempty"`
+	// MaxSizeMiB skips uploading the cache if it grows larger
+	MaxSizeMiB int64 `yaml:"max_size_mib,omitempty"`
 }
 
 type App struct {
@@ -92,6 +446,44 @@ type App struct {
 	MapToPort      int               `yaml:"map_to_port"`
 	UrlPath        string            `yaml:"url_path"`
 	UrlQueryParams map[string]string `yaml:"url_query_params"`
+	TunnelPort     int               `yaml:"tunnel_port,omitempty"`
+	// Env is added to the job container env, the values may refer to the bound ports, e.g. ${port.map.gradio}
+	Env map[string]string `yaml:"env,omitempty"`
+	// Ready is set once the Probe passes, the URL is then opened by the CLI
+	Probe *Probe `yaml:"probe,omitempty"`
+	Ready bool   `yaml:"ready,omitempty"`
+}
+
+// Probe checks that the app listens: http gets Path until it responds below 400, tcp connects.
+// IntervalSeconds and TimeoutSeconds default to consts.DELAY_PROBE and consts.PROBE_TIMEOUT.
+type Probe struct {
+	Type            string `yaml:"type"`
+	Path            string `yaml:"path,omitempty"`
+	IntervalSeconds int    `yaml:"interval_seconds,omitempty"`
+	TimeoutSeconds  int    `yaml:"timeout_seconds,omitempty"`
+}
+
+const (
+	ProbeHTTP = "http"
+	ProbeTCP  = "tcp"
+)
+
+// Sidecar is an auxiliary container sharing the network namespace of the job container
+type Sidecar struct {
+	Name        string            `yaml:"name"`
+	Image       string            `yaml:"image_name"`
+	Commands    []string          `yaml:"commands,omitempty"`
+	Entrypoint  []string          `yaml:"entrypoint,omitempty"`
+	Environment map[string]string `yaml:"env,omitempty"`
+}
+
+type Service struct {
+	Name        string            `yaml:"name"`
+	Image       string            `yaml:"image_name"`
+	Commands    []string          `yaml:"commands,omitempty"`
+	Entrypoint  []string          `yaml:"entrypoint,omitempty"`
+	Environment map[string]string `yaml:"env,omitempty"`
+	Volumes     []string          `yaml:"volumes,omitempty"`
 }
 
 type Requirements struct {
@@ -109,11 +501,84 @@ type GPU struct {
 	MemoryMiB int    `yaml:"memory_mib,omitempty"`
 }
 
+type GPUStat struct {
+	Index          int    `yaml:"index"`
+	Utilization    int    `yaml:"utilization"`
+	MemoryUsedMiB  int    `yaml:"memory_used_mib"`
+	MemoryTotalMiB int    `yaml:"memory_total_mib"`
+	Timestamp      uint64 `yaml:"timestamp"`
+}
+
+type ContainerStat struct {
+	CPUPercent     float64 `yaml:"cpu_percent" json:"cpu_percent"`
+	MemoryUsedMiB  uint64  `yaml:"memory_used_mib" json:"memory_used_mib"`
+	MemoryLimitMiB uint64  `yaml:"memory_limit_mib" json:"memory_limit_mib"`
+	DiskUsedMiB    uint64  `yaml:"disk_used_mib" json:"disk_used_mib"`
+	Timestamp      uint64  `yaml:"timestamp" json:"timestamp"`
+}
+
+// Timings are the durations (ms) of the completed job phases, summed over the retries. Build includes the image pull.
+// The bytes are the sizes of the transferred artifacts and caches, the mounted ones are not counted.
+type Timings struct {
+	CloneMs         uint64 `yaml:"clone_ms,omitempty"`
+	DownloadMs      uint64 `yaml:"download_ms,omitempty"`
+	BuildMs         uint64 `yaml:"build_ms,omitempty"`
+	ExecMs          uint64 `yaml:"exec_ms,omitempty"`
+	UploadMs        uint64 `yaml:"upload_ms,omitempty"`
+	DownloadedBytes int64  `yaml:"downloaded_bytes,omitempty"`
+	UploadedBytes   int64  `yaml:"uploaded_bytes,omitempty"`
+}
+
+// Cost is the instance price multiplied by the durations. Estimated is since the job started,
+// Phases are of the completed phases keyed by clone, download, build, exec and upload.
+type Cost struct {
+	Currency    string             `yaml:"currency,omitempty"`
+	HourlyPrice float64            `yaml:"hourly_price"`
+	Estimated   float64            `yaml:"estimated"`
+	Phases      map[string]float64 `yaml:"phases,omitempty"`
+	UpdatedAt   uint64             `yaml:"updated_at"`
+}
+
+// RunResult is the failure summary of a job. DiskFreeMiB is of the runner workdir, GPUs is the latest sample.
+type RunResult struct {
+	Error       string    `yaml:"error,omitempty"`
+	ExitCode    int       `yaml:"exit_code,omitempty"`
+	OOMKilled   bool      `yaml:"oom_killed,omitempty"`
+	Interrupted bool      `yaml:"interrupted,omitempty"`
+	LastLogs    []string  `yaml:"last_logs,omitempty"`
+	DiskFreeMiB uint64    `yaml:"disk_free_mib,omitempty"`
+	GPUs        []GPUStat `yaml:"gpus,omitempty"`
+	FinishedAt  uint64    `yaml:"finished_at"`
+
+	// MemoryLimitMiB and MemoryUsedMiB are of the OOM killed jobs, the usage is the last sample before the kill
+	MemoryLimitMiB uint64 `yaml:"memory_limit_mib,omitempty"`
+	MemoryUsedMiB  uint64 `yaml:"memory_used_mib,omitempty"`
+}
+
 type RetryPolicy struct {
 	Retry bool `yaml:"retry"`
 	Limit int  `yaml:"limit,omitempty"`
 }
 
+// ContainerRetry restarts a failed container in place, without a round-trip to the hub.
+// An empty ExitCodes list retries on any non-zero exit code.
+// Failed containers are removed unless KeepFailed is set, e.g. to inspect them.
+// ExitCodes map the exit codes of the job container to the job result: Success ends the job as done,
+// Retry restarts the container in place like ContainerRetry, Stopped ends the job as stopped, e.g. 137 after a checkpoint.
+// The artifacts are uploaded for Success and Stopped. OOM kills are always failures.
+type ExitCodes struct {
+	Success []int `yaml:"success,omitempty"`
+	Retry   []int `yaml:"retry,omitempty"`
+	Stopped []int `yaml:"stopped,omitempty"`
+}
+
+type ContainerRetry struct {
+	MaxAttempts    int   `yaml:"max_attempts"`
+	BackoffSeconds int   `yaml:"backoff_seconds,omitempty"`
+	ExitCodes      []int `yaml:"exit_codes,omitempty"`
+	KeepFailed     bool  `yaml:"keep_failed,omitempty"`
+}
+
 type State struct {
 	Job       *Job     `yaml:"job"`
 	RequestID string   `yaml:"request_id"`
@@ -121,11 +586,40 @@ type State struct {
 	RunnerID  string   `yaml:"runner_id"`
 }
 
+// Capabilities of the instance a runner advertises for the scheduler, the disk is the free space of the workdir
+type Capabilities struct {
+	RunnerID      string   `yaml:"runner_id"`
+	Resources     Resource `yaml:"resources"`
+	DiskFreeMiB   uint64   `yaml:"disk_free_mib"`
+	DockerVersion string   `yaml:"docker_version,omitempty"`
+	DockerRuntime string   `yaml:"docker_runtime,omitempty"`
+	// Platform is os/arch, e.g. linux/arm64
+	Platform  string `yaml:"platform"`
+	Region    string `yaml:"region,omitempty"`
+	Version   string `yaml:"version,omitempty"`
+	UpdatedAt uint64 `yaml:"updated_at"`
+}
+
+// DaemonState is the registration of a persistent runner polling the job queue
+type DaemonState struct {
+	RunnerID  string   `yaml:"runner_id"`
+	RequestID string   `yaml:"request_id"`
+	Resources Resource `yaml:"resources"`
+	// Status is idle or busy
+	Status    string `yaml:"status"`
+	JobID     string `yaml:"job_id,omitempty"`
+	UpdatedAt uint64 `yaml:"updated_at"`
+}
+
 type GitCredentials struct {
 	Protocol   string  `json:"protocol"`
 	OAuthToken *string `json:"oauth_token,omitempty"`
 	PrivateKey *string `json:"private_key,omitempty"`
 	Passphrase *string `json:"passphrase,omitempty"`
+	// AppID, InstallationID and AppPrivateKey are set for the github_app protocol
+	AppID          *string `json:"app_id,omitempty"`
+	InstallationID *string `json:"installation_id,omitempty"`
+	AppPrivateKey  *string `json:"app_private_key,omitempty"`
 }
 
 type RegistryAuth struct {
@@ -146,6 +640,47 @@ const (
 	BuildOnly  BuildPolicy = "build-only"
 )
 
+// BuildCacheScope controls who can reuse a build diff. Repo scope is the default.
+// Project scope falls back to repo scope if the job has no project.
+type BuildCacheScope string
+
+const (
+	BuildCacheRepo    BuildCacheScope = "repo"
+	BuildCacheProject BuildCacheScope = "project"
+	BuildCacheGlobal  BuildCacheScope = "global"
+)
+
+// SharedBuildCache reports whether build diffs are keyed by content and reused across repos
+func (j *Job) SharedBuildCache() bool {
+	return j.BuildCacheScope == BuildCacheGlobal || (j.BuildCacheScope == BuildCacheProject && j.ProjectName != "")
+}
+
+func (j *Job) BuildDiffFilepath(buildName string) string {
+	switch {
+	case j.BuildCacheScope == BuildCacheGlobal:
+		return fmt.Sprintf("builds/_global/%s.tar", buildName)
+	case j.SharedBuildCache():
+		return fmt.Sprintf("builds/_projects/%s/%s.tar", j.ProjectName, buildName)
+	}
+	return fmt.Sprintf("builds/%s/%s.tar", j.RepoId, buildName)
+}
+
+// CompressedBuildDiffFilepath is the key of the zstd compressed build diff.
+// The diff at BuildDiffFilepath is uncompressed, older runners read it.
+func (j *Job) CompressedBuildDiffFilepath(buildName string) string {
+	return j.BuildDiffFilepath(buildName) + ".zst"
+}
+
+// CheckpointFilepath is the key of the compressed container checkpoint of the job of the run
+func (j *Job) CheckpointFilepath(jobID string) string {
+	return fmt.Sprintf("checkpoints/%s/%s.tar.zst", j.RunName, jobID)
+}
+
+// SnapshotFilepath is the key of the resolved spec the job was started with
+func (j *Job) SnapshotFilepath() string {
+	return fmt.Sprintf("snapshots/%s/%s.json", j.RepoId, j.JobID)
+}
+
 func (j *Job) RepoHostNameWithPort() string {
 	if j.RepoPort == 0 {
 		return j.RepoHostName
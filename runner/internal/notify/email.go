@@ -0,0 +1,51 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+const defaultSMTPPort = 587
+
+type email struct {
+	config *models.EmailSink
+}
+
+func (e *email) Name() string {
+	return "email"
+}
+
+// Notify sends a plain text mail, STARTTLS is used if the server supports it
+func (e *email) Notify(_ context.Context, n Notification) error {
+	if len(e.config.To) == 0 {
+		return gerrors.New("no email recipients")
+	}
+	port := e.config.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	var auth smtp.Auth
+	if e.config.Username != "" {
+		auth = smtp.PlainAuth("", e.config.Username, e.config.Password, e.config.Host)
+	}
+	addr := net.JoinHostPort(e.config.Host, strconv.Itoa(port))
+	return gerrors.Wrap(smtp.SendMail(addr, auth, e.config.From, e.config.To, message(e.config.From, e.config.To, n)))
+}
+
+func message(from string, to []string, n Notification) []byte {
+	headers := []string{
+		fmt.Sprintf("From: %s", from),
+		fmt.Sprintf("To: %s", strings.Join(to, ", ")),
+		fmt.Sprintf("Subject: %s", n.Subject()),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=utf-8",
+	}
+	return []byte(strings.Join(headers, "\r\n") + "\r\n\r\n" + strings.ReplaceAll(n.Text(), "\n", "\r\n") + "\r\n")
+}
@@ -0,0 +1,82 @@
+// Package notify tells the users how their jobs ended, over Slack or email
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dstackai/dstack/runner/consts/states"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+// Notification describes a job end
+type Notification struct {
+	RunName   string
+	JobID     string
+	Status    string
+	ErrorCode string
+	ExitCode  string
+	Duration  time.Duration
+	LogsURL   string
+}
+
+type Sink interface {
+	Notify(ctx context.Context, n Notification) error
+	Name() string
+}
+
+// Sinks are the configured sinks
+func Sinks(config *models.Notifications) []Sink {
+	sinks := make([]Sink, 0)
+	if config.Slack != nil {
+		sinks = append(sinks, &slack{config: config.Slack})
+	}
+	if config.Email != nil {
+		sinks = append(sinks, &email{config: config.Email})
+	}
+	return sinks
+}
+
+// Wanted checks the job status is one of the notified ones
+func Wanted(config *models.Notifications, status string) bool {
+	on := config.On
+	if len(on) == 0 {
+		on = []string{states.Done, states.Failed}
+	}
+	for _, s := range on {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// LogsURL fills the placeholders of the template
+func LogsURL(template string, job *models.Job) string {
+	return strings.NewReplacer(
+		"{run_name}", job.RunName,
+		"{job_id}", job.JobID,
+		"{repo_id}", job.RepoId,
+	).Replace(template)
+}
+
+func (n Notification) Subject() string {
+	return fmt.Sprintf("dstack: %s %s", n.RunName, n.Status)
+}
+
+// Text is the one-line summary, e.g. Run sharp-fox-1 (job 4f2a) failed after 1h2m3s, exit code 1
+func (n Notification) Text() string {
+	text := fmt.Sprintf("Run %s (job %s) %s after %s", n.RunName, n.JobID, n.Status, n.Duration.Round(time.Second))
+	if n.ExitCode != "" {
+		text += fmt.Sprintf(", exit code %s", n.ExitCode)
+	}
+	if n.ErrorCode != "" {
+		text += fmt.Sprintf(", error %s", n.ErrorCode)
+	}
+	if n.LogsURL != "" {
+		text += fmt.Sprintf("\nLogs: %s", n.LogsURL)
+	}
+	return text
+}
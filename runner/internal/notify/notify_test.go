@@ -0,0 +1,28 @@
+package notify
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestText(t *testing.T) {
+	n := Notification{
+		RunName:  "sharp-fox-1",
+		JobID:    "4f2a",
+		Status:   "failed",
+		ExitCode: "1",
+		Duration: time.Hour + 2*time.Minute + 3*time.Second + 400*time.Millisecond,
+		LogsURL:  LogsURL("https://dstack.example/runs/{run_name}/{job_id}", &models.Job{RunName: "sharp-fox-1", JobID: "4f2a"}),
+	}
+	assert.Equal(t, "Run sharp-fox-1 (job 4f2a) failed after 1h2m3s, exit code 1\nLogs: https://dstack.example/runs/sharp-fox-1/4f2a", n.Text())
+}
+
+func TestWanted(t *testing.T) {
+	assert.Equal(t, true, Wanted(&models.Notifications{}, "done"))
+	assert.Equal(t, false, Wanted(&models.Notifications{}, "stopped"))
+	assert.Equal(t, true, Wanted(&models.Notifications{On: []string{"stopped"}}, "stopped"))
+	assert.Equal(t, false, Wanted(&models.Notifications{On: []string{"stopped"}}, "done"))
+}
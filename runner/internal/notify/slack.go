@@ -0,0 +1,45 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/models"
+)
+
+const slackTimeout = 10 * time.Second
+
+type slack struct {
+	config *models.SlackSink
+}
+
+func (s *slack) Name() string {
+	return "slack"
+}
+
+func (s *slack) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(map[string]string{"text": n.Text()})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, slackTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.config.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return gerrors.Newf("slack responded %s", resp.Status)
+	}
+	return nil
+}
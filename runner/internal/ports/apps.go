@@ -7,6 +7,7 @@ import (
 	"github.com/dstackai/dstack/runner/internal/log"
 	"github.com/dstackai/dstack/runner/internal/models"
 	"strconv"
+	"strings"
 )
 
 func GetAppsExposedPorts(ctx context.Context, apps []models.App, isLocalBackend bool) nat.PortSet {
@@ -23,26 +24,54 @@ func GetAppsExposedPorts(ctx context.Context, apps []models.App, isLocalBackend
 	return resp
 }
 
-func GetAppsBindingPorts(ctx context.Context, apps []models.App, doMapping bool) (nat.PortMap, error) {
+// Range bounds the host ports picked when the requested port is taken
+type Range struct {
+	Start int
+	End   int
+}
+
+// free returns the first port of the range which is neither used by the job nor taken on the host
+func (r Range) free(usedPorts map[int]bool) (int, error) {
+	for port := r.Start; port <= r.End; port++ {
+		if usedPorts[port] {
+			continue
+		}
+		if free, _ := CheckPort(port); free {
+			return port, nil
+		}
+	}
+	return 0, fmt.Errorf("no free port in range %d-%d", r.Start, r.End)
+}
+
+// bind returns the requested port if it is free, otherwise the first free port of the range
+func (r Range) bind(ctx context.Context, port int, usedPorts map[int]bool) (int, error) {
+	if !usedPorts[port] {
+		if free, _ := CheckPort(port); free {
+			return port, nil
+		}
+	}
+	mapToPort, err := r.free(usedPorts)
+	if err != nil {
+		return 0, err
+	}
+	log.Trace(ctx, "Port is in use, binding to a free one", "port", port, "mapToPort", mapToPort)
+	return mapToPort, nil
+}
+
+func GetAppsBindingPorts(ctx context.Context, apps []models.App, doMapping bool, portRange Range) (nat.PortMap, error) {
 	resp := make(nat.PortMap)
 	if doMapping { // no host mode
 		for i, app := range apps {
 			if app.Name == "openssh-server" { // ports will be forwarded through container's ssh server
-				mapToPort := app.MapToPort
-				if mapToPort > 0 {
-					if free, _ := CheckPort(mapToPort); !free {
-						return nat.PortMap{}, fmt.Errorf("port %d is in use", app.MapToPort)
-					}
-				} else {
-					mapToPort = app.Port
-					for {
-						if free, _ := CheckPort(mapToPort); free {
-							break
-						}
-						mapToPort += 1
-					}
-					apps[i].MapToPort = mapToPort
+				requested := app.MapToPort
+				if requested == 0 {
+					requested = app.Port
+				}
+				mapToPort, err := portRange.bind(ctx, requested, map[int]bool{})
+				if err != nil {
+					return nat.PortMap{}, err
 				}
+				apps[i].MapToPort = mapToPort
 				resp[nat.Port(fmt.Sprintf("%d/tcp", app.Port))] = []nat.PortBinding{
 					{
 						HostIP:   "0.0.0.0",
@@ -67,47 +96,70 @@ func GetAppsBindingPorts(ctx context.Context, apps []models.App, doMapping bool)
 		log.Trace(ctx, "Identity port mapping", "AppsBindingPorts", resp)
 		return resp, nil
 	}
-	// do dynamic mapping
+	// do dynamic mapping, user-defined ports go first
 	usedPorts := make(map[int]bool)
-	for _, app := range apps { // user-defined mapping
-		if app.MapToPort == 0 {
-			continue
-		}
-		free, _ := CheckPort(app.MapToPort)
-		if !free {
-			return nat.PortMap{}, fmt.Errorf("port %d is in use", app.MapToPort)
-		}
-		usedPorts[app.MapToPort] = true
-		resp[nat.Port(fmt.Sprintf("%d/tcp", app.Port))] = []nat.PortBinding{
-			{
-				HostIP:   "0.0.0.0",
-				HostPort: strconv.Itoa(app.MapToPort),
-			},
-		}
-	}
-	for i, app := range apps { // get the closest free port
-		if app.MapToPort > 0 {
-			continue
-		}
-		mapToPort := app.Port
-		for {
-			if _, used := usedPorts[mapToPort]; !used {
-				free, _ := CheckPort(mapToPort)
-				if free {
-					break
-				}
+	for _, userDefined := range []bool{true, false} {
+		for i, app := range apps {
+			if (app.MapToPort > 0) != userDefined {
+				continue
+			}
+			requested := app.MapToPort
+			if requested == 0 {
+				requested = app.Port
+			}
+			mapToPort, err := portRange.bind(ctx, requested, usedPorts)
+			if err != nil {
+				return nat.PortMap{}, err
+			}
+			apps[i].MapToPort = mapToPort // for fix_url
+			usedPorts[mapToPort] = true
+			resp[nat.Port(fmt.Sprintf("%d/tcp", app.Port))] = []nat.PortBinding{
+				{
+					HostIP:   "0.0.0.0",
+					HostPort: strconv.Itoa(mapToPort),
+				},
 			}
-			mapToPort += 1
-		}
-		apps[i].MapToPort = mapToPort // for fix_url
-		usedPorts[mapToPort] = true
-		resp[nat.Port(fmt.Sprintf("%d/tcp", app.Port))] = []nat.PortBinding{
-			{
-				HostIP:   "0.0.0.0",
-				HostPort: strconv.Itoa(mapToPort),
-			},
 		}
 	}
 	log.Trace(ctx, "Dynamic port mapping", "AppsBindingPorts", resp)
 	return resp, nil
 }
+
+// IsPortAllocatedError detects a port taken between the check and the container start
+func IsPortAllocatedError(err error) bool {
+	return err != nil && (strings.Contains(err.Error(), "port is already allocated") || strings.Contains(err.Error(), "address already in use"))
+}
+
+// BindLocalhost restricts host bindings to the loopback interface, e.g. when ports are reached over a tunnel
+func BindLocalhost(portMap nat.PortMap) {
+	for port, bindings := range portMap {
+		for i := range bindings {
+			bindings[i].HostIP = "127.0.0.1"
+		}
+		portMap[port] = bindings
+	}
+}
+
+// PublishRange exposes every port of the range on the same host port
+func PublishRange(portSet nat.PortSet, portMap nat.PortMap, r Range) {
+	for port := r.Start; port <= r.End; port++ {
+		natPort := nat.Port(fmt.Sprintf("%d/tcp", port))
+		portSet[natPort] = struct{}{}
+		portMap[natPort] = []nat.PortBinding{{HostIP: "0.0.0.0", HostPort: strconv.Itoa(port)}}
+	}
+}
+
+// AppVariables are the ports of the apps for the templated env vars, e.g. ${port.map.gradio} is the bound host port
+// and ${port.gradio} is the container one. The apps without a host port yet are mapped to their own port.
+func AppVariables(apps []models.App) map[string]string {
+	vars := make(map[string]string, 2*len(apps))
+	for _, app := range apps {
+		mapToPort := app.MapToPort
+		if mapToPort == 0 {
+			mapToPort = app.Port
+		}
+		vars[app.Name] = strconv.Itoa(app.Port)
+		vars["map."+app.Name] = strconv.Itoa(mapToPort)
+	}
+	return vars
+}
@@ -0,0 +1,13 @@
+package ports
+
+import (
+	"testing"
+
+	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppVariables(t *testing.T) {
+	vars := AppVariables([]models.App{{Name: "gradio", Port: 7860, MapToPort: 7861}, {Name: "web", Port: 80}})
+	assert.Equal(t, map[string]string{"gradio": "7860", "map.gradio": "7861", "web": "80", "map.web": "80"}, vars)
+}
@@ -0,0 +1,55 @@
+package registryauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// acrUsername is the username of the refresh tokens
+const acrUsername = "00000000-0000-0000-0000-000000000000"
+
+// mintACR exchanges the token of the managed identity for a registry refresh token
+func mintACR(ctx context.Context, host string) (credentials, error) {
+	credential, err := azidentity.NewManagedIdentityCredential(nil)
+	if err != nil {
+		return credentials{}, gerrors.Wrap(err)
+	}
+	aadToken, err := credential.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{"https://management.azure.com/.default"}})
+	if err != nil {
+		return credentials{}, gerrors.Wrap(err)
+	}
+	form := url.Values{
+		"grant_type":   {"access_token"},
+		"service":      {host},
+		"access_token": {aadToken.Token},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("https://%s/oauth2/exchange", host), strings.NewReader(form.Encode()))
+	if err != nil {
+		return credentials{}, gerrors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return credentials{}, gerrors.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return credentials{}, gerrors.Newf("ACR token exchange: %s", resp.Status)
+	}
+	var exchanged struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&exchanged); err != nil {
+		return credentials{}, gerrors.Wrap(err)
+	}
+	// the refresh token outlives the AAD one, which bounds it conservatively
+	return credentials{username: acrUsername, password: exchanged.RefreshToken, expiresAt: aadToken.ExpiresOn}, nil
+}
@@ -0,0 +1,38 @@
+package registryauth
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ecr"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// mintECR exchanges the instance role for a registry token of the account, valid for 12 hours
+func mintECR(ctx context.Context, host string) (credentials, error) {
+	region := ecrHost.FindStringSubmatch(host)[2]
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(region)})
+	if err != nil {
+		return credentials{}, gerrors.Wrap(err)
+	}
+	out, err := ecr.New(sess).GetAuthorizationTokenWithContext(ctx, &ecr.GetAuthorizationTokenInput{})
+	if err != nil {
+		return credentials{}, gerrors.Wrap(err)
+	}
+	if len(out.AuthorizationData) == 0 {
+		return credentials{}, gerrors.New("no ECR authorization data")
+	}
+	data := out.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(aws.StringValue(data.AuthorizationToken))
+	if err != nil {
+		return credentials{}, gerrors.Wrap(err)
+	}
+	username, password, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return credentials{}, gerrors.New("malformed ECR authorization token")
+	}
+	return credentials{username: username, password: password, expiresAt: aws.TimeValue(data.ExpiresAt)}, nil
+}
@@ -0,0 +1,30 @@
+package registryauth
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"cloud.google.com/go/compute/metadata"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// mintGCR takes the access token of the instance service account, Container and Artifact Registry accept it
+func mintGCR(ctx context.Context, host string) (credentials, error) {
+	body, err := metadata.Get("instance/service-accounts/default/token")
+	if err != nil {
+		return credentials{}, gerrors.Wrap(err)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err = json.Unmarshal([]byte(body), &token); err != nil {
+		return credentials{}, gerrors.Wrap(err)
+	}
+	return credentials{
+		username:  "oauth2accesstoken",
+		password:  token.AccessToken,
+		expiresAt: time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}, nil
+}
@@ -0,0 +1,80 @@
+// Package registryauth mints the short-lived credentials of the cloud registries from the identity of the instance
+package registryauth
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// refreshBefore renews the credentials before they expire, a pull of a large image takes a while
+const refreshBefore = 15 * time.Minute
+
+const (
+	ECR = "ecr"
+	GCR = "gcr"
+	ACR = "acr"
+)
+
+var ecrHost = regexp.MustCompile(`^\d+\.dkr\.ecr(-fips)?\.([a-z0-9-]+)\.amazonaws\.com(\.cn)?$`)
+
+type credentials struct {
+	username  string
+	password  string
+	expiresAt time.Time
+}
+
+type mintFn func(ctx context.Context, host string) (credentials, error)
+
+// Minter caches the credentials per registry host
+type Minter struct {
+	mu    sync.Mutex
+	cache map[string]credentials
+}
+
+func New() *Minter {
+	return &Minter{cache: make(map[string]credentials)}
+}
+
+// Auth returns the credentials of the registry, ok is false if the registry belongs to no known cloud
+func (m *Minter) Auth(ctx context.Context, host string) (username, password string, ok bool, err error) {
+	var mint mintFn
+	switch CloudOf(host) {
+	case ECR:
+		mint = mintECR
+	case GCR:
+		mint = mintGCR
+	case ACR:
+		mint = mintACR
+	default:
+		return "", "", false, nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if cached, found := m.cache[host]; found && time.Until(cached.expiresAt) > refreshBefore {
+		return cached.username, cached.password, true, nil
+	}
+	minted, err := mint(ctx, host)
+	if err != nil {
+		return "", "", true, gerrors.Wrap(err)
+	}
+	m.cache[host] = minted
+	return minted.username, minted.password, true, nil
+}
+
+// CloudOf returns the cloud of the registry host or an empty string
+func CloudOf(host string) string {
+	switch {
+	case ecrHost.MatchString(host):
+		return ECR
+	case host == "gcr.io" || strings.HasSuffix(host, ".gcr.io") || strings.HasSuffix(host, "-docker.pkg.dev"):
+		return GCR
+	case strings.HasSuffix(host, ".azurecr.io"):
+		return ACR
+	}
+	return ""
+}
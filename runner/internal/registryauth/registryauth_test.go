@@ -0,0 +1,18 @@
+package registryauth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCloudOf(t *testing.T) {
+	assert.Equal(t, ECR, CloudOf("123456789012.dkr.ecr.eu-west-1.amazonaws.com"))
+	assert.Equal(t, ECR, CloudOf("123456789012.dkr.ecr-fips.us-east-1.amazonaws.com"))
+	assert.Equal(t, GCR, CloudOf("gcr.io"))
+	assert.Equal(t, GCR, CloudOf("eu.gcr.io"))
+	assert.Equal(t, GCR, CloudOf("europe-west4-docker.pkg.dev"))
+	assert.Equal(t, ACR, CloudOf("dstack.azurecr.io"))
+	assert.Equal(t, "", CloudOf("docker.io"))
+	assert.Equal(t, "", CloudOf("ecr.example.com"))
+}
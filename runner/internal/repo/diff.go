@@ -7,7 +7,7 @@ import (
 	"fmt"
 	"io"
 	"os"
-	"path"
+	"path/filepath"
 	"strings"
 
 	"github.com/bluekeyes/go-gitdiff/gitdiff"
@@ -31,7 +31,7 @@ func ApplyDiff(ctx context.Context, dir, patch string) error {
 		output.Reset()
 		var input io.ReaderAt = empty
 		if fileInfo.OldName != "" {
-			oldFile, err = os.Open(path.Join(dir, fileInfo.OldName))
+			oldFile, err = os.Open(filepath.Join(dir, filepath.FromSlash(fileInfo.OldName)))
 			input = oldFile
 			if err != nil {
 				log.Error(ctx, "apply diff can not open file", "filename", fileInfo.OldName, "err", err)
@@ -53,7 +53,7 @@ func ApplyDiff(ctx context.Context, dir, patch string) error {
 
 		if !fileInfo.IsDelete {
 			if fileInfo.IsNew || fileInfo.IsRename {
-				dd := path.Dir(path.Join(dir, fileInfo.NewName))
+				dd := filepath.Dir(filepath.Join(dir, filepath.FromSlash(fileInfo.NewName)))
 				err = os.MkdirAll(dd, 0755)
 				if err != nil {
 					log.Warning(ctx, "diff apply new file mkdir fail",
@@ -62,20 +62,20 @@ func ApplyDiff(ctx context.Context, dir, patch string) error {
 				}
 			}
 			mode := fileModeHeuristic(ctx, dir, fileInfo)
-			err = os.WriteFile(path.Join(dir, fileInfo.NewName), output.Bytes(), mode)
+			err = os.WriteFile(filepath.Join(dir, filepath.FromSlash(fileInfo.NewName)), output.Bytes(), mode)
 			if err != nil {
 				log.Error(ctx, "diff apply write file", "filename", fileInfo.NewName, "err", err)
 				return err
 			}
 			// WriteFile does not change perm for existing files
-			err = os.Chmod(path.Join(dir, fileInfo.NewName), mode)
+			err = os.Chmod(filepath.Join(dir, filepath.FromSlash(fileInfo.NewName)), mode)
 			if err != nil {
 				log.Warning(ctx, "diff apply can not chmod", "filename", fileInfo.NewName, "err", err)
 			}
 		}
 
 		if fileInfo.IsDelete || fileInfo.IsRename {
-			err = os.Remove(path.Join(dir, fileInfo.OldName))
+			err = os.Remove(filepath.Join(dir, filepath.FromSlash(fileInfo.OldName)))
 			if err != nil {
 				log.Warning(ctx, "diff apply can not delete", "filename", fileInfo.OldName, "err", err)
 			}
@@ -92,7 +92,7 @@ func fileModeHeuristic(ctx context.Context, dir string, fileInfo *gitdiff.File)
 	}
 	if mode == 0 && fileInfo.OldName != "" {
 		// diff does not have mode info for rename only cases
-		stat, err := os.Stat(path.Join(dir, fileInfo.OldName))
+		stat, err := os.Stat(filepath.Join(dir, filepath.FromSlash(fileInfo.OldName)))
 		if err != nil {
 			log.Warning(ctx, "diff apply can not stat old file",
 				"filename", fileInfo.OldName,
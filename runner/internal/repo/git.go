@@ -0,0 +1,48 @@
+package repo
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+// gitAuth returns the git binary env authenticating like go-git does. The returned func removes the key file.
+// The token is passed in the env config, the command line of git is readable by every user of the host.
+func (m *Manager) gitAuth() ([]string, func(), error) {
+	env := os.Environ()
+	cleanup := func() {}
+	if m.token != "" {
+		basic := base64.StdEncoding.EncodeToString([]byte(TokenUsername(urlHost(m.clo.URL)) + ":" + m.token))
+		env = append(env, "GIT_CONFIG_COUNT=1", "GIT_CONFIG_KEY_0=http.extraHeader", "GIT_CONFIG_VALUE_0=Authorization: Basic "+basic)
+	}
+	if m.sshKey != "" {
+		keyFile, err := os.CreateTemp("", "git-key")
+		if err != nil {
+			return nil, cleanup, gerrors.Wrap(err)
+		}
+		cleanup = func() { _ = os.Remove(keyFile.Name()) }
+		_, err = keyFile.WriteString(m.sshKey)
+		_ = keyFile.Close()
+		if err != nil {
+			cleanup()
+			return nil, func() {}, gerrors.Wrap(err)
+		}
+		env = append(env, fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o StrictHostKeyChecking=no -o IdentitiesOnly=yes", keyFile.Name()))
+	}
+	return env, cleanup, nil
+}
+
+// runGit runs the git binary in the directory with the auth env
+func runGit(dir string, env []string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return gerrors.Newf("git %s: %s: %s", strings.Join(args, " "), err, output)
+	}
+	return nil
+}
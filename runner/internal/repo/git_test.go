@@ -0,0 +1,20 @@
+package repo
+
+import (
+	"encoding/base64"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGitAuthTokenInEnv(t *testing.T) {
+	m := &Manager{clo: git.CloneOptions{URL: "https://github.com/dstackai/dstack.git"}, token: "secret"}
+	env, cleanup, err := m.gitAuth()
+	assert.Equal(t, nil, err)
+	defer cleanup()
+	basic := base64.StdEncoding.EncodeToString([]byte("x-access-token:secret"))
+	assert.Contains(t, env, "GIT_CONFIG_COUNT=1")
+	assert.Contains(t, env, "GIT_CONFIG_KEY_0=http.extraHeader")
+	assert.Contains(t, env, "GIT_CONFIG_VALUE_0=Authorization: Basic "+basic)
+}
@@ -0,0 +1,72 @@
+package repo
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/go-git/go-git/v5"
+)
+
+// updateSubmodules checks out the submodules at the commits recorded in the checked out tree
+func (m *Manager) updateSubmodules(workTree *git.Worktree) error {
+	submodules, err := workTree.Submodules()
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	// submodules outside of the sparse paths aren't checked out
+	checkedOut := make(git.Submodules, 0, len(submodules))
+	for _, submodule := range submodules {
+		if m.inSparsePaths(submodule.Config().Path) {
+			checkedOut = append(checkedOut, submodule)
+		}
+	}
+	submodules = checkedOut
+	if len(submodules) == 0 {
+		return nil
+	}
+	log.Trace(m.ctx, "Updating submodules", "count", len(submodules))
+	err = submodules.Update(&git.SubmoduleUpdateOptions{
+		Init:              true,
+		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		Auth:              m.clo.Auth,
+	})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return nil
+}
+
+func usesLFS(localPath string) bool {
+	attributes, err := os.ReadFile(filepath.Join(localPath, ".gitattributes"))
+	if err != nil {
+		return false
+	}
+	return bytes.Contains(attributes, []byte("filter=lfs"))
+}
+
+// pullLFS replaces LFS pointers with the objects, go-git doesn't support LFS so the git-lfs binary is used
+func (m *Manager) pullLFS() error {
+	if !usesLFS(m.localPath) {
+		return nil
+	}
+	if _, err := exec.LookPath("git-lfs"); err != nil {
+		log.Warning(m.ctx, "The repo uses Git LFS, but git-lfs is not installed")
+		return nil
+	}
+	env, cleanup, err := m.gitAuth()
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer cleanup()
+	for _, lfsArgs := range [][]string{{"lfs", "install", "--local"}, {"lfs", "pull"}} {
+		if err = runGit(m.localPath, env, lfsArgs...); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	log.Trace(m.ctx, "Git LFS objects are pulled")
+	return nil
+}
@@ -19,6 +19,12 @@ type Manager struct {
 	localPath string
 	clo       git.CloneOptions
 	hash      string
+	// token and sshKey are kept for the git-lfs binary, see pullLFS
+	token  string
+	sshKey string
+	// sparsePaths are checked out by the git binary, see sparseCheckout
+	sparsePaths []string
+	mirrorsDir  string
 }
 
 func NewManager(ctx context.Context, url, branch, hash string) *Manager {
@@ -28,11 +34,14 @@ func NewManager(ctx context.Context, url, branch, hash string) *Manager {
 		clo: git.CloneOptions{
 			URL:               url,
 			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
-			ReferenceName:     plumbing.NewBranchReferenceName(branch),
 			SingleBranch:      true,
 		},
 		hash: hash,
 	}
+	// the remote HEAD is cloned if the branch is empty
+	if branch != "" {
+		m.clo.ReferenceName = plumbing.NewBranchReferenceName(branch)
+	}
 
 	return m
 }
@@ -43,13 +52,26 @@ func (m *Manager) WithLocalPath(path string) *Manager {
 	return m
 }
 
-// TODO: works with Github, possibly not with others
+// WithDepth fetches only the last depth commits of the branch, 0 fetches the whole history
+func (m *Manager) WithDepth(depth int) *Manager {
+	m.clo.Depth = depth
+	return m
+}
+
+// WithSparseCheckout checks out only the directories, the files at the root are always checked out
+func (m *Manager) WithSparseCheckout(paths []string) *Manager {
+	m.sparsePaths = paths
+	m.clo.NoCheckout = len(paths) > 0
+	return m
+}
+
 func (m *Manager) WithTokenAuth(token string) *Manager {
 	auth := &http.BasicAuth{
-		Username: "anything",
+		Username: TokenUsername(urlHost(m.clo.URL)),
 		Password: token,
 	}
 	m.clo.Auth = auth
+	m.token = token
 	return m
 }
 
@@ -60,6 +82,7 @@ func (m *Manager) WithSSHAuth(pem, password string) *Manager {
 	} else {
 		keys.HostKeyCallbackHelper.HostKeyCallback = ssh.InsecureIgnoreHostKey()
 		m.clo.Auth = keys
+		m.sshKey = pem
 	}
 	return m
 }
@@ -71,31 +94,48 @@ func (m *Manager) Checkout() error {
 			log.Error(m.ctx, "Failed clear directory")
 		}
 	}
-	ref, err := git.PlainClone(m.localPath, false, &m.clo)
+	ref, err := m.clone()
 	if err != nil && err != git.ErrRepositoryAlreadyExists {
 		return err
 	}
 	if ref != nil {
-		branchRef, err := ref.Reference(m.clo.ReferenceName, true)
+		var branchRef *plumbing.Reference
+		if m.clo.ReferenceName == "" {
+			branchRef, err = ref.Head()
+		} else {
+			branchRef, err = ref.Reference(m.clo.ReferenceName, true)
+		}
 		if err != nil {
 			return gerrors.Wrap(err)
 		}
 		var cho git.CheckoutOptions
 		if m.hash == "" || m.hash == branchRef.Hash().String() {
-			cho.Branch = m.clo.ReferenceName
+			cho.Branch = branchRef.Name()
 		} else {
 			cho.Hash = plumbing.NewHash(m.hash)
+			if _, err = ref.CommitObject(cho.Hash); err != nil && m.clo.Depth > 0 {
+				return gerrors.Newf("commit %s is not within the last %d commits of the branch, increase the clone depth", m.hash, m.clo.Depth)
+			}
 		}
 
 		workTree, err := ref.Worktree()
 		if err != nil {
 			return err
 		}
-		err = workTree.Checkout(&cho)
+		if len(m.sparsePaths) > 0 {
+			err = m.sparseCheckout(cho)
+		} else {
+			err = workTree.Checkout(&cho)
+		}
 		if err != nil {
 			return err
 		}
-
+		if err = m.updateSubmodules(workTree); err != nil {
+			return gerrors.Wrap(err)
+		}
+		if err = m.pullLFS(); err != nil {
+			return gerrors.Wrap(err)
+		}
 	} else {
 		log.Warning(m.ctx, "git clone ref==nil")
 	}
@@ -141,6 +181,19 @@ func (m *Manager) URL() string {
 	return m.clo.URL
 }
 
+// Head is the checked out commit
+func (m *Manager) Head() (string, error) {
+	repo, err := git.PlainOpen(m.localPath)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	ref, err := repo.Head()
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return ref.Hash().String(), nil
+}
+
 func (m *Manager) SetConfig(name, email string) error {
 	repo, err := git.PlainOpen(m.localPath)
 	if err != nil {
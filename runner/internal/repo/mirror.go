@@ -0,0 +1,108 @@
+package repo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/go-git/go-git/v5"
+)
+
+// WithMirror keeps a bare mirror of the repo in the directory, shared by the jobs on the host.
+// The repo is cloned with --reference to the mirror, so only the new objects are fetched.
+func (m *Manager) WithMirror(mirrorsDir string) *Manager {
+	m.mirrorsDir = mirrorsDir
+	return m
+}
+
+func mirrorDir(mirrorsDir, url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(mirrorsDir, hex.EncodeToString(sum[:8])+".git")
+}
+
+// clone clones from the mirror if there is one, a failing mirror falls back to a plain clone
+func (m *Manager) clone() (*git.Repository, error) {
+	if m.mirrorsDir != "" {
+		ref, err := m.cloneFromMirror()
+		if err == nil {
+			return ref, nil
+		}
+		log.Warning(m.ctx, "Failed to clone from the mirror, cloning from the remote", "err", err)
+		if err = os.RemoveAll(m.localPath); err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+	}
+	return git.PlainClone(m.localPath, false, &m.clo)
+}
+
+func (m *Manager) cloneFromMirror() (*git.Repository, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, gerrors.New("git is not installed")
+	}
+	env, cleanup, err := m.gitAuth()
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	defer cleanup()
+	mirror, err := m.updateMirror(env)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	// the objects are copied, so a later prune of the mirror can't break the clone
+	args := []string{"clone", "--reference", mirror, "--dissociate", "--no-checkout"}
+	if m.clo.ReferenceName != "" {
+		args = append(args, "--single-branch", "--branch", m.clo.ReferenceName.Short())
+	}
+	if m.clo.Depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(m.clo.Depth))
+	}
+	args = append(args, m.clo.URL, m.localPath)
+	if err = runGit("", env, args...); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	ref, err := git.PlainOpen(m.localPath)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	log.Trace(m.ctx, "Cloned from the mirror", "mirror", mirror)
+	return ref, nil
+}
+
+// updateMirror creates or fetches the mirror. The runners of the host share it, so it is locked.
+func (m *Manager) updateMirror(env []string) (string, error) {
+	if err := os.MkdirAll(m.mirrorsDir, 0o755); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	dir := mirrorDir(m.mirrorsDir, m.clo.URL)
+	lock, err := os.OpenFile(dir+".lock", os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	defer func() { _ = lock.Close() }()
+	if err = lockFile(lock); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	defer func() { _ = unlockFile(lock) }()
+	if _, err = os.Stat(dir); err == nil {
+		log.Trace(m.ctx, "Fetching the mirror", "mirror", dir)
+		if err = runGit(dir, env, "remote", "update", "--prune"); err == nil {
+			return dir, nil
+		}
+		// a broken mirror is cloned again
+		log.Warning(m.ctx, "Failed to fetch the mirror", "err", err)
+		if err = os.RemoveAll(dir); err != nil {
+			return "", gerrors.Wrap(err)
+		}
+	}
+	log.Trace(m.ctx, "Creating the mirror", "mirror", dir)
+	if err = runGit("", env, "clone", "--mirror", m.clo.URL, dir); err != nil {
+		_ = os.RemoveAll(dir)
+		return "", gerrors.Wrap(err)
+	}
+	return dir, nil
+}
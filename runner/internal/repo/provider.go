@@ -0,0 +1,58 @@
+package repo
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type Provider string
+
+const (
+	GitHub    Provider = "github"
+	GitLab    Provider = "gitlab"
+	Bitbucket Provider = "bitbucket"
+)
+
+// ProviderOf guesses the provider by the host, self-hosted GitLab and Bitbucket are usually named after them
+func ProviderOf(host string) Provider {
+	host = strings.ToLower(host)
+	switch {
+	case strings.Contains(host, "gitlab"):
+		return GitLab
+	case strings.Contains(host, "bitbucket"):
+		return Bitbucket
+	}
+	return GitHub
+}
+
+// TokenUsername is the user name the provider expects along with an OAuth or access token
+func TokenUsername(host string) string {
+	switch ProviderOf(host) {
+	case GitLab:
+		return "oauth2"
+	case Bitbucket:
+		return "x-token-auth"
+	}
+	return "x-access-token"
+}
+
+// Netrc authenticates git over HTTPS with the token, curl reads it without any git config
+func Netrc(host, token string) []byte {
+	return []byte(fmt.Sprintf("machine %s\nlogin %s\npassword %s\n", hostOnly(host), TokenUsername(host), token))
+}
+
+// hostOnly strips the port, netrc machines don't have one
+func hostOnly(host string) string {
+	if u, err := url.Parse("https://" + host); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return host
+}
+
+func urlHost(rawURL string) string {
+	if u, err := url.Parse(rawURL); err == nil {
+		return u.Host
+	}
+	return ""
+}
@@ -0,0 +1,14 @@
+package repo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenUsername(t *testing.T) {
+	assert.Equal(t, "x-access-token", TokenUsername("github.com"))
+	assert.Equal(t, "oauth2", TokenUsername("gitlab.example.com:8443"))
+	assert.Equal(t, "x-token-auth", TokenUsername("bitbucket.org"))
+	assert.Equal(t, "machine gitlab.example.com\nlogin oauth2\npassword token\n", string(Netrc("gitlab.example.com:8443", "token")))
+}
@@ -0,0 +1,50 @@
+package repo
+
+import (
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/go-git/go-git/v5"
+)
+
+// sparseCheckout checks out the sparse paths of the cloned repo, go-git doesn't support sparse checkouts so the git binary is used
+func (m *Manager) sparseCheckout(cho git.CheckoutOptions) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return gerrors.New("sparse checkout requires git to be installed")
+	}
+	target := cho.Hash.String()
+	if cho.Branch != "" {
+		target = cho.Branch.Short()
+	}
+	commands := [][]string{
+		{"sparse-checkout", "init", "--cone"},
+		append([]string{"sparse-checkout", "set", "--"}, m.sparsePaths...),
+		{"-c", "advice.detachedHead=false", "checkout", target},
+	}
+	for _, args := range commands {
+		if err := runGit(m.localPath, nil, os.Environ(), args...); err != nil {
+			return gerrors.Wrap(err)
+		}
+	}
+	log.Trace(m.ctx, "Sparse checkout", "paths", m.sparsePaths)
+	return nil
+}
+
+// inSparsePaths reports whether the repo path is checked out, every path is without a sparse checkout
+func (m *Manager) inSparsePaths(p string) bool {
+	if len(m.sparsePaths) == 0 {
+		return true
+	}
+	p = path.Clean(p)
+	for _, sparsePath := range m.sparsePaths {
+		sparsePath = path.Clean(strings.Trim(sparsePath, "/"))
+		if p == sparsePath || strings.HasPrefix(p, sparsePath+"/") {
+			return true
+		}
+	}
+	return false
+}
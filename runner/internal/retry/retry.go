@@ -0,0 +1,94 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+)
+
+// Policy retries a failed operation with the exponential backoff until MaxElapsed.
+// Jitter is the share of the delay that is random, so the runners don't retry in lockstep.
+type Policy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	MaxElapsed   time.Duration
+	Jitter       float64
+}
+
+// PermanentError is not retried
+type PermanentError struct {
+	Err error
+}
+
+func (e PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent stops the retries on err
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return PermanentError{Err: err}
+}
+
+// WithMaxElapsed returns the policy giving up after maxElapsed if it is sooner
+func (p Policy) WithMaxElapsed(maxElapsed time.Duration) Policy {
+	if p.MaxElapsed == 0 || maxElapsed < p.MaxElapsed {
+		p.MaxElapsed = maxElapsed
+	}
+	return p
+}
+
+// delay is the backoff before the attempt after the failed one
+func (p Policy) delay(attempt int) time.Duration {
+	delay := p.InitialDelay
+	for i := 1; i < attempt && (p.MaxDelay == 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		delay -= time.Duration(p.Jitter * rand.Float64() * float64(delay))
+	}
+	return delay
+}
+
+// Do runs op until it succeeds, fails permanently, the policy gives up or ctx is done. It returns the last error.
+func (p Policy) Do(ctx context.Context, name string, op func() error) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := op()
+		if err == nil {
+			if attempt > 1 {
+				log.Info(ctx, "Backend operation succeeded after retries", "op", name, "attempts", attempt)
+			}
+			return nil
+		}
+		var permanent PermanentError
+		if errors.As(err, &permanent) {
+			return gerrors.Wrap(permanent.Err)
+		}
+		delay := p.delay(attempt)
+		if time.Since(start)+delay > p.MaxElapsed {
+			return gerrors.Wrap(err)
+		}
+		log.Warning(ctx, "Backend operation failed, retrying", "op", name, "attempt", attempt, "delay", delay, "err", err)
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return gerrors.Wrap(err)
+		case <-timer.C:
+		}
+	}
+}
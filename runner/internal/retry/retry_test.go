@@ -0,0 +1,42 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoRetriesUntilSuccess(t *testing.T) {
+	policy := Policy{InitialDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond, MaxElapsed: time.Second, Jitter: 0.5}
+	attempts := 0
+	err := policy.Do(context.Background(), "test", func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("transient")
+		}
+		return nil
+	})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 3, attempts)
+}
+
+func TestDoStopsOnPermanent(t *testing.T) {
+	policy := Policy{InitialDelay: time.Millisecond, MaxElapsed: time.Second}
+	attempts := 0
+	err := policy.Do(context.Background(), "test", func() error {
+		attempts++
+		return Permanent(errors.New("denied"))
+	})
+	assert.Equal(t, "denied", errors.Unwrap(err).Error())
+	assert.Equal(t, 1, attempts)
+}
+
+func TestDelay(t *testing.T) {
+	policy := Policy{InitialDelay: time.Second, MaxDelay: 5 * time.Second}
+	assert.Equal(t, time.Second, policy.delay(1))
+	assert.Equal(t, 4*time.Second, policy.delay(3))
+	assert.Equal(t, 5*time.Second, policy.delay(10))
+}
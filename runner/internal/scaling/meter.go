@@ -0,0 +1,73 @@
+package scaling
+
+import (
+	"sync"
+	"time"
+)
+
+// Meter counts the requests served by the runner proxies. A nil Meter counts nothing.
+type Meter struct {
+	mu       sync.Mutex
+	inFlight int64
+	requests uint64
+	latency  time.Duration
+	// lastActive is the end of the last request, or the start of the meter
+	lastActive time.Time
+	// sampledAt, sampledRequests and sampledLatency are the totals of the previous Sample
+	sampledAt       time.Time
+	sampledRequests uint64
+	sampledLatency  time.Duration
+}
+
+// Sample is the traffic since the previous sample, QueueDepth is the number of the requests in flight
+type Sample struct {
+	RPS        float64
+	LatencyMs  float64
+	QueueDepth int64
+	Idle       time.Duration
+}
+
+func NewMeter() *Meter {
+	now := time.Now()
+	return &Meter{lastActive: now, sampledAt: now}
+}
+
+// Start counts a request in flight, the returned func ends it
+func (m *Meter) Start() func() {
+	if m == nil {
+		return func() {}
+	}
+	started := time.Now()
+	m.mu.Lock()
+	m.inFlight++
+	m.mu.Unlock()
+	return func() {
+		now := time.Now()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.inFlight--
+		m.requests++
+		m.latency += now.Sub(started)
+		m.lastActive = now
+	}
+}
+
+// Sample returns the rates since the previous call. The meter is not idle while a request is in flight.
+func (m *Meter) Sample() Sample {
+	now := time.Now()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sample := Sample{QueueDepth: m.inFlight}
+	requests := m.requests - m.sampledRequests
+	if elapsed := now.Sub(m.sampledAt).Seconds(); elapsed > 0 {
+		sample.RPS = float64(requests) / elapsed
+	}
+	if requests > 0 {
+		sample.LatencyMs = float64((m.latency - m.sampledLatency).Milliseconds()) / float64(requests)
+	}
+	if m.inFlight == 0 {
+		sample.Idle = now.Sub(m.lastActive)
+	}
+	m.sampledAt, m.sampledRequests, m.sampledLatency = now, m.requests, m.latency
+	return sample
+}
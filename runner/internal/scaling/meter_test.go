@@ -0,0 +1,33 @@
+package scaling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMeter(t *testing.T) {
+	m := NewMeter()
+	first := m.Start()
+	second := m.Start()
+	first()
+	sample := m.Sample()
+	assert.Equal(t, int64(1), sample.QueueDepth)
+	assert.Equal(t, time.Duration(0), sample.Idle)
+	assert.Equal(t, true, sample.RPS > 0)
+
+	second()
+	sample = m.Sample()
+	assert.Equal(t, int64(0), sample.QueueDepth)
+	assert.Equal(t, true, sample.Idle >= 0)
+
+	sample = m.Sample()
+	assert.Equal(t, float64(0), sample.RPS)
+	assert.Equal(t, float64(0), sample.LatencyMs)
+}
+
+func TestNilMeter(t *testing.T) {
+	var m *Meter
+	m.Start()()
+}
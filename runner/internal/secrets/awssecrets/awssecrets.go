@@ -0,0 +1,128 @@
+package awssecrets
+
+import (
+	"context"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+const (
+	KindSecretsManager = "secretsmanager"
+	KindSSM            = "ssm"
+)
+
+const arnPrefix = "arn:aws:"
+
+// Ref points to a value stored in AWS Secrets Manager or SSM Parameter Store.
+// Accepted forms are `secretsmanager:<name>`, `ssm:<path>` and full ARNs of both services.
+type Ref struct {
+	Kind   string
+	Region string
+	ID     string
+}
+
+func ParseRef(value string) (Ref, bool) {
+	if strings.HasPrefix(value, arnPrefix) {
+		// arn:aws:<service>:<region>:<account>:<resource>
+		parts := strings.SplitN(value, ":", 6)
+		if len(parts) != 6 || parts[5] == "" {
+			return Ref{}, false
+		}
+		switch parts[2] {
+		case KindSecretsManager:
+			return Ref{Kind: KindSecretsManager, Region: parts[3], ID: value}, true
+		case KindSSM:
+			name := strings.TrimPrefix(parts[5], "parameter")
+			if name == parts[5] || name == "" {
+				return Ref{}, false
+			}
+			return Ref{Kind: KindSSM, Region: parts[3], ID: value}, true
+		}
+		return Ref{}, false
+	}
+	for _, kind := range []string{KindSecretsManager, KindSSM} {
+		if id := strings.TrimPrefix(value, kind+":"); id != value && id != "" {
+			return Ref{Kind: kind, ID: id}, true
+		}
+	}
+	return Ref{}, false
+}
+
+// Resolver fetches referenced values, results are cached for the job lifetime
+type Resolver struct {
+	cache map[Ref]string
+}
+
+func NewResolver() *Resolver {
+	return &Resolver{cache: make(map[Ref]string)}
+}
+
+func (r *Resolver) Resolve(ctx context.Context, ref Ref) (string, error) {
+	if value, ok := r.cache[ref]; ok {
+		return value, nil
+	}
+	var value string
+	var err error
+	switch ref.Kind {
+	case KindSecretsManager:
+		value, err = r.secretsManager(ctx, ref)
+	case KindSSM:
+		value, err = r.ssm(ctx, ref)
+	default:
+		return "", gerrors.Newf("unknown secret reference kind: %s", ref.Kind)
+	}
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	r.cache[ref] = value
+	return value, nil
+}
+
+func loadConfig(ctx context.Context, region string) (aws.Config, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return aws.Config{}, gerrors.Wrap(err)
+	}
+	return cfg, nil
+}
+
+func (r *Resolver) secretsManager(ctx context.Context, ref Ref) (string, error) {
+	cfg, err := loadConfig(ctx, ref.Region)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	out, err := secretsmanager.NewFromConfig(cfg).GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(ref.ID),
+	})
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return aws.ToString(out.SecretString), nil
+}
+
+func (r *Resolver) ssm(ctx context.Context, ref Ref) (string, error) {
+	cfg, err := loadConfig(ctx, ref.Region)
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	out, err := ssm.NewFromConfig(cfg).GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(ref.ID),
+		WithDecryption: true,
+	})
+	if err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	if out.Parameter == nil {
+		return "", gerrors.Newf("parameter %s has no value", ref.ID)
+	}
+	return aws.ToString(out.Parameter.Value), nil
+}
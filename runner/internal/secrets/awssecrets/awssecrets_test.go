@@ -0,0 +1,34 @@
+package awssecrets
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRef(t *testing.T) {
+	ref, ok := ParseRef("ssm:/dstack/db/password")
+	assert.True(t, ok)
+	assert.Equal(t, Ref{Kind: KindSSM, ID: "/dstack/db/password"}, ref)
+
+	ref, ok = ParseRef("secretsmanager:prod/token")
+	assert.True(t, ok)
+	assert.Equal(t, Ref{Kind: KindSecretsManager, ID: "prod/token"}, ref)
+
+	arn := "arn:aws:secretsmanager:eu-west-1:123456789012:secret:prod/token-AbCdEf"
+	ref, ok = ParseRef(arn)
+	assert.True(t, ok)
+	assert.Equal(t, Ref{Kind: KindSecretsManager, Region: "eu-west-1", ID: arn}, ref)
+
+	arn = "arn:aws:ssm:us-east-1:123456789012:parameter/dstack/db/password"
+	ref, ok = ParseRef(arn)
+	assert.True(t, ok)
+	assert.Equal(t, Ref{Kind: KindSSM, Region: "us-east-1", ID: arn}, ref)
+}
+
+func TestParseRefPlainValues(t *testing.T) {
+	for _, value := range []string{"", "value", "ssm:", "arn:aws:s3:::bucket", "arn:aws:ssm:us-east-1:123:document/x"} {
+		_, ok := ParseRef(value)
+		assert.False(t, ok, value)
+	}
+}
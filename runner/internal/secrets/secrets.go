@@ -0,0 +1,16 @@
+package secrets
+
+import (
+	"context"
+)
+
+// Provider serves secrets in addition to the ones stored by the backend
+type Provider interface {
+	Secrets(ctx context.Context) (map[string]string, error)
+}
+
+// Renewer is implemented by providers holding leases that expire during long jobs.
+// Renew blocks until stopCh is closed.
+type Renewer interface {
+	Renew(ctx context.Context, stopCh chan struct{})
+}
@@ -0,0 +1,272 @@
+package vault
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/secrets"
+)
+
+const (
+	AuthToken   = "token"
+	AuthAppRole = "approle"
+)
+
+// minRenewInterval protects Vault from renewal storms on leases with tiny TTLs
+const minRenewInterval = 10 * time.Second
+
+type Config struct {
+	Address   string `yaml:"address"`
+	Namespace string `yaml:"namespace,omitempty"`
+	Auth      string `yaml:"auth"`
+	Token     string `yaml:"token,omitempty"`
+	RoleID    string `yaml:"role_id,omitempty"`
+	SecretID  string `yaml:"secret_id,omitempty"`
+	// Paths are read as is, e.g. `secret/data/dstack` for KV v2 or `database/creds/readonly` for dynamic secrets
+	Paths []string `yaml:"paths"`
+}
+
+type lease struct {
+	id       string
+	duration time.Duration
+}
+
+type Vault struct {
+	config Config
+	client *http.Client
+
+	mu        sync.Mutex
+	token     string
+	tokenTTL  time.Duration
+	renewable bool
+	leases    []lease
+	cache     map[string]string
+}
+
+var _ secrets.Provider = (*Vault)(nil)
+var _ secrets.Renewer = (*Vault)(nil)
+
+type response struct {
+	LeaseID       string                 `json:"lease_id"`
+	LeaseDuration int                    `json:"lease_duration"`
+	Renewable     bool                   `json:"renewable"`
+	Data          map[string]interface{} `json:"data"`
+	Auth          *struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+		Renewable     bool   `json:"renewable"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+func New(config Config) (*Vault, error) {
+	if config.Address == "" {
+		return nil, gerrors.New("vault address is empty")
+	}
+	switch config.Auth {
+	case AuthToken, AuthAppRole:
+	case "":
+		config.Auth = AuthToken
+	default:
+		return nil, gerrors.Newf("unsupported vault auth: %s", config.Auth)
+	}
+	return &Vault{
+		config: config,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}, nil
+}
+
+// Secrets reads every configured path once and caches the values for the job lifetime
+func (v *Vault) Secrets(ctx context.Context) (map[string]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.cache != nil {
+		return v.cache, nil
+	}
+	if err := v.login(ctx); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	values := make(map[string]string)
+	for _, path := range v.config.Paths {
+		resp, err := v.do(ctx, http.MethodGet, path, nil)
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		if resp.LeaseID != "" {
+			v.leases = append(v.leases, lease{id: resp.LeaseID, duration: time.Duration(resp.LeaseDuration) * time.Second})
+		}
+		for key, value := range flatten(resp.Data) {
+			values[key] = value
+		}
+	}
+	v.cache = values
+	return v.cache, nil
+}
+
+// Renew extends the auth token and dynamic secret leases until stopCh is closed
+func (v *Vault) Renew(ctx context.Context, stopCh chan struct{}) {
+	for {
+		interval := v.renewInterval()
+		if interval == 0 {
+			return
+		}
+		select {
+		case <-stopCh:
+			return
+		case <-time.After(interval):
+		}
+		if err := v.renew(ctx); err != nil {
+			log.Error(ctx, "Failed to renew vault leases", "err", err)
+		}
+	}
+}
+
+func (v *Vault) renewInterval() time.Duration {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	shortest := time.Duration(0)
+	if v.renewable && v.tokenTTL > 0 {
+		shortest = v.tokenTTL
+	}
+	for _, l := range v.leases {
+		if l.duration > 0 && (shortest == 0 || l.duration < shortest) {
+			shortest = l.duration
+		}
+	}
+	if shortest == 0 {
+		return 0
+	}
+	interval := shortest * 2 / 3
+	if interval < minRenewInterval {
+		interval = minRenewInterval
+	}
+	return interval
+}
+
+func (v *Vault) renew(ctx context.Context) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.renewable {
+		resp, err := v.do(ctx, http.MethodPost, "auth/token/renew-self", map[string]interface{}{})
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		if resp.Auth != nil {
+			v.tokenTTL = time.Duration(resp.Auth.LeaseDuration) * time.Second
+		}
+	}
+	for i, l := range v.leases {
+		resp, err := v.do(ctx, http.MethodPut, "sys/leases/renew", map[string]interface{}{
+			"lease_id":  l.id,
+			"increment": int(l.duration.Seconds()),
+		})
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		v.leases[i].duration = time.Duration(resp.LeaseDuration) * time.Second
+	}
+	return nil
+}
+
+func (v *Vault) login(ctx context.Context) error {
+	if v.token != "" {
+		return nil
+	}
+	if v.config.Auth == AuthToken {
+		v.token = v.config.Token
+		resp, err := v.do(ctx, http.MethodGet, "auth/token/lookup-self", nil)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		if ttl, ok := resp.Data["ttl"].(float64); ok {
+			v.tokenTTL = time.Duration(ttl) * time.Second
+		}
+		v.renewable, _ = resp.Data["renewable"].(bool)
+		return nil
+	}
+	resp, err := v.do(ctx, http.MethodPost, "auth/approle/login", map[string]interface{}{
+		"role_id":   v.config.RoleID,
+		"secret_id": v.config.SecretID,
+	})
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return gerrors.New("vault approle login returned no token")
+	}
+	v.token = resp.Auth.ClientToken
+	v.tokenTTL = time.Duration(resp.Auth.LeaseDuration) * time.Second
+	v.renewable = resp.Auth.Renewable
+	return nil
+}
+
+func (v *Vault) do(ctx context.Context, method, path string, body interface{}) (*response, error) {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return nil, gerrors.Wrap(err)
+		}
+		reader = bytes.NewReader(payload)
+	}
+	url := fmt.Sprintf("%s/v1/%s", strings.TrimRight(v.config.Address, "/"), strings.TrimLeft(path, "/"))
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	if v.token != "" {
+		req.Header.Set("X-Vault-Token", v.token)
+	}
+	if v.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+	res, err := v.client.Do(req)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	defer func() { _ = res.Body.Close() }()
+	result := new(response)
+	if res.StatusCode == http.StatusNoContent {
+		return result, nil
+	}
+	if err = json.NewDecoder(res.Body).Decode(result); err != nil && err != io.EOF {
+		return nil, gerrors.Wrap(err)
+	}
+	if res.StatusCode >= 300 {
+		return nil, gerrors.Newf("vault %s %s: %d %s", method, path, res.StatusCode, strings.Join(result.Errors, "; "))
+	}
+	return result, nil
+}
+
+// flatten unwraps KV v2 responses and stringifies non-string values
+func flatten(data map[string]interface{}) map[string]string {
+	if nested, ok := data["data"].(map[string]interface{}); ok {
+		if _, hasMetadata := data["metadata"]; hasMetadata {
+			data = nested
+		}
+	}
+	result := make(map[string]string, len(data))
+	for key, value := range data {
+		switch v := value.(type) {
+		case string:
+			result[key] = v
+		case nil:
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				continue
+			}
+			result[key] = string(encoded)
+		}
+	}
+	return result
+}
@@ -0,0 +1,45 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppRoleKV2(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			var body map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			assert.Equal(t, "role", body["role_id"])
+			_, _ = w.Write([]byte(`{"auth": {"client_token": "s.token", "lease_duration": 3600, "renewable": true}}`))
+		case "/v1/secret/data/dstack":
+			assert.Equal(t, "s.token", r.Header.Get("X-Vault-Token"))
+			_, _ = w.Write([]byte(`{"data": {"data": {"user": "qwerty", "port": 5432}, "metadata": {"version": 1}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	v, err := New(Config{Address: server.URL, Auth: AuthAppRole, RoleID: "role", SecretID: "id", Paths: []string{"secret/data/dstack"}})
+	assert.Equal(t, nil, err)
+	values, err := v.Secrets(context.Background())
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]string{"user": "qwerty", "port": "5432"}, values)
+	assert.Equal(t, minRenewInterval*240, v.renewInterval())
+}
+
+func TestFlattenKV1(t *testing.T) {
+	assert.Equal(t, map[string]string{"data": "x"}, flatten(map[string]interface{}{"data": "x", "other": nil}))
+}
+
+func TestUnsupportedAuth(t *testing.T) {
+	_, err := New(Config{Address: "http://localhost:8200", Auth: "ldap"})
+	assert.NotEqual(t, nil, err)
+}
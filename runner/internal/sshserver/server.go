@@ -0,0 +1,169 @@
+package sshserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dstackai/dstack/runner/internal/control"
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"github.com/dstackai/dstack/runner/internal/models"
+	"golang.org/x/crypto/ssh"
+)
+
+// hostKeyFile is generated in the runner config dir if the config has no host key
+const hostKeyFile = "ssh_host_ed25519_key"
+
+// Config of the SSH server landing in the job container, e.g. for the IDE remote development.
+// The host listens on every interface by default, the clients are authorized by the job public keys.
+type Config struct {
+	Host string `yaml:"host,omitempty"`
+	Port int    `yaml:"port"`
+	// HostKeyFile is a private key in the OpenSSH or PKCS#8 format
+	HostKeyFile string `yaml:"host_key_file,omitempty"`
+}
+
+// Runner is the part of the executor the sessions land in.
+// DialContainer connects to a port of the job container for the forwarded connections.
+type Runner interface {
+	JobSnapshot(ctx context.Context) models.Job
+	Exec(ctx context.Context, req *control.ExecRequest) (control.ExecSession, error)
+	DialContainer(ctx context.Context, port int) (net.Conn, error)
+}
+
+type Server struct {
+	config    Config
+	runner    Runner
+	serverCfg *ssh.ServerConfig
+	listener  net.Listener
+}
+
+func New(config Config, configDir string, runner Runner) (*Server, error) {
+	signer, err := loadHostKey(config.HostKeyFile, filepath.Join(configDir, hostKeyFile))
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	s := &Server{config: config, runner: runner}
+	s.serverCfg = &ssh.ServerConfig{PublicKeyCallback: s.authorize}
+	s.serverCfg.AddHostKey(signer)
+	return s, nil
+}
+
+func (s *Server) Run(ctx context.Context) error {
+	listener, err := net.Listen("tcp", net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port)))
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	s.listener = listener
+	log.Info(ctx, "SSH server is listening", "host", s.config.Host, "port", s.config.Port)
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return gerrors.Wrap(err)
+		}
+		go s.serve(ctx, conn)
+	}
+}
+
+func (s *Server) Shutdown() {
+	if s.listener != nil {
+		_ = s.listener.Close()
+	}
+}
+
+// authorize accepts the keys of the job state, they are read on every login as the job is updated
+func (s *Server) authorize(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	job := s.runner.JobSnapshot(context.Background())
+	for _, authorized := range authorizedKeys(job.SSHKeyPub) {
+		if bytes.Equal(authorized.Marshal(), key.Marshal()) {
+			return &ssh.Permissions{}, nil
+		}
+	}
+	return nil, gerrors.Newf("unknown public key for %s", meta.User())
+}
+
+func (s *Server) serve(ctx context.Context, conn net.Conn) {
+	sshConn, chans, reqs, err := ssh.NewServerConn(conn, s.serverCfg)
+	if err != nil {
+		log.Warning(ctx, "SSH handshake failed", "remote", conn.RemoteAddr().String(), "err", err)
+		return
+	}
+	defer func() { _ = sshConn.Close() }()
+	connCtx := log.AppendArgsCtx(ctx, "ssh_remote", sshConn.RemoteAddr().String())
+	log.Info(connCtx, "SSH client connected", "user", sshConn.User())
+	go ssh.DiscardRequests(reqs)
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			go s.session(connCtx, newChannel)
+		case "direct-tcpip":
+			go s.directTCPIP(connCtx, newChannel)
+		default:
+			_ = newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+		}
+	}
+	log.Info(connCtx, "SSH client disconnected")
+}
+
+// authorizedKeys parses the keys in the authorized_keys format, the invalid lines are skipped
+func authorizedKeys(contents string) []ssh.PublicKey {
+	var keys []ssh.PublicKey
+	for _, line := range strings.Split(contents, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// loadHostKey reads the configured key, or the generated one which is created on the first start
+func loadHostKey(configured, generated string) (ssh.Signer, error) {
+	file := configured
+	if file == "" {
+		file = generated
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			if err = generateHostKey(file); err != nil {
+				return nil, gerrors.Wrap(err)
+			}
+		}
+	}
+	contents, err := os.ReadFile(file)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	signer, err := ssh.ParsePrivateKey(contents)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return signer, nil
+}
+
+func generateHostKey(file string) error {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	return gerrors.Wrap(os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+}
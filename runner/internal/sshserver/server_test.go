@@ -0,0 +1,31 @@
+package sshserver
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestAuthorizedKeys(t *testing.T) {
+	public, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.Equal(t, nil, err)
+	key, err := ssh.NewPublicKey(public)
+	assert.Equal(t, nil, err)
+	contents := "not a key\n\n" + string(ssh.MarshalAuthorizedKey(key))
+	keys := authorizedKeys(contents)
+	assert.Equal(t, 1, len(keys))
+	assert.Equal(t, key.Marshal(), keys[0].Marshal())
+}
+
+func TestLoadHostKeyGenerated(t *testing.T) {
+	file := filepath.Join(t.TempDir(), hostKeyFile)
+	first, err := loadHostKey("", file)
+	assert.Equal(t, nil, err)
+	second, err := loadHostKey("", file)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, first.PublicKey().Marshal(), second.PublicKey().Marshal())
+}
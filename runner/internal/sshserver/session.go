@@ -0,0 +1,160 @@
+package sshserver
+
+import (
+	"context"
+	"io"
+
+	"github.com/dstackai/dstack/runner/internal/control"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"golang.org/x/crypto/ssh"
+)
+
+// loginShell prefers bash, the minimal images may have sh only
+const loginShell = "if command -v bash >/dev/null 2>&1; then exec bash -l; else exec sh -l; fi"
+
+// the payloads of the channel requests, RFC 4254
+type ptyRequest struct {
+	Term   string
+	Cols   uint32
+	Rows   uint32
+	Width  uint32
+	Height uint32
+	Modes  string
+}
+
+type windowChange struct {
+	Cols   uint32
+	Rows   uint32
+	Width  uint32
+	Height uint32
+}
+
+type envRequest struct {
+	Name  string
+	Value string
+}
+
+type execRequest struct {
+	Command string
+}
+
+type exitStatus struct {
+	Status uint32
+}
+
+type directTCPIPRequest struct {
+	Host     string
+	Port     uint32
+	OrigHost string
+	OrigPort uint32
+}
+
+// session collects the pty and env requests until a shell or a command is started in the job container
+func (s *Server) session(ctx context.Context, newChannel ssh.NewChannel) {
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		log.Warning(ctx, "Failed to accept the SSH session", "err", err)
+		return
+	}
+	defer func() { _ = channel.Close() }()
+	req := &control.ExecRequest{}
+	var exec control.ExecSession
+	for r := range reqs {
+		ok := false
+		switch r.Type {
+		case "pty-req":
+			pty := ptyRequest{}
+			if ssh.Unmarshal(r.Payload, &pty) == nil {
+				req.TTY, req.Rows, req.Cols = true, uint(pty.Rows), uint(pty.Cols)
+				req.Env = append(req.Env, "TERM="+pty.Term)
+				ok = true
+			}
+		case "env":
+			env := envRequest{}
+			if ssh.Unmarshal(r.Payload, &env) == nil {
+				req.Env = append(req.Env, env.Name+"="+env.Value)
+				ok = true
+			}
+		case "window-change":
+			size := windowChange{}
+			if exec != nil && ssh.Unmarshal(r.Payload, &size) == nil {
+				if err = exec.Resize(ctx, uint(size.Rows), uint(size.Cols)); err != nil {
+					log.Warning(ctx, "Failed to resize the SSH session", "err", err)
+				}
+			}
+		case "shell", "exec":
+			if exec != nil {
+				break
+			}
+			req.Cmd = []string{"/bin/sh", "-c", loginShell}
+			if r.Type == "exec" {
+				command := execRequest{}
+				if ssh.Unmarshal(r.Payload, &command) != nil {
+					break
+				}
+				req.Cmd = []string{"/bin/sh", "-c", command.Command}
+			}
+			if exec, err = s.runner.Exec(ctx, req); err != nil {
+				log.Warning(ctx, "Failed to start the SSH session", "err", err)
+				break
+			}
+			ok = true
+			go s.pipe(ctx, channel, exec)
+		}
+		if r.WantReply {
+			_ = r.Reply(ok, nil)
+		}
+	}
+	if exec != nil {
+		_ = exec.Close()
+	}
+}
+
+// pipe copies the session both ways, the channel is closed with the exit status of the process
+func (s *Server) pipe(ctx context.Context, channel ssh.Channel, exec control.ExecSession) {
+	go func() {
+		_, _ = io.Copy(exec, channel)
+		_ = exec.CloseWrite()
+	}()
+	_, _ = io.Copy(channel, exec)
+	code, err := exec.ExitCode(ctx)
+	if err != nil {
+		log.Warning(ctx, "Failed to get the exit code of the SSH session", "err", err)
+		code = 255
+	}
+	_, _ = channel.SendRequest("exit-status", false, ssh.Marshal(&exitStatus{Status: uint32(code)}))
+	_ = channel.Close()
+}
+
+// directTCPIP forwards a client connection to a port of the job container, e.g. to the IDE server.
+// The requested host is ignored, the ports are always of the job container.
+func (s *Server) directTCPIP(ctx context.Context, newChannel ssh.NewChannel) {
+	target := directTCPIPRequest{}
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &target); err != nil {
+		_ = newChannel.Reject(ssh.ConnectionFailed, "invalid forwarding request")
+		return
+	}
+	conn, err := s.runner.DialContainer(ctx, int(target.Port))
+	if err != nil {
+		log.Trace(ctx, "Failed to dial the forwarded port", "port", target.Port, "err", err)
+		_ = newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	defer func() { _ = conn.Close() }()
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { _ = channel.Close() }()
+	go ssh.DiscardRequests(reqs)
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(conn, channel)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(channel, conn)
+		done <- struct{}{}
+	}()
+	<-done
+}
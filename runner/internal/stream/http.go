@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"strconv"
 	"sync"
+	"time"
 
 	"github.com/dstackai/dstack/runner/internal/gerrors"
 	"github.com/dstackai/dstack/runner/internal/log"
@@ -13,6 +15,15 @@ import (
 
 const (
 	cliIDParam = "cli"
+	// offsetParam replays the logs since the byte offset, sinceParam since the RFC 3339 or Unix time
+	offsetParam = "offset"
+	sinceParam  = "since"
+	// historySize is the number of the last bytes kept for the late clients, the oldest chunks are evicted beyond it
+	historySize = 16 << 20
+	// clientQueueSize is the number of the chunks waiting for a slow client, the oldest ones are dropped beyond it
+	clientQueueSize = 4096
+	// writeTimeout disconnects the clients not reading at all
+	writeTimeout = 30 * time.Second
 )
 
 var upgrader = websocket.Upgrader{
@@ -21,42 +32,55 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// Server streams the logs to the WebSocket clients, the clients connecting late replay the kept history first
 type Server struct {
-	buf    [][]byte
-	client sync.Map
-	mu     sync.RWMutex
-	port   int
-	closed chan struct{}
-	Done   chan struct{}
+	// buf is the history, first is the index of its first chunk and size is its length in bytes
+	buf     []chunk
+	first   int
+	size    int
+	written int64
+	client  sync.Map
+	clients map[*clientQueue]struct{}
+	mu      sync.RWMutex
+	port    int
+	closed  chan struct{}
+	Done    chan struct{}
 }
 
 func New(port int) *Server {
 	s := &Server{
-		buf:    make([][]byte, 0),
-		client: sync.Map{},
-		mu:     sync.RWMutex{},
-		port:   port,
-		closed: make(chan struct{}),
-		Done:   make(chan struct{}),
+		buf:     make([]chunk, 0),
+		client:  sync.Map{},
+		clients: make(map[*clientQueue]struct{}),
+		mu:      sync.RWMutex{},
+		port:    port,
+		closed:  make(chan struct{}),
+		Done:    make(chan struct{}),
 	}
 	return s
 }
 
 func (s *Server) Run(ctx context.Context) error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/logsws", s.getLogs)
-	if err := http.ListenAndServe(fmt.Sprintf(":%d", s.port), mux); err != nil {
+	if err := http.ListenAndServe(fmt.Sprintf(":%d", s.port), s.mux()); err != nil {
 		log.Error(ctx, "HTTP server error", "err", err)
 		return gerrors.Wrap(err)
 	}
 	return nil
 }
 
+func (s *Server) mux() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/logsws", s.getLogs)
+	return mux
+}
+
 func (s *Server) Port() int {
 	return s.port
 }
 
 func (s *Server) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	select {
 	case <-s.closed:
 		return
@@ -66,53 +90,223 @@ func (s *Server) Close() {
 	close(s.closed)
 }
 
+// Reset starts a new stream on the same port, e.g. for the next job of a persistent runner
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = make([]chunk, 0)
+	s.first, s.size, s.written = 0, 0, 0
+	s.client.Range(func(key, _ interface{}) bool {
+		s.client.Delete(key)
+		return true
+	})
+	s.clients = make(map[*clientQueue]struct{})
+	s.closed = make(chan struct{})
+	s.Done = make(chan struct{})
+}
+
+// Write never waits for the clients, every one of them has its own queue
 func (s *Server) Write(p []byte) (int, error) {
 	s.mu.Lock()
+	defer s.mu.Unlock()
 	dst := make([]byte, len(p))
 	copy(dst, p)
-	s.buf = append(s.buf, dst)
-	s.mu.Unlock()
+	c := chunk{offset: s.written, time: time.Now(), data: dst}
+	s.buf = append(s.buf, c)
+	s.size += len(dst)
+	s.written += int64(len(dst))
+	for len(s.buf) > 1 && s.size > historySize {
+		s.size -= len(s.buf[0].data)
+		s.buf[0] = chunk{}
+		s.buf = s.buf[1:]
+		s.first++
+	}
+	for queue := range s.clients {
+		queue.push(c)
+	}
 	return len(p), nil
 }
 
+// Read returns the chunks written since the index, the first of them is at first, after the index if older
+// chunks are evicted. The stream is closed if there is no more chunk.
+func (s *Server) Read(index int) (first int, chunks [][]byte, closed bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	select {
+	case <-s.closed:
+		closed = true
+	default:
+	}
+	if index < s.first {
+		index = s.first
+	}
+	for i := index - s.first; i < len(s.buf); i++ {
+		chunks = append(chunks, s.buf[i].data)
+	}
+	return index, chunks, closed
+}
+
+// history returns the kept chunks since the byte offset or the time, the chunk with the offset is cut
+func (s *Server) history(offset int64, since time.Time) []chunk {
+	var chunks []chunk
+	for _, c := range s.buf {
+		end := c.offset + int64(len(c.data))
+		if end <= offset || c.time.Before(since) {
+			continue
+		}
+		if c.offset < offset {
+			c.data = c.data[offset-c.offset:]
+			c.offset = offset
+		}
+		chunks = append(chunks, c)
+	}
+	return chunks
+}
+
 func (s *Server) getLogs(w http.ResponseWriter, r *http.Request) {
-	connection, _ := upgrader.Upgrade(w, r, nil)
-	var currentPos int
-	var hasID bool
-	var clientID string
-	if r.URL.Query().Has(cliIDParam) {
-		clientID = r.URL.Query().Get(cliIDParam)
-		pos, ok := s.client.Load(clientID)
-		if ok {
-			switch v := pos.(type) {
-			case int:
-				currentPos = v
+	ctx := r.Context()
+	connection, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Warning(ctx, "Failed to upgrade the logs connection", "err", err)
+		return
+	}
+	defer func() { _ = connection.Close() }()
+	query := r.URL.Query()
+	offset, since, err := replayFrom(query.Get(offsetParam), query.Get(sinceParam))
+	if err != nil {
+		_ = connection.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseUnsupportedData, err.Error()))
+		return
+	}
+	hasID := query.Has(cliIDParam)
+	clientID := query.Get(cliIDParam)
+	if hasID && !query.Has(offsetParam) {
+		if pos, ok := s.client.Load(clientID); ok {
+			if v, ok := pos.(int64); ok {
+				offset = v
 			}
 		}
-		hasID = true
 	}
+
+	queue := newClientQueue()
+	s.mu.Lock()
+	for _, c := range s.history(offset, since) {
+		queue.push(c)
+	}
+	clients := s.clients
+	clients[queue] = struct{}{}
+	closed, done := s.closed, s.Done
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(clients, queue)
+		s.mu.Unlock()
+	}()
+
 	for {
-		s.mu.RLock()
+		chunks, dropped := queue.pop()
+		if dropped > 0 {
+			log.Warning(ctx, "Logs client is too slow, chunks are dropped", "cli", clientID, "dropped", dropped)
+		}
+		for _, c := range chunks {
+			_ = connection.SetWriteDeadline(time.Now().Add(writeTimeout))
+			if err = connection.WriteMessage(websocket.BinaryMessage, c.data); err != nil {
+				log.Trace(ctx, "Logs client is gone", "cli", clientID, "err", err)
+				return
+			}
+			if hasID {
+				s.client.Store(clientID, c.offset+int64(len(c.data)))
+			}
+		}
+		if len(chunks) > 0 {
+			continue
+		}
 		select {
-		case <-s.closed:
-			if currentPos == len(s.buf) {
+		case <-queue.notify:
+		case <-closed:
+			if queue.empty() {
 				_ = connection.WriteMessage(websocket.CloseMessage, nil)
-				_ = connection.Close()
-				s.mu.RUnlock()
-				close(s.Done)
+				s.finish(done)
 				return
 			}
-		default:
 		}
-		if currentPos == len(s.buf) {
-			s.mu.RUnlock()
-			continue
+	}
+}
+
+// finish tells the stream is sent, once per stream whatever the number of the clients is
+func (s *Server) finish(done chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-done:
+	default:
+		close(done)
+	}
+}
+
+// chunk is a write to the stream, offset is the byte offset of its data since the stream start
+type chunk struct {
+	offset int64
+	time   time.Time
+	data   []byte
+}
+
+// replayFrom parses the replay params, the history is replayed since the stream start by default
+func replayFrom(offset, since string) (int64, time.Time, error) {
+	var from int64
+	var fromTime time.Time
+	var err error
+	if offset != "" {
+		if from, err = strconv.ParseInt(offset, 10, 64); err != nil || from < 0 {
+			return 0, fromTime, gerrors.Newf("invalid offset: %s", offset)
 		}
-		_ = connection.WriteMessage(websocket.BinaryMessage, s.buf[currentPos])
-		currentPos++
-		s.mu.RUnlock()
-		if hasID {
-			s.client.Store(clientID, currentPos)
+	}
+	if since != "" {
+		if seconds, errUnix := strconv.ParseInt(since, 10, 64); errUnix == nil {
+			fromTime = time.Unix(seconds, 0)
+		} else if fromTime, err = time.Parse(time.RFC3339, since); err != nil {
+			return 0, fromTime, gerrors.Newf("invalid since: %s", since)
 		}
 	}
+	return from, fromTime, nil
+}
+
+// clientQueue holds the chunks not sent to a client yet, with the drop-oldest semantics
+type clientQueue struct {
+	mu      sync.Mutex
+	chunks  []chunk
+	dropped int
+	notify  chan struct{}
+}
+
+func newClientQueue() *clientQueue {
+	return &clientQueue{notify: make(chan struct{}, 1)}
+}
+
+func (q *clientQueue) push(c chunk) {
+	q.mu.Lock()
+	if len(q.chunks) >= clientQueueSize {
+		q.chunks = q.chunks[1:]
+		q.dropped++
+	}
+	q.chunks = append(q.chunks, c)
+	q.mu.Unlock()
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+// pop takes the queued chunks and the number of the chunks dropped since the last pop
+func (q *clientQueue) pop() ([]chunk, int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	chunks, dropped := q.chunks, q.dropped
+	q.chunks, q.dropped = nil, 0
+	return chunks, dropped
+}
+
+func (q *clientQueue) empty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.chunks) == 0
 }
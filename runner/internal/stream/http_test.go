@@ -0,0 +1,85 @@
+package stream
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientQueueDropsOldest(t *testing.T) {
+	queue := newClientQueue()
+	for i := 0; i < clientQueueSize+2; i++ {
+		queue.push(chunk{offset: int64(i)})
+	}
+	chunks, dropped := queue.pop()
+	assert.Equal(t, 2, dropped)
+	assert.Equal(t, clientQueueSize, len(chunks))
+	assert.Equal(t, int64(2), chunks[0].offset)
+	assert.True(t, queue.empty())
+}
+
+func TestLogsStream(t *testing.T) {
+	s := New(0)
+	server := httptest.NewServer(s.mux())
+	defer server.Close()
+	_, _ = s.Write([]byte("one"))
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/logsws", nil)
+	assert.Equal(t, nil, err)
+	defer func() { _ = conn.Close() }()
+	_, _ = s.Write([]byte("two"))
+	s.Close()
+
+	var messages []string
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			break
+		}
+		messages = append(messages, string(data))
+	}
+	assert.Equal(t, []string{"one", "two"}, messages)
+	<-s.Done
+}
+
+func TestLogsReplay(t *testing.T) {
+	s := New(0)
+	server := httptest.NewServer(s.mux())
+	defer server.Close()
+	_, _ = s.Write([]byte("one\n"))
+	_, _ = s.Write([]byte("two\n"))
+	s.Close()
+
+	read := func(query string) string {
+		conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/logsws?"+query, nil)
+		assert.Equal(t, nil, err)
+		defer func() { _ = conn.Close() }()
+		var logs string
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return logs
+			}
+			logs += string(data)
+		}
+	}
+	assert.Equal(t, "one\ntwo\n", read(""))
+	assert.Equal(t, "e\ntwo\n", read("offset=2"))
+	assert.Equal(t, "", read("since="+time.Now().Add(time.Minute).Format(time.RFC3339)))
+}
+
+func TestReadSkipsEvicted(t *testing.T) {
+	s := New(0)
+	big := make([]byte, historySize/2+1)
+	for i := 0; i < 3; i++ {
+		_, _ = s.Write(big)
+	}
+	first, chunks, closed := s.Read(0)
+	assert.Equal(t, 2, first)
+	assert.Equal(t, 1, len(chunks))
+	assert.False(t, closed)
+}
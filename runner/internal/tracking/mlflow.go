@@ -0,0 +1,169 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+const (
+	MLflowFinished = "FINISHED"
+	MLflowFailed   = "FAILED"
+	MLflowKilled   = "KILLED"
+
+	// mlflowNotFound is the error code of the missing experiment
+	mlflowNotFound = "RESOURCE_DOES_NOT_EXIST"
+	// mlflowRunNameTag is the tag the MLflow UI shows as the run name
+	mlflowRunNameTag = "mlflow.runName"
+)
+
+// MLflow creates the runs of the jobs on a tracking server with its REST API
+type MLflow struct {
+	uri    string
+	token  string
+	client *http.Client
+}
+
+func NewMLflow(uri, token string) *MLflow {
+	return &MLflow{
+		uri:    strings.TrimSuffix(uri, "/"),
+		token:  token,
+		client: &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// CreateRun creates the run in the experiment, the experiment is created if missing.
+// It returns the run ID and the URL of the run page.
+func (m *MLflow) CreateRun(ctx context.Context, experiment, runName string, tags map[string]string) (string, string, error) {
+	experimentID, err := m.experimentID(ctx, experiment)
+	if err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	type tag struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}
+	request := struct {
+		ExperimentID string `json:"experiment_id"`
+		RunName      string `json:"run_name"`
+		StartTime    int64  `json:"start_time"`
+		Tags         []tag  `json:"tags"`
+	}{ExperimentID: experimentID, RunName: runName, StartTime: time.Now().UnixMilli()}
+	request.Tags = append(request.Tags, tag{Key: mlflowRunNameTag, Value: runName})
+	for k, v := range tags {
+		request.Tags = append(request.Tags, tag{Key: k, Value: v})
+	}
+	var reply struct {
+		Run struct {
+			Info struct {
+				RunID string `json:"run_id"`
+			} `json:"info"`
+		} `json:"run"`
+	}
+	if err = m.call(ctx, http.MethodPost, "runs/create", request, &reply); err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	runID := reply.Run.Info.RunID
+	if runID == "" {
+		return "", "", gerrors.New("MLflow returned no run")
+	}
+	return runID, fmt.Sprintf("%s/#/experiments/%s/runs/%s", m.uri, experimentID, runID), nil
+}
+
+// FinishRun ends the run with the status unless the job code has ended it already
+func (m *MLflow) FinishRun(ctx context.Context, runID, status string) error {
+	var reply struct {
+		Run struct {
+			Info struct {
+				Status string `json:"status"`
+			} `json:"info"`
+		} `json:"run"`
+	}
+	if err := m.call(ctx, http.MethodGet, "runs/get?run_id="+url.QueryEscape(runID), nil, &reply); err != nil {
+		return gerrors.Wrap(err)
+	}
+	if reply.Run.Info.Status != "RUNNING" && reply.Run.Info.Status != "SCHEDULED" {
+		return nil
+	}
+	request := map[string]interface{}{"run_id": runID, "status": status, "end_time": time.Now().UnixMilli()}
+	return gerrors.Wrap(m.call(ctx, http.MethodPost, "runs/update", request, nil))
+}
+
+func (m *MLflow) experimentID(ctx context.Context, name string) (string, error) {
+	var found struct {
+		Experiment struct {
+			ExperimentID string `json:"experiment_id"`
+		} `json:"experiment"`
+	}
+	err := m.call(ctx, http.MethodGet, "experiments/get-by-name?experiment_name="+url.QueryEscape(name), nil, &found)
+	if err == nil {
+		return found.Experiment.ExperimentID, nil
+	}
+	var apiErr MLflowError
+	if !errors.As(err, &apiErr) || apiErr.Code != mlflowNotFound {
+		return "", gerrors.Wrap(err)
+	}
+	var created struct {
+		ExperimentID string `json:"experiment_id"`
+	}
+	if err = m.call(ctx, http.MethodPost, "experiments/create", map[string]string{"name": name}, &created); err != nil {
+		return "", gerrors.Wrap(err)
+	}
+	return created.ExperimentID, nil
+}
+
+// MLflowError is the error reply of the tracking server
+type MLflowError struct {
+	Code    string `json:"error_code"`
+	Message string `json:"message"`
+}
+
+func (e MLflowError) Error() string {
+	return fmt.Sprintf("mlflow: %s: %s", e.Code, e.Message)
+}
+
+func (m *MLflow) call(ctx context.Context, method, endpoint string, request, reply interface{}) error {
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return gerrors.Wrap(err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, m.uri+"/api/2.0/mlflow/"+endpoint, body)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if m.token != "" {
+		req.Header.Set("Authorization", "Bearer "+m.token)
+	}
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		apiErr := MLflowError{Code: resp.Status}
+		_ = json.Unmarshal(data, &apiErr)
+		return gerrors.Wrap(apiErr)
+	}
+	if reply == nil {
+		return nil
+	}
+	return gerrors.Wrap(json.Unmarshal(data, reply))
+}
@@ -0,0 +1,64 @@
+package tracking
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMLflowCreateRun(t *testing.T) {
+	var status string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/2.0/mlflow/experiments/get-by-name":
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error_code": "RESOURCE_DOES_NOT_EXIST", "message": "no experiment"}`))
+		case "/api/2.0/mlflow/experiments/create":
+			_, _ = w.Write([]byte(`{"experiment_id": "7"}`))
+		case "/api/2.0/mlflow/runs/create":
+			var request struct {
+				ExperimentID string `json:"experiment_id"`
+				RunName      string `json:"run_name"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			assert.Equal(t, "7", request.ExperimentID)
+			assert.Equal(t, "fast-moth-1", request.RunName)
+			_, _ = w.Write([]byte(`{"run": {"info": {"run_id": "abc"}}}`))
+		case "/api/2.0/mlflow/runs/get":
+			_, _ = w.Write([]byte(`{"run": {"info": {"status": "RUNNING"}}}`))
+		case "/api/2.0/mlflow/runs/update":
+			var request struct {
+				Status string `json:"status"`
+			}
+			_ = json.NewDecoder(r.Body).Decode(&request)
+			status = request.Status
+			_, _ = w.Write([]byte(`{}`))
+		}
+	}))
+	defer server.Close()
+	m := NewMLflow(server.URL, "")
+	runID, runURL, err := m.CreateRun(context.Background(), "experiment", "fast-moth-1", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "abc", runID)
+	assert.Equal(t, server.URL+"/#/experiments/7/runs/abc", runURL)
+	assert.Equal(t, nil, m.FinishRun(context.Background(), runID, MLflowFailed))
+	assert.Equal(t, MLflowFailed, status)
+}
+
+func TestWandBUpsertRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, key, _ := r.BasicAuth()
+		assert.Equal(t, "api", user)
+		assert.Equal(t, "key", key)
+		_, _ = w.Write([]byte(`{"data": {"upsertBucket": {"bucket": {"name": "job-1", "project": {"name": "llm", "entity": {"name": "team"}}}}}}`))
+	}))
+	defer server.Close()
+	entity, runURL, err := NewWandB(server.URL, "key").UpsertRun(context.Background(), "", "llm", "job-1", "fast-moth-1", nil)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "team", entity)
+	assert.Equal(t, server.URL+"/team/llm/runs/job-1", runURL)
+}
@@ -0,0 +1,131 @@
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+)
+
+const (
+	WandBDefaultURL = "https://api.wandb.ai"
+
+	requestTimeout = 30 * time.Second
+	// wandbAppURL is the UI of the W&B cloud, the self-hosted servers serve the API and the UI on one URL
+	wandbAppURL = "https://wandb.ai"
+)
+
+// upsertBucket is the mutation the W&B clients create and resume the runs with, a run is a bucket in the API
+const upsertBucket = `mutation UpsertBucket($name: String, $displayName: String, $project: String, $entity: String, $tags: [String!]) {
+  upsertBucket(input: {name: $name, displayName: $displayName, modelName: $project, entityName: $entity, tags: $tags}) {
+    bucket {
+      name
+      project {
+        name
+        entity {
+          name
+        }
+      }
+    }
+  }
+}`
+
+// WandB creates the runs of the jobs with the GraphQL API of W&B
+type WandB struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewWandB(baseURL, apiKey string) *WandB {
+	if baseURL == "" {
+		baseURL = WandBDefaultURL
+	}
+	return &WandB{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: requestTimeout},
+	}
+}
+
+// UpsertRun creates the run with the ID or returns the existing one, so the retried jobs resume it.
+// The empty entity is the default entity of the key. It returns the entity and the URL of the run page.
+func (w *WandB) UpsertRun(ctx context.Context, entity, project, runID, displayName string, tags []string) (string, string, error) {
+	request := map[string]interface{}{
+		"query": upsertBucket,
+		"variables": map[string]interface{}{
+			"name":        runID,
+			"displayName": displayName,
+			"project":     project,
+			"entity":      entity,
+			"tags":        tags,
+		},
+	}
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.baseURL+"/graphql", bytes.NewReader(data))
+	if err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("api", w.apiKey)
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", "", gerrors.Newf("wandb: %s %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	var reply struct {
+		Data struct {
+			UpsertBucket struct {
+				Bucket struct {
+					Name    string `json:"name"`
+					Project struct {
+						Name   string `json:"name"`
+						Entity struct {
+							Name string `json:"name"`
+						} `json:"entity"`
+					} `json:"project"`
+				} `json:"bucket"`
+			} `json:"upsertBucket"`
+		} `json:"data"`
+		Errors []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err = json.Unmarshal(body, &reply); err != nil {
+		return "", "", gerrors.Wrap(err)
+	}
+	if len(reply.Errors) > 0 {
+		return "", "", gerrors.Newf("wandb: %s", reply.Errors[0].Message)
+	}
+	bucket := reply.Data.UpsertBucket.Bucket
+	if bucket.Name == "" {
+		return "", "", gerrors.New("wandb returned no run")
+	}
+	entity = bucket.Project.Entity.Name
+	runURL := fmt.Sprintf("%s/%s/%s/runs/%s", w.appURL(), url.PathEscape(entity), url.PathEscape(bucket.Project.Name), url.PathEscape(bucket.Name))
+	return entity, runURL, nil
+}
+
+func (w *WandB) appURL() string {
+	if w.baseURL == WandBDefaultURL {
+		return wandbAppURL
+	}
+	return w.baseURL
+}
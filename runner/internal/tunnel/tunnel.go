@@ -0,0 +1,255 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dstackai/dstack/runner/internal/gerrors"
+	"github.com/dstackai/dstack/runner/internal/log"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	dialTimeout       = 30 * time.Second
+	keepAliveInterval = 30 * time.Second
+	minReconnectDelay = time.Second
+	maxReconnectDelay = time.Minute
+)
+
+// Config points to an SSH server accepting remote port forwarding, e.g. a gateway run by the hub.
+// App ports are reachable on the gateway, so the instance doesn't need open ports.
+type Config struct {
+	Host         string `yaml:"host"`
+	Port         int    `yaml:"port,omitempty"`
+	User         string `yaml:"user"`
+	IdentityFile string `yaml:"identity_file"`
+	// HostKey is the gateway public key in the authorized_keys format
+	HostKey string `yaml:"host_key"`
+	// BindHost is the gateway interface the forwarded ports listen on
+	BindHost string `yaml:"bind_host,omitempty"`
+}
+
+// forward is a gateway port piped to a local address, it is listened again after a reconnect
+type forward struct {
+	remotePort int
+	localAddr  string
+	listener   net.Listener
+}
+
+// Tunnel reconnects to the gateway with a backoff if the connection is lost, forwarded ports keep their numbers
+type Tunnel struct {
+	config    Config
+	clientCfg *ssh.ClientConfig
+
+	mu       sync.Mutex
+	client   *ssh.Client
+	forwards []*forward
+	done     chan struct{}
+}
+
+func Connect(ctx context.Context, config Config) (*Tunnel, error) {
+	if config.Port == 0 {
+		config.Port = 22
+	}
+	if config.BindHost == "" {
+		config.BindHost = "0.0.0.0"
+	}
+	key, err := os.ReadFile(config.IdentityFile)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(config.HostKey))
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	t := &Tunnel{
+		config: config,
+		clientCfg: &ssh.ClientConfig{
+			User:            config.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: ssh.FixedHostKey(hostKey),
+			Timeout:         dialTimeout,
+		},
+		done: make(chan struct{}),
+	}
+	if t.client, err = t.dial(ctx); err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	go t.keepAlive(ctx)
+	return t, nil
+}
+
+func (t *Tunnel) dial(ctx context.Context) (*ssh.Client, error) {
+	addr := net.JoinHostPort(t.config.Host, strconv.Itoa(t.config.Port))
+	log.Trace(ctx, "Connecting to the tunnel gateway", "addr", addr)
+	client, err := ssh.Dial("tcp", addr, t.clientCfg)
+	if err != nil {
+		return nil, gerrors.Wrap(err)
+	}
+	return client, nil
+}
+
+// Forward makes the gateway listen on remotePort and pipes every connection to localAddr.
+// If remotePort is 0, the gateway picks a free port. The actual remote port is returned.
+func (t *Tunnel) Forward(ctx context.Context, remotePort int, localAddr string) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fwd := &forward{remotePort: remotePort, localAddr: localAddr}
+	if err := t.listen(ctx, fwd); err != nil {
+		return 0, gerrors.Wrap(err)
+	}
+	t.forwards = append(t.forwards, fwd)
+	return fwd.remotePort, nil
+}
+
+// Repoint pipes the connections to the remote port to another local address, e.g. after the app port is rebound
+func (t *Tunnel) Repoint(ctx context.Context, remotePort int, localAddr string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, fwd := range t.forwards {
+		if fwd.remotePort == remotePort && fwd.localAddr != localAddr {
+			log.Trace(ctx, "Repointing forwarded port", "remote", remotePort, "local", localAddr)
+			fwd.localAddr = localAddr
+		}
+	}
+}
+
+func (t *Tunnel) localAddr(fwd *forward) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return fwd.localAddr
+}
+
+// listen is called with the lock held
+func (t *Tunnel) listen(ctx context.Context, fwd *forward) error {
+	listener, err := t.client.Listen("tcp", net.JoinHostPort(t.config.BindHost, strconv.Itoa(fwd.remotePort)))
+	if err != nil {
+		return gerrors.Wrap(err)
+	}
+	if addr, ok := listener.Addr().(*net.TCPAddr); ok && addr.Port != 0 {
+		fwd.remotePort = addr.Port
+	}
+	fwd.listener = listener
+	log.Trace(ctx, "Forwarding port over the tunnel", "remote", fwd.remotePort, "local", fwd.localAddr)
+	go func() {
+		for {
+			remote, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go pipe(ctx, remote, t.localAddr(fwd))
+		}
+	}()
+	return nil
+}
+
+func (t *Tunnel) Close() error {
+	select {
+	case <-t.done:
+		return nil
+	default:
+	}
+	close(t.done)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, fwd := range t.forwards {
+		if fwd.listener != nil {
+			_ = fwd.listener.Close()
+		}
+	}
+	t.forwards = nil
+	return gerrors.Wrap(t.client.Close())
+}
+
+func (t *Tunnel) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			client := t.client
+			t.mu.Unlock()
+			if _, _, err := client.SendRequest("keepalive@openssh.com", true, nil); err != nil {
+				log.Error(ctx, "Tunnel keepalive failed, reconnecting", "err", err)
+				t.reconnect(ctx)
+			}
+		}
+	}
+}
+
+// reconnect dials the gateway until it succeeds or the tunnel is closed, then listens on the same remote ports
+func (t *Tunnel) reconnect(ctx context.Context) {
+	t.mu.Lock()
+	_ = t.client.Close()
+	t.mu.Unlock()
+	delay := minReconnectDelay
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-time.After(delay):
+		}
+		client, err := t.dial(ctx)
+		if err != nil {
+			log.Error(ctx, "Failed to reconnect to the tunnel gateway", "err", err, "retry_in", delay)
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+			continue
+		}
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		select {
+		case <-t.done:
+			_ = client.Close()
+			return
+		default:
+		}
+		t.client = client
+		for _, fwd := range t.forwards {
+			if err = t.listen(ctx, fwd); err != nil {
+				log.Error(ctx, "Failed to forward the port again", "remote", fwd.remotePort, "err", err)
+			}
+		}
+		log.Info(ctx, "Reconnected to the tunnel gateway")
+		return
+	}
+}
+
+func pipe(ctx context.Context, remote net.Conn, localAddr string) {
+	defer func() { _ = remote.Close() }()
+	local, err := net.DialTimeout("tcp", localAddr, dialTimeout)
+	if err != nil {
+		log.Trace(ctx, "Failed to dial forwarded port", "addr", localAddr, "err", err)
+		return
+	}
+	defer func() { _ = local.Close() }()
+	done := make(chan struct{}, 2)
+	go func() {
+		_, _ = io.Copy(local, remote)
+		done <- struct{}{}
+	}()
+	go func() {
+		_, _ = io.Copy(remote, local)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+// LocalAddr is the address the container app is reachable at on the instance
+func LocalAddr(port int) string {
+	return fmt.Sprintf("127.0.0.1:%d", port)
+}
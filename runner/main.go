@@ -3,6 +3,7 @@ package main
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"github.com/dstackai/dstack/runner/internal/ports"
 	"io"
@@ -20,15 +21,21 @@ import (
 	"time"
 
 	"github.com/dstackai/dstack/runner/consts"
+	"github.com/dstackai/dstack/runner/internal/appproxy"
 	"github.com/dstackai/dstack/runner/internal/backend"
 	_ "github.com/dstackai/dstack/runner/internal/backend/azure"
 	_ "github.com/dstackai/dstack/runner/internal/backend/gcp"
 	_ "github.com/dstackai/dstack/runner/internal/backend/local"
 	_ "github.com/dstackai/dstack/runner/internal/backend/s3"
 	"github.com/dstackai/dstack/runner/internal/container"
+	"github.com/dstackai/dstack/runner/internal/control"
 	"github.com/dstackai/dstack/runner/internal/executor"
+	"github.com/dstackai/dstack/runner/internal/gateway"
+	"github.com/dstackai/dstack/runner/internal/health"
+	"github.com/dstackai/dstack/runner/internal/joblog"
 	"github.com/dstackai/dstack/runner/internal/log"
 	"github.com/dstackai/dstack/runner/internal/models"
+	"github.com/dstackai/dstack/runner/internal/sshserver"
 	"github.com/dstackai/dstack/runner/internal/stream"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli/v2"
@@ -39,7 +46,7 @@ func main() {
 	App()
 }
 
-func start(logLevel int, httpPort int, configDir string) {
+func start(logLevel int, httpPort int, configDir string, dryRun bool) {
 	ctx := context.Background()
 	//Load runner config
 	config := new(executor.Config)
@@ -58,17 +65,22 @@ func start(logLevel int, httpPort int, configDir string) {
 		return
 	}
 
-	if _, err = os.Stat(filepath.Join(configDir, "logs", "runners")); err != nil {
-		if err = os.MkdirAll(filepath.Join(configDir, "logs", "runners"), 0o777); err != nil {
-			fmt.Println(err)
-			return
-		}
+	// before the backend and git clients make any request
+	if err = config.Proxy.Apply(); err != nil {
+		fmt.Println(err)
+		return
 	}
 
 	pathLogRunner := filepath.Join(configDir, "logs", "runners", fmt.Sprintf("%s.log", config.Id))
 	log.L.Logger.SetLevel(logrus.Level(logLevel))
-	fileLog, err := os.OpenFile(pathLogRunner, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o777)
+	if config.LogLevel != "" {
+		if level, err := logrus.ParseLevel(config.LogLevel); err == nil {
+			log.L.Logger.SetLevel(level)
+		}
+	}
+	fileLog, err := joblog.OpenRotating(pathLogRunner, filepath.Join(configDir, "logs"), config.LogRotation)
 	if err != nil {
+		fmt.Println(err)
 		return
 	}
 	defer fileLog.Close()
@@ -79,19 +91,30 @@ func start(logLevel int, httpPort int, configDir string) {
 	log.Info(logCtx, "RUNNER START...")
 
 	pathConfig := filepath.Join(configDir, consts.CONFIG_FILE_NAME)
+	if err = backend.LoadPlugins(logCtx, config.BackendPlugins); err != nil {
+		log.L.Error("[ERROR]", err)
+		os.Exit(1)
+	}
 
-	b, err := backend.New(logCtx, pathConfig)
+	if len(config.Slots) > 0 {
+		startPool(logCtx, config, configDir, pathConfig)
+		return
+	}
+
+	b, err := backend.New(logCtx, config.Backend, pathConfig)
 	if err != nil {
 		log.L.Error("[ERROR]", err)
 		os.Exit(1)
 	}
-	if httpPort == 0 {
-		for httpPort = 10999; httpPort >= 10000; httpPort-- {
-			if vacant, _ := ports.CheckPort(httpPort); vacant {
-				break
-			}
+	if dryRun {
+		if err = dryRunJob(logCtx, b, configDir); err != nil {
+			log.L.Error("[ERROR]", err)
+			os.Exit(1)
 		}
-		if httpPort == 9999 {
+		return
+	}
+	if httpPort == 0 {
+		if httpPort = pickStreamPort(nil); httpPort == 0 {
 			log.Error(ctx, "Can't pick a vacant port for logs streaming")
 			os.Exit(1)
 		}
@@ -104,14 +127,112 @@ func start(logLevel int, httpPort int, configDir string) {
 		}
 	}()
 
+	if config.Daemon != nil {
+		ctxSig, cancel := signal.NotifyContext(logCtx, os.Interrupt, syscall.SIGTERM, syscall.SIGKILL, syscall.SIGQUIT)
+		defer cancel()
+		if config.ControlPort != 0 {
+			log.Warning(logCtx, "The control API is not supported in the daemon mode")
+		}
+		if config.SSH != nil {
+			log.Warning(logCtx, "The SSH server is not supported in the daemon mode")
+		}
+		if config.HealthPort != 0 {
+			log.Warning(logCtx, "The health server is not supported in the daemon mode")
+		}
+		if config.AppProxy != nil {
+			log.Warning(logCtx, "The app proxy is not supported in the daemon mode")
+			config.AppProxy = nil
+		}
+		if config.Gateway != nil {
+			log.Warning(logCtx, "The model gateway is not supported in the daemon mode")
+			config.Gateway = nil
+		}
+		newBackend := func() (backend.Backend, error) {
+			return backend.New(logCtx, config.Backend, pathConfig)
+		}
+		go reloadOnHangup(ctxSig, configDir, func(fresh *executor.Config) {
+			config.Reload(ctxSig, fresh)
+		})
+		if err = executor.Serve(ctxSig, b, newBackend, streamLogs, configDir, config); err != nil {
+			log.Error(logCtx, "dstack-runner daemon ended with an error: ", "err", err)
+		}
+		return
+	}
+
 	ex := executor.New(b)
 	ex.SetStreamLogs(streamLogs)
 
+	if config.ControlPort != 0 {
+		controlServer := control.New(config.ControlHost, config.ControlPort, config.ControlToken, ex, streamLogs)
+		go func() {
+			if err := controlServer.Run(logCtx); err != nil {
+				log.Error(logCtx, "Failed control API", "err", err)
+			}
+		}()
+		defer controlServer.Shutdown()
+	}
+	if config.HealthPort != 0 {
+		healthServer := health.New(config.HealthHost, config.HealthPort, ex)
+		go func() {
+			if err := healthServer.Run(logCtx); err != nil {
+				log.Error(logCtx, "Failed health server", "err", err)
+			}
+		}()
+		defer healthServer.Shutdown()
+	}
+	if config.SSH != nil {
+		sshServer, err := sshserver.New(*config.SSH, configDir, ex)
+		if err != nil {
+			log.Error(logCtx, "Failed to create SSH server", "err", err)
+		} else {
+			go func() {
+				if err := sshServer.Run(logCtx); err != nil {
+					log.Error(logCtx, "Failed SSH server", "err", err)
+				}
+			}()
+			defer sshServer.Shutdown()
+		}
+	}
+	if config.AppProxy != nil {
+		appProxy, err := appproxy.New(*config.AppProxy, configDir, ex)
+		if err != nil {
+			log.Error(logCtx, "Failed to create app proxy", "err", err)
+		} else {
+			appProxy.SetMeter(ex.Meter())
+			go func() {
+				if err := appProxy.Run(logCtx); err != nil {
+					log.Error(logCtx, "Failed app proxy", "err", err)
+				}
+			}()
+			defer appProxy.Shutdown()
+		}
+	}
+	if config.Gateway != nil {
+		modelGateway := gateway.New(*config.Gateway, ex)
+		modelGateway.SetMeter(ex.Meter())
+		ex.SetGateway(modelGateway)
+		go func() {
+			if err := modelGateway.Run(logCtx); err != nil {
+				log.Error(logCtx, "Failed model gateway", "err", err)
+			}
+		}()
+		defer modelGateway.Shutdown()
+	}
+
 	ctxSig, cancel := signal.NotifyContext(logCtx, os.Interrupt, syscall.SIGTERM, syscall.SIGKILL, syscall.SIGQUIT)
 
 	defer ex.Shutdown(context.Background())
+	go reloadOnHangup(ctxSig, configDir, func(fresh *executor.Config) {
+		ex.ReloadConfig(ctxSig, fresh)
+	})
 
+	ex.AllowSelfUpdate()
 	if err = ex.Init(ctxSig, configDir); err != nil {
+		var update executor.UpdateRequired
+		if errors.As(err, &update) {
+			log.Info(logCtx, "Restarting the runner", "version", update.Version, "binary", update.Binary)
+			err = update.Exec()
+		}
 		log.Error(logCtx, "Failed to init executor", "err", err)
 		cancel()
 	}
@@ -135,6 +256,129 @@ func start(logLevel int, httpPort int, configDir string) {
 	}
 }
 
+// dryRunJob prints the container spec of the job, the instance is not shut down and the state is not written
+func dryRunJob(ctx context.Context, b backend.Backend, configDir string) error {
+	ex := executor.New(b)
+	ex.SetDryRun()
+	if err := ex.Init(ctx, configDir); err != nil {
+		return err
+	}
+	return ex.DryRun(ctx, os.Stdout)
+}
+
+// reloadOnHangup re-reads the runner config on SIGHUP until ctx is done, reload applies its tunables
+func reloadOnHangup(ctx context.Context, configDir string, reload func(fresh *executor.Config)) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+		}
+		fresh, err := executor.LoadConfig(configDir)
+		if err != nil {
+			log.Error(ctx, "Failed to reload the runner config", "err", err)
+			continue
+		}
+		reload(fresh)
+		log.Info(ctx, "Runner config is reloaded")
+	}
+}
+
+// startPool runs a job per slot concurrently, every slot has its own backend, executor and logs stream
+func startPool(ctx context.Context, config *executor.Config, configDir, pathConfig string) {
+	ctxSig, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM, syscall.SIGKILL, syscall.SIGQUIT)
+	defer cancel()
+	if config.ControlPort != 0 {
+		log.Warning(ctx, "The control API is not supported in the pool mode")
+	}
+	if config.SSH != nil {
+		log.Warning(ctx, "The SSH server is not supported in the pool mode")
+	}
+	if config.HealthPort != 0 {
+		log.Warning(ctx, "The health server is not supported in the pool mode")
+	}
+	if config.AppProxy != nil {
+		log.Warning(ctx, "The app proxy is not supported in the pool mode")
+	}
+	if config.Gateway != nil {
+		log.Warning(ctx, "The model gateway is not supported in the pool mode")
+	}
+	taken := map[int]bool{}
+	wg := sync.WaitGroup{}
+	// the slots share the instance, it is shut down once all of them are done
+	var initialized []*executor.Executor
+	initMu := sync.Mutex{}
+	go reloadOnHangup(ctxSig, configDir, func(fresh *executor.Config) {
+		initMu.Lock()
+		defer initMu.Unlock()
+		for _, ex := range initialized {
+			ex.ReloadConfig(ctxSig, fresh)
+		}
+	})
+	for i, slot := range config.Slots {
+		slotCtx := log.AppendArgsCtx(ctx, "slot", slot.Id)
+		b, err := backend.New(slotCtx, config.Backend, pathConfig)
+		if err != nil {
+			log.Error(slotCtx, "Failed to create backend", "err", err)
+			continue
+		}
+		httpPort := pickStreamPort(taken)
+		if httpPort == 0 {
+			log.Error(slotCtx, "Can't pick a vacant port for logs streaming")
+			continue
+		}
+		taken[httpPort] = true
+		streamLogs := stream.New(httpPort)
+		go func() {
+			if err := streamLogs.Run(slotCtx); err != nil {
+				log.Error(slotCtx, "Failed stream log", "err", err)
+			}
+		}()
+		ex := executor.NewSlot(b, slot, i, len(config.Slots))
+		ex.SetStreamLogs(streamLogs)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := ex.Init(ctxSig, configDir); err != nil {
+				log.Error(slotCtx, "Failed to init executor", "err", err)
+				return
+			}
+			initMu.Lock()
+			initialized = append(initialized, ex)
+			initMu.Unlock()
+			if err := ex.Run(ctxSig); err != nil {
+				log.Error(slotCtx, "dstack-runner slot ended with an error: ", "err", err)
+			}
+			select {
+			case <-streamLogs.Done:
+				log.Trace(slotCtx, "Done streaming logs")
+			case <-time.After(time.Second * 30):
+				log.Trace(slotCtx, "Timed out streaming logs")
+			}
+		}()
+	}
+	wg.Wait()
+	if len(initialized) > 0 {
+		initialized[0].Shutdown(context.Background())
+	}
+}
+
+// pickStreamPort returns a vacant port for logs streaming, not in taken, or 0 if there is none
+func pickStreamPort(taken map[int]bool) int {
+	for port := 10999; port >= 10000; port-- {
+		if taken[port] {
+			continue
+		}
+		if vacant, _ := ports.CheckPort(port); vacant {
+			return port
+		}
+	}
+	return 0
+}
+
 func check(configDir string) error {
 	ctx := context.Background()
 	config := new(executor.Config)